@@ -15,7 +15,6 @@ import (
 	"os"
 
 	"github.com/spdx/tools-golang/v0/idsearcher"
-
 	"github.com/spdx/tools-golang/v0/tvsaver"
 )
 
@@ -109,11 +108,18 @@ func main() {
 	// these are the same arguments needed for builder, and in fact they get
 	// passed through to builder (with the relevant data from the config
 	// object extracted behind the scenes).
-	doc, err := idsearcher.BuildIDsDocument(packageName, packageRootDir, config)
+	// errors from searching individual files, including invalid license
+	// expressions, do not stop the search. BuildIDsDocument leaves them
+	// out; BuildIDsDocumentWithErrors also returns them, so that they can
+	// be shown as warnings.
+	doc, fileErrs, err := idsearcher.BuildIDsDocumentWithErrors(packageName, packageRootDir, config)
 	if err != nil {
 		fmt.Printf("Error while building document: %v\n", err)
 		return
 	}
+	for _, fileErr := range fileErrs {
+		fmt.Printf("Warning: could not fully search %v\n", fileErr)
+	}
 
 	// if we got here, the document has been created.
 	// all file hashes and the package verification code have been filled in
@@ -124,9 +130,10 @@ func main() {
 	// also be filled in with all license identifiers.
 	fmt.Printf("Successfully created document and searched for IDs for package %s\n", packageName)
 
-	// NOTE that BuildIDsDocument does NOT do any validation of the license
-	// identifiers, to confirm that they are e.g. on the SPDX License List
-	// or in other appropriate format (e.g., LicenseRef-...)
+	// NOTE that BuildIDsDocument parses each identifier as an SPDX license
+	// expression. Invalid expressions are left out, and are reported among
+	// the warnings above. Set ReportUnknownLicenses in the config to also
+	// report identifiers that are not on the SPDX License List.
 
 	// we can now save it to disk, using tvsaver.
 
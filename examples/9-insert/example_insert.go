@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+// Example for: *idinserter*, *tvloader*
+
+// This example demonstrates loading an SPDX tag-value file from disk into
+// memory, and using the concluded licenses of its Files to add or update
+// SPDX short-form ID headers in the files of a directory. With -n, the
+// changes are only printed as a diff, and the files are left unchanged.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spdx/tools-golang/v0/idinserter"
+	"github.com/spdx/tools-golang/v0/tvloader"
+)
+
+func main() {
+
+	// check that we've received the right number of arguments
+	args := os.Args
+	dryRun := len(args) == 4 && args[1] == "-n"
+	if dryRun {
+		args = append(args[:1], args[2:]...)
+	}
+	if len(args) != 3 {
+		fmt.Printf("Usage: %v [-n] <spdx-file-in> <package-root-dir>\n", args[0])
+		fmt.Printf("  Load SPDX 2.1 tag-value file <spdx-file-in>, and write the concluded\n")
+		fmt.Printf("  license of each of its files as an SPDX short-form ID in the header of\n")
+		fmt.Printf("  that file in <package-root-dir>. With -n, print the changes as a diff\n")
+		fmt.Printf("  instead of making them.\n")
+		return
+	}
+
+	// open the SPDX file
+	fileIn := args[1]
+	packageRootDir := args[2]
+	r, err := os.Open(fileIn)
+	if err != nil {
+		fmt.Printf("Error while opening %v for reading: %v", fileIn, err)
+		return
+	}
+	defer r.Close()
+
+	// try to load the SPDX file's contents as a tag-value file, version 2.1
+	doc, err := tvloader.Load2_1(r)
+	if err != nil {
+		fmt.Printf("Error while parsing %v: %v", fileIn, err)
+		return
+	}
+
+	// get the header for each file from the document. passing true would
+	// also write each file's copyright text as SPDX-FileCopyrightText lines.
+	headers := idinserter.HeadersFromDocument(doc, false)
+
+	// and update the files. the comment syntax for each file is chosen
+	// from its name; files in languages that idinserter does not know are
+	// skipped, unless their syntax is added to Config.Styles.
+	result, err := idinserter.UpdateHeaders(packageRootDir, headers, &idinserter.Config{DryRun: dryRun})
+	if err != nil {
+		fmt.Printf("Error while updating headers: %v\n", err)
+		return
+	}
+
+	for _, change := range result.Changes {
+		if dryRun {
+			fmt.Print(change.Diff)
+		} else {
+			fmt.Printf("Updated %v\n", change.FileName)
+		}
+	}
+	for _, fileName := range result.Unsupported {
+		fmt.Printf("Skipped %v: unknown comment syntax\n", fileName)
+	}
+}
@@ -5,8 +5,16 @@
 package builder
 
 import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
 	"github.com/spdx/tools-golang/v0/builder/builder2v1"
+	"github.com/spdx/tools-golang/v0/gitfs"
 	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
 )
 
 // Config2_1 is a collection of configuration settings for builder
@@ -33,6 +41,104 @@ type Config2_1 struct {
 	// directory, regardless of where it is in the file tree.
 	PathsIgnored []string
 
+	// IgnoreFileNames lists the names of gitignore-format files, such as
+	// ".gitignore" or ".spdxignore". Files with these names are read from
+	// each directory during the walk, and the paths they exclude are
+	// omitted from the built document, with the same semantics as git
+	// (including "!", "*", "**" and anchored patterns). They are not used
+	// when building from an archive.
+	IgnoreFileNames []string
+
+	// SymlinkPolicy determines how symbolic links are handled: skipped
+	// (utils.SymlinkSkip, the default), followed with cycle detection
+	// (utils.SymlinkFollow), or recorded as files of their own
+	// (utils.SymlinkRecord). A recorded link gets a File whose comment
+	// names its target, and an "OTHER" Relationship to the target's File
+	// if the target is a file within the tree. It is not used when
+	// building from an archive.
+	SymlinkPolicy utils.SymlinkPolicy
+
+	// NumWorkers sets how many files will be hashed concurrently while
+	// building the Package section. Values of 0 or 1 hash the files one at
+	// a time. The resulting Document is the same either way.
+	NumWorkers int
+
+	// HashCachePath, if not empty, is the path to a local file used to
+	// cache file hashes and types between builds. Files whose relative
+	// path, size, modification time and inode are unchanged since the
+	// previous build are not read again; the resulting Document is the
+	// same as for a build without the cache, as long as FileClassifier is
+	// not changed between builds. The file is created if it does not exist
+	// yet, and is rewritten after each successful build. Use a separate
+	// cache file for each directory being analyzed. Files without a
+	// modification time, as in an embed.FS or fstest.MapFS, are never
+	// cached.
+	HashCachePath string
+
+	// Decompressors maps a compression format name ("gzip", "bzip2", "xz"
+	// or "zstd") to a function returning a reader for the decompressed
+	// data, for use by BuildFromArchive2_1 and BuildFromImage2_1. gzip,
+	// bzip2 and xz are supported without it. zstd is not supported out of
+	// the box, so zstd-compressed archives and image layers need an entry
+	// here. An entry for a supported format replaces the built-in decoder.
+	Decompressors map[string]func(io.Reader) (io.Reader, error)
+
+	// GoModules, if true, adds a Package for each module dependency of the
+	// Go module whose go.mod file is at the root of the analyzed directory,
+	// with a "DEPENDS_ON" Relationship to it from the main Package. The
+	// dependencies are read from go.mod, go.sum and vendor/modules.txt;
+	// nothing is downloaded. It has no effect if there is no go.mod file,
+	// and is not used when building from an archive.
+	GoModules bool
+
+	// NPMPackages, if true, adds a Package for each npm package installed
+	// for the project whose package.json is at the root of the analyzed
+	// directory, with a "DEPENDS_ON" Relationship to it from the main
+	// Package. The packages are read from package-lock.json or yarn.lock,
+	// and their declared licenses from the lockfile or node_modules. It
+	// has no effect if there is no lockfile, and is not used when building
+	// from an archive.
+	NPMPackages bool
+
+	// PythonPackages, if true, adds a Package for each Python package
+	// listed in Pipfile.lock, poetry.lock or requirements*.txt at the root
+	// of the analyzed directory, or installed in a *.dist-info directory
+	// within it, with a "DEPENDS_ON" Relationship to it from the main
+	// Package. It is not used when building from an archive.
+	PythonPackages bool
+
+	// MavenPackages, if true, adds a Package for each Maven artifact that
+	// the project depends on, according to pom.xml (and the modules and
+	// parent POMs it refers to) or gradle.lockfile at the root of the
+	// analyzed directory, with a "DEPENDS_ON" Relationship to it from the
+	// main Package whose comment gives the dependency's scope. Dependency
+	// licenses are read from POMs in a local repository at .m2/repository,
+	// if there is one. It is not used when building from an archive.
+	MavenPackages bool
+
+	// OSPackages, if true, treats the analyzed directory as a root
+	// filesystem, such as an extracted container image, and adds a Package
+	// for each operating system package installed in it according to the
+	// dpkg status file, the apk installed database or the rpm SQLite
+	// database. The main Package gets a "CONTAINS" Relationship to each of
+	// them, and each of them gets a "CONTAINS" Relationship to the Files it
+	// owns. It is not used when building from an archive.
+	OSPackages bool
+
+	// SubPackageRules, if non-empty, splits the analyzed directory into
+	// several Packages: each directory matching one of the rules, such as
+	// a vendored copy of another project, gets a Package of its own for
+	// the Files within it, with a "CONTAINS" Relationship to it from the
+	// main Package. builder2v1.DefaultSubPackageRules covers node_modules,
+	// third_party and vendor directories. It is not used when building
+	// from an archive or a container image.
+	SubPackageRules []builder2v1.SubPackageRule
+
+	// FileClassifier assigns each File its SPDX file type, such as SOURCE
+	// or BINARY, and can be used to add mappings of file names and
+	// contents to types. If nil, only the built-in rules are used.
+	FileClassifier *builder2v1.FileClassifier
+
 	// TestValues is used to pass fixed values for testing purposes
 	// only, and should be set to nil for production use. It is only
 	// exported so that it will be accessible within builder2v1.
@@ -45,13 +151,244 @@ type Config2_1 struct {
 //   - dirRoot: path to directory to be analyzed
 //   - config: Config object
 func Build2_1(packageName string, dirRoot string, config *Config2_1) (*spdx.Document2_1, error) {
+	return BuildFromFS2_1(packageName, utils.DirFS(dirRoot), config)
+}
+
+// BuildFromFS2_1 creates an SPDX Document (version 2.1) for the files in
+// a file system, such as an embed.FS, an fstest.MapFS or a zip.Reader,
+// returning that document or error if any is encountered. File names are
+// relative to the root of fsys. Arguments:
+//   - packageName: name of package
+//   - fsys: file system to be analyzed
+//   - config: Config object
+func BuildFromFS2_1(packageName string, fsys fs.FS, config *Config2_1) (*spdx.Document2_1, error) {
 	// build Package section first -- will include Files and make the
 	// package verification code available
-	pkg, err := builder2v1.BuildPackageSection2_1(packageName, dirRoot, config.PathsIgnored)
+	opts := &builder2v1.PackageOptions2_1{
+		PathsIgnored:    config.PathsIgnored,
+		IgnoreFileNames: config.IgnoreFileNames,
+		SymlinkPolicy:   config.SymlinkPolicy,
+		NumWorkers:      config.NumWorkers,
+		FileClassifier:  config.FileClassifier,
+	}
+	if config.HashCachePath != "" {
+		cache, err := utils.LoadHashCache(config.HashCachePath)
+		if err != nil {
+			return nil, err
+		}
+		opts.HashCache = cache
+	}
+	pkg, err := builder2v1.BuildPackageSectionFromFS2_1(packageName, fsys, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.HashCache != nil {
+		if err = opts.HashCache.Save(config.HashCachePath); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := buildDocument2_1(packageName, pkg, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.SymlinkPolicy == utils.SymlinkRecord {
+		rlns, err := builder2v1.BuildSymlinkRelationships2_1(fsys, pkg.Files)
+		if err != nil {
+			return nil, err
+		}
+		doc.Relationships = append(doc.Relationships, rlns...)
+	}
+
+	for _, buildDeps := range dependencyBuilders2_1(config) {
+		pkgs, rlns, err := buildDeps(fsys, pkg)
+		if err != nil {
+			return nil, err
+		}
+		doc.Packages = append(doc.Packages, pkgs...)
+		doc.Relationships = append(doc.Relationships, rlns...)
+	}
+
+	// split off sub-packages last, so that the document namespace and the
+	// dependency builders see every file in the tree
+	if len(config.SubPackageRules) > 0 {
+		pkgs, rlns, err := builder2v1.BuildSubPackages2_1(fsys, pkg, config.SubPackageRules)
+		if err != nil {
+			return nil, err
+		}
+		doc.Packages = append(doc.Packages, pkgs...)
+		doc.Relationships = append(doc.Relationships, rlns...)
+	}
+
+	return doc, nil
+}
+
+// dependencyBuilders2_1 returns the functions that config enables for
+// adding a Package for each dependency found in package manager metadata.
+func dependencyBuilders2_1(config *Config2_1) []func(fs.FS, *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	builders := []func(fs.FS, *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error){}
+	if config.GoModules {
+		builders = append(builders, builder2v1.BuildGoModulePackages2_1)
+	}
+	if config.NPMPackages {
+		builders = append(builders, builder2v1.BuildNPMPackages2_1)
+	}
+	if config.PythonPackages {
+		builders = append(builders, builder2v1.BuildPythonPackages2_1)
+	}
+	if config.MavenPackages {
+		builders = append(builders, builder2v1.BuildMavenPackages2_1)
+	}
+	if config.OSPackages {
+		builders = append(builders, builder2v1.BuildOSPackages2_1)
+	}
+	return builders
+}
+
+// BuildFromGitCommit2_1 creates an SPDX Document (version 2.1) for the
+// files in a commit of a local git repository, returning that document or
+// error if any is encountered. The files are read from the repository's
+// object store, so uncommitted changes in the working tree are not
+// included, and no checkout is needed. The package's source info records
+// the full commit ID. config.HashCachePath is ignored, since a commit's
+// files have no modification times to validate cached hashes against.
+// Arguments:
+//   - packageName: name of package
+//   - repoPath: path to the repository's working tree or .git directory
+//   - commitish: commit to be analyzed, e.g. "HEAD", a tag or a commit ID
+//   - config: Config object
+func BuildFromGitCommit2_1(packageName string, repoPath string, commitish string, config *Config2_1) (*spdx.Document2_1, error) {
+	repo, err := gitfs.OpenRepository(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+	fsys, commitID, err := repo.CommitFS(commitish)
 	if err != nil {
 		return nil, err
 	}
 
+	cfg := *config
+	cfg.HashCachePath = ""
+	doc, err := BuildFromFS2_1(packageName, fsys, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Packages[0].PackageSourceInfo = fmt.Sprintf("built from git commit %s", commitID)
+	return doc, nil
+}
+
+// BuildFromArchive2_1 creates an SPDX Document (version 2.1) for the files
+// contained in a tar or zip archive, returning that document or error if
+// any is encountered. The archive is read as a stream and is not extracted
+// to disk. File names are relative to the archive root, and the package's
+// file name and checksums are filled in from the archive itself. Arguments:
+//   - packageName: name of package
+//   - archiveName: file name of the archive, used for PackageFileName
+//   - r: reader for the archive's contents
+//   - config: Config object
+func BuildFromArchive2_1(packageName string, archiveName string, r io.Reader, config *Config2_1) (*spdx.Document2_1, error) {
+	pkg, err := builder2v1.BuildPackageSectionFromArchive2_1(packageName, archiveName, r, archiveOptions(config))
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDocument2_1(packageName, pkg, config)
+}
+
+// archiveOptions returns the settings from config that apply to building
+// a Package from an archive.
+func archiveOptions(config *Config2_1) *builder2v1.PackageOptions2_1 {
+	return &builder2v1.PackageOptions2_1{
+		PathsIgnored:   config.PathsIgnored,
+		Decompressors:  config.Decompressors,
+		FileClassifier: config.FileClassifier,
+	}
+}
+
+// BuildFromArchiveFile2_1 creates an SPDX Document (version 2.1) for the
+// files contained in the tar or zip archive at archivePath, in the same
+// manner as BuildFromArchive2_1. A zip archive's entries are read directly
+// from the file, rather than copying it to a temporary file. Arguments:
+//   - packageName: name of package
+//   - archivePath: path to archive file to be analyzed
+//   - config: Config object
+func BuildFromArchiveFile2_1(packageName string, archivePath string, config *Config2_1) (*spdx.Document2_1, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := builder2v1.BuildPackageSectionFromArchiveReaderAt2_1(packageName, filepath.Base(archivePath), f, fi.Size(), archiveOptions(config))
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDocument2_1(packageName, pkg, config)
+}
+
+// BuildFromImage2_1 creates an SPDX Document (version 2.1) for a container
+// image, returning that document or error if any is encountered. The image
+// may be an OCI image layout directory or an uncompressed "docker save"
+// archive; it is read in place, and nothing is pulled from a registry. The
+// document has a Package for the image, whose Files are those of the
+// image's final filesystem once its layers' whiteouts have been applied,
+// and a Package for each layer, named by its digest. Each File's comment
+// names the layer it came from, and that layer "CONTAINS" it. Arguments:
+//   - packageName: name of package
+//   - imagePath: path to the image layout directory or archive
+//   - ref: the image to use if there is more than one, given as a tag or
+//     image name, a manifest or config digest, or a platform such as
+//     "linux/arm64"; "" if there is only one image
+//   - config: Config object
+func BuildFromImage2_1(packageName string, imagePath string, ref string, config *Config2_1) (*spdx.Document2_1, error) {
+	fi, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	var fsys fs.FS
+	if fi.IsDir() {
+		fsys = utils.DirFS(imagePath)
+	} else {
+		f, err := os.Open(imagePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if fsys, err = utils.NewTarFS(f, fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &builder2v1.PackageOptions2_1{
+		PathsIgnored:   config.PathsIgnored,
+		Decompressors:  config.Decompressors,
+		FileClassifier: config.FileClassifier,
+	}
+	pkgs, rlns, err := builder2v1.BuildImagePackages2_1(packageName, filepath.Base(imagePath), fsys, ref, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := buildDocument2_1(packageName, pkgs[0], config)
+	if err != nil {
+		return nil, err
+	}
+	doc.Packages = append(doc.Packages, pkgs[1:]...)
+	doc.Relationships = append(doc.Relationships, rlns...)
+	return doc, nil
+}
+
+// buildDocument2_1 fills in the Creation Info and Relationship sections for
+// an already-built Package, and returns the resulting Document.
+func buildDocument2_1(packageName string, pkg *spdx.Package2_1, config *Config2_1) (*spdx.Document2_1, error) {
 	ci, err := builder2v1.BuildCreationInfoSection2_1(packageName, pkg.PackageVerificationCode, config.NamespacePrefix, config.CreatorType, config.Creator, config.TestValues)
 	if err != nil {
 		return nil, err
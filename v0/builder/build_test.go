@@ -3,8 +3,20 @@
 package builder
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/builder/builder2v1"
+	"github.com/spdx/tools-golang/v0/utils"
 )
 
 // ===== Builder top-level Document test =====
@@ -355,3 +367,598 @@ func TestBuild2_1CanIgnoreFiles(t *testing.T) {
 		t.Errorf("expected %v, got %v", want, got)
 	}
 }
+
+func TestBuild2_1CreatesSameDocumentWithWorkers(t *testing.T) {
+	dirRoot := "../../testdata/project1/"
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	serialDoc, err := Build2_1("project1", dirRoot, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	config.NumWorkers = 4
+	parallelDoc, err := Build2_1("project1", dirRoot, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if !reflect.DeepEqual(serialDoc, parallelDoc) {
+		t.Errorf("expected parallel build to match serial build")
+	}
+}
+
+func TestBuild2_1CreatesSameDocumentWithHashCache(t *testing.T) {
+	dirRoot := "../../testdata/project1/"
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	coldDoc, err := Build2_1("project1", dirRoot, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	config.HashCachePath = filepath.Join(t.TempDir(), "hashcache.json")
+	for i := 0; i < 2; i++ {
+		cachedDoc, err := Build2_1("project1", dirRoot, config)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if !reflect.DeepEqual(coldDoc, cachedDoc) {
+			t.Errorf("expected build %d with cache to match build without cache", i)
+		}
+	}
+
+	if _, err := os.Stat(config.HashCachePath); err != nil {
+		t.Errorf("expected hash cache file to be written, got %v", err)
+	}
+}
+
+func TestBuild2_1CanBuildFromArchiveFile(t *testing.T) {
+	// write a small tar.gz of testdata/project3/keep to a temporary file
+	archivePath := filepath.Join(t.TempDir(), "keep-1.0.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("couldn't create archive: %v", err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	b, err := os.ReadFile("../../testdata/project3/keep/keep.txt")
+	if err != nil {
+		t.Fatalf("couldn't read test file: %v", err)
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: "keep-1.0/keep.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(b))}); err != nil {
+		t.Fatalf("couldn't write tar header: %v", err)
+	}
+	if _, err = tw.Write(b); err != nil {
+		t.Fatalf("couldn't write tar contents: %v", err)
+	}
+	tw.Close()
+	gw.Close()
+	f.Close()
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromArchiveFile2_1("keep", archivePath, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if doc == nil {
+		t.Fatalf("expected non-nil Document, got nil")
+	}
+	if doc.CreationInfo == nil {
+		t.Fatalf("expected non-nil CreationInfo section, got nil")
+	}
+	if len(doc.Packages) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(doc.Packages))
+	}
+	pkg := doc.Packages[0]
+	if pkg.PackageFileName != "keep-1.0.tar.gz" {
+		t.Errorf("expected %v, got %v", "keep-1.0.tar.gz", pkg.PackageFileName)
+	}
+	if pkg.PackageChecksumSHA1 == "" {
+		t.Errorf("expected non-empty PackageChecksumSHA1")
+	}
+	if len(pkg.Files) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(pkg.Files))
+	}
+	if pkg.Files[0].FileName != "/keep-1.0/keep.txt" {
+		t.Errorf("expected %v, got %v", "/keep-1.0/keep.txt", pkg.Files[0].FileName)
+	}
+	if len(doc.Relationships) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(doc.Relationships))
+	}
+	if doc.Relationships[0].RefB != "SPDXRef-Package-keep" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Package-keep", doc.Relationships[0].RefB)
+	}
+}
+
+func TestBuild2_1BuildFromArchiveFileFailsForInvalidPath(t *testing.T) {
+	config := &Config2_1{}
+
+	_, err := BuildFromArchiveFile2_1("nope", "./does/not/exist.tar", config)
+	if err == nil {
+		t.Fatalf("expected non-nil error, got nil")
+	}
+}
+
+func TestBuild2_1CanBuildFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("goodbye")},
+		"b/c.txt":   {Data: []byte{}},
+		"b/skip.me": {Data: []byte("skip")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		PathsIgnored:    []string{"**/skip.me"},
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("inmemory", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if doc.CreationInfo == nil {
+		t.Fatalf("expected non-nil CreationInfo section, got nil")
+	}
+	if doc.CreationInfo.DocumentName != "inmemory" {
+		t.Errorf("expected %s, got %s", "inmemory", doc.CreationInfo.DocumentName)
+	}
+	if len(doc.Packages) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(doc.Packages))
+	}
+	pkg := doc.Packages[0]
+	if len(pkg.Files) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkg.Files))
+	}
+	if pkg.Files[0].FileName != "/a.txt" {
+		t.Errorf("expected %v, got %v", "/a.txt", pkg.Files[0].FileName)
+	}
+	if pkg.Files[1].FileName != "/b/c.txt" {
+		t.Errorf("expected %v, got %v", "/b/c.txt", pkg.Files[1].FileName)
+	}
+	if len(doc.Relationships) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(doc.Relationships))
+	}
+}
+
+func TestBuild2_1CanRecordSymlinks(t *testing.T) {
+	dirRoot := "../../testdata/project1/"
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		SymlinkPolicy:   utils.SymlinkRecord,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := Build2_1("project1", dirRoot, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(doc.Packages))
+	}
+	if len(doc.Packages[0].Files) != 6 {
+		t.Fatalf("expected %d, got %d", 6, len(doc.Packages[0].Files))
+	}
+	if len(doc.Relationships) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Relationships))
+	}
+	if doc.Relationships[0].Relationship != "DESCRIBES" {
+		t.Errorf("expected %v, got %v", "DESCRIBES", doc.Relationships[0].Relationship)
+	}
+	rln := doc.Relationships[1]
+	if rln.RefA != "SPDXRef-File5" {
+		t.Errorf("expected %v, got %v", "SPDXRef-File5", rln.RefA)
+	}
+	if rln.RefB != "SPDXRef-File2" {
+		t.Errorf("expected %v, got %v", "SPDXRef-File2", rln.RefB)
+	}
+}
+
+func TestBuild2_1CanBuildFromGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dirRoot := "../../testdata/project1/"
+
+	repoDir := t.TempDir()
+	if out, err := exec.Command("cp", "-a", dirRoot+".", repoDir).CombinedOutput(); err != nil {
+		t.Fatalf("cp: %v\n%s", err, out)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	// uncommitted changes must not be included
+	if err := os.WriteFile(filepath.Join(repoDir, "uncommitted.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		HashCachePath:   filepath.Join(t.TempDir(), "hashes.json"),
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	gitDoc, err := BuildFromGitCommit2_1("project1", repoDir, "HEAD", config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, err := os.Stat(config.HashCachePath); !os.IsNotExist(err) {
+		t.Errorf("expected hash cache not to be written, got %v", err)
+	}
+
+	config.HashCachePath = ""
+	dirDoc, err := Build2_1("project1", dirRoot, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	gitPkg := gitDoc.Packages[0]
+	dirPkg := dirDoc.Packages[0]
+	if !reflect.DeepEqual(gitPkg.Files, dirPkg.Files) {
+		t.Errorf("expected files from git commit to match files from directory")
+	}
+	if gitPkg.PackageVerificationCode != dirPkg.PackageVerificationCode {
+		t.Errorf("expected %v, got %v", dirPkg.PackageVerificationCode, gitPkg.PackageVerificationCode)
+	}
+	if !strings.HasPrefix(gitPkg.PackageSourceInfo, "built from git commit ") || len(gitPkg.PackageSourceInfo) != len("built from git commit ")+40 {
+		t.Errorf("expected source info with commit ID, got %v", gitPkg.PackageSourceInfo)
+	}
+}
+
+func TestBuild2_1BuildFromGitCommitFailsForNonRepository(t *testing.T) {
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+	}
+	_, err := BuildFromGitCommit2_1("project1", t.TempDir(), "HEAD", config)
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestBuild2_1CanAddGoModulePackages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":  {Data: []byte("module example.com/m\n\nrequire github.com/a/b v1.0.0\n")},
+		"main.go": {Data: []byte("package main\n")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		GoModules:       true,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("m", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+	}
+	if len(doc.Packages[0].Files) != 2 {
+		t.Errorf("expected %d, got %d", 2, len(doc.Packages[0].Files))
+	}
+	if doc.Packages[1].PackageName != "github.com/a/b" {
+		t.Errorf("expected %v, got %v", "github.com/a/b", doc.Packages[1].PackageName)
+	}
+	if len(doc.Relationships) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Relationships))
+	}
+	rln := doc.Relationships[1]
+	if rln.RefA != "SPDXRef-Package-m" || rln.RefB != doc.Packages[1].PackageSPDXIdentifier || rln.Relationship != "DEPENDS_ON" {
+		t.Errorf("expected DEPENDS_ON relationship, got %+v", rln)
+	}
+
+	// without the option, only the main package is built
+	config.GoModules = false
+	doc, err = BuildFromFS2_1("m", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 1 {
+		t.Errorf("expected %d, got %d", 1, len(doc.Packages))
+	}
+}
+
+func TestBuild2_1CanAddNPMPackages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json":      {Data: []byte(`{"name": "app", "version": "1.0.0", "dependencies": {"a": "^1.0.0"}}`)},
+		"package-lock.json": {Data: []byte(`{"lockfileVersion": 3, "packages": {"node_modules/a": {"version": "1.0.1", "license": "MIT"}}}`)},
+		"index.js":          {Data: []byte("module.exports = 1\n")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		NPMPackages:     true,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("app", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+	}
+	if doc.Packages[0].PackageVersion != "1.0.0" {
+		t.Errorf("expected %v, got %v", "1.0.0", doc.Packages[0].PackageVersion)
+	}
+	if doc.Packages[1].PackageName != "a" || doc.Packages[1].PackageLicenseDeclared != "MIT" {
+		t.Errorf("expected a with MIT, got %v with %v", doc.Packages[1].PackageName, doc.Packages[1].PackageLicenseDeclared)
+	}
+	if len(doc.Relationships) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Relationships))
+	}
+	if doc.Relationships[1].Relationship != "DEPENDS_ON" {
+		t.Errorf("expected %v, got %v", "DEPENDS_ON", doc.Relationships[1].Relationship)
+	}
+}
+
+func TestBuild2_1CanAddPythonPackages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"requirements.txt": {Data: []byte("requests==2.31.0\n")},
+		"main.py":          {Data: []byte("import requests\n")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		PythonPackages:  true,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("app", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+	}
+	if doc.Packages[1].PackageName != "requests" || doc.Packages[1].PackageVersion != "2.31.0" {
+		t.Errorf("expected requests 2.31.0, got %v %v", doc.Packages[1].PackageName, doc.Packages[1].PackageVersion)
+	}
+	if len(doc.Relationships) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Relationships))
+	}
+	if doc.Relationships[1].Relationship != "DEPENDS_ON" {
+		t.Errorf("expected %v, got %v", "DEPENDS_ON", doc.Relationships[1].Relationship)
+	}
+}
+
+func TestBuild2_1CanAddMavenPackages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pom.xml": {Data: []byte(`<project>
+  <groupId>com.example</groupId><artifactId>app</artifactId><version>1.0</version>
+  <licenses><license><name>MIT License</name></license></licenses>
+  <dependencies>
+    <dependency><groupId>junit</groupId><artifactId>junit</artifactId><version>4.13.2</version><scope>test</scope></dependency>
+  </dependencies>
+</project>`)},
+		"src/main/java/App.java": {Data: []byte("class App {}\n")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		MavenPackages:   true,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("app", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+	}
+	if doc.Packages[0].PackageLicenseDeclared != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", doc.Packages[0].PackageLicenseDeclared)
+	}
+	if doc.Packages[1].PackageName != "junit:junit" {
+		t.Errorf("expected %v, got %v", "junit:junit", doc.Packages[1].PackageName)
+	}
+	if len(doc.Relationships) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Relationships))
+	}
+	if doc.Relationships[1].Relationship != "DEPENDS_ON" || doc.Relationships[1].RelationshipComment != "test scope" {
+		t.Errorf("expected DEPENDS_ON with test scope, got %+v", doc.Relationships[1])
+	}
+}
+
+func TestBuild2_1CanAddOSPackages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/apk/db/installed":    {Data: []byte("P:musl\nV:1.2.4-r2\nA:x86_64\nL:MIT\nF:lib\nR:ld-musl-x86_64.so.1\n")},
+		"lib/ld-musl-x86_64.so.1": {Data: []byte("ELF")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		OSPackages:      true,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("rootfs", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+	}
+	if doc.Packages[1].PackageName != "musl" {
+		t.Errorf("expected %v, got %v", "musl", doc.Packages[1].PackageName)
+	}
+
+	// DESCRIBES, root CONTAINS musl, musl CONTAINS the loader
+	if len(doc.Relationships) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(doc.Relationships))
+	}
+	var loaderID string
+	for _, f := range doc.Packages[0].Files {
+		if f.FileName == "/lib/ld-musl-x86_64.so.1" {
+			loaderID = f.FileSPDXIdentifier
+		}
+	}
+	rln := doc.Relationships[2]
+	if rln.RefA != doc.Packages[1].PackageSPDXIdentifier || rln.Relationship != "CONTAINS" || rln.RefB != loaderID {
+		t.Errorf("expected %v CONTAINS %v, got %+v", doc.Packages[1].PackageSPDXIdentifier, loaderID, rln)
+	}
+}
+
+func TestBuild2_1CanBuildFromImage(t *testing.T) {
+	// a single-layer image in the layout written by "docker save"
+	layer := &bytes.Buffer{}
+	lw := tar.NewWriter(layer)
+	lw.WriteHeader(&tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+	lw.Write([]byte("host\n"))
+	lw.Close()
+	image := map[string][]byte{
+		"manifest.json":    []byte(`[{"Config":"config.json","RepoTags":["app:1.0"],"Layers":["layer1/layer.tar"]}]`),
+		"config.json":      []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`),
+		"layer1/layer.tar": layer.Bytes(),
+	}
+
+	// save it both as a directory and as an archive
+	imageDir := t.TempDir()
+	archivePath := filepath.Join(t.TempDir(), "app.tar")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("couldn't create archive: %v", err)
+	}
+	tw := tar.NewWriter(f)
+	for _, name := range []string{"manifest.json", "config.json", "layer1/layer.tar"} {
+		if err = os.MkdirAll(filepath.Join(imageDir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatalf("couldn't create directory: %v", err)
+		}
+		if err = os.WriteFile(filepath.Join(imageDir, name), image[name], 0644); err != nil {
+			t.Fatalf("couldn't write file: %v", err)
+		}
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(image[name]))})
+		tw.Write(image[name])
+	}
+	tw.Close()
+	f.Close()
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	for _, imagePath := range []string{imageDir, archivePath} {
+		doc, err := BuildFromImage2_1("app", imagePath, "", config)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if len(doc.Packages) != 2 {
+			t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+		}
+		if doc.Packages[0].PackageVersion != "1.0" {
+			t.Errorf("expected %v, got %v", "1.0", doc.Packages[0].PackageVersion)
+		}
+		if len(doc.Packages[0].Files) != 1 || doc.Packages[0].Files[0].FileName != "/etc/hostname" {
+			t.Errorf("expected /etc/hostname only, got %+v", doc.Packages[0].Files)
+		}
+		// DESCRIBES, image CONTAINS layer, layer CONTAINS file
+		if len(doc.Relationships) != 3 {
+			t.Errorf("expected %d, got %d", 3, len(doc.Relationships))
+		}
+	}
+}
+
+func TestBuild2_1CanSplitSubPackages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":                            {Data: []byte("package main\n")},
+		"node_modules/left-pad/package.json": {Data: []byte(`{"name":"left-pad","version":"1.3.0","license":"WTFPL"}`)},
+		"node_modules/left-pad/index.js":     {Data: []byte("module.exports = leftPad\n")},
+	}
+
+	config := &Config2_1{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		CreatorType:     "Person",
+		Creator:         "John Doe",
+		SubPackageRules: builder2v1.DefaultSubPackageRules,
+		TestValues:      make(map[string]string),
+	}
+	config.TestValues["Created"] = "2018-10-19T04:38:00Z"
+
+	doc, err := BuildFromFS2_1("app", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Packages))
+	}
+	if len(doc.Packages[0].Files) != 1 || len(doc.Packages[1].Files) != 2 {
+		t.Errorf("expected 1 and 2 files, got %d and %d", len(doc.Packages[0].Files), len(doc.Packages[1].Files))
+	}
+	if doc.Packages[1].PackageName != "left-pad" || doc.Packages[1].PackageLicenseDeclared != "WTFPL" {
+		t.Errorf("expected left-pad with WTFPL, got %v with %v", doc.Packages[1].PackageName, doc.Packages[1].PackageLicenseDeclared)
+	}
+	if len(doc.Relationships) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(doc.Relationships))
+	}
+	rln := doc.Relationships[1]
+	if rln.RefA != "SPDXRef-Package-app" || rln.Relationship != "CONTAINS" || rln.RefB != doc.Packages[1].PackageSPDXIdentifier {
+		t.Errorf("expected SPDXRef-Package-app CONTAINS %v, got %+v", doc.Packages[1].PackageSPDXIdentifier, rln)
+	}
+}
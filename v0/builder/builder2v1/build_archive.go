@@ -0,0 +1,295 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// fileHashes is the SHA1, SHA256 and MD5 hashes for a single file, along
+// with its SPDX file type.
+type fileHashes struct {
+	sha1     string
+	sha256   string
+	md5      string
+	fileType string
+}
+
+// BuildPackageSectionFromArchive2_1 creates an SPDX Package (version 2.1)
+// for the files contained in a tar or zip archive, returning that package or
+// error if any is encountered. The archive is read as a stream and is not
+// extracted to disk, though a zip archive is first copied to a temporary
+// file, since its central directory is at the end. Tar archives may be compressed with
+// gzip, bzip2 or xz. zstd is not supported out of the box; such archives
+// can only be read if a decompressor is supplied in opts.Decompressors.
+// Arguments:
+//   - packageName: name of package
+//   - archiveName: file name of the archive, used for PackageFileName
+//   - r: reader for the archive's contents
+//   - opts: optional settings; nil uses the defaults
+func BuildPackageSectionFromArchive2_1(packageName string, archiveName string, r io.Reader, opts *PackageOptions2_1) (*spdx.Package2_1, error) {
+	return buildArchivePackage(packageName, archiveName, r, nil, 0, opts)
+}
+
+// BuildPackageSectionFromArchiveReaderAt2_1 creates an SPDX Package
+// (version 2.1) for the files contained in a tar or zip archive, in the same
+// manner as BuildPackageSectionFromArchive2_1, but reads a zip archive's
+// entries directly from r rather than copying it to a temporary file.
+// Arguments:
+//   - packageName: name of package
+//   - archiveName: file name of the archive, used for PackageFileName
+//   - r: the archive's contents, such as an *os.File
+//   - size: size of the archive in bytes
+//   - opts: optional settings; nil uses the defaults
+func BuildPackageSectionFromArchiveReaderAt2_1(packageName string, archiveName string, r io.ReaderAt, size int64, opts *PackageOptions2_1) (*spdx.Package2_1, error) {
+	return buildArchivePackage(packageName, archiveName, io.NewSectionReader(r, 0, size), r, size, opts)
+}
+
+// buildArchivePackage creates an SPDX Package (version 2.1) for the archive
+// read from r. If ra is non-nil, it is the same archive, of the given size,
+// and is used to read a zip archive's entries.
+func buildArchivePackage(packageName string, archiveName string, r io.Reader, ra io.ReaderAt, size int64, opts *PackageOptions2_1) (*spdx.Package2_1, error) {
+	if opts == nil {
+		opts = &PackageOptions2_1{}
+	}
+
+	// hash the archive itself while its contents are being read
+	hSHA1 := sha1.New()
+	hSHA256 := sha256.New()
+	hMD5 := md5.New()
+	br := bufio.NewReader(io.TeeReader(r, io.MultiWriter(hSHA1, hSHA256, hMD5)))
+
+	hashes, err := getArchiveFileHashes(br, ra, size, archiveName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// read any remaining bytes, such as trailing padding, so that they
+	// are included in the package checksums
+	if _, err = io.Copy(io.Discard, br); err != nil {
+		return nil, err
+	}
+
+	// build the file section in the same order as for a directory, so
+	// that an archive and its extracted tree yield the same files
+	filepaths := []string{}
+	for fp := range hashes {
+		filepaths = append(filepaths, fp)
+	}
+	sort.Strings(filepaths)
+	files := []*spdx.File2_1{}
+	for i, fp := range filepaths {
+		h := hashes[fp]
+		f := newFileSection(fp, i, h.sha1, h.sha256, h.md5)
+		f.FileType = []string{h.fileType}
+		files = append(files, f)
+	}
+
+	// get the verification code
+	code, err := utils.GetVerificationCode2_1(files, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// now build the package section
+	pkg := &spdx.Package2_1{
+		IsUnpackaged:                false,
+		PackageName:                 packageName,
+		PackageSPDXIdentifier:       fmt.Sprintf("SPDXRef-Package-%s", packageName),
+		PackageFileName:             archiveName,
+		PackageDownloadLocation:     "NOASSERTION",
+		FilesAnalyzed:               true,
+		IsFilesAnalyzedTagPresent:   true,
+		PackageVerificationCode:     code,
+		PackageChecksumSHA1:         fmt.Sprintf("%x", hSHA1.Sum(nil)),
+		PackageChecksumSHA256:       fmt.Sprintf("%x", hSHA256.Sum(nil)),
+		PackageChecksumMD5:          fmt.Sprintf("%x", hMD5.Sum(nil)),
+		PackageLicenseConcluded:     "NOASSERTION",
+		PackageLicenseInfoFromFiles: []string{},
+		PackageLicenseDeclared:      "NOASSERTION",
+		PackageCopyrightText:        "NOASSERTION",
+		Files:                       files,
+	}
+
+	return pkg, nil
+}
+
+// getArchiveFileHashes detects the archive's format from its first few
+// bytes, and returns the hashes of each regular file in it, keyed by path
+// relative to the archive root. A zip archive is read from ra, if it is
+// non-nil.
+func getArchiveFileHashes(br *bufio.Reader, ra io.ReaderAt, size int64, archiveName string, opts *PackageOptions2_1) (map[string]fileHashes, error) {
+	// a short read just means a short (and probably invalid) archive;
+	// let the archive readers report on that
+	magic, _ := br.Peek(6)
+
+	if bytes.HasPrefix(magic, []byte("PK\x03\x04")) || bytes.HasPrefix(magic, []byte("PK\x05\x06")) {
+		return getZipFileHashes(br, ra, size, opts)
+	}
+	if format := detectCompression(magic); format != "" {
+		return getCompressedTarFileHashes(br, format, archiveName, opts)
+	}
+	return getTarFileHashes(br, opts)
+}
+
+// detectCompression returns the name of the compression format indicated
+// by the first few bytes of a stream, or "" if they are not recognized.
+func detectCompression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return "bzip2"
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return "xz"
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// decompressReader returns a reader for the decompressed contents of r,
+// using a decompressor from opts if there is one for format.
+func decompressReader(r io.Reader, format string, archiveName string, opts *PackageOptions2_1) (io.Reader, error) {
+	if decompress, ok := opts.Decompressors[format]; ok {
+		return decompress(r)
+	}
+	switch format {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "bzip2":
+		return bzip2.NewReader(r), nil
+	case "xz":
+		return utils.NewXZReader(r)
+	default:
+		return nil, fmt.Errorf("%s-compressed archive %s is not supported without a decompressor in Decompressors", format, archiveName)
+	}
+}
+
+func getCompressedTarFileHashes(r io.Reader, format string, archiveName string, opts *PackageOptions2_1) (map[string]fileHashes, error) {
+	dr, err := decompressReader(r, format, archiveName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := getTarFileHashes(dr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// finish decompressing, so that any trailing checksum in the
+	// compressed stream gets verified
+	if _, err = io.Copy(io.Discard, dr); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+func getTarFileHashes(r io.Reader, opts *PackageOptions2_1) (map[string]fileHashes, error) {
+	hashes := map[string]fileHashes{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// only include regular files, skipping directories and links as
+		// GetAllFilePaths does
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		fp := archivePath(hdr.Name)
+		if fp == "" || (opts.PathsIgnored != nil && utils.ShouldIgnore(fp, opts.PathsIgnored)) {
+			continue
+		}
+
+		h, err := hashAndClassify(tr, fp, opts.FileClassifier)
+		if err != nil {
+			return nil, err
+		}
+		// if a path appears more than once, the last entry wins, as it
+		// would on extraction
+		hashes[fp] = h
+	}
+
+	return hashes, nil
+}
+
+func getZipFileHashes(r io.Reader, ra io.ReaderAt, size int64, opts *PackageOptions2_1) (map[string]fileHashes, error) {
+	// the zip central directory is at the end of the archive, so without
+	// random access it needs to be copied to a temporary file to be read
+	if ra == nil {
+		f, err := os.CreateTemp("", "spdx-archive-*.zip")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if size, err = io.Copy(f, r); err != nil {
+			return nil, err
+		}
+		ra = f
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := map[string]fileHashes{}
+	for _, zf := range zr.File {
+		if !zf.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		fp := archivePath(zf.Name)
+		if fp == "" || (opts.PathsIgnored != nil && utils.ShouldIgnore(fp, opts.PathsIgnored)) {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		h, err := hashAndClassify(rc, fp, opts.FileClassifier)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		hashes[fp] = h
+	}
+
+	return hashes, nil
+}
+
+// archivePath converts the name of an archive entry to a file path relative
+// to the archive root, prefixed with "/" in the same way as paths returned
+// by GetAllFilePaths. It returns an empty string for the root itself.
+func archivePath(name string) string {
+	fp := path.Clean("/" + name)
+	if fp == "/" {
+		return ""
+	}
+	return fp
+}
@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// project1Files lists the regular files in testdata/project1, as they would
+// appear inside an archive of that directory.
+var project1Files = []string{
+	"project1/emptyfile.testdata.txt",
+	"project1/file1.testdata.txt",
+	"project1/file3.testdata.txt",
+	"project1/folder1/file4.testdata.txt",
+	"project1/lastfile.testdata.txt",
+}
+
+func makeProject1Tar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "project1/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatalf("couldn't write tar header: %v", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "project1/symbolic-link", Typeflag: tar.TypeSymlink, Linkname: "file1.testdata.txt"}); err != nil {
+		t.Fatalf("couldn't write tar header: %v", err)
+	}
+	for _, name := range project1Files {
+		b, err := os.ReadFile(filepath.Join("../../../testdata", name))
+		if err != nil {
+			t.Fatalf("couldn't read test file: %v", err)
+		}
+		if err = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(b))}); err != nil {
+			t.Fatalf("couldn't write tar header: %v", err)
+		}
+		if _, err = tw.Write(b); err != nil {
+			t.Fatalf("couldn't write tar contents: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("couldn't close tar writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func makeProject1Zip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create("project1/"); err != nil {
+		t.Fatalf("couldn't create zip directory: %v", err)
+	}
+	for _, name := range project1Files {
+		b, err := os.ReadFile(filepath.Join("../../../testdata", name))
+		if err != nil {
+			t.Fatalf("couldn't read test file: %v", err)
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("couldn't create zip entry: %v", err)
+		}
+		if _, err = w.Write(b); err != nil {
+			t.Fatalf("couldn't write zip contents: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("couldn't close zip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(b); err != nil {
+		t.Fatalf("couldn't write gzip contents: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("couldn't close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func checkProject1ArchivePackage(t *testing.T, pkg *spdx.Package2_1, archiveName string, archive []byte) {
+	wantVerificationCode := "fc9ac4a370af0a471c2e52af66d6b4cf4e2ba12b"
+
+	if pkg == nil {
+		t.Fatalf("expected non-nil Package, got nil")
+	}
+	if pkg.PackageName != "project1" {
+		t.Errorf("expected %v, got %v", "project1", pkg.PackageName)
+	}
+	if pkg.PackageFileName != archiveName {
+		t.Errorf("expected %v, got %v", archiveName, pkg.PackageFileName)
+	}
+	wantSHA1 := fmt.Sprintf("%x", sha1.Sum(archive))
+	if pkg.PackageChecksumSHA1 != wantSHA1 {
+		t.Errorf("expected %v, got %v", wantSHA1, pkg.PackageChecksumSHA1)
+	}
+	if pkg.PackageChecksumSHA256 == "" {
+		t.Errorf("expected non-empty PackageChecksumSHA256")
+	}
+	if pkg.PackageChecksumMD5 == "" {
+		t.Errorf("expected non-empty PackageChecksumMD5")
+	}
+	if pkg.PackageVerificationCode != wantVerificationCode {
+		t.Errorf("expected %v, got %v", wantVerificationCode, pkg.PackageVerificationCode)
+	}
+	if len(pkg.Files) != 5 {
+		t.Fatalf("expected %d, got %d", 5, len(pkg.Files))
+	}
+	if pkg.Files[0].FileName != "/project1/emptyfile.testdata.txt" {
+		t.Errorf("expected %v, got %v", "/project1/emptyfile.testdata.txt", pkg.Files[0].FileName)
+	}
+	if pkg.Files[0].FileSPDXIdentifier != "SPDXRef-File0" {
+		t.Errorf("expected %v, got %v", "SPDXRef-File0", pkg.Files[0].FileSPDXIdentifier)
+	}
+	if pkg.Files[3].FileName != "/project1/folder1/file4.testdata.txt" {
+		t.Errorf("expected %v, got %v", "/project1/folder1/file4.testdata.txt", pkg.Files[3].FileName)
+	}
+	if pkg.Files[1].FileChecksumSHA1 != "024f870eb6323f532515f7a09d5646a97083b819" {
+		t.Errorf("expected %v, got %v", "024f870eb6323f532515f7a09d5646a97083b819", pkg.Files[1].FileChecksumSHA1)
+	}
+}
+
+// ===== Package section from archive builder tests =====
+func TestBuilder2_1CanBuildPackageSectionFromTar(t *testing.T) {
+	archive := makeProject1Tar(t)
+
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar", bytes.NewReader(archive), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkProject1ArchivePackage(t, pkg, "project1.tar", archive)
+}
+
+func TestBuilder2_1CanBuildPackageSectionFromTarGz(t *testing.T) {
+	archive := gzipBytes(t, makeProject1Tar(t))
+
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar.gz", bytes.NewReader(archive), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkProject1ArchivePackage(t, pkg, "project1.tar.gz", archive)
+}
+
+func TestBuilder2_1CanBuildPackageSectionFromZip(t *testing.T) {
+	archive := makeProject1Zip(t)
+
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.zip", bytes.NewReader(archive), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkProject1ArchivePackage(t, pkg, "project1.zip", archive)
+}
+
+func TestBuilder2_1BuildPackageSectionFromZipRemovesTemporaryFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	archive := makeProject1Zip(t)
+
+	if _, err := BuildPackageSectionFromArchive2_1("project1", "project1.zip", bytes.NewReader(archive), nil); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// a truncated zip fails, and its temporary file is removed too
+	if _, err := BuildPackageSectionFromArchive2_1("project1", "project1.zip", bytes.NewReader(archive[:len(archive)-10]), nil); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected %d, got %d", 0, len(entries))
+	}
+}
+
+func TestBuilder2_1CanBuildPackageSectionFromArchiveReaderAt(t *testing.T) {
+	for name, archive := range map[string][]byte{
+		"project1.zip": makeProject1Zip(t),
+		"project1.tar": makeProject1Tar(t),
+	} {
+		pkg, err := BuildPackageSectionFromArchiveReaderAt2_1("project1", name, bytes.NewReader(archive), int64(len(archive)), nil)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %v", name, err)
+		}
+		checkProject1ArchivePackage(t, pkg, name, archive)
+	}
+}
+
+func TestBuilder2_1CanBuildPackageSectionFromTarXzWithDecompressor(t *testing.T) {
+	tarBytes := makeProject1Tar(t)
+	// not a real xz stream; just the magic number, followed by the tar
+	// which the stand-in decompressor below passes through
+	archive := append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, tarBytes...)
+	opts := &PackageOptions2_1{
+		Decompressors: map[string]func(io.Reader) (io.Reader, error){
+			"xz": func(r io.Reader) (io.Reader, error) {
+				if _, err := io.ReadFull(r, make([]byte, 6)); err != nil {
+					return nil, err
+				}
+				return r, nil
+			},
+		},
+	}
+
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar.xz", bytes.NewReader(archive), opts)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkProject1ArchivePackage(t, pkg, "project1.tar.xz", archive)
+}
+
+func TestBuilder2_1CanBuildPackageSectionFromTarXz(t *testing.T) {
+	archive, err := os.ReadFile("../../../testdata/xz/project1.tar.xz")
+	if err != nil {
+		t.Fatalf("couldn't read test file: %v", err)
+	}
+
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar.xz", bytes.NewReader(archive), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkProject1ArchivePackage(t, pkg, "project1.tar.xz", archive)
+}
+
+func TestBuilder2_1BuildPackageSectionFromTarZstFailsWithoutDecompressor(t *testing.T) {
+	archive := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x00, 0x00, 0x00}
+
+	_, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar.zst", bytes.NewReader(archive), nil)
+	if err == nil {
+		t.Fatalf("expected non-nil error, got nil")
+	}
+}
+
+func TestBuilder2_1CanIgnoreFilesInArchive(t *testing.T) {
+	archive := makeProject1Tar(t)
+	opts := &PackageOptions2_1{
+		PathsIgnored: []string{"**/folder1/", "/project1/lastfile.testdata.txt"},
+	}
+
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar", bytes.NewReader(archive), opts)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkg.Files) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(pkg.Files))
+	}
+	if pkg.Files[2].FileName != "/project1/file3.testdata.txt" {
+		t.Errorf("expected %v, got %v", "/project1/file3.testdata.txt", pkg.Files[2].FileName)
+	}
+}
+
+func TestBuilder2_1BuildPackageSectionFromArchiveFailsForInvalidArchive(t *testing.T) {
+	archive := []byte("this is not an archive, but it is long enough to not be a tar EOF either")
+
+	_, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar", bytes.NewReader(archive), nil)
+	if err == nil {
+		t.Fatalf("expected non-nil error, got nil")
+	}
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// newDependencyPackage2_1 creates an SPDX Package (version 2.1) for a
+// dependency that was found in package manager metadata, rather than by
+// analyzing its files. License and copyright fields are NOASSERTION until
+// filled in by the caller. Arguments:
+//   - id: the Package's SPDX identifier
+//   - name: name of package
+//   - version: version of package, or "" if unknown
+//   - purl: package URL, or "" if none should be recorded
+func newDependencyPackage2_1(id string, name string, version string, purl string) *spdx.Package2_1 {
+	pkg := &spdx.Package2_1{
+		PackageName:               name,
+		PackageSPDXIdentifier:     id,
+		PackageVersion:            version,
+		PackageDownloadLocation:   "NOASSERTION",
+		FilesAnalyzed:             false,
+		IsFilesAnalyzedTagPresent: true,
+		PackageLicenseConcluded:   "NOASSERTION",
+		PackageLicenseDeclared:    "NOASSERTION",
+		PackageCopyrightText:      "NOASSERTION",
+	}
+	if purl != "" {
+		pkg.PackageExternalReferences = []*spdx.PackageExternalReference2_1{
+			{
+				Category: "PACKAGE-MANAGER",
+				RefType:  "purl",
+				Locator:  purl,
+			},
+		}
+	}
+	return pkg
+}
+
+// dependsOn creates a "DEPENDS_ON" Relationship from one Package to
+// another, with an optional comment.
+func dependsOn(fromID string, toID string, comment string) *spdx.Relationship2_1 {
+	return &spdx.Relationship2_1{
+		RefA:                fromID,
+		RefB:                toID,
+		Relationship:        "DEPENDS_ON",
+		RelationshipComment: comment,
+	}
+}
+
+// packageIDs hands out SPDX identifiers for dependency Packages, making
+// sure that two Packages whose names differ only in characters that are
+// not allowed in identifiers still get distinct identifiers.
+type packageIDs map[string]bool
+
+// next returns an unused identifier of the form
+// "SPDXRef-Package-<ecosystem>-<name>-<version>".
+func (ids packageIDs) next(ecosystem string, name string, version string) string {
+	base := "SPDXRef-Package-" + ecosystem + "-" + idString(name)
+	if version != "" {
+		base += "-" + idString(version)
+	}
+	return ids.unique(base)
+}
+
+// unique returns base, or base with a numeric suffix if base is already
+// in use, and marks the result as used.
+func (ids packageIDs) unique(base string) string {
+	id := base
+	for n := 2; ids[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	ids[id] = true
+	return id
+}
+
+// idString replaces the characters in s that may not appear in an SPDX
+// identifier with "-".
+func idString(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
+
+// buildPurl returns a package URL (see https://github.com/package-url/purl-spec)
+// of the form "pkg:<type>/<namespace>/<name>@<version>". The namespace may
+// contain several "/"-separated segments, and may be empty, as may the
+// version.
+func buildPurl(purlType string, namespace string, name string, version string) string {
+	var sb strings.Builder
+	sb.WriteString("pkg:" + purlType + "/")
+	if namespace != "" {
+		for _, seg := range strings.Split(namespace, "/") {
+			sb.WriteString(purlEscape(seg) + "/")
+		}
+	}
+	sb.WriteString(purlEscape(name))
+	if version != "" {
+		sb.WriteString("@" + purlEscape(version))
+	}
+	return sb.String()
+}
+
+// withPurlQualifiers appends qualifiers to a package URL. The qualifiers
+// are given as key-value pairs; pairs with an empty value are left out, and
+// the rest are sorted by key.
+func withPurlQualifiers(purl string, pairs ...string) string {
+	quals := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			quals = append(quals, pairs[i]+"="+purlEscape(pairs[i+1]))
+		}
+	}
+	if len(quals) == 0 {
+		return purl
+	}
+	sort.Strings(quals)
+	return purl + "?" + strings.Join(quals, "&")
+}
+
+// purlEscape percent-encodes every character in s other than ASCII
+// letters, digits, ".", "-", "_" and "~".
+func purlEscape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '-', c == '_', c == '~':
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
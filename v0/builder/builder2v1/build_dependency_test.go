@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"testing"
+)
+
+// ===== Dependency Package helper tests =====
+func TestNewDependencyPackageFillsInNOASSERTION(t *testing.T) {
+	pkg := newDependencyPackage2_1("SPDXRef-Package-x", "x", "1.0", "pkg:generic/x@1.0")
+
+	if pkg.PackageName != "x" {
+		t.Errorf("expected %v, got %v", "x", pkg.PackageName)
+	}
+	if pkg.PackageVersion != "1.0" {
+		t.Errorf("expected %v, got %v", "1.0", pkg.PackageVersion)
+	}
+	if pkg.FilesAnalyzed != false || pkg.IsFilesAnalyzedTagPresent != true {
+		t.Errorf("expected FilesAnalyzed to be present and false")
+	}
+	if pkg.PackageDownloadLocation != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.PackageDownloadLocation)
+	}
+	if pkg.PackageLicenseConcluded != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.PackageLicenseConcluded)
+	}
+	if pkg.PackageLicenseDeclared != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.PackageLicenseDeclared)
+	}
+	if pkg.PackageCopyrightText != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.PackageCopyrightText)
+	}
+	if len(pkg.PackageExternalReferences) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(pkg.PackageExternalReferences))
+	}
+	ref := pkg.PackageExternalReferences[0]
+	if ref.Category != "PACKAGE-MANAGER" || ref.RefType != "purl" || ref.Locator != "pkg:generic/x@1.0" {
+		t.Errorf("expected purl reference, got %+v", ref)
+	}
+
+	pkg = newDependencyPackage2_1("SPDXRef-Package-x", "x", "", "")
+	if len(pkg.PackageExternalReferences) != 0 {
+		t.Errorf("expected %d, got %d", 0, len(pkg.PackageExternalReferences))
+	}
+}
+
+func TestPackageIDsAreValidAndUnique(t *testing.T) {
+	ids := packageIDs{}
+
+	got := ids.next("golang", "github.com/a/b", "v1.0.0+incompatible")
+	want := "SPDXRef-Package-golang-github.com-a-b-v1.0.0-incompatible"
+	if got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	got = ids.next("golang", "github.com/a-b", "v1.0.0+incompatible")
+	want = "SPDXRef-Package-golang-github.com-a-b-v1.0.0-incompatible-2"
+	if got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	got = ids.next("npm", "@scope/pkg", "")
+	want = "SPDXRef-Package-npm--scope-pkg"
+	if got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestBuildPurlEscapesSegments(t *testing.T) {
+	for _, tc := range []struct {
+		purlType, namespace, name, version, want string
+	}{
+		{"golang", "github.com/spdx", "tools-golang", "v0.1.0", "pkg:golang/github.com/spdx/tools-golang@v0.1.0"},
+		{"golang", "gopkg.in", "yaml.v2", "v2.0.0+incompatible", "pkg:golang/gopkg.in/yaml.v2@v2.0.0%2Bincompatible"},
+		{"npm", "@babel", "core", "7.0.0", "pkg:npm/%40babel/core@7.0.0"},
+		{"pypi", "", "requests", "", "pkg:pypi/requests"},
+	} {
+		got := buildPurl(tc.purlType, tc.namespace, tc.name, tc.version)
+		if got != tc.want {
+			t.Errorf("expected %v, got %v", tc.want, got)
+		}
+	}
+}
+
+func TestWithPurlQualifiersSortsAndSkipsEmpty(t *testing.T) {
+	got := withPurlQualifiers("pkg:deb/debian/curl@7.50.3-1", "distro", "debian 11", "arch", "i386", "epoch", "")
+	want := "pkg:deb/debian/curl@7.50.3-1?arch=i386&distro=debian%2011"
+	if got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got = withPurlQualifiers("pkg:npm/a", "epoch", ""); got != "pkg:npm/a" {
+		t.Errorf("expected %v, got %v", "pkg:npm/a", got)
+	}
+}
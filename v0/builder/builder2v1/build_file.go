@@ -4,7 +4,10 @@ package builder2v1
 
 import (
 	"fmt"
-	"path/filepath"
+	"io/fs"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/spdx/tools-golang/v0/spdx"
 	"github.com/spdx/tools-golang/v0/utils"
@@ -16,15 +19,97 @@ import (
 //   - prefix: relative directory for filePath
 //   - fileNumber: integer index (unique within package) to use in identifier
 func BuildFileSection2_1(filePath string, prefix string, fileNumber int) (*spdx.File2_1, error) {
-	// build the full file path
-	p := filepath.Join(prefix, filePath)
+	return BuildFileSectionFromFS2_1(utils.DirFS(prefix), filePath, fileNumber)
+}
+
+// BuildFileSectionFromFS2_1 creates an SPDX File (version 2.1) for a file
+// within a file system, returning that file or error if any is encountered.
+// Arguments:
+//   - fsys: file system containing the file
+//   - filePath: path to file, relative to the root of fsys
+//   - fileNumber: integer index (unique within package) to use in identifier
+func BuildFileSectionFromFS2_1(fsys fs.FS, filePath string, fileNumber int) (*spdx.File2_1, error) {
+	b := &fileSectionBuilder{fsys: fsys}
+	return b.build(filePath, fileNumber)
+}
+
+// fileSectionBuilder holds the settings shared by all of the File sections
+// built for a single Package.
+type fileSectionBuilder struct {
+	// fsys is the file system containing the files
+	fsys fs.FS
+	// cache, if non-nil, is used to look up the files' hashes
+	cache *utils.HashCache
+	// recordLinks is true if symbolic links should be described as links,
+	// rather than by the contents of their targets
+	recordLinks bool
+	// classifier assigns the files' types; nil uses the built-in rules
+	classifier *FileClassifier
+}
+
+// build creates an SPDX File (version 2.1) for the file at filePath.
+func (b *fileSectionBuilder) build(filePath string, fileNumber int) (*spdx.File2_1, error) {
+	if b.recordLinks {
+		fi, err := utils.Lstat(b.fsys, strings.TrimPrefix(filePath, "/"))
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&fs.ModeSymlink == fs.ModeSymlink {
+			return b.buildLink(filePath, fileNumber)
+		}
+	}
+
+	// make sure we can get the file, its hashes and its type
+	ssha1, ssha256, smd5, fileType, err := b.cache.GetHashesAndTypeForFS(b.fsys, filePath, func() (string, string, string, string, error) {
+		return b.hashFile(filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFileSection(filePath, fileNumber, ssha1, ssha256, smd5)
+	f.FileType = []string{fileType}
+	return f, nil
+}
+
+// hashFile reads the file at filePath once, both to hash and to classify
+// it.
+func (b *fileSectionBuilder) hashFile(filePath string) (string, string, string, string, error) {
+	r, err := b.fsys.Open(strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		return "", "", "", "", err
+	}
+	defer r.Close()
+
+	h, err := hashAndClassify(r, filePath, b.classifier)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	return h.sha1, h.sha256, h.md5, h.fileType, nil
+}
 
-	// make sure we can get the file and its hashes
-	ssha1, ssha256, smd5, err := utils.GetHashesForFilePath(p)
+// buildLink creates an SPDX File (version 2.1) for the symbolic link at
+// filePath. As git does, the link is hashed as the text of its target.
+func (b *fileSectionBuilder) buildLink(filePath string, fileNumber int) (*spdx.File2_1, error) {
+	target, err := utils.ReadLink(b.fsys, strings.TrimPrefix(filePath, "/"))
 	if err != nil {
 		return nil, err
 	}
 
+	ssha1, ssha256, smd5, err := utils.GetHashesForReader(strings.NewReader(target))
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFileSection(filePath, fileNumber, ssha1, ssha256, smd5)
+	f.FileType = []string{FileTypeOther}
+	f.FileComment = fmt.Sprintf("symbolic link to %s", target)
+	return f, nil
+}
+
+// newFileSection fills in an SPDX File (version 2.1) for a file whose
+// hashes have already been calculated.
+func newFileSection(filePath string, fileNumber int, ssha1 string, ssha256 string, smd5 string) *spdx.File2_1 {
 	// build the identifier
 	i := fmt.Sprintf("SPDXRef-File%d", fileNumber)
 
@@ -40,5 +125,74 @@ func BuildFileSection2_1(filePath string, prefix string, fileNumber int) (*spdx.
 		FileCopyrightText:  "NOASSERTION",
 	}
 
-	return f, nil
+	return f
+}
+
+// BuildFileSections2_1 creates SPDX Files (version 2.1) for each of the
+// given file paths, returning them in the same order as filePaths or error
+// if any is encountered. Each file's identifier is numbered by its index in
+// filePaths, so the results are the same no matter how many workers are
+// used. Arguments:
+//   - filePaths: paths to files, relative to prefix
+//   - prefix: relative directory for filePaths
+//   - numWorkers: number of files to hash concurrently; 0 or 1 for serial
+func BuildFileSections2_1(filePaths []string, prefix string, numWorkers int) ([]*spdx.File2_1, error) {
+	b := &fileSectionBuilder{fsys: utils.DirFS(prefix)}
+	return b.buildAll(filePaths, numWorkers)
+}
+
+// buildAll creates SPDX Files (version 2.1) for each of the given file
+// paths, in the same manner as BuildFileSections2_1.
+func (b *fileSectionBuilder) buildAll(filePaths []string, numWorkers int) ([]*spdx.File2_1, error) {
+	files := make([]*spdx.File2_1, len(filePaths))
+
+	if numWorkers <= 1 {
+		for i, fp := range filePaths {
+			newFile, err := b.build(fp, i)
+			if err != nil {
+				return nil, err
+			}
+			files[i] = newFile
+		}
+		return files, nil
+	}
+
+	// each worker writes only to its own indices in files and errs, so
+	// no further locking is needed for the results themselves
+	errs := make([]error, len(filePaths))
+	jobs := make(chan int)
+	var failed int32
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				files[i], errs[i] = b.build(filePaths[i], i)
+				if errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	// stop handing out new files once any of them has failed
+	for i := range filePaths {
+		if atomic.LoadInt32(&failed) != 0 {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// report the error for the earliest failing file, as the serial
+	// path would have done
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
 }
@@ -3,7 +3,10 @@
 package builder2v1
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
+	"testing/fstest"
 )
 
 // ===== File section builder tests =====
@@ -57,3 +60,81 @@ func TestBuilder2_1BuildFileSectionFailsForInvalidFilePath(t *testing.T) {
 		t.Fatalf("expected non-nil error, got nil")
 	}
 }
+
+func TestBuilder2_1CanBuildFileSectionsInParallel(t *testing.T) {
+	filePaths := []string{
+		"/emptyfile.testdata.txt",
+		"/file1.testdata.txt",
+		"/file3.testdata.txt",
+		"/folder1/file4.testdata.txt",
+		"/lastfile.testdata.txt",
+	}
+	prefix := "../../../testdata/project1/"
+
+	serial, err := BuildFileSections2_1(filePaths, prefix, 1)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	parallel, err := BuildFileSections2_1(filePaths, prefix, 3)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if len(serial) != len(filePaths) {
+		t.Fatalf("expected %d, got %d", len(filePaths), len(serial))
+	}
+	if len(parallel) != len(filePaths) {
+		t.Fatalf("expected %d, got %d", len(filePaths), len(parallel))
+	}
+	for i := range filePaths {
+		if !reflect.DeepEqual(serial[i], parallel[i]) {
+			t.Errorf("expected %+v, got %+v", serial[i], parallel[i])
+		}
+		wantID := fmt.Sprintf("SPDXRef-File%d", i)
+		if parallel[i].FileSPDXIdentifier != wantID {
+			t.Errorf("expected %v, got %v", wantID, parallel[i].FileSPDXIdentifier)
+		}
+		if parallel[i].FileName != filePaths[i] {
+			t.Errorf("expected %v, got %v", filePaths[i], parallel[i].FileName)
+		}
+	}
+}
+
+func TestBuilder2_1BuildFileSectionsInParallelFailsForInvalidFilePath(t *testing.T) {
+	filePaths := []string{
+		"/file1.testdata.txt",
+		"/does-not-exist.txt",
+		"/file3.testdata.txt",
+	}
+	prefix := "../../../testdata/project1/"
+
+	_, err := BuildFileSections2_1(filePaths, prefix, 4)
+	if err == nil {
+		t.Fatalf("expected non-nil error, got nil")
+	}
+}
+
+func TestBuilder2_1CanBuildFileSectionFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/file.txt": {Data: []byte("goodbye")},
+	}
+
+	file1, err := BuildFileSectionFromFS2_1(fsys, "/dir/file.txt", 3)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if file1.FileName != "/dir/file.txt" {
+		t.Errorf("expected %v, got %v", "/dir/file.txt", file1.FileName)
+	}
+	if file1.FileSPDXIdentifier != "SPDXRef-File3" {
+		t.Errorf("expected %v, got %v", "SPDXRef-File3", file1.FileSPDXIdentifier)
+	}
+	if file1.FileChecksumSHA1 != "3c8ec4874488f6090a157b014ce3397ca8e06d4f" {
+		t.Errorf("expected %v, got %v", "3c8ec4874488f6090a157b014ce3397ca8e06d4f", file1.FileChecksumSHA1)
+	}
+
+	_, err = BuildFileSectionFromFS2_1(fsys, "/dir/missing.txt", 4)
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
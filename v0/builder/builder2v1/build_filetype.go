@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// SPDX file types assigned by a FileClassifier.
+const (
+	FileTypeSource  = "SOURCE"
+	FileTypeBinary  = "BINARY"
+	FileTypeArchive = "ARCHIVE"
+	FileTypeOther   = "OTHER"
+)
+
+// fileHeadSize is the number of bytes from the start of a file that are
+// used to classify it.
+const fileHeadSize = 8000
+
+// FileClassifier assigns an SPDX file type to a file, based on its name
+// and the first few thousand bytes of its contents. The fields let teams
+// add their own mappings; they are consulted in the order given below,
+// before the built-in rules. The built-in rules check the contents for
+// the magic numbers of ELF, PE, Mach-O and WebAssembly binaries, Java
+// class files and zip, gzip, bzip2, xz, zstd and tar archives, then look
+// up the file name and extension in built-in tables, and finally treat
+// text starting with "#!" as SOURCE, other text as OTHER, and anything
+// else as BINARY. A nil *FileClassifier uses only the built-in rules.
+type FileClassifier struct {
+	// Funcs are called in order with the file's path and the start of its
+	// contents, and the first type returned that is not "" is used.
+	Funcs []func(filePath string, head []byte) string
+
+	// Names maps file names, without their directories (such as
+	// "Makefile"), to file types.
+	Names map[string]string
+
+	// Extensions maps file name extensions, in lower case and including
+	// the leading "." (such as ".proto" or ".tar.gz"), to file types.
+	// Where several extensions apply, the longest one wins.
+	Extensions map[string]string
+}
+
+// Classify returns the SPDX file type for a file. Arguments:
+//   - filePath: path to the file; only its name is used by the built-in
+//     rules
+//   - head: the first bytes of the file, or all of it if it is short
+func (c *FileClassifier) Classify(filePath string, head []byte) string {
+	if c != nil {
+		for _, f := range c.Funcs {
+			if t := f(filePath, head); t != "" {
+				return t
+			}
+		}
+		if t := lookupFileName(filePath, c.Names, c.Extensions); t != "" {
+			return t
+		}
+	}
+	if t := sniffFileType(head); t != "" {
+		return t
+	}
+	if t := lookupFileName(filePath, defaultFileNameTypes, defaultFileExtensionTypes); t != "" {
+		return t
+	}
+	switch {
+	case !looksLikeText(head):
+		return FileTypeBinary
+	case bytes.HasPrefix(head, []byte("#!")):
+		return FileTypeSource
+	default:
+		return FileTypeOther
+	}
+}
+
+// lookupFileName finds a file's type by its name, or else by the longest
+// of its extensions that is listed.
+func lookupFileName(filePath string, names map[string]string, extensions map[string]string) string {
+	base := path.Base(filePath)
+	if t := names[base]; t != "" {
+		return t
+	}
+	lower := strings.ToLower(base)
+	for i := 0; i < len(lower); i++ {
+		if lower[i] == '.' && i > 0 {
+			if t := extensions[lower[i:]]; t != "" {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// sniffFileType recognizes binaries and archives by their magic numbers.
+func sniffFileType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")),
+		bytes.HasPrefix(head, []byte("\x00asm")),
+		isPEFile(head):
+		return FileTypeBinary
+	case len(head) >= 4:
+		// Mach-O, in either byte order and either word size, plus fat
+		// binaries and Java class files, which share 0xcafebabe
+		switch binary.BigEndian.Uint32(head) {
+		case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe, 0xcafebabe:
+			return FileTypeBinary
+		}
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")),
+		bytes.HasPrefix(head, []byte("PK\x05\x06")),
+		bytes.HasPrefix(head, []byte("PK\x07\x08")),
+		detectCompression(head) != "",
+		len(head) >= 263 && bytes.HasPrefix(head[257:], []byte("ustar")):
+		return FileTypeArchive
+	}
+	return ""
+}
+
+// isPEFile reports whether head is the start of a Windows PE file: an MS-DOS
+// stub whose header points to a PE signature. A signature beyond head is
+// not accepted, since "MZ" alone is too common a start for text files.
+func isPEFile(head []byte) bool {
+	if !bytes.HasPrefix(head, []byte("MZ")) || len(head) < 0x40 {
+		return false
+	}
+	offset := int64(binary.LittleEndian.Uint32(head[0x3c:]))
+	if offset+4 > int64(len(head)) {
+		return false
+	}
+	return bytes.Equal(head[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// looksLikeText reports whether head seems to be text: it has no NUL bytes,
+// and few other control characters.
+func looksLikeText(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	control := 0
+	for _, c := range head {
+		if (c < 0x20 && !strings.ContainsRune("\t\n\v\f\r\b\x1b", rune(c))) || c == 0x7f {
+			control++
+		}
+	}
+	return control*10 <= len(head)
+}
+
+// headBuffer keeps the first fileHeadSize bytes written to it.
+type headBuffer struct {
+	b []byte
+}
+
+func (hb *headBuffer) Write(p []byte) (int, error) {
+	if room := fileHeadSize - len(hb.b); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		hb.b = append(hb.b, p[:room]...)
+	}
+	return len(p), nil
+}
+
+// hashAndClassify hashes the contents of a file read from r, such as an
+// archive entry, and classifies it using c.
+func hashAndClassify(r io.Reader, filePath string, c *FileClassifier) (fileHashes, error) {
+	hb := &headBuffer{}
+	ssha1, ssha256, smd5, err := utils.GetHashesForReader(io.TeeReader(r, hb))
+	if err != nil {
+		return fileHashes{}, err
+	}
+	return fileHashes{sha1: ssha1, sha256: ssha256, md5: smd5, fileType: c.Classify(filePath, hb.b)}, nil
+}
+
+// defaultFileNameTypes are the built-in file types for well-known file
+// names.
+var defaultFileNameTypes = map[string]string{
+	"Makefile":       FileTypeSource,
+	"GNUmakefile":    FileTypeSource,
+	"makefile":       FileTypeSource,
+	"Dockerfile":     FileTypeSource,
+	"Containerfile":  FileTypeSource,
+	"CMakeLists.txt": FileTypeSource,
+	"BUILD":          FileTypeSource,
+	"BUILD.bazel":    FileTypeSource,
+	"WORKSPACE":      FileTypeSource,
+	"Rakefile":       FileTypeSource,
+	"Jenkinsfile":    FileTypeSource,
+	"configure.ac":   FileTypeSource,
+	"meson.build":    FileTypeSource,
+}
+
+// defaultFileExtensionTypes are the built-in file types for well-known
+// file name extensions.
+var defaultFileExtensionTypes = fileTypeTable(map[string][]string{
+	FileTypeSource: {
+		".c", ".h", ".cc", ".cpp", ".cxx", ".c++", ".hh", ".hpp", ".hxx", ".inl",
+		".go", ".rs", ".py", ".pyi", ".pyx", ".js", ".mjs", ".cjs", ".jsx", ".ts", ".tsx",
+		".java", ".kt", ".kts", ".scala", ".groovy", ".gradle", ".clj", ".cljs",
+		".rb", ".php", ".pl", ".pm", ".sh", ".bash", ".zsh", ".fish", ".ps1", ".bat", ".cmd",
+		".swift", ".m", ".mm", ".cs", ".fs", ".vb", ".lua", ".r", ".jl", ".hs", ".ml", ".mli",
+		".erl", ".hrl", ".ex", ".exs", ".dart", ".elm", ".zig", ".nim", ".d", ".f", ".f90",
+		".s", ".asm", ".sql", ".proto", ".thrift", ".cmake", ".mk", ".bzl", ".vue", ".svelte",
+		".css", ".scss", ".sass", ".less", ".html", ".htm", ".tf", ".v", ".sv", ".vhd", ".vhdl",
+	},
+	FileTypeBinary: {
+		".o", ".obj", ".so", ".dll", ".exe", ".dylib", ".a", ".lib", ".class", ".pyc", ".pyo",
+		".wasm", ".bin", ".elf", ".ko", ".sys",
+	},
+	FileTypeArchive: {
+		".zip", ".jar", ".war", ".ear", ".aar", ".tar", ".tgz", ".tar.gz", ".gz", ".tbz2",
+		".tar.bz2", ".bz2", ".txz", ".tar.xz", ".xz", ".zst", ".tar.zst", ".7z", ".rar",
+		".whl", ".egg", ".gem", ".nupkg", ".deb", ".rpm", ".apk", ".crate", ".cpio", ".iso",
+	},
+})
+
+// fileTypeTable inverts lists of extensions keyed by file type.
+func fileTypeTable(byType map[string][]string) map[string]string {
+	table := map[string]string{}
+	for fileType, exts := range byType {
+		for _, ext := range exts {
+			table[ext] = fileType
+		}
+	}
+	return table
+}
@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ===== File type classifier tests =====
+func testPEHead() []byte {
+	head := make([]byte, 0x84)
+	copy(head, "MZ")
+	binary.LittleEndian.PutUint32(head[0x3c:], 0x80)
+	copy(head[0x80:], "PE\x00\x00")
+	return head
+}
+
+func testTarHead() []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	tw.Write([]byte("a"))
+	tw.Close()
+	return buf.Bytes()
+}
+
+func testZipHead() []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, _ := zw.Create("a.txt")
+	w.Write([]byte("a"))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func testGzipHead() []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	zw.Write([]byte("a"))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestIsPEFileRequiresSignatureWithinHead(t *testing.T) {
+	if !isPEFile(testPEHead()) {
+		t.Errorf("expected PE head to be a PE file")
+	}
+	wrongSig := testPEHead()
+	copy(wrongSig[0x80:], "NE\x00\x00")
+	if isPEFile(wrongSig) {
+		t.Errorf("expected head with wrong signature not to be a PE file")
+	}
+	if isPEFile(testPEHead()[:0x82]) {
+		t.Errorf("expected head with signature out of range not to be a PE file")
+	}
+}
+
+func TestFileClassifierBuiltInRules(t *testing.T) {
+	tests := []struct {
+		filePath string
+		head     []byte
+		want     string
+	}{
+		// magic numbers win over extensions
+		{"/bin/ls", []byte("\x7fELF\x02\x01\x01\x00"), FileTypeBinary},
+		{"/lib/notes.txt", []byte("\x7fELF\x02\x01\x01\x00"), FileTypeBinary},
+		{"/app.exe", testPEHead(), FileTypeBinary},
+		// "MZ" without a PE signature within the head is not enough
+		{"/MZ-notes", []byte("MZ notes" + strings.Repeat(" ", 0x34) + "zzzz\n"), FileTypeOther},
+		{"/lib.dylib", []byte{0xcf, 0xfa, 0xed, 0xfe, 7, 0, 0, 1}, FileTypeBinary},
+		{"/Main.class", []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 52}, FileTypeBinary},
+		{"/mod.wasm", []byte("\x00asm\x01\x00\x00\x00"), FileTypeBinary},
+		{"/lib.jar", testZipHead(), FileTypeArchive},
+		{"/data", testGzipHead(), FileTypeArchive},
+		{"/backup", testTarHead(), FileTypeArchive},
+		// names and extensions
+		{"/src/main.go", []byte("package main\n"), FileTypeSource},
+		{"/src/Widget.TSX", []byte("export {}\n"), FileTypeSource},
+		{"/Makefile", []byte("all:\n"), FileTypeSource},
+		{"/dist/app.min.js", []byte("!function(){}()"), FileTypeSource},
+		{"/release.tar.gz", []byte("not really compressed"), FileTypeArchive},
+		{"/libfoo.so", []byte("INPUT(libfoo.so.1)\n"), FileTypeBinary},
+		// content heuristics
+		{"/scripts/deploy", []byte("#!/bin/sh\necho hi\n"), FileTypeSource},
+		{"/README", []byte("Read me.\n"), FileTypeOther},
+		{"/.bashrc", []byte("alias ll='ls -l'\n"), FileTypeOther},
+		{"/empty", []byte{}, FileTypeOther},
+		{"/blob", []byte("abc\x00def"), FileTypeBinary},
+		{"/noise", []byte("\x01\x02\x03\x04\x05\x06abcd"), FileTypeBinary},
+		{"/latin1.txt", []byte("caf\xe9\n"), FileTypeOther},
+	}
+	var c *FileClassifier
+	for _, tc := range tests {
+		if got := c.Classify(tc.filePath, tc.head); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.filePath, tc.want, got)
+		}
+	}
+}
+
+func TestFileClassifierCustomMappingsComeFirst(t *testing.T) {
+	c := &FileClassifier{
+		Funcs: []func(string, []byte) string{
+			func(filePath string, head []byte) string {
+				if strings.HasSuffix(filePath, ".md") {
+					return "DOCUMENTATION"
+				}
+				return ""
+			},
+		},
+		Names:      map[string]string{"VERSION": FileTypeOther},
+		Extensions: map[string]string{".apk": "APPLICATION", ".tmpl": FileTypeSource},
+	}
+
+	tests := []struct {
+		filePath string
+		head     []byte
+		want     string
+	}{
+		{"/docs/guide.md", []byte("# Guide\n"), "DOCUMENTATION"},
+		{"/VERSION", []byte("#!not a script\n"), FileTypeOther},
+		{"/app.apk", testZipHead(), "APPLICATION"},
+		{"/page.html.tmpl", []byte("<html>\n"), FileTypeSource},
+		// anything else still uses the built-in rules
+		{"/main.c", []byte("int main() {}\n"), FileTypeSource},
+	}
+	for _, tc := range tests {
+		if got := c.Classify(tc.filePath, tc.head); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.filePath, tc.want, got)
+		}
+	}
+}
+
+func TestBuildFileSectionSetsFileType(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go": {Data: []byte("package main\n")},
+		"tool":    {Data: []byte("\x7fELF\x02\x01\x01\x00" + strings.Repeat("\x00", 20000))},
+	}
+
+	file, err := BuildFileSectionFromFS2_1(fsys, "/main.go", 0)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(file.FileType) != 1 || file.FileType[0] != FileTypeSource {
+		t.Errorf("expected %v, got %v", []string{FileTypeSource}, file.FileType)
+	}
+
+	opts := &PackageOptions2_1{FileClassifier: &FileClassifier{Names: map[string]string{"tool": "APPLICATION"}}}
+	pkg, err := BuildPackageSectionFromFS2_1("test", fsys, opts)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkg.Files) != 2 || pkg.Files[1].FileType[0] != "APPLICATION" {
+		t.Errorf("expected tool to be APPLICATION, got %+v", pkg.Files)
+	}
+}
+
+func TestBuildPackageSectionFromArchiveSetsFileType(t *testing.T) {
+	pkg, err := BuildPackageSectionFromArchive2_1("project1", "project1.tar", bytes.NewReader(makeProject1Tar(t)), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for _, f := range pkg.Files {
+		if len(f.FileType) != 1 || f.FileType[0] != FileTypeOther {
+			t.Errorf("%s: expected %v, got %v", f.FileName, []string{FileTypeOther}, f.FileType)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// BuildGoModulePackages2_1 creates SPDX Packages (version 2.1) for the
+// module dependencies of the Go module whose go.mod file is at the root of
+// fsys, along with "DEPENDS_ON" Relationships from the main module's
+// Package to each of them. Dependencies are read from the require and
+// replace directives in go.mod, and from vendor/modules.txt if present;
+// their h1: checksums are taken from go.sum. A "purl" external reference
+// for the main module is added to mainPkg. If there is no go.mod file, no
+// Packages are returned. Arguments:
+//   - fsys: file system containing the main module
+//   - mainPkg: the main module's Package, as built from its files
+func BuildGoModulePackages2_1(fsys fs.FS, mainPkg *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	data, err := fs.ReadFile(fsys, "go.mod")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	gomod, err := parseGoMod(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("go.mod: %v", err)
+	}
+	if gomod.modulePath != "" {
+		mainPkg.PackageExternalReferences = append(mainPkg.PackageExternalReferences, &spdx.PackageExternalReference2_1{
+			Category: "PACKAGE-MANAGER",
+			RefType:  "purl",
+			Locator:  goPurl(gomod.modulePath, ""),
+		})
+	}
+
+	sums := map[string]string{}
+	data, err = fs.ReadFile(fsys, "go.sum")
+	if err == nil {
+		sums = parseGoSum(data)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	vendored := map[string]bool{}
+	requires := gomod.requires
+	data, err = fs.ReadFile(fsys, "vendor/modules.txt")
+	if err == nil {
+		// modules.txt from older Go versions may list modules that are
+		// missing from go.mod
+		listed := map[string]bool{}
+		for _, req := range requires {
+			listed[req.path] = true
+		}
+		for _, req := range parseVendorModules(data) {
+			vendored[req.path] = true
+			if !listed[req.path] {
+				listed[req.path] = true
+				requires = append(requires, req)
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	ids := packageIDs{}
+	pkgs := []*spdx.Package2_1{}
+	rlns := []*spdx.Relationship2_1{}
+	for _, req := range requires {
+		var pkg *spdx.Package2_1
+		comments := []string{}
+		rep, replaced := gomod.replacement(req.path, req.version)
+		switch {
+		case replaced && rep.newVersion == "":
+			// replaced by a directory, which has no version or purl
+			pkg = newDependencyPackage2_1(ids.next("golang", req.path, ""), req.path, "", "")
+			comments = append(comments, fmt.Sprintf("replaced by local directory %s", rep.newPath))
+		case replaced:
+			pkg = newDependencyPackage2_1(ids.next("golang", rep.newPath, rep.newVersion), rep.newPath, rep.newVersion, goPurl(rep.newPath, rep.newVersion))
+			comments = append(comments, fmt.Sprintf("replaces %s %s", req.path, req.version))
+		default:
+			pkg = newDependencyPackage2_1(ids.next("golang", req.path, req.version), req.path, req.version, goPurl(req.path, req.version))
+		}
+
+		if pkg.PackageVersion != "" {
+			if h, ok := sums[pkg.PackageName+" "+pkg.PackageVersion]; ok {
+				comments = append(comments, fmt.Sprintf("go.sum module checksum: %s", h))
+			}
+			if h, ok := sums[pkg.PackageName+" "+pkg.PackageVersion+"/go.mod"]; ok {
+				comments = append(comments, fmt.Sprintf("go.sum go.mod checksum: %s", h))
+			}
+		}
+		if vendored[req.path] {
+			comments = append(comments, "vendored in vendor/")
+		}
+		pkg.PackageComment = strings.Join(comments, "\n")
+
+		rlnComment := ""
+		if req.indirect {
+			rlnComment = "indirect dependency"
+		}
+		pkgs = append(pkgs, pkg)
+		rlns = append(rlns, dependsOn(mainPkg.PackageSPDXIdentifier, pkg.PackageSPDXIdentifier, rlnComment))
+	}
+
+	return pkgs, rlns, nil
+}
+
+// goPurl returns the package URL for a Go module.
+func goPurl(modulePath string, version string) string {
+	namespace := ""
+	name := modulePath
+	if i := strings.LastIndex(modulePath, "/"); i >= 0 {
+		namespace, name = modulePath[:i], modulePath[i+1:]
+	}
+	return buildPurl("golang", namespace, name, version)
+}
+
+// goModFile holds the directives from a go.mod file that matter for
+// finding dependencies.
+type goModFile struct {
+	modulePath string
+	requires   []goRequire
+	replaces   []goReplace
+}
+
+// goRequire is a single module requirement.
+type goRequire struct {
+	path     string
+	version  string
+	indirect bool
+}
+
+// goReplace is a single replace directive. oldVersion is empty if all
+// versions are replaced, and newVersion is empty if the replacement is a
+// local directory.
+type goReplace struct {
+	oldPath    string
+	oldVersion string
+	newPath    string
+	newVersion string
+}
+
+// replacement returns the replace directive that applies to a module
+// version, if any. As in the go command, a directive for the specific
+// version takes precedence over one for all versions.
+func (m *goModFile) replacement(path string, version string) (goReplace, bool) {
+	var found goReplace
+	ok := false
+	for _, rep := range m.replaces {
+		if rep.oldPath != path {
+			continue
+		}
+		if rep.oldVersion == version {
+			return rep, true
+		}
+		if rep.oldVersion == "" {
+			found, ok = rep, true
+		}
+	}
+	return found, ok
+}
+
+// parseGoMod parses the module, require and replace directives in a
+// go.mod file. Other directives are ignored.
+func parseGoMod(data []byte) (*goModFile, error) {
+	m := &goModFile{}
+	block := ""
+	lineNum := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lineNum++
+		tokens, comment, err := tokenizeGoModLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		verb := block
+		if block == "" {
+			verb, tokens = tokens[0], tokens[1:]
+			if len(tokens) == 1 && tokens[0] == "(" {
+				block = verb
+				continue
+			}
+		} else if len(tokens) == 1 && tokens[0] == ")" {
+			block = ""
+			continue
+		}
+
+		switch verb {
+		case "module":
+			if len(tokens) != 1 {
+				return nil, fmt.Errorf("line %d: usage: module module/path", lineNum)
+			}
+			m.modulePath = tokens[0]
+		case "require":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: usage: require module/path v1.2.3", lineNum)
+			}
+			indirect := comment == "indirect" || strings.HasPrefix(comment, "indirect;")
+			m.requires = append(m.requires, goRequire{path: tokens[0], version: tokens[1], indirect: indirect})
+		case "replace":
+			rep, err := parseGoReplace(tokens)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			m.replaces = append(m.replaces, rep)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if block != "" {
+		return nil, fmt.Errorf("unterminated %s block", block)
+	}
+
+	return m, nil
+}
+
+// parseGoReplace parses the arguments of a replace directive.
+func parseGoReplace(tokens []string) (goReplace, error) {
+	arrow := -1
+	for i, t := range tokens {
+		if t == "=>" {
+			arrow = i
+		}
+	}
+	old, repl := tokens, []string{}
+	if arrow >= 0 {
+		old, repl = tokens[:arrow], tokens[arrow+1:]
+	}
+	if arrow < 0 || len(old) < 1 || len(old) > 2 || len(repl) < 1 || len(repl) > 2 {
+		return goReplace{}, errors.New("usage: replace module/path [v1.2.3] => other/module v1.4 or replace module/path [v1.2.3] => ../local/directory")
+	}
+
+	rep := goReplace{oldPath: old[0], newPath: repl[0]}
+	if len(old) == 2 {
+		rep.oldVersion = old[1]
+	}
+	if len(repl) == 2 {
+		rep.newVersion = repl[1]
+	}
+	return rep, nil
+}
+
+// tokenizeGoModLine splits a line of a go.mod file into tokens, unquoting
+// any quoted strings, and returns the text of its trailing "//" comment.
+func tokenizeGoModLine(line string) ([]string, string, error) {
+	tokens := []string{}
+	for {
+		line = strings.TrimLeft(line, " \t\r")
+		switch {
+		case line == "":
+			return tokens, "", nil
+		case strings.HasPrefix(line, "//"):
+			return tokens, strings.TrimSpace(line[2:]), nil
+		case line[0] == '"' || line[0] == '`':
+			end := 1
+			for end < len(line) && line[end] != line[0] {
+				if line[0] == '"' && line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, "", errors.New("unterminated quoted string")
+			}
+			s, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil, "", err
+			}
+			tokens = append(tokens, s)
+			line = line[end+1:]
+		case line[0] == '(' || line[0] == ')':
+			tokens = append(tokens, line[:1])
+			line = line[1:]
+		default:
+			end := strings.IndexAny(line, " \t\r\"`()")
+			if i := strings.Index(line, "//"); i >= 0 && (end < 0 || i < end) {
+				end = i
+			}
+			if end < 0 {
+				end = len(line)
+			}
+			tokens = append(tokens, line[:end])
+			line = line[end:]
+		}
+	}
+}
+
+// parseGoSum returns the checksums in a go.sum file, keyed by
+// "<module path> <version>" (for the module's contents) or
+// "<module path> <version>/go.mod" (for its go.mod file alone).
+func parseGoSum(data []byte) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		sums[fields[0]+" "+fields[1]] = fields[2]
+	}
+	return sums
+}
+
+// parseVendorModules returns the modules listed in a vendor/modules.txt
+// file. Modules that are not marked "## explicit" are treated as indirect
+// requirements.
+func parseVendorModules(data []byte) []goRequire {
+	reqs := []goRequire{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if len(reqs) == 0 {
+				continue
+			}
+			for _, attr := range strings.Split(line[3:], ";") {
+				if strings.TrimSpace(attr) == "explicit" {
+					reqs[len(reqs)-1].indirect = false
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			// "# path version" or "# path [version] => replacement";
+			// replacements are already known from go.mod
+			fields := strings.Fields(line[2:])
+			if len(fields) < 2 || fields[1] == "=>" {
+				continue
+			}
+			reqs = append(reqs, goRequire{path: fields[0], version: fields[1], indirect: true})
+		}
+	}
+	return reqs
+}
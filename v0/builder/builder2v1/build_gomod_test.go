@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Go module Package builder tests =====
+const testGoMod = `// a comment
+module example.com/service
+
+go 1.21
+
+require (
+	github.com/a/direct v1.2.3
+	"github.com/b/indirect" v0.1.0 // indirect
+	golang.org/x/replaced v0.5.0
+	example.com/local v1.0.0
+)
+
+require github.com/c/single v2.0.0+incompatible
+
+replace golang.org/x/replaced => github.com/fork/replaced v0.6.0
+
+replace (
+	example.com/local v1.0.0 => ../local
+)
+
+exclude github.com/a/direct v1.0.0
+
+retract [v0.1.0, v0.2.0] // broken
+`
+
+const testGoSum = `github.com/a/direct v1.2.3 h1:directhash=
+github.com/a/direct v1.2.3/go.mod h1:directmodhash=
+github.com/b/indirect v0.1.0/go.mod h1:indirectmodhash=
+github.com/fork/replaced v0.6.0 h1:forkhash=
+`
+
+func TestBuildGoModulePackagesReadsGoModAndGoSum(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":  {Data: []byte(testGoMod)},
+		"go.sum":  {Data: []byte(testGoSum)},
+		"main.go": {Data: []byte("package main\n")},
+	}
+	mainPkg := &spdx.Package2_1{PackageName: "service", PackageSPDXIdentifier: "SPDXRef-Package-service"}
+
+	pkgs, rlns, err := BuildGoModulePackages2_1(fsys, mainPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if len(mainPkg.PackageExternalReferences) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(mainPkg.PackageExternalReferences))
+	}
+	if mainPkg.PackageExternalReferences[0].Locator != "pkg:golang/example.com/service" {
+		t.Errorf("expected %v, got %v", "pkg:golang/example.com/service", mainPkg.PackageExternalReferences[0].Locator)
+	}
+
+	if len(pkgs) != 5 {
+		t.Fatalf("expected %d, got %d", 5, len(pkgs))
+	}
+	if len(rlns) != 5 {
+		t.Fatalf("expected %d, got %d", 5, len(rlns))
+	}
+
+	for i, want := range []struct {
+		name, version, purl, comment, rlnComment string
+	}{
+		{"github.com/a/direct", "v1.2.3", "pkg:golang/github.com/a/direct@v1.2.3",
+			"go.sum module checksum: h1:directhash=\ngo.sum go.mod checksum: h1:directmodhash=", ""},
+		{"github.com/b/indirect", "v0.1.0", "pkg:golang/github.com/b/indirect@v0.1.0",
+			"go.sum go.mod checksum: h1:indirectmodhash=", "indirect dependency"},
+		{"github.com/fork/replaced", "v0.6.0", "pkg:golang/github.com/fork/replaced@v0.6.0",
+			"replaces golang.org/x/replaced v0.5.0\ngo.sum module checksum: h1:forkhash=", ""},
+		{"example.com/local", "", "", "replaced by local directory ../local", ""},
+		{"github.com/c/single", "v2.0.0+incompatible", "pkg:golang/github.com/c/single@v2.0.0%2Bincompatible", "", ""},
+	} {
+		pkg := pkgs[i]
+		if pkg.PackageName != want.name {
+			t.Errorf("%d: expected %v, got %v", i, want.name, pkg.PackageName)
+		}
+		if pkg.PackageVersion != want.version {
+			t.Errorf("%d: expected %v, got %v", i, want.version, pkg.PackageVersion)
+		}
+		purl := ""
+		if len(pkg.PackageExternalReferences) > 0 {
+			purl = pkg.PackageExternalReferences[0].Locator
+		}
+		if purl != want.purl {
+			t.Errorf("%d: expected %v, got %v", i, want.purl, purl)
+		}
+		if pkg.PackageComment != want.comment {
+			t.Errorf("%d: expected %q, got %q", i, want.comment, pkg.PackageComment)
+		}
+
+		rln := rlns[i]
+		if rln.RefA != "SPDXRef-Package-service" || rln.RefB != pkg.PackageSPDXIdentifier || rln.Relationship != "DEPENDS_ON" {
+			t.Errorf("%d: expected DEPENDS_ON from main package, got %+v", i, rln)
+		}
+		if rln.RelationshipComment != want.rlnComment {
+			t.Errorf("%d: expected %v, got %v", i, want.rlnComment, rln.RelationshipComment)
+		}
+	}
+
+	if pkgs[0].PackageSPDXIdentifier != "SPDXRef-Package-golang-github.com-a-direct-v1.2.3" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Package-golang-github.com-a-direct-v1.2.3", pkgs[0].PackageSPDXIdentifier)
+	}
+}
+
+func TestBuildGoModulePackagesReadsVendorModules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod": {Data: []byte("module example.com/m\n\nrequire github.com/a/direct v1.2.3\n")},
+		"vendor/modules.txt": {Data: []byte(`# github.com/a/direct v1.2.3
+## explicit
+github.com/a/direct
+# github.com/old/unlisted v0.0.1
+github.com/old/unlisted/sub
+`)},
+	}
+	mainPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-m"}
+
+	pkgs, rlns, err := BuildGoModulePackages2_1(fsys, mainPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkgs))
+	}
+	if pkgs[0].PackageComment != "vendored in vendor/" {
+		t.Errorf("expected %q, got %q", "vendored in vendor/", pkgs[0].PackageComment)
+	}
+	if pkgs[1].PackageName != "github.com/old/unlisted" || pkgs[1].PackageVersion != "v0.0.1" {
+		t.Errorf("expected %v, got %v %v", "github.com/old/unlisted v0.0.1", pkgs[1].PackageName, pkgs[1].PackageVersion)
+	}
+	if rlns[1].RelationshipComment != "indirect dependency" {
+		t.Errorf("expected %v, got %v", "indirect dependency", rlns[1].RelationshipComment)
+	}
+}
+
+func TestBuildGoModulePackagesReturnsNothingWithoutGoMod(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go": {Data: []byte("package main\n")},
+	}
+	mainPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-m"}
+
+	pkgs, rlns, err := BuildGoModulePackages2_1(fsys, mainPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 0 || len(rlns) != 0 {
+		t.Errorf("expected no packages or relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+	if len(mainPkg.PackageExternalReferences) != 0 {
+		t.Errorf("expected %d, got %d", 0, len(mainPkg.PackageExternalReferences))
+	}
+}
+
+func TestBuildGoModulePackagesFailsForInvalidGoMod(t *testing.T) {
+	for _, gomod := range []string{
+		"module example.com/m\nrequire (\n\tgithub.com/a/b v1.0.0\n",
+		"module example.com/m\nrequire github.com/a/b\n",
+		"module example.com/m\nreplace github.com/a/b v1.0.0\n",
+		"module \"example.com/m\n",
+	} {
+		fsys := fstest.MapFS{"go.mod": {Data: []byte(gomod)}}
+		_, _, err := BuildGoModulePackages2_1(fsys, &spdx.Package2_1{})
+		if err == nil {
+			t.Errorf("expected non-nil error for %q, got nil", gomod)
+		}
+	}
+}
+
+func TestTokenizeGoModLine(t *testing.T) {
+	tokens, comment, err := tokenizeGoModLine("\t\"quoted/path\" v1.0.0//indirect; test")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want := []string{"quoted/path", "v1.0.0"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("expected %v, got %v", want, tokens)
+	}
+	if comment != "indirect; test" {
+		t.Errorf("expected %v, got %v", "indirect; test", comment)
+	}
+}
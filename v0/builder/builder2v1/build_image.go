@@ -0,0 +1,639 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// BuildImagePackages2_1 creates SPDX Packages (version 2.1) for a container
+// image stored as an OCI image layout or as a "docker save" archive,
+// returning the image's Package followed by a Package for each of its
+// layers, or error if any is encountered. Each layer is read in turn and
+// its whiteouts applied, so the image Package's Files are those of the
+// image's final filesystem. Each File's comment names the layer it came
+// from, and that layer's Package gets a "CONTAINS" Relationship to it; the
+// image Package gets a "CONTAINS" Relationship to each layer. Layer
+// digests are checked against their contents. Arguments:
+//   - packageName: name of package
+//   - imageName: file name of the image layout or archive, used for
+//     PackageFileName
+//   - fsys: the image layout directory, or the contents of the archive
+//   - ref: the image to build, if there is more than one: a tag or image
+//     name, a manifest or config digest, or a platform such as
+//     "linux/arm64"; "" if there should be exactly one image
+//   - opts: optional settings; only PathsIgnored, Decompressors and
+//     FileClassifier are used
+func BuildImagePackages2_1(packageName string, imageName string, fsys fs.FS, ref string, opts *PackageOptions2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	if opts == nil {
+		opts = &PackageOptions2_1{}
+	}
+
+	images, err := readImageCandidates(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, err := selectImage(images, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configData, err := readImageBlob(fsys, img.configPath, img.configDigest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("image config: %v", err)
+	}
+	if img.configDigest == "" {
+		img.configDigest = fmt.Sprintf("sha256:%x", sha256.Sum256(configData))
+	}
+	var config imageConfig
+	if err = json.Unmarshal(configData, &config); err != nil {
+		return nil, nil, fmt.Errorf("image config: %v", err)
+	}
+	if img.platform == "" && config.OS != "" {
+		img.platform = joinPlatform(config.OS, config.Architecture, config.Variant)
+	}
+
+	// apply the layers in order, keeping track of which layer each file in
+	// the final filesystem came from
+	files := map[string]*imageFile{}
+	for i := range img.layers {
+		if err = applyImageLayer(fsys, &img.layers[i], i, files, opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	filepaths := []string{}
+	for fp := range files {
+		if opts.PathsIgnored == nil || !utils.ShouldIgnore(fp, opts.PathsIgnored) {
+			filepaths = append(filepaths, fp)
+		}
+	}
+	sort.Strings(filepaths)
+	fileSections := []*spdx.File2_1{}
+	for i, fp := range filepaths {
+		f := files[fp]
+		file := newFileSection(fp, i, f.hashes.sha1, f.hashes.sha256, f.hashes.md5)
+		file.FileType = []string{f.hashes.fileType}
+		file.FileComment = fmt.Sprintf("from image layer %s", img.layers[f.layer].digest)
+		fileSections = append(fileSections, file)
+	}
+
+	code, err := utils.GetVerificationCode2_1(fileSections, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repository, tag := splitImageName(img.refName())
+	imagePkg := &spdx.Package2_1{
+		IsUnpackaged:                false,
+		PackageName:                 packageName,
+		PackageSPDXIdentifier:       fmt.Sprintf("SPDXRef-Package-%s", packageName),
+		PackageVersion:              tag,
+		PackageFileName:             imageName,
+		PackageDownloadLocation:     "NOASSERTION",
+		FilesAnalyzed:               true,
+		IsFilesAnalyzedTagPresent:   true,
+		PackageVerificationCode:     code,
+		PackageLicenseConcluded:     "NOASSERTION",
+		PackageLicenseInfoFromFiles: []string{},
+		PackageLicenseDeclared:      "NOASSERTION",
+		PackageCopyrightText:        "NOASSERTION",
+		PackageComment:              img.describe(),
+		Files:                       fileSections,
+	}
+	if img.manifestDigest != "" {
+		name := packageName
+		if repository != "" {
+			name = path.Base(repository)
+		}
+		repositoryURL := ""
+		if strings.Contains(repository, "/") {
+			repositoryURL = repository
+		}
+		purl := withPurlQualifiers(buildPurl("oci", "", strings.ToLower(name), img.manifestDigest),
+			"arch", config.Architecture, "repository_url", repositoryURL, "tag", tag)
+		imagePkg.PackageExternalReferences = []*spdx.PackageExternalReference2_1{
+			{Category: "PACKAGE-MANAGER", RefType: "purl", Locator: purl},
+		}
+	}
+
+	// history entries for empty layers have no layer of their own
+	createdBy := []string{}
+	for _, h := range config.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+	}
+
+	pkgs := []*spdx.Package2_1{imagePkg}
+	rlns := []*spdx.Relationship2_1{}
+	ids := packageIDs{}
+	for i, layer := range img.layers {
+		pkg := newDependencyPackage2_1(ids.next("layer", layer.digest, ""), layer.digest, "", "")
+		pkg.PackageFileName = layer.path
+		if alg, hex, _ := strings.Cut(layer.digest, ":"); alg == "sha256" {
+			pkg.PackageChecksumSHA256 = hex
+		}
+		comment := []string{fmt.Sprintf("layer %d of %d", i+1, len(img.layers))}
+		if i < len(config.RootFS.DiffIDs) && config.RootFS.DiffIDs[i] != layer.digest {
+			comment = append(comment, fmt.Sprintf("diff ID %s", config.RootFS.DiffIDs[i]))
+		}
+		if len(createdBy) == len(img.layers) && createdBy[i] != "" {
+			comment = append(comment, fmt.Sprintf("created by: %s", createdBy[i]))
+		}
+		pkg.PackageComment = strings.Join(comment, "; ")
+		pkgs = append(pkgs, pkg)
+
+		rlns = append(rlns, &spdx.Relationship2_1{
+			RefA:         imagePkg.PackageSPDXIdentifier,
+			RefB:         pkg.PackageSPDXIdentifier,
+			Relationship: "CONTAINS",
+		})
+		for j, fp := range filepaths {
+			if files[fp].layer == i {
+				rlns = append(rlns, &spdx.Relationship2_1{
+					RefA:         pkg.PackageSPDXIdentifier,
+					RefB:         fileSections[j].FileSPDXIdentifier,
+					Relationship: "CONTAINS",
+				})
+			}
+		}
+	}
+
+	return pkgs, rlns, nil
+}
+
+// ociDescriptor is an OCI content descriptor, as found in image indexes
+// and manifests.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+// ociManifest is an OCI image index or image manifest.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// dockerSaveManifest is an entry in the manifest.json of a "docker save"
+// archive.
+type dockerSaveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// imageConfig is the part of an image config that is used.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant"`
+	RootFS       struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// imageCandidate is an image found in an image layout or archive.
+type imageCandidate struct {
+	manifestDigest string
+	refNames       []string
+	platform       string
+	configPath     string
+	configDigest   string
+	layers         []imageLayer
+}
+
+// imageLayer is a layer of an image. Its digest is "" until the layer
+// has been read if it is not known in advance.
+type imageLayer struct {
+	path   string
+	digest string
+}
+
+// imageFile is a file in an image's filesystem.
+type imageFile struct {
+	hashes fileHashes
+	layer  int
+}
+
+const (
+	ociIndexMediaType        = "application/vnd.oci.image.index.v1+json"
+	dockerManifestListMedia  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociRefNameAnnotation     = "org.opencontainers.image.ref.name"
+	containerdNameAnnotation = "io.containerd.image.name"
+)
+
+// readImageCandidates lists the images in an OCI image layout, or, if
+// there is no index.json, in the manifest.json of a "docker save" archive.
+func readImageCandidates(fsys fs.FS) ([]*imageCandidate, error) {
+	data, err := fs.ReadFile(fsys, "index.json")
+	if err == nil {
+		var index ociManifest
+		if err = json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("index.json: %v", err)
+		}
+		images := []*imageCandidate{}
+		if err = readOCIManifests(fsys, index.Manifests, nil, &images, 0); err != nil {
+			return nil, err
+		}
+		return images, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err = fs.ReadFile(fsys, "manifest.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.New("no index.json or manifest.json found; not an OCI image layout or docker save archive")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []dockerSaveManifest
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("manifest.json: %v", err)
+	}
+	images := []*imageCandidate{}
+	for _, e := range entries {
+		img := &imageCandidate{refNames: e.RepoTags, configPath: path.Clean(e.Config)}
+		img.configDigest = digestFromBlobPath(img.configPath)
+		for _, l := range e.Layers {
+			lp := path.Clean(l)
+			img.layers = append(img.layers, imageLayer{path: lp, digest: digestFromBlobPath(lp)})
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// readOCIManifests adds the images that descriptors refer to, looking
+// inside nested image indexes. Reference names annotated on an index apply
+// to the images in it.
+func readOCIManifests(fsys fs.FS, descs []ociDescriptor, refNames []string, images *[]*imageCandidate, depth int) error {
+	if depth > 8 {
+		return errors.New("image indexes nested too deeply")
+	}
+	for _, desc := range descs {
+		// attestations, such as provenance, are stored as manifests for an
+		// unknown platform
+		if desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest" ||
+			(desc.Platform != nil && desc.Platform.OS == "unknown") {
+			continue
+		}
+		names := refNames
+		for _, key := range []string{containerdNameAnnotation, ociRefNameAnnotation} {
+			if name := desc.Annotations[key]; name != "" && !containsString(names, name) {
+				names = append(append([]string{}, names...), name)
+			}
+		}
+
+		blobPath, err := ociBlobPath(desc.Digest)
+		if err != nil {
+			return err
+		}
+		data, err := readImageBlob(fsys, blobPath, desc.Digest)
+		if err != nil {
+			return err
+		}
+		var m ociManifest
+		if err = json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("manifest %s: %v", desc.Digest, err)
+		}
+		if desc.MediaType == ociIndexMediaType || desc.MediaType == dockerManifestListMedia || len(m.Manifests) > 0 {
+			if err = readOCIManifests(fsys, m.Manifests, names, images, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		img := &imageCandidate{manifestDigest: desc.Digest, refNames: names, configDigest: m.Config.Digest}
+		if desc.Platform != nil {
+			img.platform = joinPlatform(desc.Platform.OS, desc.Platform.Architecture, desc.Platform.Variant)
+		}
+		if img.configPath, err = ociBlobPath(m.Config.Digest); err != nil {
+			return err
+		}
+		for _, l := range m.Layers {
+			lp, err := ociBlobPath(l.Digest)
+			if err != nil {
+				return err
+			}
+			img.layers = append(img.layers, imageLayer{path: lp, digest: l.Digest})
+		}
+		*images = append(*images, img)
+	}
+	return nil
+}
+
+// selectImage picks the image that ref refers to.
+func selectImage(images []*imageCandidate, ref string) (*imageCandidate, error) {
+	matches := []*imageCandidate{}
+	for _, img := range images {
+		if ref == "" || img.matches(ref) {
+			matches = append(matches, img)
+		}
+	}
+	switch {
+	case len(images) == 0:
+		return nil, errors.New("no images found")
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) == 0:
+		return nil, fmt.Errorf("no image matches %q; found %s", ref, describeImages(images))
+	default:
+		return nil, fmt.Errorf("%d images match %q; choose one of %s", len(matches), ref, describeImages(matches))
+	}
+}
+
+func describeImages(images []*imageCandidate) string {
+	descs := []string{}
+	for _, img := range images {
+		descs = append(descs, img.describe())
+	}
+	return strings.Join(descs, ", ")
+}
+
+// matches reports whether ref names this image.
+func (img *imageCandidate) matches(ref string) bool {
+	if ref == img.manifestDigest || ref == img.configDigest || ref == img.platform {
+		return true
+	}
+	for _, name := range img.refNames {
+		if ref == name || strings.HasSuffix(name, "/"+ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// refName returns the image's fullest reference name, if it has one.
+func (img *imageCandidate) refName() string {
+	best := ""
+	for _, name := range img.refNames {
+		if len(name) > len(best) {
+			best = name
+		}
+	}
+	return best
+}
+
+func (img *imageCandidate) describe() string {
+	parts := []string{}
+	if name := img.refName(); name != "" {
+		parts = append(parts, fmt.Sprintf("image %s", name))
+	}
+	if img.manifestDigest != "" {
+		parts = append(parts, fmt.Sprintf("manifest %s", img.manifestDigest))
+	}
+	if img.configDigest != "" {
+		parts = append(parts, fmt.Sprintf("config %s", img.configDigest))
+	}
+	if img.platform != "" {
+		parts = append(parts, fmt.Sprintf("platform %s", img.platform))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func joinPlatform(os string, arch string, variant string) string {
+	p := os + "/" + arch
+	if variant != "" {
+		p += "/" + variant
+	}
+	return p
+}
+
+// splitImageName splits an image reference name such as
+// "docker.io/library/alpine:3.19" into its repository and tag. An OCI
+// reference name that is only a tag, such as "3.19", has no repository.
+func splitImageName(name string) (string, string) {
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	i := strings.LastIndex(name, ":")
+	if i < 0 || strings.Contains(name[i:], "/") {
+		if strings.Contains(name, "/") {
+			return name, ""
+		}
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// ociBlobPath returns the path of a blob in an OCI image layout.
+func ociBlobPath(digest string) (string, error) {
+	alg, hex, ok := strings.Cut(digest, ":")
+	if !ok || alg == "" || hex == "" || strings.ContainsAny(digest, "/\\") || strings.Contains(digest, "..") {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return "blobs/" + alg + "/" + hex, nil
+}
+
+// digestFromBlobPath returns the digest of a blob at a path of the form
+// "blobs/<algorithm>/<hex>", which newer versions of docker save use, or ""
+// for other paths.
+func digestFromBlobPath(p string) string {
+	parts := strings.Split(p, "/")
+	if len(parts) != 3 || parts[0] != "blobs" {
+		return ""
+	}
+	return parts[1] + ":" + parts[2]
+}
+
+// newDigestHash returns a hash for checking a digest, or nil if the
+// digest's algorithm is not supported. An empty digest is computed with
+// SHA256.
+func newDigestHash(digest string) hash.Hash {
+	alg, _, _ := strings.Cut(digest, ":")
+	switch alg {
+	case "sha256", "":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+func digestString(digest string, h hash.Hash) string {
+	alg, _, _ := strings.Cut(digest, ":")
+	if alg == "" {
+		alg = "sha256"
+	}
+	return fmt.Sprintf("%s:%x", alg, h.Sum(nil))
+}
+
+// readImageBlob reads a JSON blob, checking it against its digest if the
+// digest is known.
+func readImageBlob(fsys fs.FS, p string, digest string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	if h := newDigestHash(digest); h != nil && digest != "" {
+		h.Write(data)
+		if got := digestString(digest, h); got != digest {
+			return nil, fmt.Errorf("%s has digest %s, expected %s", p, got, digest)
+		}
+	}
+	return data, nil
+}
+
+// applyImageLayer reads a layer's tar archive, which may be compressed,
+// and applies it to files. Whiteout entries remove the paths they name
+// from lower layers, and opaque whiteouts remove everything that lower
+// layers put in their directory. The layer's digest is checked, or filled
+// in if it was not known.
+func applyImageLayer(fsys fs.FS, layer *imageLayer, index int, files map[string]*imageFile, opts *PackageOptions2_1) error {
+	f, err := fsys.Open(layer.path)
+	if err != nil {
+		return fmt.Errorf("layer %d: %v", index+1, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	h := newDigestHash(layer.digest)
+	if h != nil {
+		r = io.TeeReader(f, h)
+	}
+	br := bufio.NewReader(r)
+	var tr io.Reader = br
+	magic, _ := br.Peek(6)
+	if format := detectCompression(magic); format != "" {
+		if tr, err = decompressReader(br, format, layer.path, opts); err != nil {
+			return fmt.Errorf("layer %d: %v", index+1, err)
+		}
+	}
+
+	if err = applyLayerEntries(tar.NewReader(tr), index, files, opts.FileClassifier); err != nil {
+		return fmt.Errorf("layer %d: %v", index+1, err)
+	}
+
+	// read the rest of the layer, so that all of it is digested and any
+	// trailing checksum in the compressed stream gets verified
+	if _, err = io.Copy(io.Discard, tr); err != nil {
+		return fmt.Errorf("layer %d: %v", index+1, err)
+	}
+	if _, err = io.Copy(io.Discard, br); err != nil {
+		return fmt.Errorf("layer %d: %v", index+1, err)
+	}
+	if h != nil {
+		got := digestString(layer.digest, h)
+		if layer.digest == "" {
+			layer.digest = got
+		} else if got != layer.digest {
+			return fmt.Errorf("layer %d has digest %s, expected %s", index+1, got, layer.digest)
+		}
+	}
+	return nil
+}
+
+// applyLayerEntries reads the entries of a layer's tar archive, then
+// applies them to the files from lower layers in a single pass.
+func applyLayerEntries(tr *tar.Reader, index int, files map[string]*imageFile, classifier *FileClassifier) error {
+	// removed holds the paths whose lower-layer contents are gone, along
+	// with anything beneath them; opaque holds directories whose
+	// lower-layer contents are gone; and replaced holds paths where only
+	// a lower-layer file is gone, because a directory took its place
+	added := map[string]*imageFile{}
+	removed := map[string]bool{}
+	opaque := map[string]bool{}
+	replaced := map[string]bool{}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fp := archivePath(hdr.Name)
+		if fp == "" {
+			continue
+		}
+		dir, base := path.Split(fp)
+
+		switch {
+		case base == ".wh..wh..opq":
+			opaque[path.Clean(dir)] = true
+			continue
+		case strings.HasPrefix(base, ".wh."):
+			removed[dir+strings.TrimPrefix(base, ".wh.")] = true
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			h, err := hashAndClassify(tr, fp, classifier)
+			if err != nil {
+				return err
+			}
+			removed[fp] = true
+			added[fp] = &imageFile{hashes: h, layer: index}
+		case tar.TypeLink:
+			removed[fp] = true
+			target := archivePath(hdr.Linkname)
+			if f, ok := added[target]; ok {
+				added[fp] = &imageFile{hashes: f.hashes, layer: index}
+			} else if f, ok := files[target]; ok {
+				added[fp] = &imageFile{hashes: f.hashes, layer: index}
+			} else {
+				delete(added, fp)
+			}
+		case tar.TypeDir:
+			// a directory replaces a file at the same path, but keeps the
+			// contents of a directory there
+			replaced[fp] = true
+		default:
+			// symbolic links and special files are not recorded, as for
+			// archives, but still replace what was there before
+			removed[fp] = true
+			delete(added, fp)
+		}
+	}
+
+	for fp := range files {
+		gone := removed[fp] || replaced[fp]
+		for dir := path.Dir(fp); !gone; dir = path.Dir(dir) {
+			gone = removed[dir] || opaque[dir]
+			if dir == "/" {
+				break
+			}
+		}
+		if gone {
+			delete(files, fp)
+		}
+	}
+	for fp, f := range added {
+		files[fp] = f
+	}
+	return nil
+}
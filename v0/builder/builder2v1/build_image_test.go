@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ===== Container image Package builder tests =====
+
+// testLayerEntry is an entry in a layer tar archive built for tests; an
+// empty body with a name ending in "/" is a directory, and a linkname
+// makes it a symbolic link.
+type testLayerEntry struct {
+	name     string
+	body     string
+	linkname string
+}
+
+func buildTestLayer(t *testing.T, entries []testLayerEntry, compress bool) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		case e.linkname != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.linkname
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !compress {
+		return buf.Bytes()
+	}
+	gz := &bytes.Buffer{}
+	zw := gzip.NewWriter(gz)
+	zw.Write(buf.Bytes())
+	zw.Close()
+	return gz.Bytes()
+}
+
+// addTestBlob stores data as a blob in an OCI image layout, returning its
+// digest.
+func addTestBlob(fsys fstest.MapFS, data []byte) string {
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	fsys["blobs/sha256/"+sum] = &fstest.MapFile{Data: data}
+	return "sha256:" + sum
+}
+
+func addTestJSONBlob(t *testing.T, fsys fstest.MapFS, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return addTestBlob(fsys, data)
+}
+
+// addTestImage stores an image manifest and config for layers in an OCI
+// image layout, returning the manifest's digest.
+func addTestImage(t *testing.T, fsys fstest.MapFS, arch string, layers ...[]byte) string {
+	layerDescs := []map[string]interface{}{}
+	diffIDs := []string{}
+	history := []map[string]interface{}{{"created_by": "ENV A=b", "empty_layer": true}}
+	for i, l := range layers {
+		layerDescs = append(layerDescs, map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"digest":    addTestBlob(fsys, l),
+			"size":      len(l),
+		})
+		diffIDs = append(diffIDs, fmt.Sprintf("sha256:%064d", i))
+		history = append(history, map[string]interface{}{"created_by": fmt.Sprintf("RUN step %d", i+1)})
+	}
+	config := addTestJSONBlob(t, fsys, map[string]interface{}{
+		"architecture": arch,
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+		"history":      history,
+	})
+	return addTestJSONBlob(t, fsys, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        map[string]interface{}{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": config},
+		"layers":        layerDescs,
+	})
+}
+
+func setTestIndex(t *testing.T, fsys fstest.MapFS, manifests ...map[string]interface{}) {
+	data, err := json.Marshal(map[string]interface{}{"schemaVersion": 2, "manifests": manifests})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	fsys["oci-layout"] = &fstest.MapFile{Data: []byte(`{"imageLayoutVersion":"1.0.0"}`)}
+	fsys["index.json"] = &fstest.MapFile{Data: data}
+}
+
+func testImageLayers(t *testing.T) ([]byte, []byte) {
+	base := buildTestLayer(t, []testLayerEntry{
+		{name: "etc/"},
+		{name: "etc/os-release", body: "ID=test\n"},
+		{name: "bin/sh", body: "shell"},
+		{name: "usr/share/doc/a/README", body: "a"},
+		{name: "usr/share/doc/a/COPYING", body: "a license"},
+		{name: "opt/data/old.txt", body: "old"},
+		{name: "lib", linkname: "usr/lib"},
+	}, true)
+	top := buildTestLayer(t, []testLayerEntry{
+		{name: "bin/.wh.sh"},
+		{name: "usr/share/doc/.wh..wh..opq"},
+		{name: "usr/share/doc/b/README", body: "b"},
+		{name: "etc/os-release", body: "ID=test\nVERSION_ID=2\n"},
+		{name: "opt/data", body: "now a file"},
+		{name: "app/main", body: "binary"},
+	}, false)
+	return base, top
+}
+
+func TestBuildImagePackagesAppliesLayersAndWhiteouts(t *testing.T) {
+	fsys := fstest.MapFS{}
+	base, top := testImageLayers(t)
+	manifest := addTestImage(t, fsys, "amd64", base, top)
+	setTestIndex(t, fsys, map[string]interface{}{
+		"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+		"digest":      manifest,
+		"annotations": map[string]string{"org.opencontainers.image.ref.name": "registry.example.com/team/app:1.2"},
+	})
+
+	pkgs, rlns, err := BuildImagePackages2_1("app", "app-oci", fsys, "", nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(pkgs))
+	}
+
+	img := pkgs[0]
+	if img.PackageSPDXIdentifier != "SPDXRef-Package-app" || img.PackageVersion != "1.2" || img.PackageFileName != "app-oci" {
+		t.Errorf("expected SPDXRef-Package-app version 1.2 from app-oci, got %v version %v from %v", img.PackageSPDXIdentifier, img.PackageVersion, img.PackageFileName)
+	}
+	wantPurl := "pkg:oci/app@" + strings.Replace(manifest, ":", "%3A", 1) + "?arch=amd64&repository_url=registry.example.com%2Fteam%2Fapp&tag=1.2"
+	if len(img.PackageExternalReferences) != 1 || img.PackageExternalReferences[0].Locator != wantPurl {
+		t.Errorf("expected purl %v, got %+v", wantPurl, img.PackageExternalReferences)
+	}
+	if !strings.Contains(img.PackageComment, "platform linux/amd64") {
+		t.Errorf("expected platform in comment, got %v", img.PackageComment)
+	}
+
+	wantFiles := []string{"/app/main", "/etc/os-release", "/opt/data", "/usr/share/doc/b/README"}
+	if len(img.Files) != len(wantFiles) {
+		t.Fatalf("expected %d, got %d", len(wantFiles), len(img.Files))
+	}
+	for i, f := range img.Files {
+		if f.FileName != wantFiles[i] {
+			t.Errorf("expected %v, got %v", wantFiles[i], f.FileName)
+		}
+		if f.FileComment != "from image layer "+pkgs[2].PackageName {
+			t.Errorf("expected %v, got %v", "from image layer "+pkgs[2].PackageName, f.FileComment)
+		}
+	}
+	if img.Files[1].FileType[0] != FileTypeOther {
+		t.Errorf("expected %v, got %v", FileTypeOther, img.Files[1].FileType)
+	}
+	if img.PackageVerificationCode == "" {
+		t.Errorf("expected a verification code, got none")
+	}
+
+	baseLayer := pkgs[1]
+	wantDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(base))
+	if baseLayer.PackageName != wantDigest || baseLayer.PackageChecksumSHA256 != wantDigest[7:] {
+		t.Errorf("expected layer %v, got %v with checksum %v", wantDigest, baseLayer.PackageName, baseLayer.PackageChecksumSHA256)
+	}
+	if baseLayer.PackageSPDXIdentifier != "SPDXRef-Package-layer-sha256-"+wantDigest[7:] {
+		t.Errorf("expected %v, got %v", "SPDXRef-Package-layer-sha256-"+wantDigest[7:], baseLayer.PackageSPDXIdentifier)
+	}
+	wantComment := fmt.Sprintf("layer 1 of 2; diff ID sha256:%064d; created by: RUN step 1", 0)
+	if baseLayer.PackageComment != wantComment {
+		t.Errorf("expected %v, got %v", wantComment, baseLayer.PackageComment)
+	}
+
+	// image CONTAINS base; image CONTAINS top; top CONTAINS each file
+	if len(rlns) != 6 {
+		t.Fatalf("expected %d, got %d", 6, len(rlns))
+	}
+	if rlns[0].RefB != baseLayer.PackageSPDXIdentifier || rlns[1].RefB != pkgs[2].PackageSPDXIdentifier {
+		t.Errorf("expected image to contain layers, got %+v and %+v", rlns[0], rlns[1])
+	}
+	if rlns[2].RefA != pkgs[2].PackageSPDXIdentifier || rlns[2].RefB != img.Files[0].FileSPDXIdentifier || rlns[2].Relationship != "CONTAINS" {
+		t.Errorf("expected %v CONTAINS %v, got %+v", pkgs[2].PackageSPDXIdentifier, img.Files[0].FileSPDXIdentifier, rlns[2])
+	}
+}
+
+func TestBuildImagePackagesChecksLayerDigests(t *testing.T) {
+	fsys := fstest.MapFS{}
+	_, top := testImageLayers(t)
+	manifest := addTestImage(t, fsys, "amd64", top)
+	setTestIndex(t, fsys, map[string]interface{}{"digest": manifest})
+
+	// corrupt a file's contents within the layer blob
+	digest := fmt.Sprintf("%x", sha256.Sum256(top))
+	corrupt := bytes.Replace(top, []byte("binary"), []byte("BINARY"), 1)
+	fsys["blobs/sha256/"+digest] = &fstest.MapFile{Data: corrupt}
+
+	_, _, err := BuildImagePackages2_1("app", "app-oci", fsys, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "has digest") {
+		t.Errorf("expected digest mismatch error, got %v", err)
+	}
+}
+
+func TestBuildImagePackagesSelectsFromIndex(t *testing.T) {
+	fsys := fstest.MapFS{}
+	base, top := testImageLayers(t)
+	amd64 := addTestImage(t, fsys, "amd64", base)
+	arm64 := addTestImage(t, fsys, "arm64", base, top)
+	attestation := addTestJSONBlob(t, fsys, map[string]interface{}{"schemaVersion": 2})
+	list := addTestJSONBlob(t, fsys, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests": []map[string]interface{}{
+			{"digest": amd64, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			{"digest": arm64, "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+			{"digest": attestation, "platform": map[string]string{"os": "unknown", "architecture": "unknown"}},
+		},
+	})
+	setTestIndex(t, fsys, map[string]interface{}{
+		"mediaType":   "application/vnd.oci.image.index.v1+json",
+		"digest":      list,
+		"annotations": map[string]string{"io.containerd.image.name": "docker.io/library/app:latest"},
+	})
+
+	_, _, err := BuildImagePackages2_1("app", "app-oci", fsys, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "platform linux/arm64") {
+		t.Errorf("expected error listing images, got %v", err)
+	}
+
+	pkgs, _, err := BuildImagePackages2_1("app", "app-oci", fsys, "linux/arm64", nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 3 {
+		t.Errorf("expected %d, got %d", 3, len(pkgs))
+	}
+
+	pkgs, _, err = BuildImagePackages2_1("app", "app-oci", fsys, amd64, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 2 || pkgs[0].PackageVersion != "latest" {
+		t.Errorf("expected 2 packages with version latest, got %d with version %v", len(pkgs), pkgs[0].PackageVersion)
+	}
+
+	if _, _, err = BuildImagePackages2_1("app", "app-oci", fsys, "library/app:latest", nil); err == nil {
+		t.Errorf("expected non-nil error for ambiguous name, got nil")
+	}
+	if _, _, err = BuildImagePackages2_1("app", "app-oci", fsys, "linux/s390x", nil); err == nil {
+		t.Errorf("expected non-nil error for unknown platform, got nil")
+	}
+}
+
+func TestBuildImagePackagesReadsDockerSaveLayout(t *testing.T) {
+	base, top := testImageLayers(t)
+	config := []byte(`{"architecture":"arm64","os":"linux","rootfs":{"diff_ids":[]}}`)
+	fsys := fstest.MapFS{
+		"manifest.json": {Data: []byte(`[{"Config":"cafe.json","RepoTags":["app:dev"],"Layers":["l1/layer.tar","l2/layer.tar"]}]`)},
+		"cafe.json":     {Data: config},
+		"l1/layer.tar":  {Data: base},
+		"l2/layer.tar":  {Data: top},
+	}
+
+	pkgs, _, err := BuildImagePackages2_1("app", "app.tar", fsys, "app:dev", &PackageOptions2_1{PathsIgnored: []string{"/app/"}})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(pkgs))
+	}
+	if pkgs[0].PackageVersion != "dev" || len(pkgs[0].PackageExternalReferences) != 0 {
+		t.Errorf("expected version dev and no purl, got %v and %+v", pkgs[0].PackageVersion, pkgs[0].PackageExternalReferences)
+	}
+	wantComment := fmt.Sprintf("image app:dev; config sha256:%x; platform linux/arm64", sha256.Sum256(config))
+	if pkgs[0].PackageComment != wantComment {
+		t.Errorf("expected %v, got %v", wantComment, pkgs[0].PackageComment)
+	}
+	if len(pkgs[0].Files) != 3 {
+		t.Errorf("expected %d, got %d", 3, len(pkgs[0].Files))
+	}
+	if pkgs[2].PackageName != fmt.Sprintf("sha256:%x", sha256.Sum256(top)) || pkgs[2].PackageFileName != "l2/layer.tar" {
+		t.Errorf("expected layer digest and path, got %v and %v", pkgs[2].PackageName, pkgs[2].PackageFileName)
+	}
+}
+
+func TestBuildImagePackagesFailsWithoutManifest(t *testing.T) {
+	fsys := fstest.MapFS{"etc/passwd": {Data: []byte("root:x:0:0\n")}}
+	if _, _, err := BuildImagePackages2_1("app", "app", fsys, "", nil); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestSplitImageName(t *testing.T) {
+	for _, tc := range []struct{ name, repository, tag string }{
+		{"docker.io/library/alpine:3.19", "docker.io/library/alpine", "3.19"},
+		{"localhost:5000/app", "localhost:5000/app", ""},
+		{"localhost:5000/app:v1@sha256:abc", "localhost:5000/app", "v1"},
+		{"latest", "", "latest"},
+		{"", "", ""},
+	} {
+		repository, tag := splitImageName(tc.name)
+		if repository != tc.repository || tag != tc.tag {
+			t.Errorf("expected %v and %v, got %v and %v", tc.repository, tc.tag, repository, tag)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// mavenRepository is where BuildMavenPackages2_1 looks for the POMs of
+// dependencies and of parents that are not part of the project, relative
+// to the root of the analyzed directory.
+const mavenRepository = ".m2/repository"
+
+// BuildMavenPackages2_1 creates SPDX Packages (version 2.1) for the Maven
+// artifacts that the JVM project at the root of fsys depends on, along
+// with "DEPENDS_ON" Relationships from the root Package to each of them.
+// The direct dependencies of the project (and of any modules it lists) are
+// read from pom.xml, with versions filled in from dependencyManagement,
+// properties and parent POMs found locally. The resolved dependencies in
+// gradle.lockfile are added as well. Each Relationship's comment gives the
+// dependency's scope, so that runtime dependencies can be told apart from
+// test-only ones. Licenses are taken from the POMs: the project's own, and
+// those of dependencies whose POMs are in a local repository at
+// .m2/repository. If pom.xml declares coordinates and licenses, they are
+// added to rootPkg as a "purl" external reference, version and declared
+// license. Arguments:
+//   - fsys: file system containing the project
+//   - rootPkg: the project's Package, as built from its files
+func BuildMavenPackages2_1(fsys fs.FS, rootPkg *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	r := &mavenResolver{fsys: fsys, repoPOMs: map[string]*mavenPOM{}}
+	found := &mavenArtifacts{byKey: map[string]*mavenArtifact{}}
+
+	root, err := r.loadLocal("pom.xml", 0)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	if root != nil {
+		if root.artifactID != "" {
+			rootPkg.PackageExternalReferences = append(rootPkg.PackageExternalReferences, &spdx.PackageExternalReference2_1{
+				Category: "PACKAGE-MANAGER",
+				RefType:  "purl",
+				Locator:  mavenPurl(root.groupID, root.artifactID, root.version),
+			})
+		}
+		if rootPkg.PackageVersion == "" {
+			rootPkg.PackageVersion = root.version
+		}
+		if license, _ := mavenLicense(root.licenses); license != "" && rootPkg.PackageLicenseDeclared == "NOASSERTION" {
+			rootPkg.PackageLicenseDeclared = license
+		}
+
+		poms, err := r.modules(root, "pom.xml", map[string]bool{})
+		if err != nil {
+			return nil, nil, err
+		}
+		internal := map[string]bool{}
+		for _, pom := range poms {
+			internal[pom.groupID+":"+pom.artifactID] = true
+		}
+		for _, pom := range poms {
+			for _, dep := range pom.dependencies() {
+				if !internal[dep.groupID+":"+dep.artifactID] {
+					found.add(dep)
+				}
+			}
+		}
+	}
+
+	data, err := fs.ReadFile(fsys, "gradle.lockfile")
+	if err == nil {
+		deps, err := parseGradleLockfile(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gradle.lockfile: %v", err)
+		}
+		for _, dep := range deps {
+			found.add(dep)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	ids := packageIDs{}
+	pkgs := []*spdx.Package2_1{}
+	rlns := []*spdx.Relationship2_1{}
+	for _, a := range found.all {
+		name := a.groupID + ":" + a.artifactID
+		purl := ""
+		if a.version != "" {
+			purl = mavenPurl(a.groupID, a.artifactID, a.version)
+		}
+		pkg := newDependencyPackage2_1(ids.next("maven", name, a.version), name, a.version, purl)
+		pkg.PackageComment = strings.Join(a.comments, "\n")
+
+		if repoPOM := r.loadRepo(a.groupID, a.artifactID, a.version, 0); repoPOM != nil {
+			license, comments := mavenLicense(repoPOM.licenses)
+			if license != "" {
+				pkg.PackageLicenseDeclared = license
+			}
+			pkg.PackageLicenseComments = strings.Join(comments, "\n")
+		}
+
+		pkgs = append(pkgs, pkg)
+		rlns = append(rlns, dependsOn(rootPkg.PackageSPDXIdentifier, pkg.PackageSPDXIdentifier, a.scope+" scope"))
+	}
+
+	return pkgs, rlns, nil
+}
+
+// mavenArtifact is a single dependency of the project.
+type mavenArtifact struct {
+	groupID    string
+	artifactID string
+	version    string
+	// scope is a Maven scope ("compile", "runtime", "provided", "test" or
+	// "system")
+	scope    string
+	comments []string
+}
+
+// mavenArtifacts collects the dependencies found so far, merging the
+// entries for the same version of an artifact.
+type mavenArtifacts struct {
+	all   []*mavenArtifact
+	byKey map[string]*mavenArtifact
+}
+
+// mavenScopeRank orders scopes from the widest to the narrowest, so that
+// an artifact needed in several scopes is reported with the widest one.
+var mavenScopeRank = map[string]int{"compile": 0, "runtime": 1, "provided": 2, "system": 3, "test": 4}
+
+func (ma *mavenArtifacts) add(a *mavenArtifact) {
+	key := a.groupID + ":" + a.artifactID + ":" + a.version
+	prev, ok := ma.byKey[key]
+	if !ok {
+		ma.byKey[key] = a
+		ma.all = append(ma.all, a)
+		return
+	}
+	if mavenScopeRank[a.scope] < mavenScopeRank[prev.scope] {
+		prev.scope = a.scope
+	}
+	for _, c := range a.comments {
+		if !containsString(prev.comments, c) {
+			prev.comments = append(prev.comments, c)
+		}
+	}
+}
+
+// pomFile holds the parts of a pom.xml file that are used here.
+type pomFile struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Parent     struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+		// RelativePath is nil if the element is missing, and points to
+		// "" if it is present but empty, which disables the lookup
+		RelativePath *string `xml:"relativePath"`
+	} `xml:"parent"`
+	Properties          pomProperties   `xml:"properties"`
+	ManagedDependencies []pomDependency `xml:"dependencyManagement>dependencies>dependency"`
+	Dependencies        []pomDependency `xml:"dependencies>dependency"`
+	Licenses            []pomLicense    `xml:"licenses>license"`
+	Modules             []string        `xml:"modules>module"`
+}
+
+type pomDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Type       string `xml:"type"`
+	Classifier string `xml:"classifier"`
+	Scope      string `xml:"scope"`
+	Optional   string `xml:"optional"`
+}
+
+type pomLicense struct {
+	Name string `xml:"name"`
+	URL  string `xml:"url"`
+}
+
+// pomProperties collects the arbitrarily-named child elements of a POM's
+// properties element.
+type pomProperties map[string]string
+
+func (p *pomProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = pomProperties{}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			(*p)[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// mavenPOM is a POM combined with everything it inherits from its parents.
+type mavenPOM struct {
+	groupID    string
+	artifactID string
+	version    string
+	// props holds the POM's properties, including the built-in
+	// "project.*" ones
+	props    map[string]string
+	managed  []pomDependency
+	deps     []pomDependency
+	licenses []pomLicense
+	modules  []string
+}
+
+// mavenResolver loads POMs from the project and from the local repository.
+type mavenResolver struct {
+	fsys     fs.FS
+	repoPOMs map[string]*mavenPOM
+}
+
+// maxPOMDepth limits the length of parent and import chains, which guards
+// against cycles.
+const maxPOMDepth = 20
+
+// loadLocal loads the POM at the given path within the project, along with
+// its parents.
+func (r *mavenResolver) loadLocal(pomPath string, depth int) (*mavenPOM, error) {
+	data, err := fs.ReadFile(r.fsys, pomPath)
+	if err != nil {
+		return nil, err
+	}
+	pf := &pomFile{}
+	if err := xml.Unmarshal(data, pf); err != nil {
+		return nil, fmt.Errorf("%s: %v", pomPath, err)
+	}
+
+	var parent *mavenPOM
+	if pf.Parent.ArtifactID != "" && depth < maxPOMDepth {
+		rel := "../pom.xml"
+		if pf.Parent.RelativePath != nil {
+			rel = strings.TrimSpace(*pf.Parent.RelativePath)
+		}
+		if rel != "" {
+			parentPath := path.Join(path.Dir(pomPath), rel)
+			if !strings.HasSuffix(parentPath, ".xml") {
+				parentPath = path.Join(parentPath, "pom.xml")
+			}
+			if fs.ValidPath(parentPath) {
+				p, err := r.loadLocal(parentPath, depth+1)
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return nil, err
+				}
+				// the file at relativePath must be the declared parent
+				if p != nil && p.groupID == pf.Parent.GroupID && p.artifactID == pf.Parent.ArtifactID {
+					parent = p
+				}
+			}
+		}
+		if parent == nil {
+			parent = r.loadRepo(pf.Parent.GroupID, pf.Parent.ArtifactID, pf.Parent.Version, depth+1)
+		}
+	}
+
+	return r.combine(pf, parent, depth), nil
+}
+
+// loadRepo loads the POM of an artifact from the local repository, along
+// with its parents, returning nil if it is not there or cannot be read.
+func (r *mavenResolver) loadRepo(groupID string, artifactID string, version string, depth int) *mavenPOM {
+	if groupID == "" || artifactID == "" || version == "" || depth > maxPOMDepth {
+		return nil
+	}
+	key := groupID + ":" + artifactID + ":" + version
+	if pom, ok := r.repoPOMs[key]; ok {
+		return pom
+	}
+	r.repoPOMs[key] = nil
+
+	pomPath := path.Join(mavenRepository, strings.ReplaceAll(groupID, ".", "/"), artifactID, version, artifactID+"-"+version+".pom")
+	if !fs.ValidPath(pomPath) {
+		return nil
+	}
+	data, err := fs.ReadFile(r.fsys, pomPath)
+	if err != nil {
+		return nil
+	}
+	pf := &pomFile{}
+	if err := xml.Unmarshal(data, pf); err != nil {
+		return nil
+	}
+	var parent *mavenPOM
+	if pf.Parent.ArtifactID != "" {
+		parent = r.loadRepo(pf.Parent.GroupID, pf.Parent.ArtifactID, pf.Parent.Version, depth+1)
+	}
+
+	pom := r.combine(pf, parent, depth)
+	r.repoPOMs[key] = pom
+	return pom
+}
+
+// combine builds the effective POM for a POM file and its parent, which
+// may be nil.
+func (r *mavenResolver) combine(pf *pomFile, parent *mavenPOM, depth int) *mavenPOM {
+	pom := &mavenPOM{
+		groupID:    strings.TrimSpace(pf.GroupID),
+		artifactID: strings.TrimSpace(pf.ArtifactID),
+		version:    strings.TrimSpace(pf.Version),
+		props:      map[string]string{},
+		deps:       pf.Dependencies,
+		licenses:   pf.Licenses,
+		modules:    pf.Modules,
+	}
+	if pom.groupID == "" {
+		pom.groupID = strings.TrimSpace(pf.Parent.GroupID)
+	}
+	if pom.version == "" {
+		pom.version = strings.TrimSpace(pf.Parent.Version)
+	}
+
+	if parent != nil {
+		for k, v := range parent.props {
+			pom.props[k] = v
+		}
+		pom.managed = append(pom.managed, parent.managed...)
+		pom.deps = append(append([]pomDependency{}, parent.deps...), pom.deps...)
+		if len(pom.licenses) == 0 {
+			pom.licenses = parent.licenses
+		}
+	}
+	for k, v := range pf.Properties {
+		pom.props[k] = v
+	}
+	pom.props["project.groupId"] = pom.groupID
+	pom.props["project.artifactId"] = pom.artifactID
+	pom.props["project.version"] = pom.version
+	pom.props["pom.groupId"] = pom.groupID
+	pom.props["pom.version"] = pom.version
+	pom.props["version"] = pom.version
+	pom.props["project.parent.groupId"] = strings.TrimSpace(pf.Parent.GroupID)
+	pom.props["project.parent.version"] = strings.TrimSpace(pf.Parent.Version)
+	pom.groupID = pom.interpolate(pom.groupID)
+	pom.version = pom.interpolate(pom.version)
+
+	// entries in the POM's own dependencyManagement take precedence over
+	// inherited ones, and BOMs it imports are expanded in place
+	own := []pomDependency{}
+	for _, m := range pf.ManagedDependencies {
+		if strings.TrimSpace(m.Scope) == "import" {
+			bom := r.loadRepo(pom.interpolate(m.GroupID), pom.interpolate(m.ArtifactID), pom.interpolate(m.Version), depth+1)
+			if bom != nil {
+				own = append(own, bom.resolvedManaged()...)
+			}
+			continue
+		}
+		own = append(own, m)
+	}
+	pom.managed = append(own, pom.managed...)
+
+	return pom
+}
+
+// interpolate replaces "${name}" references to properties in s.
+func (pom *mavenPOM) interpolate(s string) string {
+	s = strings.TrimSpace(s)
+	for i := 0; i < 10 && strings.Contains(s, "${"); i++ {
+		start := strings.Index(s, "${")
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			break
+		}
+		value, ok := pom.props[s[start+2:start+end]]
+		if !ok {
+			break
+		}
+		s = s[:start] + value + s[start+end+1:]
+	}
+	return s
+}
+
+// resolvedManaged returns the POM's managed dependencies with their
+// properties interpolated, for importing into another POM.
+func (pom *mavenPOM) resolvedManaged() []pomDependency {
+	deps := []pomDependency{}
+	for _, m := range pom.managed {
+		m.GroupID = pom.interpolate(m.GroupID)
+		m.ArtifactID = pom.interpolate(m.ArtifactID)
+		m.Version = pom.interpolate(m.Version)
+		m.Scope = pom.interpolate(m.Scope)
+		deps = append(deps, m)
+	}
+	return deps
+}
+
+// dependencies returns the POM's dependencies, with versions and scopes
+// filled in from dependencyManagement where they are not given.
+func (pom *mavenPOM) dependencies() []*mavenArtifact {
+	arts := []*mavenArtifact{}
+	for _, d := range pom.deps {
+		a := &mavenArtifact{
+			groupID:    pom.interpolate(d.GroupID),
+			artifactID: pom.interpolate(d.ArtifactID),
+			version:    pom.interpolate(d.Version),
+			scope:      pom.interpolate(d.Scope),
+		}
+		for _, m := range pom.managed {
+			if pom.interpolate(m.GroupID) != a.groupID || pom.interpolate(m.ArtifactID) != a.artifactID {
+				continue
+			}
+			if a.version == "" {
+				a.version = pom.interpolate(m.Version)
+			}
+			if a.scope == "" {
+				a.scope = pom.interpolate(m.Scope)
+			}
+			break
+		}
+		if a.scope == "" {
+			a.scope = "compile"
+		}
+		if strings.Contains(a.version, "${") {
+			a.comments = append(a.comments, fmt.Sprintf("unresolved version %s", a.version))
+			a.version = ""
+		} else if a.version == "" {
+			a.comments = append(a.comments, "version not found in POMs")
+		}
+		if classifier := pom.interpolate(d.Classifier); classifier != "" {
+			a.comments = append(a.comments, fmt.Sprintf("classifier: %s", classifier))
+		}
+		if pom.interpolate(d.Optional) == "true" {
+			a.comments = append(a.comments, "optional dependency")
+		}
+		arts = append(arts, a)
+	}
+	return arts
+}
+
+// modules returns the project's POM and those of all the modules it lists,
+// recursively. visited guards against cycles.
+func (r *mavenResolver) modules(pom *mavenPOM, pomPath string, visited map[string]bool) ([]*mavenPOM, error) {
+	visited[pomPath] = true
+	poms := []*mavenPOM{pom}
+	for _, m := range pom.modules {
+		modPath := path.Join(path.Dir(pomPath), strings.TrimSpace(m))
+		if !strings.HasSuffix(modPath, ".xml") {
+			modPath = path.Join(modPath, "pom.xml")
+		}
+		if visited[modPath] || !fs.ValidPath(modPath) {
+			continue
+		}
+		mod, err := r.loadLocal(modPath, 0)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sub, err := r.modules(mod, modPath, visited)
+		if err != nil {
+			return nil, err
+		}
+		poms = append(poms, sub...)
+	}
+	return poms, nil
+}
+
+// parseGradleLockfile returns the dependencies in a gradle.lockfile. A
+// dependency that is only in test configurations gets the "test" scope,
+// one that is only in compile configurations the "provided" scope, and
+// any other the "runtime" scope.
+func parseGradleLockfile(data []byte) ([]*mavenArtifact, error) {
+	arts := []*mavenArtifact{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "empty=") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		coords := strings.Split(line[:i], ":")
+		if len(coords) != 3 {
+			return nil, fmt.Errorf("invalid coordinates %q", line[:i])
+		}
+
+		scope := "test"
+		for _, conf := range strings.Split(line[i+1:], ",") {
+			lower := strings.ToLower(conf)
+			switch {
+			case strings.HasPrefix(lower, "test"):
+			case strings.Contains(lower, "runtimeclasspath"):
+				scope = "runtime"
+			case scope == "test":
+				scope = "provided"
+			}
+		}
+		arts = append(arts, &mavenArtifact{groupID: coords[0], artifactID: coords[1], version: coords[2], scope: scope})
+	}
+	sort.SliceStable(arts, func(i, j int) bool {
+		return arts[i].groupID+":"+arts[i].artifactID < arts[j].groupID+":"+arts[j].artifactID
+	})
+	return arts, nil
+}
+
+// mavenPurl returns the package URL for a Maven artifact.
+func mavenPurl(groupID string, artifactID string, version string) string {
+	return buildPurl("maven", groupID, artifactID, version)
+}
+
+// mavenLicenseNames maps the license names and URLs commonly found in POMs
+// to SPDX license identifiers.
+var mavenLicenseNames = map[string]string{
+	"apache license, version 2.0": "Apache-2.0",
+	"apache license 2.0":          "Apache-2.0",
+	"apache 2.0":                  "Apache-2.0",
+	"apache-2.0":                  "Apache-2.0",
+	"the apache software license, version 2.0":        "Apache-2.0",
+	"the apache license, version 2.0":                 "Apache-2.0",
+	"https://www.apache.org/licenses/license-2.0":     "Apache-2.0",
+	"http://www.apache.org/licenses/license-2.0":      "Apache-2.0",
+	"https://www.apache.org/licenses/license-2.0.txt": "Apache-2.0",
+	"http://www.apache.org/licenses/license-2.0.txt":  "Apache-2.0",
+	"mit license":                         "MIT",
+	"the mit license":                     "MIT",
+	"mit":                                 "MIT",
+	"https://opensource.org/licenses/mit": "MIT",
+	"http://www.opensource.org/licenses/mit-license.php": "MIT",
+	"bsd-2-clause":                                   "BSD-2-Clause",
+	"bsd-3-clause":                                   "BSD-3-Clause",
+	"eclipse public license - v 1.0":                 "EPL-1.0",
+	"eclipse public license 1.0":                     "EPL-1.0",
+	"eclipse public license - v 2.0":                 "EPL-2.0",
+	"eclipse public license v2.0":                    "EPL-2.0",
+	"epl-2.0":                                        "EPL-2.0",
+	"https://www.eclipse.org/legal/epl-2.0/":         "EPL-2.0",
+	"mozilla public license version 2.0":             "MPL-2.0",
+	"mpl 2.0":                                        "MPL-2.0",
+	"gnu lesser general public license, version 2.1": "LGPL-2.1-only",
+	"lgpl-2.1":                                       "LGPL-2.1-only",
+	"cddl + gplv2 with classpath exception":          "CDDL-1.1 OR GPL-2.0-only WITH Classpath-exception-2.0",
+	"gpl2 w/ cpe":                                    "GPL-2.0-only WITH Classpath-exception-2.0",
+	"cc0":                                            "CC0-1.0",
+	"public domain, per creative commons cc0":        "CC0-1.0",
+	"eclipse distribution license - v 1.0":           "BSD-3-Clause",
+	"edl 1.0":                                        "BSD-3-Clause",
+}
+
+// mavenLicense returns the declared license for the licenses listed in a
+// POM, treating several licenses as alternatives. If any of them cannot be
+// identified, no license is returned, and comments list them all instead.
+func mavenLicense(licenses []pomLicense) (string, []string) {
+	ids := []string{}
+	comments := []string{}
+	identified := true
+	for _, l := range licenses {
+		name := strings.TrimSpace(l.Name)
+		url := strings.TrimSpace(l.URL)
+		if url != "" {
+			comments = append(comments, fmt.Sprintf("POM license: %s (%s)", name, url))
+		} else {
+			comments = append(comments, fmt.Sprintf("POM license: %s", name))
+		}
+
+		id, ok := mavenLicenseNames[strings.ToLower(name)]
+		if !ok {
+			id, ok = mavenLicenseNames[strings.ToLower(strings.TrimSuffix(url, "/"))]
+		}
+		if !ok {
+			identified = false
+			continue
+		}
+		if !containsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	switch {
+	case !identified:
+		return "", comments
+	case len(ids) == 0:
+		return "", nil
+	case len(ids) == 1:
+		return ids[0], nil
+	}
+	for i, id := range ids {
+		if strings.Contains(id, " ") {
+			ids[i] = "(" + id + ")"
+		}
+	}
+	return "(" + strings.Join(ids, " OR ") + ")", nil
+}
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Maven Package builder tests =====
+const testParentPOM = `<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <modelVersion>4.0.0</modelVersion>
+  <groupId>com.example</groupId>
+  <artifactId>parent</artifactId>
+  <version>2.0.0</version>
+  <packaging>pom</packaging>
+  <properties>
+    <guava.version>32.1.2-jre</guava.version>
+  </properties>
+  <licenses>
+    <license>
+      <name>The Apache Software License, Version 2.0</name>
+      <url>https://www.apache.org/licenses/LICENSE-2.0.txt</url>
+    </license>
+  </licenses>
+  <modules>
+    <module>app</module>
+    <module>lib</module>
+  </modules>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>com.google.guava</groupId>
+        <artifactId>guava</artifactId>
+        <version>${guava.version}</version>
+      </dependency>
+      <dependency>
+        <groupId>junit</groupId>
+        <artifactId>junit</artifactId>
+        <version>4.13.2</version>
+        <scope>test</scope>
+      </dependency>
+      <dependency>
+        <groupId>com.example.bom</groupId>
+        <artifactId>bom</artifactId>
+        <version>1.0</version>
+        <type>pom</type>
+        <scope>import</scope>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>`
+
+const testAppPOM = `<project>
+  <parent>
+    <groupId>com.example</groupId>
+    <artifactId>parent</artifactId>
+    <version>2.0.0</version>
+  </parent>
+  <artifactId>app</artifactId>
+  <dependencies>
+    <dependency>
+      <groupId>${project.groupId}</groupId>
+      <artifactId>lib</artifactId>
+      <version>${project.version}</version>
+    </dependency>
+    <dependency>
+      <groupId>com.google.guava</groupId>
+      <artifactId>guava</artifactId>
+    </dependency>
+    <dependency>
+      <groupId>junit</groupId>
+      <artifactId>junit</artifactId>
+    </dependency>
+    <dependency>
+      <groupId>org.slf4j</groupId>
+      <artifactId>slf4j-api</artifactId>
+      <scope>runtime</scope>
+    </dependency>
+    <dependency>
+      <groupId>org.unknown</groupId>
+      <artifactId>mystery</artifactId>
+      <version>${undefined.version}</version>
+      <optional>true</optional>
+    </dependency>
+  </dependencies>
+</project>`
+
+const testLibPOM = `<project>
+  <parent>
+    <groupId>com.example</groupId>
+    <artifactId>parent</artifactId>
+    <version>2.0.0</version>
+  </parent>
+  <artifactId>lib</artifactId>
+  <dependencies>
+    <dependency>
+      <groupId>com.google.guava</groupId>
+      <artifactId>guava</artifactId>
+      <scope>provided</scope>
+    </dependency>
+  </dependencies>
+</project>`
+
+const testBOMPOM = `<project>
+  <groupId>com.example.bom</groupId>
+  <artifactId>bom</artifactId>
+  <version>1.0</version>
+  <properties><slf4j.version>2.0.9</slf4j.version></properties>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>org.slf4j</groupId>
+        <artifactId>slf4j-api</artifactId>
+        <version>${slf4j.version}</version>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>`
+
+const testGuavaPOM = `<project>
+  <parent>
+    <groupId>com.google.guava</groupId>
+    <artifactId>guava-parent</artifactId>
+    <version>32.1.2-jre</version>
+  </parent>
+  <artifactId>guava</artifactId>
+</project>`
+
+const testGuavaParentPOM = `<project>
+  <groupId>com.google.guava</groupId>
+  <artifactId>guava-parent</artifactId>
+  <version>32.1.2-jre</version>
+  <licenses>
+    <license><name>Apache License, Version 2.0</name></license>
+  </licenses>
+</project>`
+
+func TestBuildMavenPackagesReadsPOMs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pom.xml":     {Data: []byte(testParentPOM)},
+		"app/pom.xml": {Data: []byte(testAppPOM)},
+		"lib/pom.xml": {Data: []byte(testLibPOM)},
+		".m2/repository/com/example/bom/bom/1.0/bom-1.0.pom":                                  {Data: []byte(testBOMPOM)},
+		".m2/repository/com/google/guava/guava/32.1.2-jre/guava-32.1.2-jre.pom":               {Data: []byte(testGuavaPOM)},
+		".m2/repository/com/google/guava/guava-parent/32.1.2-jre/guava-parent-32.1.2-jre.pom": {Data: []byte(testGuavaParentPOM)},
+	}
+	rootPkg := &spdx.Package2_1{
+		PackageSPDXIdentifier:  "SPDXRef-Package-parent",
+		PackageLicenseDeclared: "NOASSERTION",
+	}
+
+	pkgs, rlns, err := BuildMavenPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if rootPkg.PackageVersion != "2.0.0" {
+		t.Errorf("expected %v, got %v", "2.0.0", rootPkg.PackageVersion)
+	}
+	if rootPkg.PackageLicenseDeclared != "Apache-2.0" {
+		t.Errorf("expected %v, got %v", "Apache-2.0", rootPkg.PackageLicenseDeclared)
+	}
+	if len(rootPkg.PackageExternalReferences) != 1 || rootPkg.PackageExternalReferences[0].Locator != "pkg:maven/com.example/parent@2.0.0" {
+		t.Errorf("expected root purl, got %+v", rootPkg.PackageExternalReferences)
+	}
+
+	// the dependency of app on lib is internal to the project
+	if len(pkgs) != 4 || len(rlns) != 4 {
+		t.Fatalf("expected 4 packages and relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+	for i, want := range []struct {
+		name, version, purl, license, comment, rlnComment string
+	}{
+		{"com.google.guava:guava", "32.1.2-jre", "pkg:maven/com.google.guava/guava@32.1.2-jre", "Apache-2.0", "", "compile scope"},
+		{"junit:junit", "4.13.2", "pkg:maven/junit/junit@4.13.2", "NOASSERTION", "", "test scope"},
+		{"org.slf4j:slf4j-api", "2.0.9", "pkg:maven/org.slf4j/slf4j-api@2.0.9", "NOASSERTION", "", "runtime scope"},
+		{"org.unknown:mystery", "", "", "NOASSERTION", "unresolved version ${undefined.version}\noptional dependency", "compile scope"},
+	} {
+		pkg := pkgs[i]
+		if pkg.PackageName != want.name || pkg.PackageVersion != want.version {
+			t.Errorf("%d: expected %v %v, got %v %v", i, want.name, want.version, pkg.PackageName, pkg.PackageVersion)
+		}
+		purl := ""
+		if len(pkg.PackageExternalReferences) > 0 {
+			purl = pkg.PackageExternalReferences[0].Locator
+		}
+		if purl != want.purl {
+			t.Errorf("%d: expected %v, got %v", i, want.purl, purl)
+		}
+		if pkg.PackageLicenseDeclared != want.license {
+			t.Errorf("%d: expected %v, got %v", i, want.license, pkg.PackageLicenseDeclared)
+		}
+		if pkg.PackageComment != want.comment {
+			t.Errorf("%d: expected %q, got %q", i, want.comment, pkg.PackageComment)
+		}
+		rln := rlns[i]
+		if rln.RefA != "SPDXRef-Package-parent" || rln.RefB != pkg.PackageSPDXIdentifier || rln.Relationship != "DEPENDS_ON" {
+			t.Errorf("%d: expected DEPENDS_ON from root package, got %+v", i, rln)
+		}
+		if rln.RelationshipComment != want.rlnComment {
+			t.Errorf("%d: expected %v, got %v", i, want.rlnComment, rln.RelationshipComment)
+		}
+	}
+}
+
+func TestBuildMavenPackagesReadsGradleLockfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"gradle.lockfile": {Data: []byte(`# This is a Gradle generated file for dependency locking.
+# Manual edits can break the build and are not advised.
+# This file is expected to be part of source control.
+com.google.guava:guava:31.1-jre=compileClasspath,runtimeClasspath,testCompileClasspath,testRuntimeClasspath
+junit:junit:4.13.2=testCompileClasspath,testRuntimeClasspath
+org.projectlombok:lombok:1.18.30=annotationProcessor,compileClasspath
+empty=
+`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildMavenPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(pkgs))
+	}
+	for i, want := range [][2]string{
+		{"com.google.guava:guava", "runtime scope"},
+		{"junit:junit", "test scope"},
+		{"org.projectlombok:lombok", "provided scope"},
+	} {
+		if pkgs[i].PackageName != want[0] {
+			t.Errorf("%d: expected %v, got %v", i, want[0], pkgs[i].PackageName)
+		}
+		if rlns[i].RelationshipComment != want[1] {
+			t.Errorf("%d: expected %v, got %v", i, want[1], rlns[i].RelationshipComment)
+		}
+	}
+}
+
+func TestBuildMavenPackagesMergesScopes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pom.xml": {Data: []byte(`<project><groupId>g</groupId><artifactId>a</artifactId><version>1</version>
+<dependencies><dependency><groupId>junit</groupId><artifactId>junit</artifactId><version>4.13.2</version><scope>test</scope></dependency></dependencies>
+</project>`)},
+		"gradle.lockfile": {Data: []byte("junit:junit:4.13.2=runtimeClasspath\n")},
+	}
+	pkgs, rlns, err := BuildMavenPackages2_1(fsys, &spdx.Package2_1{})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(pkgs))
+	}
+	if rlns[0].RelationshipComment != "runtime scope" {
+		t.Errorf("expected %v, got %v", "runtime scope", rlns[0].RelationshipComment)
+	}
+}
+
+func TestBuildMavenPackagesFailsForInvalidFiles(t *testing.T) {
+	for _, fsys := range []fstest.MapFS{
+		{"pom.xml": {Data: []byte("<project><groupId>")}},
+		{"gradle.lockfile": {Data: []byte("no-equals-sign\n")}},
+		{"gradle.lockfile": {Data: []byte("a:b=compileClasspath\n")}},
+	} {
+		_, _, err := BuildMavenPackages2_1(fsys, &spdx.Package2_1{})
+		if err == nil {
+			t.Errorf("expected non-nil error for %v, got nil", fsys)
+		}
+	}
+}
+
+func TestMavenLicenseIdentifiesCommonNames(t *testing.T) {
+	license, comments := mavenLicense([]pomLicense{
+		{Name: "MIT License"},
+		{Name: "GPL2 w/ CPE"},
+	})
+	if license != "(MIT OR (GPL-2.0-only WITH Classpath-exception-2.0))" {
+		t.Errorf("expected %v, got %v", "(MIT OR (GPL-2.0-only WITH Classpath-exception-2.0))", license)
+	}
+	if len(comments) != 0 {
+		t.Errorf("expected no comments, got %v", comments)
+	}
+
+	license, comments = mavenLicense([]pomLicense{
+		{Name: "MIT License"},
+		{Name: "Custom License", URL: "https://example.com/license"},
+	})
+	if license != "" {
+		t.Errorf("expected no license, got %v", license)
+	}
+	if len(comments) != 2 || comments[1] != "POM license: Custom License (https://example.com/license)" {
+		t.Errorf("expected comments for both licenses, got %v", comments)
+	}
+}
@@ -0,0 +1,480 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// BuildNPMPackages2_1 creates SPDX Packages (version 2.1) for the npm
+// packages installed for the project whose package.json file is at the
+// root of fsys, along with "DEPENDS_ON" Relationships from the root
+// Package to each of them. The installed packages are read from
+// package-lock.json (or node_modules/.package-lock.json), or else from
+// yarn.lock. Declared licenses come from the lockfile if it records them,
+// or otherwise from the package.json files under node_modules. A "purl"
+// external reference for the project is added to rootPkg, and its version
+// is filled in from package.json if not already set. If there is no
+// package.json or lockfile, no Packages are returned. Arguments:
+//   - fsys: file system containing the project
+//   - rootPkg: the project's Package, as built from its files
+func BuildNPMPackages2_1(fsys fs.FS, rootPkg *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	manifest, err := readNPMManifest(fsys, "package.json")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	direct := map[string]string{}
+	if manifest != nil {
+		if manifest.Name != "" {
+			rootPkg.PackageExternalReferences = append(rootPkg.PackageExternalReferences, &spdx.PackageExternalReference2_1{
+				Category: "PACKAGE-MANAGER",
+				RefType:  "purl",
+				Locator:  npmPurl(manifest.Name, manifest.Version),
+			})
+		}
+		if rootPkg.PackageVersion == "" {
+			rootPkg.PackageVersion = manifest.Version
+		}
+		direct = manifest.directDependencies()
+	}
+
+	var installed []*npmPackage
+	found := false
+	for _, lockPath := range []string{"package-lock.json", "node_modules/.package-lock.json"} {
+		data, err := fs.ReadFile(fsys, lockPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if installed, err = parseNPMLockfile(data, direct); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", lockPath, err)
+		}
+		found = true
+		break
+	}
+	if !found {
+		data, err := fs.ReadFile(fsys, "yarn.lock")
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if installed, err = parseYarnLockfile(data, direct); err != nil {
+			return nil, nil, fmt.Errorf("yarn.lock: %v", err)
+		}
+	}
+
+	ids := packageIDs{}
+	pkgs := []*spdx.Package2_1{}
+	rlns := []*spdx.Relationship2_1{}
+	for _, p := range installed {
+		pkg := newDependencyPackage2_1(ids.next("npm", p.name, p.version), p.name, p.version, npmPurl(p.name, p.version))
+		if strings.Contains(p.resolved, "://") {
+			pkg.PackageDownloadLocation = p.resolved
+		}
+
+		comments := []string{}
+		for _, integrity := range strings.Fields(p.integrity) {
+			if !setNPMIntegrity(pkg, integrity) {
+				comments = append(comments, fmt.Sprintf("integrity: %s", integrity))
+			}
+		}
+		if p.checksum != "" {
+			comments = append(comments, fmt.Sprintf("yarn checksum: %s", p.checksum))
+		}
+		pkg.PackageComment = strings.Join(comments, "\n")
+
+		license := p.license
+		if license == "" {
+			license = installedNPMLicense(fsys, p)
+		}
+		setNPMLicense(pkg, license)
+
+		rlnComment := ""
+		switch {
+		case !p.direct:
+			rlnComment = "indirect dependency"
+		case p.dev:
+			rlnComment = "development dependency"
+		}
+		pkgs = append(pkgs, pkg)
+		rlns = append(rlns, dependsOn(rootPkg.PackageSPDXIdentifier, pkg.PackageSPDXIdentifier, rlnComment))
+	}
+
+	return pkgs, rlns, nil
+}
+
+// npmPackage is a single installed npm package, as found in a lockfile.
+type npmPackage struct {
+	name      string
+	version   string
+	resolved  string
+	integrity string
+	// checksum is yarn's own hash of the package archive (yarn 2+)
+	checksum string
+	// license is only known from lockfiles that record it
+	license string
+	// installPath is the package's directory relative to the project
+	// root, if known
+	installPath string
+	direct      bool
+	dev         bool
+}
+
+// npmManifest holds the fields of a package.json file that are used here.
+type npmManifest struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	License              json.RawMessage   `json:"license"`
+	Licenses             json.RawMessage   `json:"licenses"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+}
+
+func readNPMManifest(fsys fs.FS, p string) (*npmManifest, error) {
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	m := &npmManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return m, nil
+}
+
+// directDependencies returns the version ranges of all the packages that
+// the manifest depends on directly, keyed by package name.
+func (m *npmManifest) directDependencies() map[string]string {
+	deps := map[string]string{}
+	for _, group := range []map[string]string{m.PeerDependencies, m.OptionalDependencies, m.DevDependencies, m.Dependencies} {
+		for name, rng := range group {
+			deps[name] = rng
+		}
+	}
+	return deps
+}
+
+// license returns the manifest's declared license. Besides the usual
+// string form, the deprecated {"type": ...} object form and "licenses"
+// arrays are understood; several licenses in an array are alternatives.
+func (m *npmManifest) license() string {
+	var s string
+	if json.Unmarshal(m.License, &s) == nil && s != "" {
+		return s
+	}
+	type licenseObject struct {
+		Type string `json:"type"`
+	}
+	var obj licenseObject
+	if json.Unmarshal(m.License, &obj) == nil && obj.Type != "" {
+		return obj.Type
+	}
+	var objs []licenseObject
+	if json.Unmarshal(m.Licenses, &objs) == nil {
+		types := []string{}
+		for _, o := range objs {
+			if o.Type != "" {
+				types = append(types, o.Type)
+			}
+		}
+		if len(types) == 1 {
+			return types[0]
+		}
+		if len(types) > 1 {
+			return "(" + strings.Join(types, " OR ") + ")"
+		}
+	}
+	return ""
+}
+
+// npmLockfile holds the fields of a package-lock.json file that are used
+// here. Version 1 lockfiles only have Dependencies, version 3 lockfiles
+// only have Packages, and version 2 lockfiles have both.
+type npmLockfile struct {
+	LockfileVersion int                           `json:"lockfileVersion"`
+	Packages        map[string]*npmLockPackage    `json:"packages"`
+	Dependencies    map[string]*npmLockDependency `json:"dependencies"`
+}
+
+type npmLockPackage struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	Resolved  string          `json:"resolved"`
+	Integrity string          `json:"integrity"`
+	License   json.RawMessage `json:"license"`
+	Dev       bool            `json:"dev"`
+	Link      bool            `json:"link"`
+}
+
+type npmLockDependency struct {
+	Version      string                        `json:"version"`
+	Resolved     string                        `json:"resolved"`
+	Integrity    string                        `json:"integrity"`
+	Dev          bool                          `json:"dev"`
+	Bundled      bool                          `json:"bundled"`
+	Dependencies map[string]*npmLockDependency `json:"dependencies"`
+}
+
+// parseNPMLockfile returns the packages installed by a package-lock.json
+// file, sorted by install path. direct holds the names of the project's
+// direct dependencies.
+func parseNPMLockfile(data []byte, direct map[string]string) ([]*npmPackage, error) {
+	lock := &npmLockfile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, err
+	}
+
+	pkgs := []*npmPackage{}
+	if lock.Packages != nil {
+		for key, lp := range lock.Packages {
+			// "" is the project itself, and other paths outside
+			// node_modules are workspaces, which are part of the project
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 || lp.Link {
+				continue
+			}
+			// the directory name is the name the project depends on, which
+			// differs from the package's own name for aliases
+			installedAs := key[i+len("node_modules/"):]
+			name := installedAs
+			if lp.Name != "" {
+				name = lp.Name
+			}
+			m := &npmManifest{License: lp.License}
+			_, isDirect := direct[installedAs]
+			pkgs = append(pkgs, &npmPackage{
+				name:        name,
+				version:     lp.Version,
+				resolved:    lp.Resolved,
+				integrity:   lp.Integrity,
+				license:     m.license(),
+				installPath: key,
+				direct:      isDirect && i == 0,
+				dev:         lp.Dev,
+			})
+		}
+	} else {
+		var walk func(deps map[string]*npmLockDependency, dir string)
+		walk = func(deps map[string]*npmLockDependency, dir string) {
+			for name, dep := range deps {
+				installPath := path.Join(dir, "node_modules", name)
+				_, isDirect := direct[name]
+				pkgs = append(pkgs, &npmPackage{
+					name:        name,
+					version:     dep.Version,
+					resolved:    dep.Resolved,
+					integrity:   dep.Integrity,
+					installPath: installPath,
+					direct:      isDirect && dir == "",
+					dev:         dep.Dev,
+				})
+				walk(dep.Dependencies, installPath)
+			}
+		}
+		walk(lock.Dependencies, "")
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].installPath < pkgs[j].installPath })
+	return pkgs, nil
+}
+
+// parseYarnLockfile returns the packages listed in a yarn.lock file, in
+// either the yarn 1 format or the YAML-based format of yarn 2 and later,
+// sorted by name and version. direct holds the version ranges of the
+// project's direct dependencies.
+func parseYarnLockfile(data []byte, direct map[string]string) ([]*npmPackage, error) {
+	pkgs := []*npmPackage{}
+	seen := map[string]*npmPackage{}
+
+	var specs []string
+	fields := map[string]string{}
+	flush := func() error {
+		if len(specs) == 0 {
+			return nil
+		}
+		defer func() { specs, fields = nil, map[string]string{} }()
+
+		name, rng := splitYarnSpec(specs[0])
+		if name == "" || name == "__metadata" {
+			return nil
+		}
+		p := &npmPackage{
+			name:      name,
+			version:   fields["version"],
+			resolved:  fields["resolved"],
+			integrity: fields["integrity"],
+			checksum:  fields["checksum"],
+		}
+		if res := fields["resolution"]; res != "" {
+			// yarn 2+: workspaces and links are part of the project
+			_, resRange := splitYarnSpec(res)
+			if strings.HasPrefix(resRange, "workspace:") || strings.HasPrefix(resRange, "link:") || strings.HasPrefix(resRange, "portal:") {
+				return nil
+			}
+		}
+		if p.version == "" || rng == "" {
+			return fmt.Errorf("invalid entry %q", strings.Join(specs, ", "))
+		}
+		for _, spec := range specs {
+			n, r := splitYarnSpec(spec)
+			if want, ok := direct[n]; ok && n == name && (r == want || r == "npm:"+want) {
+				p.direct = true
+			}
+		}
+
+		key := name + "@" + p.version
+		if prev, ok := seen[key]; ok {
+			prev.direct = prev.direct || p.direct
+			return nil
+		}
+		seen[key] = p
+		pkgs = append(pkgs, p)
+		return nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case indent == 0:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if !strings.HasSuffix(trimmed, ":") {
+				return nil, fmt.Errorf("unexpected line %q", trimmed)
+			}
+			for _, spec := range strings.Split(strings.TrimSuffix(trimmed, ":"), ",") {
+				// yarn 1 quotes each spec, yarn 2+ quotes the whole list
+				specs = append(specs, strings.Trim(strings.TrimSpace(spec), `"`))
+			}
+		case indent == 2:
+			// yarn 1 uses `key "value"`, yarn 2+ uses `key: value`
+			key, value := trimmed, ""
+			if i := strings.IndexAny(trimmed, " :"); i >= 0 {
+				key, value = trimmed[:i], strings.TrimSpace(strings.TrimPrefix(trimmed[i:], ":"))
+			}
+			fields[unquoteYarn(key)] = unquoteYarn(value)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		if pkgs[i].name != pkgs[j].name {
+			return pkgs[i].name < pkgs[j].name
+		}
+		return pkgs[i].version < pkgs[j].version
+	})
+	return pkgs, nil
+}
+
+// splitYarnSpec splits a yarn.lock entry such as "@scope/name@^1.0.0" into
+// the package name and the version range.
+func splitYarnSpec(spec string) (string, string) {
+	// a scoped package name begins with "@", and the range may itself
+	// contain "@" (as in "npm:other@1.0.0"), so split at the first "@"
+	// after the name
+	start := 0
+	if strings.HasPrefix(spec, "@") {
+		start = strings.Index(spec, "/")
+		if start < 0 {
+			return spec, ""
+		}
+	}
+	i := strings.Index(spec[start:], "@")
+	if i < 0 {
+		return spec, ""
+	}
+	return spec[:start+i], spec[start+i+1:]
+}
+
+func unquoteYarn(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// npmPurl returns the package URL for an npm package.
+func npmPurl(name string, version string) string {
+	namespace := ""
+	if i := strings.Index(name, "/"); i >= 0 && strings.HasPrefix(name, "@") {
+		namespace, name = name[:i], name[i+1:]
+	}
+	return buildPurl("npm", namespace, name, version)
+}
+
+// setNPMIntegrity fills in the Package checksum for a Subresource
+// Integrity string such as "sha1-<base64>", returning false if the hash
+// algorithm is not one that SPDX 2.1 Package checksums support.
+func setNPMIntegrity(pkg *spdx.Package2_1, integrity string) bool {
+	i := strings.Index(integrity, "-")
+	if i < 0 {
+		return false
+	}
+	sum, err := base64.StdEncoding.DecodeString(integrity[i+1:])
+	if err != nil {
+		return false
+	}
+	switch integrity[:i] {
+	case "sha1":
+		pkg.PackageChecksumSHA1 = hex.EncodeToString(sum)
+	case "sha256":
+		pkg.PackageChecksumSHA256 = hex.EncodeToString(sum)
+	default:
+		return false
+	}
+	return true
+}
+
+// installedNPMLicense returns the declared license from the package.json
+// of an installed package, if it is present in fsys and is the expected
+// version.
+func installedNPMLicense(fsys fs.FS, p *npmPackage) string {
+	installPath := p.installPath
+	if installPath == "" {
+		installPath = "node_modules/" + p.name
+	}
+	m, err := readNPMManifest(fsys, installPath+"/package.json")
+	if err != nil || m.Version != p.version {
+		return ""
+	}
+	return m.license()
+}
+
+// setNPMLicense fills in the Package's declared license from the license
+// given in npm package metadata. Values that are not license expressions,
+// such as "UNLICENSED" or "SEE LICENSE IN <file>", are recorded in the
+// license comments instead.
+func setNPMLicense(pkg *spdx.Package2_1, license string) {
+	switch {
+	case license == "":
+		return
+	case license == "UNLICENSED" || strings.HasPrefix(license, "SEE LICENSE IN"):
+		pkg.PackageLicenseComments = fmt.Sprintf("package metadata declares license %q", license)
+	default:
+		pkg.PackageLicenseDeclared = license
+	}
+}
@@ -0,0 +1,295 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== npm Package builder tests =====
+const testPackageJSON = `{
+  "name": "@acme/app",
+  "version": "1.2.0",
+  "dependencies": {"left-pad": "^1.3.0", "alias": "npm:right-pad@1.0.0"},
+  "devDependencies": {"@types/node": "^20.0.0"}
+}`
+
+const testPackageLockV3 = `{
+  "name": "@acme/app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "@acme/app", "version": "1.2.0"},
+    "node_modules/left-pad": {
+      "version": "1.3.0",
+      "resolved": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz",
+      "integrity": "sha1-qvZ0M2y8D8+cgcwO3ZZ+6P0zjzQ=",
+      "license": "WTFPL"
+    },
+    "node_modules/alias": {
+      "name": "right-pad",
+      "version": "1.0.0",
+      "resolved": "https://registry.npmjs.org/right-pad/-/right-pad-1.0.0.tgz",
+      "license": {"type": "MIT"}
+    },
+    "node_modules/@types/node": {
+      "version": "20.1.0",
+      "resolved": "https://registry.npmjs.org/@types/node/-/node-20.1.0.tgz",
+      "integrity": "sha512-m6YIp9zBfYBsKjmJjrn+W61yF6ACfcAD5U2pQ9DfGlaj1tZFzZvmixg2+0k3aZjA0jxLsHvS3NWGEMSN/HwQ0Q==",
+      "license": "MIT",
+      "dev": true
+    },
+    "node_modules/left-pad/node_modules/nested": {
+      "version": "0.0.1",
+      "resolved": "file:../nested",
+      "license": "UNLICENSED"
+    },
+    "packages/workspace": {"name": "workspace", "version": "0.1.0"},
+    "node_modules/workspace": {"resolved": "packages/workspace", "link": true}
+  }
+}`
+
+func TestBuildNPMPackagesReadsPackageLockV3(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json":      {Data: []byte(testPackageJSON)},
+		"package-lock.json": {Data: []byte(testPackageLockV3)},
+	}
+	rootPkg := &spdx.Package2_1{PackageName: "app", PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildNPMPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if rootPkg.PackageVersion != "1.2.0" {
+		t.Errorf("expected %v, got %v", "1.2.0", rootPkg.PackageVersion)
+	}
+	if len(rootPkg.PackageExternalReferences) != 1 || rootPkg.PackageExternalReferences[0].Locator != "pkg:npm/%40acme/app@1.2.0" {
+		t.Errorf("expected root purl, got %+v", rootPkg.PackageExternalReferences)
+	}
+
+	if len(pkgs) != 4 || len(rlns) != 4 {
+		t.Fatalf("expected 4 packages and relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+
+	// sorted by install path
+	for i, want := range []struct {
+		name, version, download, license, purl, rlnComment string
+	}{
+		{"@types/node", "20.1.0", "https://registry.npmjs.org/@types/node/-/node-20.1.0.tgz", "MIT", "pkg:npm/%40types/node@20.1.0", "development dependency"},
+		{"right-pad", "1.0.0", "https://registry.npmjs.org/right-pad/-/right-pad-1.0.0.tgz", "MIT", "pkg:npm/right-pad@1.0.0", ""},
+		{"left-pad", "1.3.0", "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz", "WTFPL", "pkg:npm/left-pad@1.3.0", ""},
+		{"nested", "0.0.1", "NOASSERTION", "NOASSERTION", "pkg:npm/nested@0.0.1", "indirect dependency"},
+	} {
+		pkg := pkgs[i]
+		if pkg.PackageName != want.name || pkg.PackageVersion != want.version {
+			t.Errorf("%d: expected %v %v, got %v %v", i, want.name, want.version, pkg.PackageName, pkg.PackageVersion)
+		}
+		if pkg.PackageDownloadLocation != want.download {
+			t.Errorf("%d: expected %v, got %v", i, want.download, pkg.PackageDownloadLocation)
+		}
+		if pkg.PackageLicenseDeclared != want.license {
+			t.Errorf("%d: expected %v, got %v", i, want.license, pkg.PackageLicenseDeclared)
+		}
+		if pkg.PackageExternalReferences[0].Locator != want.purl {
+			t.Errorf("%d: expected %v, got %v", i, want.purl, pkg.PackageExternalReferences[0].Locator)
+		}
+		rln := rlns[i]
+		if rln.RefA != "SPDXRef-Package-app" || rln.RefB != pkg.PackageSPDXIdentifier || rln.Relationship != "DEPENDS_ON" {
+			t.Errorf("%d: expected DEPENDS_ON from root package, got %+v", i, rln)
+		}
+		if rln.RelationshipComment != want.rlnComment {
+			t.Errorf("%d: expected %v, got %v", i, want.rlnComment, rln.RelationshipComment)
+		}
+	}
+
+	if pkgs[2].PackageChecksumSHA1 != "aaf674336cbc0fcf9c81cc0edd967ee8fd338f34" {
+		t.Errorf("expected %v, got %v", "aaf674336cbc0fcf9c81cc0edd967ee8fd338f34", pkgs[2].PackageChecksumSHA1)
+	}
+	wantComment := "integrity: sha512-m6YIp9zBfYBsKjmJjrn+W61yF6ACfcAD5U2pQ9DfGlaj1tZFzZvmixg2+0k3aZjA0jxLsHvS3NWGEMSN/HwQ0Q=="
+	if pkgs[0].PackageComment != wantComment {
+		t.Errorf("expected %v, got %v", wantComment, pkgs[0].PackageComment)
+	}
+	if pkgs[3].PackageLicenseComments != `package metadata declares license "UNLICENSED"` {
+		t.Errorf("expected license comment, got %v", pkgs[3].PackageLicenseComments)
+	}
+}
+
+func TestBuildNPMPackagesReadsPackageLockV1AndInstalledLicenses(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{"name": "app", "version": "0.1.0", "dependencies": {"a": "^1.0.0"}}`)},
+		"package-lock.json": {Data: []byte(`{
+  "lockfileVersion": 1,
+  "dependencies": {
+    "a": {
+      "version": "1.0.0",
+      "resolved": "https://registry.npmjs.org/a/-/a-1.0.0.tgz",
+      "dependencies": {
+        "b": {"version": "2.0.0", "resolved": "https://registry.npmjs.org/b/-/b-2.0.0.tgz"}
+      }
+    }
+  }
+}`)},
+		"node_modules/a/package.json":                {Data: []byte(`{"name": "a", "version": "1.0.0", "licenses": [{"type": "MIT"}, {"type": "Apache-2.0"}]}`)},
+		"node_modules/a/node_modules/b/package.json": {Data: []byte(`{"name": "b", "version": "1.9.0", "license": "ISC"}`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildNPMPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkgs))
+	}
+	if pkgs[0].PackageName != "a" || pkgs[0].PackageLicenseDeclared != "(MIT OR Apache-2.0)" {
+		t.Errorf("expected a with (MIT OR Apache-2.0), got %v with %v", pkgs[0].PackageName, pkgs[0].PackageLicenseDeclared)
+	}
+	// the installed b is a different version than the locked one
+	if pkgs[1].PackageName != "b" || pkgs[1].PackageLicenseDeclared != "NOASSERTION" {
+		t.Errorf("expected b with NOASSERTION, got %v with %v", pkgs[1].PackageName, pkgs[1].PackageLicenseDeclared)
+	}
+	if rlns[0].RelationshipComment != "" || rlns[1].RelationshipComment != "indirect dependency" {
+		t.Errorf("expected direct and indirect dependencies, got %q and %q", rlns[0].RelationshipComment, rlns[1].RelationshipComment)
+	}
+}
+
+func TestBuildNPMPackagesReadsYarnV1Lockfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{"name": "app", "dependencies": {"@babel/code-frame": "^7.10.4"}}`)},
+		"yarn.lock": {Data: []byte(`# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@babel/code-frame@^7.0.0", "@babel/code-frame@^7.10.4":
+  version "7.10.4"
+  resolved "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.10.4.tgz#168da1a36e90da68ae8d49c0f1b48c7c6249213a"
+  integrity sha1-qvZ0M2y8D8+cgcwO3ZZ+6P0zjzQ=
+  dependencies:
+    "@babel/highlight" "^7.10.4"
+
+"@babel/highlight@^7.10.4":
+  version "7.10.4"
+  resolved "https://registry.yarnpkg.com/@babel/highlight/-/highlight-7.10.4.tgz"
+`)},
+		"node_modules/@babel/highlight/package.json": {Data: []byte(`{"name": "@babel/highlight", "version": "7.10.4", "license": "MIT"}`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildNPMPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkgs))
+	}
+	if pkgs[0].PackageName != "@babel/code-frame" || pkgs[0].PackageVersion != "7.10.4" {
+		t.Errorf("expected @babel/code-frame 7.10.4, got %v %v", pkgs[0].PackageName, pkgs[0].PackageVersion)
+	}
+	wantLocation := "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.10.4.tgz#168da1a36e90da68ae8d49c0f1b48c7c6249213a"
+	if pkgs[0].PackageDownloadLocation != wantLocation {
+		t.Errorf("expected %v, got %v", wantLocation, pkgs[0].PackageDownloadLocation)
+	}
+	if pkgs[0].PackageChecksumSHA1 != "aaf674336cbc0fcf9c81cc0edd967ee8fd338f34" {
+		t.Errorf("expected %v, got %v", "aaf674336cbc0fcf9c81cc0edd967ee8fd338f34", pkgs[0].PackageChecksumSHA1)
+	}
+	if pkgs[1].PackageLicenseDeclared != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", pkgs[1].PackageLicenseDeclared)
+	}
+	if rlns[0].RelationshipComment != "" || rlns[1].RelationshipComment != "indirect dependency" {
+		t.Errorf("expected direct and indirect dependencies, got %q and %q", rlns[0].RelationshipComment, rlns[1].RelationshipComment)
+	}
+}
+
+func TestBuildNPMPackagesReadsYarnBerryLockfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{"name": "app", "dependencies": {"lodash": "^4.17.0"}}`)},
+		"yarn.lock": {Data: []byte(`# This file is generated by running "yarn install" inside your project.
+
+__metadata:
+  version: 6
+  cacheKey: 8
+
+"app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "app@workspace:."
+  languageName: unknown
+  linkType: soft
+
+"lodash@npm:^4.17.0, lodash@npm:^4.17.21":
+  version: 4.17.21
+  resolution: "lodash@npm:4.17.21"
+  checksum: eb835a2e51d381e561e508ce932ea50a8e5a68f4ebdd771ea240d3048244a8d13658acbd502cd4829768c56f2e16bdd4340b9ea141297d472517b83868e677f7
+  languageName: node
+  linkType: hard
+`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildNPMPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(pkgs))
+	}
+	if pkgs[0].PackageName != "lodash" || pkgs[0].PackageVersion != "4.17.21" {
+		t.Errorf("expected lodash 4.17.21, got %v %v", pkgs[0].PackageName, pkgs[0].PackageVersion)
+	}
+	if pkgs[0].PackageDownloadLocation != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkgs[0].PackageDownloadLocation)
+	}
+	wantComment := "yarn checksum: eb835a2e51d381e561e508ce932ea50a8e5a68f4ebdd771ea240d3048244a8d13658acbd502cd4829768c56f2e16bdd4340b9ea141297d472517b83868e677f7"
+	if pkgs[0].PackageComment != wantComment {
+		t.Errorf("expected %v, got %v", wantComment, pkgs[0].PackageComment)
+	}
+	if rlns[0].RelationshipComment != "" {
+		t.Errorf("expected direct dependency, got %q", rlns[0].RelationshipComment)
+	}
+}
+
+func TestBuildNPMPackagesReturnsNothingWithoutLockfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{"name": "app", "version": "1.0.0"}`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildNPMPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 0 || len(rlns) != 0 {
+		t.Errorf("expected no packages or relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+}
+
+func TestBuildNPMPackagesFailsForInvalidLockfiles(t *testing.T) {
+	for _, fsys := range []fstest.MapFS{
+		{"package.json": {Data: []byte(`{"name": `)}},
+		{"package-lock.json": {Data: []byte(`[]`)}},
+		{"yarn.lock": {Data: []byte("a@^1.0.0:\n  resolved \"x\"\n")}},
+		{"yarn.lock": {Data: []byte("not an entry\n")}},
+	} {
+		_, _, err := BuildNPMPackages2_1(fsys, &spdx.Package2_1{})
+		if err == nil {
+			t.Errorf("expected non-nil error for %v, got nil", fsys)
+		}
+	}
+}
+
+func TestSplitYarnSpec(t *testing.T) {
+	for spec, want := range map[string][2]string{
+		"lodash@^4.17.0":           {"lodash", "^4.17.0"},
+		"@babel/core@npm:^7.0.0":   {"@babel/core", "npm:^7.0.0"},
+		"alias@npm:other@1.0.0":    {"alias", "npm:other@1.0.0"},
+		"@scope/alias@npm:x@1.0.0": {"@scope/alias", "npm:x@1.0.0"},
+		"__metadata":               {"__metadata", ""},
+	} {
+		name, rng := splitYarnSpec(spec)
+		if name != want[0] || rng != want[1] {
+			t.Errorf("%s: expected %v %v, got %v %v", spec, want[0], want[1], name, rng)
+		}
+	}
+}
@@ -0,0 +1,690 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// BuildOSPackages2_1 creates SPDX Packages (version 2.1) for the operating
+// system packages installed in a root filesystem, such as an extracted
+// container image, according to the dpkg status file, the apk installed
+// database or the rpm SQLite database within it. The root Package gets a
+// "CONTAINS" Relationship to each of them, and each of them gets a
+// "CONTAINS" Relationship to the Files in the root Package that it owns.
+// Arguments:
+//   - fsys: the root filesystem
+//   - rootPkg: the root filesystem's Package, as built from its files
+func BuildOSPackages2_1(fsys fs.FS, rootPkg *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	rfs := newRootFS(fsys, rootPkg.Files)
+
+	installed := []*osPackage{}
+	for _, detect := range []func(*rootFS) ([]*osPackage, error){readDpkgStatus, readApkInstalled, readRpmDatabase} {
+		found, err := detect(rfs)
+		if err != nil {
+			return nil, nil, err
+		}
+		installed = append(installed, found...)
+	}
+
+	ids := packageIDs{}
+	pkgs := []*spdx.Package2_1{}
+	rlns := []*spdx.Relationship2_1{}
+	for _, p := range installed {
+		pkg := newDependencyPackage2_1(ids.next(p.ecosystem, p.name, p.version), p.name, p.version, p.purl)
+		pkg.PackageSupplierPerson = p.supplierPerson
+		pkg.PackageSupplierOrganization = p.supplierOrganization
+		pkg.PackageHomePage = p.homePage
+		if p.license != "" {
+			pkg.PackageLicenseDeclared = p.license
+		}
+		pkg.PackageLicenseComments = p.licenseComments
+		pkg.PackageComment = p.comment
+		pkgs = append(pkgs, pkg)
+
+		rlns = append(rlns, &spdx.Relationship2_1{
+			RefA:         rootPkg.PackageSPDXIdentifier,
+			RefB:         pkg.PackageSPDXIdentifier,
+			Relationship: "CONTAINS",
+		})
+		seen := map[string]bool{}
+		for _, f := range p.files {
+			fileID, ok := rfs.fileID(f)
+			if !ok || seen[fileID] {
+				continue
+			}
+			seen[fileID] = true
+			rlns = append(rlns, &spdx.Relationship2_1{
+				RefA:         pkg.PackageSPDXIdentifier,
+				RefB:         fileID,
+				Relationship: "CONTAINS",
+			})
+		}
+	}
+
+	return pkgs, rlns, nil
+}
+
+// osPackage is a package found in an operating system package database.
+type osPackage struct {
+	// ecosystem is the purl type, which is also used in SPDX identifiers
+	ecosystem            string
+	name                 string
+	version              string
+	purl                 string
+	supplierPerson       string
+	supplierOrganization string
+	homePage             string
+	license              string
+	licenseComments      string
+	comment              string
+	// files are the absolute paths of the files the package owns
+	files []string
+}
+
+// rootFS is a root filesystem, along with the Files built from it.
+type rootFS struct {
+	fsys fs.FS
+	// ids maps File names to SPDX identifiers
+	ids map[string]string
+	// dirs caches the resolved paths of directories
+	dirs map[string]string
+	// osID and osVersion are the ID and VERSION_ID from os-release
+	osID      string
+	osVersion string
+}
+
+func newRootFS(fsys fs.FS, files []*spdx.File2_1) *rootFS {
+	rfs := &rootFS{fsys: fsys, ids: map[string]string{}, dirs: map[string]string{}}
+	for _, f := range files {
+		rfs.ids[f.FileName] = f.FileSPDXIdentifier
+	}
+	for _, p := range []string{"etc/os-release", "usr/lib/os-release"} {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if i := strings.Index(line, "="); i > 0 {
+				value := strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+				switch strings.TrimSpace(line[:i]) {
+				case "ID":
+					rfs.osID = value
+				case "VERSION_ID":
+					rfs.osVersion = value
+				}
+			}
+		}
+		break
+	}
+	return rfs
+}
+
+// distro returns the purl "distro" qualifier for the root filesystem.
+func (rfs *rootFS) distro() string {
+	if rfs.osID == "" || rfs.osVersion == "" {
+		return ""
+	}
+	return rfs.osID + "-" + rfs.osVersion
+}
+
+// fileID returns the SPDX identifier of the File for an absolute path
+// listed in a package database. Symbolic links in the directories leading
+// to it are resolved as they would be within the root filesystem, since
+// for instance /bin is often a link to /usr/bin.
+func (rfs *rootFS) fileID(p string) (string, bool) {
+	p = path.Clean("/" + p)
+	if id, ok := rfs.ids[p]; ok {
+		return id, true
+	}
+	dir, ok := rfs.resolveDir(path.Dir(p), 0)
+	if !ok {
+		return "", false
+	}
+	id, ok := rfs.ids[path.Join(dir, path.Base(p))]
+	return id, ok
+}
+
+// resolveDir resolves the symbolic links in an absolute directory path,
+// treating absolute link targets as relative to the root filesystem.
+func (rfs *rootFS) resolveDir(dir string, depth int) (string, bool) {
+	if dir == "/" {
+		return dir, true
+	}
+	if resolved, ok := rfs.dirs[dir]; ok {
+		return resolved, resolved != ""
+	}
+	if depth > 40 {
+		return "", false
+	}
+
+	resolved := ""
+	parent, ok := rfs.resolveDir(path.Dir(dir), depth+1)
+	if ok {
+		next := path.Join(parent, path.Base(dir))
+		fi, err := utils.Lstat(rfs.fsys, strings.TrimPrefix(next, "/"))
+		switch {
+		case err != nil:
+		case fi.Mode()&fs.ModeSymlink != 0:
+			target, err := utils.ReadLink(rfs.fsys, strings.TrimPrefix(next, "/"))
+			if err == nil {
+				if !path.IsAbs(target) {
+					target = path.Join(parent, target)
+				}
+				resolved, _ = rfs.resolveDir(path.Clean(target), depth+1)
+			}
+		case fi.IsDir():
+			resolved = next
+		}
+	}
+	rfs.dirs[dir] = resolved
+	return resolved, resolved != ""
+}
+
+// readFile reads a file from the root filesystem, returning nil data and
+// no error if it does not exist.
+func (rfs *rootFS) readFile(p string) ([]byte, error) {
+	data, err := fs.ReadFile(rfs.fsys, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// parseStanzas parses the blank-line-separated stanzas of "Key: value"
+// fields used by the dpkg status file and Debian copyright files. Values
+// continued on indented lines are joined with newlines.
+func parseStanzas(data []byte) []map[string]string {
+	stanzas := []map[string]string{}
+	cur := map[string]string{}
+	lastKey := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(cur) > 0 {
+				stanzas = append(stanzas, cur)
+				cur = map[string]string{}
+			}
+			lastKey = ""
+		case line[0] == ' ' || line[0] == '\t':
+			if lastKey != "" {
+				cur[lastKey] += "\n" + strings.TrimSpace(line)
+			}
+		default:
+			if i := strings.Index(line, ":"); i > 0 {
+				lastKey = line[:i]
+				cur[lastKey] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	if len(cur) > 0 {
+		stanzas = append(stanzas, cur)
+	}
+	return stanzas
+}
+
+// readDpkgStatus reads the packages installed according to the dpkg
+// status file, with the files listed for them in /var/lib/dpkg/info and
+// the licenses from their Debian copyright files.
+func readDpkgStatus(rfs *rootFS) ([]*osPackage, error) {
+	data, err := rfs.readFile("var/lib/dpkg/status")
+	if data == nil || err != nil {
+		return nil, err
+	}
+
+	namespace := rfs.osID
+	if namespace == "" {
+		namespace = "debian"
+	}
+
+	pkgs := []*osPackage{}
+	for _, st := range parseStanzas(data) {
+		status := strings.Fields(st["Status"])
+		if st["Package"] == "" || len(status) != 3 || status[2] != "installed" {
+			continue
+		}
+		p := &osPackage{
+			ecosystem:      "deb",
+			name:           st["Package"],
+			version:        st["Version"],
+			supplierPerson: emailToSPDX(st["Maintainer"]),
+			homePage:       st["Homepage"],
+		}
+		p.purl = withPurlQualifiers(buildPurl("deb", namespace, p.name, p.version),
+			"arch", st["Architecture"], "distro", rfs.distro())
+
+		for _, listName := range []string{p.name + ":" + st["Architecture"] + ".list", p.name + ".list"} {
+			list, err := rfs.readFile("var/lib/dpkg/info/" + listName)
+			if err != nil {
+				return nil, err
+			}
+			if list != nil {
+				p.files = strings.Fields(string(list))
+				break
+			}
+		}
+
+		copyright, err := rfs.readFile("usr/share/doc/" + p.name + "/copyright")
+		if err != nil {
+			return nil, err
+		}
+		if copyright != nil {
+			p.license, p.licenseComments = debianCopyrightLicense(copyright)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// emailToSPDX converts a "Name <email>" contact to the "Name (email)"
+// form used in SPDX Person fields.
+func emailToSPDX(contact string) string {
+	contact = strings.TrimSpace(contact)
+	i := strings.Index(contact, "<")
+	j := strings.LastIndex(contact, ">")
+	if i < 0 || j < i {
+		return contact
+	}
+	return strings.TrimSpace(contact[:i]) + " (" + contact[i+1:j] + ")"
+}
+
+// debianLicenseNames maps the license short names used in Debian
+// machine-readable copyright files to SPDX license identifiers.
+var debianLicenseNames = map[string]string{
+	"apache-2.0":   "Apache-2.0",
+	"artistic-2.0": "Artistic-2.0",
+	"bsd-2-clause": "BSD-2-Clause",
+	"bsd-3-clause": "BSD-3-Clause",
+	"bsd-4-clause": "BSD-4-Clause",
+	"cc0-1.0":      "CC0-1.0",
+	"expat":        "MIT",
+	"mit":          "MIT",
+	"gpl-1":        "GPL-1.0-only",
+	"gpl-1+":       "GPL-1.0-or-later",
+	"gpl-2":        "GPL-2.0-only",
+	"gpl-2+":       "GPL-2.0-or-later",
+	"gpl-3":        "GPL-3.0-only",
+	"gpl-3+":       "GPL-3.0-or-later",
+	"lgpl-2":       "LGPL-2.0-only",
+	"lgpl-2+":      "LGPL-2.0-or-later",
+	"lgpl-2.1":     "LGPL-2.1-only",
+	"lgpl-2.1+":    "LGPL-2.1-or-later",
+	"lgpl-3":       "LGPL-3.0-only",
+	"lgpl-3+":      "LGPL-3.0-or-later",
+	"agpl-3":       "AGPL-3.0-only",
+	"agpl-3+":      "AGPL-3.0-or-later",
+	"isc":          "ISC",
+	"mpl-1.1":      "MPL-1.1",
+	"mpl-2.0":      "MPL-2.0",
+	"zlib":         "Zlib",
+	"curl":         "curl",
+	"openssl":      "OpenSSL",
+	"python-2.0":   "Python-2.0",
+}
+
+var debianLicenseOperator = regexp.MustCompile(`(?i)^(and|or|,)$`)
+
+// debianCopyrightLicense returns the declared license from a Debian
+// machine-readable copyright file: the license in its header paragraph if
+// there is one, or else the combination of the licenses of all its Files
+// paragraphs. If the file is not machine-readable, or uses license names
+// that cannot be mapped to SPDX identifiers, no license is returned, and
+// the comment lists the license names instead.
+func debianCopyrightLicense(data []byte) (string, string) {
+	stanzas := parseStanzas(data)
+	if len(stanzas) == 0 || !strings.Contains(stanzas[0]["Format"], "copyright-format") {
+		return "", ""
+	}
+
+	exprs := []string{}
+	names := []string{}
+	if header := firstLine(stanzas[0]["License"]); header != "" {
+		exprs = append(exprs, header)
+	} else {
+		for _, st := range stanzas[1:] {
+			if _, ok := st["Files"]; !ok {
+				continue
+			}
+			if expr := firstLine(st["License"]); expr != "" && !containsString(exprs, expr) {
+				exprs = append(exprs, expr)
+			}
+		}
+	}
+	if len(exprs) == 0 {
+		return "", ""
+	}
+
+	converted := []string{}
+	mapped := true
+	for _, expr := range exprs {
+		tokens := strings.Fields(strings.ReplaceAll(expr, ",", " , "))
+		out := []string{}
+		for _, tok := range tokens {
+			if debianLicenseOperator.MatchString(tok) {
+				op := strings.ToUpper(tok)
+				if op == "," {
+					op = "AND"
+				}
+				out = append(out, op)
+				continue
+			}
+			if !containsString(names, tok) {
+				names = append(names, tok)
+			}
+			id, ok := debianLicenseNames[strings.ToLower(tok)]
+			if !ok {
+				mapped = false
+			}
+			out = append(out, id)
+		}
+		s := strings.Join(out, " ")
+		if len(out) > 1 && len(exprs) > 1 {
+			s = "(" + s + ")"
+		}
+		converted = append(converted, s)
+	}
+
+	if !mapped {
+		return "", fmt.Sprintf("copyright file licenses: %s", strings.Join(names, ", "))
+	}
+	return strings.Join(converted, " AND "), ""
+}
+
+func firstLine(s string) string {
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// readApkInstalled reads the packages installed according to the apk
+// database of an Alpine root filesystem.
+func readApkInstalled(rfs *rootFS) ([]*osPackage, error) {
+	data, err := rfs.readFile("lib/apk/db/installed")
+	if data == nil || err != nil {
+		return nil, err
+	}
+
+	namespace := rfs.osID
+	if namespace == "" {
+		namespace = "alpine"
+	}
+
+	pkgs := []*osPackage{}
+	var p *osPackage
+	arch := ""
+	dir := ""
+	flush := func() {
+		if p != nil && p.name != "" {
+			p.purl = withPurlQualifiers(buildPurl("apk", namespace, p.name, p.version),
+				"arch", arch, "distro", rfs.distro())
+			pkgs = append(pkgs, p)
+		}
+		p, arch, dir = nil, "", ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		if p == nil {
+			p = &osPackage{ecosystem: "apk"}
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			p.name = value
+		case 'V':
+			p.version = value
+		case 'A':
+			arch = value
+		case 'L':
+			p.license = value
+		case 'm':
+			p.supplierPerson = emailToSPDX(value)
+		case 'U':
+			p.homePage = value
+		case 'o':
+			if value != p.name {
+				p.comment = fmt.Sprintf("origin: %s", value)
+			}
+		case 'F':
+			dir = value
+		case 'R':
+			p.files = append(p.files, "/"+path.Join(dir, value))
+		}
+	}
+	flush()
+	return pkgs, nil
+}
+
+// rpm header tags
+const (
+	rpmTagName        = 1000
+	rpmTagVersion     = 1001
+	rpmTagRelease     = 1002
+	rpmTagEpoch       = 1003
+	rpmTagVendor      = 1011
+	rpmTagLicense     = 1014
+	rpmTagURL         = 1020
+	rpmTagArch        = 1022
+	rpmTagOldFilename = 1027
+	rpmTagSourceRPM   = 1044
+	rpmTagDirIndexes  = 1116
+	rpmTagBasenames   = 1117
+	rpmTagDirnames    = 1118
+)
+
+// readRpmDatabase reads the packages installed according to the rpm
+// SQLite database, which is used by rpm 4.16 and later.
+func readRpmDatabase(rfs *rootFS) ([]*osPackage, error) {
+	var data []byte
+	for _, p := range []string{"var/lib/rpm/rpmdb.sqlite", "usr/lib/sysimage/rpm/rpmdb.sqlite"} {
+		var err error
+		if data, err = rfs.readFile(p); err != nil {
+			return nil, err
+		}
+		if data != nil {
+			break
+		}
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, fmt.Errorf("rpm database: %v", err)
+	}
+	root, err := db.tableRoot("Packages")
+	if err != nil {
+		return nil, fmt.Errorf("rpm database: %v", err)
+	}
+
+	pkgs := []*osPackage{}
+	err = db.scanTable(root, func(rowid int64, values []interface{}) error {
+		if len(values) < 2 {
+			return nil
+		}
+		blob, ok := values[1].([]byte)
+		if !ok {
+			return nil
+		}
+		h, err := parseRpmHeader(blob)
+		if err != nil {
+			return fmt.Errorf("rpm database: package %d: %v", rowid, err)
+		}
+		name := h.str(rpmTagName)
+		// imported signing keys are stored as pseudo-packages
+		if name == "" || name == "gpg-pubkey" {
+			return nil
+		}
+
+		p := &osPackage{
+			ecosystem:            "rpm",
+			name:                 name,
+			version:              h.str(rpmTagVersion) + "-" + h.str(rpmTagRelease),
+			supplierOrganization: h.str(rpmTagVendor),
+			homePage:             h.str(rpmTagURL),
+			license:              h.str(rpmTagLicense),
+		}
+		epoch := ""
+		if e := h.ints(rpmTagEpoch); len(e) > 0 {
+			epoch = fmt.Sprintf("%d", e[0])
+		}
+		p.purl = withPurlQualifiers(buildPurl("rpm", rfs.osID, p.name, p.version),
+			"arch", h.str(rpmTagArch), "epoch", epoch, "distro", rfs.distro())
+		if src := h.str(rpmTagSourceRPM); src != "" {
+			p.comment = fmt.Sprintf("source rpm: %s", src)
+		}
+
+		basenames := h.strs(rpmTagBasenames)
+		dirnames := h.strs(rpmTagDirnames)
+		dirIndexes := h.ints(rpmTagDirIndexes)
+		if len(basenames) > 0 && len(dirIndexes) == len(basenames) {
+			for i, base := range basenames {
+				if idx := dirIndexes[i]; idx >= 0 && int(idx) < len(dirnames) {
+					p.files = append(p.files, dirnames[idx]+base)
+				}
+			}
+		} else {
+			p.files = h.strs(rpmTagOldFilename)
+		}
+
+		pkgs = append(pkgs, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// rpmHeader is a parsed rpm header, as stored in an rpm database.
+type rpmHeader struct {
+	entries map[int32]rpmEntry
+	store   []byte
+}
+
+type rpmEntry struct {
+	typ    int32
+	offset int32
+	count  int32
+}
+
+// rpm header data types
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// parseRpmHeader parses a header blob: the index entry count and data
+// length, the index entries, and the data store.
+func parseRpmHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, errors.New("header too short")
+	}
+	il := int64(binary.BigEndian.Uint32(blob[0:4]))
+	dl := int64(binary.BigEndian.Uint32(blob[4:8]))
+	if 8+il*16+dl > int64(len(blob)) {
+		return nil, errors.New("header too short")
+	}
+
+	h := &rpmHeader{entries: map[int32]rpmEntry{}, store: blob[8+il*16 : 8+il*16+dl]}
+	for i := int64(0); i < il; i++ {
+		e := blob[8+i*16:]
+		tag := int32(binary.BigEndian.Uint32(e[0:4]))
+		entry := rpmEntry{
+			typ:    int32(binary.BigEndian.Uint32(e[4:8])),
+			offset: int32(binary.BigEndian.Uint32(e[8:12])),
+			count:  int32(binary.BigEndian.Uint32(e[12:16])),
+		}
+		if entry.offset < 0 || int64(entry.offset) > dl || entry.count < 0 {
+			return nil, fmt.Errorf("invalid entry for tag %d", tag)
+		}
+		h.entries[tag] = entry
+	}
+	return h, nil
+}
+
+// strs returns the values of a string, string array or i18n string tag.
+func (h *rpmHeader) strs(tag int32) []string {
+	e, ok := h.entries[tag]
+	if !ok || (e.typ != rpmTypeString && e.typ != rpmTypeStringArray && e.typ != rpmTypeI18NString) {
+		return nil
+	}
+	count := int(e.count)
+	if e.typ == rpmTypeString {
+		count = 1
+	}
+	vals := []string{}
+	data := h.store[e.offset:]
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		vals = append(vals, string(data[:end]))
+		data = data[end+1:]
+	}
+	return vals
+}
+
+// str returns the first value of a string tag, or "" if it is missing.
+func (h *rpmHeader) str(tag int32) string {
+	if vals := h.strs(tag); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// ints returns the values of an integer tag.
+func (h *rpmHeader) ints(tag int32) []int32 {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	size := 0
+	switch e.typ {
+	case rpmTypeInt16:
+		size = 2
+	case rpmTypeInt32:
+		size = 4
+	default:
+		return nil
+	}
+	data := h.store[e.offset:]
+	if int64(len(data)) < int64(e.count)*int64(size) {
+		return nil
+	}
+	vals := make([]int32, e.count)
+	for i := range vals {
+		if size == 2 {
+			vals[i] = int32(int16(binary.BigEndian.Uint16(data[i*2:])))
+		} else {
+			vals[i] = int32(binary.BigEndian.Uint32(data[i*4:]))
+		}
+	}
+	return vals
+}
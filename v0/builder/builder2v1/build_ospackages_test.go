@@ -0,0 +1,425 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== OS Package builder tests =====
+const testDpkgStatus = `Package: libc6
+Status: install ok installed
+Priority: optional
+Architecture: amd64
+Version: 2.36-9+deb12u4
+Maintainer: GNU Libc Maintainers <debian-glibc@lists.debian.org>
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries that are used by nearly all programs on
+ the system.
+Homepage: https://www.gnu.org/software/libc/libc.html
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+
+Package: base-files
+Status: install ok installed
+Architecture: amd64
+Version: 12.4+deb12u5
+Maintainer: Santiago Vila <sanvila@debian.org>
+`
+
+const testDebianCopyright = `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: glibc
+
+Files: *
+Copyright: 1991-2023 Free Software Foundation, Inc.
+License: LGPL-2.1+
+ This library is free software.
+
+Files: debian/*
+Copyright: 1998 Someone
+License: GPL-2+ or Expat
+
+License: LGPL-2.1+
+ The full text.
+`
+
+func testRootPkg(fileNames ...string) *spdx.Package2_1 {
+	pkg := &spdx.Package2_1{PackageName: "rootfs", PackageSPDXIdentifier: "SPDXRef-Package-rootfs"}
+	for i, name := range fileNames {
+		pkg.Files = append(pkg.Files, &spdx.File2_1{
+			FileName:           name,
+			FileSPDXIdentifier: fmt.Sprintf("SPDXRef-File%d", i),
+		})
+	}
+	return pkg
+}
+
+func TestBuildOSPackagesReadsDpkgStatus(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/os-release":                     {Data: []byte("PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\n")},
+		"var/lib/dpkg/status":                {Data: []byte(testDpkgStatus)},
+		"var/lib/dpkg/info/libc6:amd64.list": {Data: []byte("/.\n/lib\n/lib/x86_64-linux-gnu/libc.so.6\n/usr/share/doc/libc6/copyright\n")},
+		"var/lib/dpkg/info/base-files.list":  {Data: []byte("/etc/issue\n")},
+		"lib":                                {Data: []byte("usr/lib"), Mode: os.ModeSymlink},
+		"usr/lib/x86_64-linux-gnu/libc.so.6": {Data: []byte("ELF")},
+		"usr/share/doc/libc6/copyright":      {Data: []byte(testDebianCopyright)},
+		"usr/share/doc/base-files/copyright": {Data: []byte("This is not machine-readable.\n")},
+		"etc/issue":                          {Data: []byte("Debian GNU/Linux 12\n")},
+	}
+	root := testRootPkg("/etc/issue", "/usr/lib/x86_64-linux-gnu/libc.so.6", "/usr/share/doc/libc6/copyright")
+
+	pkgs, rlns, err := BuildOSPackages2_1(fsys, root)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkgs))
+	}
+
+	libc := pkgs[0]
+	if libc.PackageSPDXIdentifier != "SPDXRef-Package-deb-libc6-2.36-9-deb12u4" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Package-deb-libc6-2.36-9-deb12u4", libc.PackageSPDXIdentifier)
+	}
+	if libc.PackageSupplierPerson != "GNU Libc Maintainers (debian-glibc@lists.debian.org)" {
+		t.Errorf("expected %v, got %v", "GNU Libc Maintainers (debian-glibc@lists.debian.org)", libc.PackageSupplierPerson)
+	}
+	if libc.PackageHomePage != "https://www.gnu.org/software/libc/libc.html" {
+		t.Errorf("expected %v, got %v", "https://www.gnu.org/software/libc/libc.html", libc.PackageHomePage)
+	}
+	wantLicense := "LGPL-2.1-or-later AND (GPL-2.0-or-later OR MIT)"
+	if libc.PackageLicenseDeclared != wantLicense {
+		t.Errorf("expected %v, got %v", wantLicense, libc.PackageLicenseDeclared)
+	}
+	wantPurl := "pkg:deb/debian/libc6@2.36-9%2Bdeb12u4?arch=amd64&distro=debian-12"
+	if len(libc.PackageExternalReferences) != 1 || libc.PackageExternalReferences[0].Locator != wantPurl {
+		t.Errorf("expected purl %v, got %+v", wantPurl, libc.PackageExternalReferences)
+	}
+
+	base := pkgs[1]
+	if base.PackageLicenseDeclared != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", base.PackageLicenseDeclared)
+	}
+
+	want := [][3]string{
+		{"SPDXRef-Package-rootfs", "CONTAINS", libc.PackageSPDXIdentifier},
+		{libc.PackageSPDXIdentifier, "CONTAINS", "SPDXRef-File1"},
+		{libc.PackageSPDXIdentifier, "CONTAINS", "SPDXRef-File2"},
+		{"SPDXRef-Package-rootfs", "CONTAINS", base.PackageSPDXIdentifier},
+		{base.PackageSPDXIdentifier, "CONTAINS", "SPDXRef-File0"},
+	}
+	if len(rlns) != len(want) {
+		t.Fatalf("expected %d, got %d", len(want), len(rlns))
+	}
+	for i, w := range want {
+		got := [3]string{rlns[i].RefA, rlns[i].Relationship, rlns[i].RefB}
+		if got != w {
+			t.Errorf("expected %v, got %v", w, got)
+		}
+	}
+}
+
+func TestDebianCopyrightLicenseReportsUnmappedNames(t *testing.T) {
+	data := []byte(`Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+
+Files: *
+License: GPL-2+ and Custom-License
+`)
+	license, comments := debianCopyrightLicense(data)
+	if license != "" {
+		t.Errorf("expected empty license, got %v", license)
+	}
+	if comments != "copyright file licenses: GPL-2+, Custom-License" {
+		t.Errorf("expected %v, got %v", "copyright file licenses: GPL-2+, Custom-License", comments)
+	}
+
+	header := []byte("Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\nLicense: Apache-2.0\n\nFiles: *\nLicense: MIT\n")
+	if license, _ = debianCopyrightLicense(header); license != "Apache-2.0" {
+		t.Errorf("expected %v, got %v", "Apache-2.0", license)
+	}
+}
+
+const testApkInstalled = `C:Q1abc=
+P:musl
+V:1.2.4-r2
+A:x86_64
+S:383152
+L:MIT
+m:Timo Teräs <timo.teras@iki.fi>
+U:https://musl.libc.org/
+o:musl
+F:lib
+R:ld-musl-x86_64.so.1
+R:libc.musl-x86_64.so.1
+
+C:Q1def=
+P:busybox-binsh
+V:1.36.1-r5
+A:x86_64
+L:GPL-2.0-only
+o:busybox
+F:bin
+R:sh
+`
+
+func TestBuildOSPackagesReadsApkInstalled(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/os-release":            {Data: []byte("ID=alpine\nVERSION_ID=3.19.1\n")},
+		"lib/apk/db/installed":      {Data: []byte(testApkInstalled)},
+		"lib/ld-musl-x86_64.so.1":   {Data: []byte("ELF")},
+		"lib/libc.musl-x86_64.so.1": {Data: []byte("ld-musl-x86_64.so.1"), Mode: os.ModeSymlink},
+		"bin/sh":                    {Data: []byte("/bin/busybox"), Mode: os.ModeSymlink},
+	}
+	root := testRootPkg("/lib/ld-musl-x86_64.so.1", "/lib/libc.musl-x86_64.so.1", "/bin/sh")
+
+	pkgs, rlns, err := BuildOSPackages2_1(fsys, root)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkgs))
+	}
+
+	musl := pkgs[0]
+	if musl.PackageLicenseDeclared != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", musl.PackageLicenseDeclared)
+	}
+	if musl.PackageSupplierPerson != "Timo Teräs (timo.teras@iki.fi)" {
+		t.Errorf("expected %v, got %v", "Timo Teräs (timo.teras@iki.fi)", musl.PackageSupplierPerson)
+	}
+	if musl.PackageComment != "" {
+		t.Errorf("expected empty comment, got %v", musl.PackageComment)
+	}
+	wantPurl := "pkg:apk/alpine/musl@1.2.4-r2?arch=x86_64&distro=alpine-3.19.1"
+	if musl.PackageExternalReferences[0].Locator != wantPurl {
+		t.Errorf("expected %v, got %v", wantPurl, musl.PackageExternalReferences[0].Locator)
+	}
+	if pkgs[1].PackageComment != "origin: busybox" {
+		t.Errorf("expected %v, got %v", "origin: busybox", pkgs[1].PackageComment)
+	}
+
+	// root CONTAINS musl, musl CONTAINS 2 files, root CONTAINS busybox-binsh,
+	// busybox-binsh CONTAINS /bin/sh
+	if len(rlns) != 5 {
+		t.Fatalf("expected %d, got %d", 5, len(rlns))
+	}
+	if rlns[4].RefA != pkgs[1].PackageSPDXIdentifier || rlns[4].RefB != "SPDXRef-File2" {
+		t.Errorf("expected %v CONTAINS %v, got %+v", pkgs[1].PackageSPDXIdentifier, "SPDXRef-File2", rlns[4])
+	}
+}
+
+func TestBuildOSPackagesResolvesAbsoluteLinksWithinRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/apk/db/installed": {Data: []byte("P:a\nV:1\nF:lib64\nR:liba.so\n")},
+		"lib64":                {Data: []byte("/usr/lib"), Mode: os.ModeSymlink},
+		"usr/lib/liba.so":      {Data: []byte("ELF")},
+	}
+	root := testRootPkg("/usr/lib/liba.so")
+
+	_, rlns, err := BuildOSPackages2_1(fsys, root)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(rlns) != 2 || rlns[1].RefB != "SPDXRef-File0" {
+		t.Errorf("expected CONTAINS %v, got %+v", "SPDXRef-File0", rlns)
+	}
+}
+
+func TestBuildOSPackagesIgnoresPlainDirectories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go": {Data: []byte("package main\n")},
+	}
+
+	pkgs, rlns, err := BuildOSPackages2_1(fsys, testRootPkg("/main.go"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 0 || len(rlns) != 0 {
+		t.Errorf("expected no packages or relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+}
+
+// testRpmTag is one entry of an rpm header built for tests.
+type testRpmTag struct {
+	tag   int32
+	typ   int32
+	value interface{}
+}
+
+// buildTestRpmHeader encodes tags as an rpm header blob, as stored in the
+// rpm database.
+func buildTestRpmHeader(tags []testRpmTag) []byte {
+	index := &bytes.Buffer{}
+	store := &bytes.Buffer{}
+	for _, t := range tags {
+		count := 1
+		offset := store.Len()
+		switch v := t.value.(type) {
+		case string:
+			store.WriteString(v + "\x00")
+		case []string:
+			count = len(v)
+			for _, s := range v {
+				store.WriteString(s + "\x00")
+			}
+		case []int32:
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+			offset = store.Len()
+			count = len(v)
+			binary.Write(store, binary.BigEndian, v)
+		}
+		binary.Write(index, binary.BigEndian, []int32{t.tag, t.typ, int32(offset), int32(count)})
+	}
+	blob := &bytes.Buffer{}
+	binary.Write(blob, binary.BigEndian, []uint32{uint32(len(tags)), uint32(store.Len())})
+	blob.Write(index.Bytes())
+	blob.Write(store.Bytes())
+	return blob.Bytes()
+}
+
+func TestParseRpmHeaderReadsTags(t *testing.T) {
+	blob := buildTestRpmHeader([]testRpmTag{
+		{rpmTagName, rpmTypeString, "bash"},
+		{rpmTagLicense, rpmTypeString, "GPL-3.0-or-later"},
+		{rpmTagBasenames, rpmTypeStringArray, []string{"bash", "sh"}},
+		{rpmTagEpoch, rpmTypeInt32, []int32{2}},
+		{rpmTagDirIndexes, rpmTypeInt32, []int32{0, 0}},
+	})
+
+	h, err := parseRpmHeader(blob)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if h.str(rpmTagName) != "bash" {
+		t.Errorf("expected %v, got %v", "bash", h.str(rpmTagName))
+	}
+	if got := h.strs(rpmTagBasenames); len(got) != 2 || got[1] != "sh" {
+		t.Errorf("expected %v, got %v", []string{"bash", "sh"}, got)
+	}
+	if got := h.ints(rpmTagEpoch); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected %v, got %v", []int32{2}, got)
+	}
+	if h.str(rpmTagVendor) != "" {
+		t.Errorf("expected empty vendor, got %v", h.str(rpmTagVendor))
+	}
+
+	if _, err = parseRpmHeader(blob[:20]); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestBuildOSPackagesReadsRpmDatabase(t *testing.T) {
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not available")
+	}
+
+	files := []string{}
+	for i := 0; i < 400; i++ {
+		files = append(files, fmt.Sprintf("file%03d", i))
+	}
+	dirIndexes := make([]int32, len(files))
+	bash := buildTestRpmHeader([]testRpmTag{
+		{rpmTagName, rpmTypeString, "bash"},
+		{rpmTagVersion, rpmTypeString, "5.2.15"},
+		{rpmTagRelease, rpmTypeString, "3.el9"},
+		{rpmTagVendor, rpmTypeString, "Red Hat, Inc."},
+		{rpmTagLicense, rpmTypeString, "GPLv3+"},
+		{rpmTagURL, rpmTypeString, "https://www.gnu.org/software/bash"},
+		{rpmTagArch, rpmTypeString, "x86_64"},
+		{rpmTagSourceRPM, rpmTypeString, "bash-5.2.15-3.el9.src.rpm"},
+		{rpmTagBasenames, rpmTypeStringArray, files},
+		{rpmTagDirnames, rpmTypeStringArray, []string{"/usr/share/bash/"}},
+		{rpmTagDirIndexes, rpmTypeInt32, dirIndexes},
+		{rpmTagEpoch, rpmTypeInt32, []int32{1}},
+	})
+	key := buildTestRpmHeader([]testRpmTag{
+		{rpmTagName, rpmTypeString, "gpg-pubkey"},
+		{rpmTagVersion, rpmTypeString, "fd431d51"},
+	})
+
+	sql := &strings.Builder{}
+	sql.WriteString("CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL);\n")
+	sql.WriteString("CREATE TABLE Name (key TEXT NOT NULL, hnum INTEGER NOT NULL);\n")
+	fmt.Fprintf(sql, "INSERT INTO Packages (blob) VALUES (X'%s');\n", hex.EncodeToString(key))
+	fmt.Fprintf(sql, "INSERT INTO Packages (blob) VALUES (X'%s');\n", hex.EncodeToString(bash))
+	// enough rows to need interior table pages
+	for i := 0; i < 50; i++ {
+		blob := buildTestRpmHeader([]testRpmTag{
+			{rpmTagName, rpmTypeString, fmt.Sprintf("pkg%02d-%s", i, strings.Repeat("x", 200))},
+			{rpmTagVersion, rpmTypeString, "1"},
+			{rpmTagRelease, rpmTypeString, "1"},
+		})
+		fmt.Fprintf(sql, "INSERT INTO Packages (blob) VALUES (X'%s');\n", hex.EncodeToString(blob))
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "rpmdb.sqlite")
+	cmd := exec.Command(sqlite3, dbPath)
+	cmd.Stdin = strings.NewReader(sql.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("sqlite3 failed: %v: %s", err, out)
+	}
+	db, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	fsys := fstest.MapFS{
+		"etc/os-release":           {Data: []byte("ID=\"rhel\"\nVERSION_ID=\"9.3\"\n")},
+		"var/lib/rpm/rpmdb.sqlite": {Data: db},
+		"usr/share/bash/file007":   {Data: []byte("x")},
+	}
+	root := testRootPkg("/usr/share/bash/file007")
+
+	pkgs, rlns, err := BuildOSPackages2_1(fsys, root)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 51 {
+		t.Fatalf("expected %d, got %d", 51, len(pkgs))
+	}
+
+	p := pkgs[0]
+	if p.PackageName != "bash" || p.PackageVersion != "5.2.15-3.el9" {
+		t.Errorf("expected bash 5.2.15-3.el9, got %v %v", p.PackageName, p.PackageVersion)
+	}
+	if p.PackageSupplierOrganization != "Red Hat, Inc." {
+		t.Errorf("expected %v, got %v", "Red Hat, Inc.", p.PackageSupplierOrganization)
+	}
+	if p.PackageLicenseDeclared != "GPLv3+" {
+		t.Errorf("expected %v, got %v", "GPLv3+", p.PackageLicenseDeclared)
+	}
+	if p.PackageComment != "source rpm: bash-5.2.15-3.el9.src.rpm" {
+		t.Errorf("expected %v, got %v", "source rpm: bash-5.2.15-3.el9.src.rpm", p.PackageComment)
+	}
+	wantPurl := "pkg:rpm/rhel/bash@5.2.15-3.el9?arch=x86_64&distro=rhel-9.3&epoch=1"
+	if p.PackageExternalReferences[0].Locator != wantPurl {
+		t.Errorf("expected %v, got %v", wantPurl, p.PackageExternalReferences[0].Locator)
+	}
+	if pkgs[50].PackageName != "pkg49-"+strings.Repeat("x", 200) {
+		t.Errorf("expected %v, got %v", "pkg49-...", pkgs[50].PackageName)
+	}
+
+	if len(rlns) != 52 {
+		t.Fatalf("expected %d, got %d", 52, len(rlns))
+	}
+	if rlns[1].RefA != p.PackageSPDXIdentifier || rlns[1].RefB != "SPDXRef-File0" {
+		t.Errorf("expected %v CONTAINS %v, got %+v", p.PackageSPDXIdentifier, "SPDXRef-File0", rlns[1])
+	}
+}
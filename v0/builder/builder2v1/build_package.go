@@ -4,33 +4,100 @@ package builder2v1
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 
 	"github.com/spdx/tools-golang/v0/spdx"
 	"github.com/spdx/tools-golang/v0/utils"
 )
 
+// PackageOptions2_1 is a collection of optional settings that control how
+// BuildPackageSectionWithOptions2_1 finds and hashes a package's files.
+type PackageOptions2_1 struct {
+	// PathsIgnored is a slice of strings for filepaths to ignore, in the
+	// format accepted by utils.ShouldIgnore.
+	PathsIgnored []string
+
+	// IgnoreFileNames lists the names of gitignore-format files, such as
+	// ".gitignore" or ".spdxignore", to be read from each directory and
+	// applied to the paths within it. See utils.FilePathOptions.
+	IgnoreFileNames []string
+
+	// SymlinkPolicy determines whether symbolic links are skipped,
+	// followed or recorded as files. See utils.SymlinkPolicy.
+	SymlinkPolicy utils.SymlinkPolicy
+
+	// NumWorkers is the number of files that will be hashed concurrently.
+	// Values of 0 or 1 hash the files one at a time.
+	NumWorkers int
+
+	// HashCache, if non-nil, is used to look up the hashes of files that
+	// have not changed since they were last hashed.
+	HashCache *utils.HashCache
+
+	// Decompressors maps a compression format name ("gzip", "bzip2", "xz"
+	// or "zstd") to a function returning a reader for the decompressed
+	// data. It is only used when building from an archive or a container
+	// image. gzip, bzip2 and xz are supported without it;
+	// zstd-compressed archives and image layers need an entry here.
+	Decompressors map[string]func(io.Reader) (io.Reader, error)
+
+	// FileClassifier assigns each File its SPDX file type, such as SOURCE
+	// or BINARY. If nil, only the built-in rules are used.
+	FileClassifier *FileClassifier
+}
+
 // BuildPackageSection2_1 creates an SPDX Package (version 2.1), returning
 // that package or error if any is encountered. Arguments:
 //   - packageName: name of package / directory
 //   - dirRoot: path to directory to be analyzed
 //   - pathsIgnore: slice of strings for filepaths to ignore
 func BuildPackageSection2_1(packageName string, dirRoot string, pathsIgnore []string) (*spdx.Package2_1, error) {
+	opts := &PackageOptions2_1{PathsIgnored: pathsIgnore}
+	return BuildPackageSectionWithOptions2_1(packageName, dirRoot, opts)
+}
+
+// BuildPackageSectionWithOptions2_1 creates an SPDX Package (version 2.1),
+// returning that package or error if any is encountered. Arguments:
+//   - packageName: name of package / directory
+//   - dirRoot: path to directory to be analyzed
+//   - opts: optional settings; nil uses the defaults
+func BuildPackageSectionWithOptions2_1(packageName string, dirRoot string, opts *PackageOptions2_1) (*spdx.Package2_1, error) {
+	return BuildPackageSectionFromFS2_1(packageName, utils.DirFS(dirRoot), opts)
+}
+
+// BuildPackageSectionFromFS2_1 creates an SPDX Package (version 2.1) for
+// the files in a file system, returning that package or error if any is
+// encountered. Arguments:
+//   - packageName: name of package
+//   - fsys: file system to be analyzed
+//   - opts: optional settings; nil uses the defaults
+func BuildPackageSectionFromFS2_1(packageName string, fsys fs.FS, opts *PackageOptions2_1) (*spdx.Package2_1, error) {
+	if opts == nil {
+		opts = &PackageOptions2_1{}
+	}
+
 	// build the file section first, so we'll have it available
 	// for calculating the package verification code
-	filepaths, err := utils.GetAllFilePaths(dirRoot, pathsIgnore)
+	fpOpts := &utils.FilePathOptions{
+		PathsIgnored:    opts.PathsIgnored,
+		IgnoreFileNames: opts.IgnoreFileNames,
+		SymlinkPolicy:   opts.SymlinkPolicy,
+	}
+	filepaths, err := utils.GetAllFilePathsFSWithOptions(fsys, fpOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	files := []*spdx.File2_1{}
-	fileNumber := 0
-	for _, fp := range filepaths {
-		newFile, err := BuildFileSection2_1(fp, dirRoot, fileNumber)
-		if err != nil {
-			return nil, err
-		}
-		files = append(files, newFile)
-		fileNumber++
+	b := &fileSectionBuilder{
+		fsys:        fsys,
+		cache:       opts.HashCache,
+		recordLinks: opts.SymlinkPolicy == utils.SymlinkRecord,
+		classifier:  opts.FileClassifier,
+	}
+	files, err := b.buildAll(filepaths, opts.NumWorkers)
+	if err != nil {
+		return nil, err
 	}
 
 	// get the verification code
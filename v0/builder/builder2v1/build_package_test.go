@@ -3,7 +3,14 @@
 package builder2v1
 
 import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"reflect"
 	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/utils"
 )
 
 // ===== Package section builder tests =====
@@ -144,3 +151,100 @@ func TestBuilder2_1CanIgnoreFiles(t *testing.T) {
 		t.Errorf("expected %v, got %v", want, got)
 	}
 }
+
+func TestBuilder2_1CanBuildPackageSectionFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"emptyfile.testdata.txt": {Data: []byte{}},
+		"sub/hello.txt":          {Data: []byte("goodbye")},
+	}
+
+	pkg, err := BuildPackageSectionFromFS2_1("inmemory", fsys, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if pkg.PackageSPDXIdentifier != "SPDXRef-Package-inmemory" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Package-inmemory", pkg.PackageSPDXIdentifier)
+	}
+	if len(pkg.Files) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(pkg.Files))
+	}
+	if pkg.Files[0].FileName != "/emptyfile.testdata.txt" {
+		t.Errorf("expected %v, got %v", "/emptyfile.testdata.txt", pkg.Files[0].FileName)
+	}
+	if pkg.Files[1].FileName != "/sub/hello.txt" {
+		t.Errorf("expected %v, got %v", "/sub/hello.txt", pkg.Files[1].FileName)
+	}
+	if pkg.Files[1].FileSPDXIdentifier != "SPDXRef-File1" {
+		t.Errorf("expected %v, got %v", "SPDXRef-File1", pkg.Files[1].FileSPDXIdentifier)
+	}
+	if pkg.Files[1].FileChecksumSHA1 != "3c8ec4874488f6090a157b014ce3397ca8e06d4f" {
+		t.Errorf("expected %v, got %v", "3c8ec4874488f6090a157b014ce3397ca8e06d4f", pkg.Files[1].FileChecksumSHA1)
+	}
+}
+
+func TestBuilder2_1CanBuildSamePackageSectionFromDirFS(t *testing.T) {
+	dirRoot := "../../../testdata/project1/"
+
+	dirPkg, err := BuildPackageSection2_1("project1", dirRoot, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	fsPkg, err := BuildPackageSectionFromFS2_1("project1", os.DirFS(dirRoot), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(dirPkg, fsPkg) {
+		t.Errorf("expected package from os.DirFS to match package from directory")
+	}
+}
+
+func TestBuilder2_1CanRecordSymlinksInPackageSection(t *testing.T) {
+	dirRoot := "../../../testdata/project1/"
+	opts := &PackageOptions2_1{SymlinkPolicy: utils.SymlinkRecord}
+
+	pkg, err := BuildPackageSectionWithOptions2_1("project1", dirRoot, opts)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkg.Files) != 6 {
+		t.Fatalf("expected %d, got %d", 6, len(pkg.Files))
+	}
+
+	link := pkg.Files[5]
+	if link.FileName != "/symbolic-link" {
+		t.Errorf("expected %v, got %v", "/symbolic-link", link.FileName)
+	}
+	if link.FileComment != "symbolic link to file3.testdata.txt" {
+		t.Errorf("expected %v, got %v", "symbolic link to file3.testdata.txt", link.FileComment)
+	}
+	// hashed as the text of the link's target
+	wantSHA1 := fmt.Sprintf("%x", sha1.Sum([]byte("file3.testdata.txt")))
+	if link.FileChecksumSHA1 != wantSHA1 {
+		t.Errorf("expected %v, got %v", wantSHA1, link.FileChecksumSHA1)
+	}
+}
+
+func TestBuilder2_1CanFollowSymlinksInPackageSection(t *testing.T) {
+	dirRoot := "../../../testdata/project1/"
+	opts := &PackageOptions2_1{SymlinkPolicy: utils.SymlinkFollow}
+
+	pkg, err := BuildPackageSectionWithOptions2_1("project1", dirRoot, opts)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkg.Files) != 6 {
+		t.Fatalf("expected %d, got %d", 6, len(pkg.Files))
+	}
+
+	// a followed link has the contents of its target
+	link := pkg.Files[5]
+	if link.FileName != "/symbolic-link" {
+		t.Errorf("expected %v, got %v", "/symbolic-link", link.FileName)
+	}
+	if link.FileChecksumSHA1 != pkg.Files[2].FileChecksumSHA1 {
+		t.Errorf("expected %v, got %v", pkg.Files[2].FileChecksumSHA1, link.FileChecksumSHA1)
+	}
+	if link.FileComment != "" {
+		t.Errorf("expected empty FileComment, got %v", link.FileComment)
+	}
+}
@@ -0,0 +1,603 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// BuildPythonPackages2_1 creates SPDX Packages (version 2.1) for the
+// Python packages that the project at the root of fsys depends on, along
+// with "DEPENDS_ON" Relationships from the root Package to each of them.
+// The packages are read from Pipfile.lock, poetry.lock and
+// requirements*.txt at the root of fsys, and from the METADATA files of
+// any *.dist-info directories (such as those in a virtual environment)
+// within it. A package found in several places gets a single Package, and
+// a requirement without a pinned version only gets a Package of its own if
+// no version of that package is found elsewhere.
+// Declared licenses come from the installed METADATA files, since the
+// other formats do not record them. Arguments:
+//   - fsys: file system containing the project
+//   - rootPkg: the project's Package, as built from its files
+func BuildPythonPackages2_1(fsys fs.FS, rootPkg *spdx.Package2_1) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	found := &pythonPackages{byKey: map[string]*pythonPackage{}}
+
+	data, err := fs.ReadFile(fsys, "Pipfile.lock")
+	if err == nil {
+		if err = found.addPipfileLock(data); err != nil {
+			return nil, nil, fmt.Errorf("Pipfile.lock: %v", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	data, err = fs.ReadFile(fsys, "poetry.lock")
+	if err == nil {
+		if err = found.addPoetryLock(data); err != nil {
+			return nil, nil, fmt.Errorf("poetry.lock: %v", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	reqFiles, err := fs.Glob(fsys, "requirements*.txt")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, reqFile := range reqFiles {
+		if err = found.addRequirements(fsys, reqFile, map[string]bool{}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || !strings.HasSuffix(p, ".dist-info") {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p+"/METADATA")
+		if errors.Is(err, fs.ErrNotExist) {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		found.addInstalled(parsePythonMetadata(data), path.Dir(p))
+		return fs.SkipDir
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all := found.pinned()
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if pythonNormalize(a.name) != pythonNormalize(b.name) {
+			return pythonNormalize(a.name) < pythonNormalize(b.name)
+		}
+		return a.version < b.version
+	})
+
+	ids := packageIDs{}
+	pkgs := []*spdx.Package2_1{}
+	rlns := []*spdx.Relationship2_1{}
+	for _, p := range all {
+		purlName := strings.ReplaceAll(strings.ToLower(p.name), "_", "-")
+		pkg := newDependencyPackage2_1(ids.next("pypi", p.name, p.version), p.name, p.version, buildPurl("pypi", "", purlName, p.version))
+		if p.downloadLocation != "" {
+			pkg.PackageDownloadLocation = p.downloadLocation
+		}
+
+		comments := p.comments
+		if len(p.hashes) == 1 && strings.HasPrefix(p.hashes[0], "sha256:") {
+			pkg.PackageChecksumSHA256 = strings.TrimPrefix(p.hashes[0], "sha256:")
+		} else {
+			for _, h := range p.hashes {
+				comments = append(comments, fmt.Sprintf("pinned hash: %s", h))
+			}
+		}
+		pkg.PackageComment = strings.Join(comments, "\n")
+		if p.license != "" {
+			pkg.PackageLicenseDeclared = p.license
+		}
+		pkg.PackageLicenseComments = strings.Join(p.licenseComments, "\n")
+
+		rlnComment := ""
+		if p.dev {
+			rlnComment = "development dependency"
+		}
+		pkgs = append(pkgs, pkg)
+		rlns = append(rlns, dependsOn(rootPkg.PackageSPDXIdentifier, pkg.PackageSPDXIdentifier, rlnComment))
+	}
+
+	return pkgs, rlns, nil
+}
+
+// pythonPackage is a Python package found in a lockfile, requirements
+// file or installed METADATA file.
+type pythonPackage struct {
+	name             string
+	version          string
+	downloadLocation string
+	hashes           []string
+	dev              bool
+	license          string
+	licenseComments  []string
+	comments         []string
+}
+
+// pythonPackages collects the Python packages found so far, merging the
+// entries for the same version of a package.
+type pythonPackages struct {
+	all   []*pythonPackage
+	byKey map[string]*pythonPackage
+}
+
+// add records a package, or merges it into an earlier entry for the same
+// version of the same package.
+func (pp *pythonPackages) add(p *pythonPackage) *pythonPackage {
+	key := pythonNormalize(p.name) + "==" + p.version
+	prev, ok := pp.byKey[key]
+	if !ok {
+		pp.byKey[key] = p
+		pp.all = append(pp.all, p)
+		return p
+	}
+
+	// a package that any source says is needed at runtime is not only a
+	// development dependency
+	prev.dev = prev.dev && p.dev
+	for _, h := range p.hashes {
+		if !containsString(prev.hashes, h) {
+			prev.hashes = append(prev.hashes, h)
+		}
+	}
+	if prev.downloadLocation == "" {
+		prev.downloadLocation = p.downloadLocation
+	}
+	if prev.license == "" && len(prev.licenseComments) == 0 {
+		prev.license, prev.licenseComments = p.license, p.licenseComments
+	}
+	return prev
+}
+
+// addPipfileLock adds the packages in a Pipfile.lock file.
+func (pp *pythonPackages) addPipfileLock(data []byte) error {
+	type pipfileEntry struct {
+		Version string   `json:"version"`
+		Hashes  []string `json:"hashes"`
+		Git     string   `json:"git"`
+		Ref     string   `json:"ref"`
+		File    string   `json:"file"`
+	}
+	lock := struct {
+		Default map[string]*pipfileEntry `json:"default"`
+		Develop map[string]*pipfileEntry `json:"develop"`
+	}{}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return err
+	}
+
+	for _, group := range []struct {
+		entries map[string]*pipfileEntry
+		dev     bool
+	}{{lock.Default, false}, {lock.Develop, true}} {
+		names := []string{}
+		for name := range group.entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e := group.entries[name]
+			p := &pythonPackage{
+				name:    name,
+				version: strings.TrimPrefix(e.Version, "=="),
+				hashes:  e.Hashes,
+				dev:     group.dev,
+			}
+			switch {
+			case e.Git != "":
+				p.downloadLocation = vcsLocation("git", e.Git, e.Ref)
+			case strings.Contains(e.File, "://"):
+				p.downloadLocation = e.File
+			}
+			pp.add(p)
+		}
+	}
+	return nil
+}
+
+// addPoetryLock adds the packages in a poetry.lock file.
+func (pp *pythonPackages) addPoetryLock(data []byte) error {
+	lock, err := utils.ParseTOML(data)
+	if err != nil {
+		return err
+	}
+
+	// older versions of poetry list the files in a separate table
+	metadataFiles := map[string]interface{}{}
+	if metadata, ok := lock["metadata"].(map[string]interface{}); ok {
+		if files, ok := metadata["files"].(map[string]interface{}); ok {
+			metadataFiles = files
+		}
+	}
+
+	pkgList, _ := lock["package"].([]interface{})
+	for _, item := range pkgList {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := entry["name"].(string)
+		version, _ := entry["version"].(string)
+		if name == "" || version == "" {
+			return errors.New("package without name or version")
+		}
+		category, _ := entry["category"].(string)
+		p := &pythonPackage{name: name, version: version, dev: category == "dev"}
+
+		files, ok := entry["files"].([]interface{})
+		if !ok {
+			files, _ = metadataFiles[name].([]interface{})
+		}
+		for _, f := range files {
+			if file, ok := f.(map[string]interface{}); ok {
+				if h, ok := file["hash"].(string); ok && h != "" {
+					p.hashes = append(p.hashes, h)
+				}
+			}
+		}
+
+		if source, ok := entry["source"].(map[string]interface{}); ok {
+			sourceType, _ := source["type"].(string)
+			url, _ := source["url"].(string)
+			switch sourceType {
+			case "git":
+				ref, _ := source["resolved_reference"].(string)
+				p.downloadLocation = vcsLocation("git", url, ref)
+			case "url":
+				p.downloadLocation = url
+			}
+		}
+		pp.add(p)
+	}
+	return nil
+}
+
+// requirementPattern matches a requirement specifier: a project name,
+// optional extras and an optional version specifier or direct reference.
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*(.*)$`)
+
+// addRequirements adds the packages in a pip requirements file, following
+// any "-r" includes. visited guards against include cycles.
+func (pp *pythonPackages) addRequirements(fsys fs.FS, reqFile string, visited map[string]bool) error {
+	if visited[reqFile] {
+		return nil
+	}
+	visited[reqFile] = true
+
+	f, err := fsys.Open(reqFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	logical := ""
+	scanner := bufio.NewScanner(f)
+	lines := []string{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasSuffix(line, "\\") {
+			logical += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		lines = append(lines, logical+line)
+		logical = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if logical != "" {
+		lines = append(lines, logical)
+	}
+
+	for _, line := range lines {
+		// comments start with "#" at the beginning of the line or after
+		// whitespace
+		if i := strings.Index(line, "#"); i == 0 {
+			line = ""
+		} else if i = strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if opt, arg := splitRequirementOption(fields); opt != "" {
+			switch opt {
+			case "-r", "--requirement":
+				included := path.Join(path.Dir(reqFile), arg)
+				if err := pp.addRequirements(fsys, included, visited); err != nil {
+					return fmt.Errorf("%s: %v", reqFile, err)
+				}
+			case "-e", "--editable":
+				// only editable installs from version control have a
+				// usable name and location
+				if i := strings.Index(arg, "#egg="); i >= 0 && strings.Contains(arg, "://") {
+					pp.add(&pythonPackage{name: arg[i+len("#egg="):], downloadLocation: arg[:i]})
+				}
+			}
+			continue
+		}
+
+		p, err := parseRequirement(fields)
+		if err != nil {
+			return fmt.Errorf("%s: %v", reqFile, err)
+		}
+		pp.add(p)
+	}
+	return nil
+}
+
+// splitRequirementOption returns the option and its argument if a
+// requirements file line is an option rather than a requirement.
+func splitRequirementOption(fields []string) (string, string) {
+	if !strings.HasPrefix(fields[0], "-") {
+		return "", ""
+	}
+	if i := strings.Index(fields[0], "="); i >= 0 {
+		return fields[0][:i], fields[0][i+1:]
+	}
+	if strings.HasPrefix(fields[0], "-r") && len(fields[0]) > 2 {
+		return "-r", fields[0][2:]
+	}
+	if len(fields) > 1 {
+		return fields[0], fields[1]
+	}
+	return fields[0], ""
+}
+
+// parseRequirement parses a single requirement, given as the fields of
+// its line in a requirements file.
+func parseRequirement(fields []string) (*pythonPackage, error) {
+	specFields := []string{}
+	hashes := []string{}
+	for i := 0; i < len(fields); i++ {
+		switch {
+		case strings.HasPrefix(fields[i], "--hash="):
+			hashes = append(hashes, strings.TrimPrefix(fields[i], "--hash="))
+		case fields[i] == "--hash" && i+1 < len(fields):
+			hashes = append(hashes, fields[i+1])
+			i++
+		case strings.HasPrefix(fields[i], "--"):
+			// other per-requirement options
+		default:
+			specFields = append(specFields, fields[i])
+		}
+	}
+
+	spec := strings.Join(specFields, " ")
+	if i := strings.Index(spec, ";"); i >= 0 {
+		// environment markers
+		spec = strings.TrimSpace(spec[:i])
+	}
+	m := requirementPattern.FindStringSubmatch(spec)
+	if m == nil {
+		return nil, fmt.Errorf("invalid requirement %q", spec)
+	}
+
+	p := &pythonPackage{name: m[1], hashes: hashes}
+	constraint := strings.TrimSpace(m[3])
+	switch {
+	case constraint == "":
+	case strings.HasPrefix(constraint, "@"):
+		p.downloadLocation = strings.TrimSpace(constraint[1:])
+	case (strings.HasPrefix(constraint, "==") || strings.HasPrefix(constraint, "===")) &&
+		!strings.ContainsAny(constraint, ",*"):
+		p.version = strings.TrimSpace(strings.TrimLeft(constraint, "="))
+	default:
+		p.comments = append(p.comments, fmt.Sprintf("version constraint: %s", constraint))
+	}
+	return p, nil
+}
+
+// addInstalled adds an installed package described by the fields of its
+// METADATA file, found in the directory dir.
+func (pp *pythonPackages) addInstalled(meta map[string][]string, dir string) {
+	name := firstValue(meta, "Name")
+	version := firstValue(meta, "Version")
+	if name == "" {
+		return
+	}
+
+	license, comments := pythonLicense(meta)
+	p := pp.add(&pythonPackage{
+		name:            name,
+		version:         version,
+		license:         license,
+		licenseComments: comments,
+	})
+	p.comments = append(p.comments, fmt.Sprintf("installed in %s", dir))
+}
+
+// pinned returns the packages found, leaving out any package without a
+// version (such as an unpinned requirement) if the same package was also
+// found with a version.
+func (pp *pythonPackages) pinned() []*pythonPackage {
+	hasVersion := map[string]bool{}
+	for _, p := range pp.all {
+		if p.version != "" {
+			hasVersion[pythonNormalize(p.name)] = true
+		}
+	}
+	pkgs := []*pythonPackage{}
+	for _, p := range pp.all {
+		if p.version != "" || !hasVersion[pythonNormalize(p.name)] {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs
+}
+
+// parsePythonMetadata parses the header fields of a core metadata file
+// (METADATA or PKG-INFO), which use the email header format.
+func parsePythonMetadata(data []byte) map[string][]string {
+	meta := map[string][]string{}
+	lastKey := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			// the description follows the headers
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && lastKey != "" {
+			vals := meta[lastKey]
+			vals[len(vals)-1] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		lastKey = strings.TrimSpace(line[:i])
+		meta[lastKey] = append(meta[lastKey], strings.TrimSpace(line[i+1:]))
+	}
+	return meta
+}
+
+// pythonLicenseClassifiers maps trove classifiers to SPDX license
+// identifiers. Classifiers that cover several licenses, such as
+// "License :: OSI Approved :: BSD License", are left out.
+var pythonLicenseClassifiers = map[string]string{
+	"License :: OSI Approved :: Apache Software License":                                    "Apache-2.0",
+	"License :: OSI Approved :: Boost Software License 1.0 (BSL-1.0)":                       "BSL-1.0",
+	"License :: OSI Approved :: Eclipse Public License 2.0 (EPL-2.0)":                       "EPL-2.0",
+	"License :: OSI Approved :: European Union Public Licence 1.2 (EUPL 1.2)":               "EUPL-1.2",
+	"License :: OSI Approved :: GNU Affero General Public License v3":                       "AGPL-3.0-only",
+	"License :: OSI Approved :: GNU Affero General Public License v3 or later (AGPLv3+)":    "AGPL-3.0-or-later",
+	"License :: OSI Approved :: GNU General Public License v2 (GPLv2)":                      "GPL-2.0-only",
+	"License :: OSI Approved :: GNU General Public License v2 or later (GPLv2+)":            "GPL-2.0-or-later",
+	"License :: OSI Approved :: GNU General Public License v3 (GPLv3)":                      "GPL-3.0-only",
+	"License :: OSI Approved :: GNU General Public License v3 or later (GPLv3+)":            "GPL-3.0-or-later",
+	"License :: OSI Approved :: GNU Lesser General Public License v2 (LGPLv2)":              "LGPL-2.0-only",
+	"License :: OSI Approved :: GNU Lesser General Public License v2 or later (LGPLv2+)":    "LGPL-2.0-or-later",
+	"License :: OSI Approved :: GNU Lesser General Public License v3 (LGPLv3)":              "LGPL-3.0-only",
+	"License :: OSI Approved :: GNU Lesser General Public License v3 or later (LGPLv3+)":    "LGPL-3.0-or-later",
+	"License :: OSI Approved :: ISC License (ISCL)":                                         "ISC",
+	"License :: OSI Approved :: MIT License":                                                "MIT",
+	"License :: OSI Approved :: MIT No Attribution License (MIT-0)":                         "MIT-0",
+	"License :: OSI Approved :: Mozilla Public License 1.1 (MPL 1.1)":                       "MPL-1.1",
+	"License :: OSI Approved :: Mozilla Public License 2.0 (MPL 2.0)":                       "MPL-2.0",
+	"License :: OSI Approved :: Python Software Foundation License":                         "PSF-2.0",
+	"License :: OSI Approved :: The Unlicense (Unlicense)":                                  "Unlicense",
+	"License :: OSI Approved :: zlib/libpng License":                                        "Zlib",
+	"License :: CC0 1.0 Universal (CC0 1.0) Public Domain Dedication":                       "CC0-1.0",
+	"License :: OSI Approved :: Universal Permissive License (UPL)":                         "UPL-1.0",
+	"License :: OSI Approved :: Historical Permission Notice and Disclaimer (HPND)":         "HPND",
+	"License :: OSI Approved :: Common Development and Distribution License 1.0 (CDDL-1.0)": "CDDL-1.0",
+}
+
+// pythonLicense returns the declared license of an installed package,
+// from its License-Expression field, its license classifiers or its
+// License field, in that order of preference, along with comments about
+// any license information that could not be used.
+func pythonLicense(meta map[string][]string) (string, []string) {
+	comments := []string{}
+
+	ids := []string{}
+	for _, c := range meta["Classifier"] {
+		if !strings.HasPrefix(c, "License ::") {
+			continue
+		}
+		if id, ok := pythonLicenseClassifiers[c]; ok {
+			if !containsString(ids, id) {
+				ids = append(ids, id)
+			}
+		} else if c != "License :: OSI Approved" {
+			comments = append(comments, fmt.Sprintf("license classifier: %s", c))
+		}
+	}
+
+	licenseField := firstValue(meta, "License")
+	known := false
+	for _, id := range pythonLicenseClassifiers {
+		if licenseField == id {
+			known = true
+		}
+	}
+
+	declared := ""
+	switch {
+	case firstValue(meta, "License-Expression") != "":
+		declared = firstValue(meta, "License-Expression")
+	case len(ids) == 1:
+		declared = ids[0]
+	case len(ids) > 1:
+		// several license classifiers mean that the package can be used
+		// under any of them
+		declared = "(" + strings.Join(ids, " OR ") + ")"
+	case known:
+		declared = licenseField
+		licenseField = ""
+	}
+
+	switch {
+	case licenseField == "" || licenseField == "UNKNOWN" || licenseField == declared:
+	case strings.Contains(licenseField, "\n") || len(licenseField) > 100:
+		comments = append(comments, "License field contains license text")
+	default:
+		comments = append(comments, fmt.Sprintf("License field: %s", licenseField))
+	}
+	return declared, comments
+}
+
+// pythonNormalize returns the normalized form of a Python project name,
+// as defined in PEP 503.
+func pythonNormalize(name string) string {
+	return strings.ToLower(pythonSeparators.ReplaceAllString(name, "-"))
+}
+
+var pythonSeparators = regexp.MustCompile(`[-_.]+`)
+
+// vcsLocation returns a download location such as
+// "git+https://example.com/repo.git@ref".
+func vcsLocation(vcs string, url string, ref string) string {
+	loc := url
+	if !strings.HasPrefix(loc, vcs+"+") {
+		loc = vcs + "+" + loc
+	}
+	if ref != "" {
+		loc += "@" + ref
+	}
+	return loc
+}
+
+func firstValue(meta map[string][]string, key string) string {
+	if vals := meta[key]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
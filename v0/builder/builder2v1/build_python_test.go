@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Python Package builder tests =====
+func TestBuildPythonPackagesReadsRequirements(t *testing.T) {
+	fsys := fstest.MapFS{
+		"requirements.txt": {Data: []byte(`# production requirements
+--index-url https://pypi.org/simple
+requests==2.31.0 \
+    --hash=sha256:58cd2187c01e70e6e26505bca751777aa9f2ee0b7f4300988b709f44e013003f
+Django_Allauth[socialaccount]>=0.50 ; python_version >= "3.8"
+pinned-twice==1.0 --hash=sha256:aaaa --hash=sha256:bbbb
+mylib @ https://example.com/mylib-1.0.tar.gz
+-r requirements/base.txt
+-e git+https://github.com/example/editable.git#egg=editable
+-e ./local/path
+`)},
+		"requirements/base.txt": {Data: []byte("six===1.16.0  # pinned\n-r ../requirements.txt\n")},
+		"requirements-dev.txt":  {Data: []byte("pytest\n")},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildPythonPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 7 || len(rlns) != 7 {
+		t.Fatalf("expected 7 packages and relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+
+	for i, want := range []struct {
+		name, version, download, purl, comment string
+	}{
+		{"Django_Allauth", "", "NOASSERTION", "pkg:pypi/django-allauth", "version constraint: >=0.50"},
+		{"editable", "", "git+https://github.com/example/editable.git", "pkg:pypi/editable", ""},
+		{"mylib", "", "https://example.com/mylib-1.0.tar.gz", "pkg:pypi/mylib", ""},
+		{"pinned-twice", "1.0", "NOASSERTION", "pkg:pypi/pinned-twice@1.0", "pinned hash: sha256:aaaa\npinned hash: sha256:bbbb"},
+		{"pytest", "", "NOASSERTION", "pkg:pypi/pytest", ""},
+		{"requests", "2.31.0", "NOASSERTION", "pkg:pypi/requests@2.31.0", ""},
+		{"six", "1.16.0", "NOASSERTION", "pkg:pypi/six@1.16.0", ""},
+	} {
+		pkg := pkgs[i]
+		if pkg.PackageName != want.name || pkg.PackageVersion != want.version {
+			t.Errorf("%d: expected %v %v, got %v %v", i, want.name, want.version, pkg.PackageName, pkg.PackageVersion)
+		}
+		if pkg.PackageDownloadLocation != want.download {
+			t.Errorf("%d: expected %v, got %v", i, want.download, pkg.PackageDownloadLocation)
+		}
+		if pkg.PackageExternalReferences[0].Locator != want.purl {
+			t.Errorf("%d: expected %v, got %v", i, want.purl, pkg.PackageExternalReferences[0].Locator)
+		}
+		if pkg.PackageComment != want.comment {
+			t.Errorf("%d: expected %q, got %q", i, want.comment, pkg.PackageComment)
+		}
+		if rlns[i].RefA != "SPDXRef-Package-app" || rlns[i].RefB != pkg.PackageSPDXIdentifier || rlns[i].Relationship != "DEPENDS_ON" {
+			t.Errorf("%d: expected DEPENDS_ON from root package, got %+v", i, rlns[i])
+		}
+	}
+	if pkgs[5].PackageChecksumSHA256 != "58cd2187c01e70e6e26505bca751777aa9f2ee0b7f4300988b709f44e013003f" {
+		t.Errorf("expected checksum, got %v", pkgs[5].PackageChecksumSHA256)
+	}
+}
+
+func TestBuildPythonPackagesReadsPipfileLock(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Pipfile.lock": {Data: []byte(`{
+  "_meta": {"hash": {"sha256": "x"}},
+  "default": {
+    "certifi": {"hashes": ["sha256:1111"], "version": "==2023.7.22"},
+    "forked": {"git": "https://github.com/example/forked.git", "ref": "abc123"}
+  },
+  "develop": {
+    "certifi": {"hashes": ["sha256:1111"], "version": "==2023.7.22"},
+    "pytest": {"hashes": ["sha256:2222", "sha256:3333"], "version": "==7.4.0"}
+  }
+}`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildPythonPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(pkgs))
+	}
+	if pkgs[0].PackageName != "certifi" || pkgs[0].PackageChecksumSHA256 != "1111" {
+		t.Errorf("expected certifi with checksum 1111, got %v with %v", pkgs[0].PackageName, pkgs[0].PackageChecksumSHA256)
+	}
+	if rlns[0].RelationshipComment != "" {
+		t.Errorf("expected runtime dependency, got %q", rlns[0].RelationshipComment)
+	}
+	if pkgs[1].PackageDownloadLocation != "git+https://github.com/example/forked.git@abc123" {
+		t.Errorf("expected %v, got %v", "git+https://github.com/example/forked.git@abc123", pkgs[1].PackageDownloadLocation)
+	}
+	if pkgs[2].PackageName != "pytest" || rlns[2].RelationshipComment != "development dependency" {
+		t.Errorf("expected pytest as development dependency, got %v with %q", pkgs[2].PackageName, rlns[2].RelationshipComment)
+	}
+}
+
+func TestBuildPythonPackagesReadsPoetryLock(t *testing.T) {
+	fsys := fstest.MapFS{
+		"poetry.lock": {Data: []byte(`# This file is automatically @generated by Poetry and should not be changed by hand.
+
+[[package]]
+name = "attrs"
+version = "23.1.0"
+description = "Classes Without Boilerplate"
+optional = false
+python-versions = ">=3.7"
+files = [
+    {file = "attrs-23.1.0-py3-none-any.whl", hash = "sha256:1f28b4522cdc2fb4256ac1a020c78acf9cba2c6b461ccd2c126f3aa8e8335d04"},
+]
+
+[package.extras]
+tests = ["pytest"]
+
+[[package]]
+name = "old-style"
+version = "0.1"
+description = ""
+category = "dev"
+optional = false
+python-versions = "*"
+
+[[package]]
+name = "from-git"
+version = "1.0"
+description = ""
+optional = false
+python-versions = "*"
+files = []
+
+[package.source]
+type = "git"
+url = "https://github.com/example/from-git.git"
+reference = "main"
+resolved_reference = "deadbeef"
+
+[metadata]
+lock-version = "2.0"
+python-versions = "^3.9"
+content-hash = "abc"
+
+[metadata.files]
+old-style = [
+    {file = "old_style-0.1.tar.gz", hash = "sha256:4444"},
+]
+`)},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, rlns, err := BuildPythonPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 3 {
+		t.Fatalf("expected %d, got %d", 3, len(pkgs))
+	}
+	if pkgs[0].PackageName != "attrs" || pkgs[0].PackageChecksumSHA256 != "1f28b4522cdc2fb4256ac1a020c78acf9cba2c6b461ccd2c126f3aa8e8335d04" {
+		t.Errorf("expected attrs with checksum, got %v with %v", pkgs[0].PackageName, pkgs[0].PackageChecksumSHA256)
+	}
+	if pkgs[1].PackageName != "from-git" || pkgs[1].PackageDownloadLocation != "git+https://github.com/example/from-git.git@deadbeef" {
+		t.Errorf("expected from-git with git location, got %v with %v", pkgs[1].PackageName, pkgs[1].PackageDownloadLocation)
+	}
+	if pkgs[2].PackageName != "old-style" || pkgs[2].PackageChecksumSHA256 != "4444" {
+		t.Errorf("expected old-style with checksum 4444, got %v with %v", pkgs[2].PackageName, pkgs[2].PackageChecksumSHA256)
+	}
+	if rlns[2].RelationshipComment != "development dependency" {
+		t.Errorf("expected %v, got %v", "development dependency", rlns[2].RelationshipComment)
+	}
+}
+
+func TestBuildPythonPackagesReadsInstalledMetadata(t *testing.T) {
+	fsys := fstest.MapFS{
+		"requirements.txt": {Data: []byte("requests\nclassified==1.0\n")},
+		"venv/lib/python3.11/site-packages/requests-2.31.0.dist-info/METADATA": {Data: []byte(`Metadata-Version: 2.1
+Name: requests
+Version: 2.31.0
+License: Apache 2.0
+Classifier: License :: OSI Approved :: Apache Software License
+Classifier: Programming Language :: Python
+
+Long description here.
+License: not a header
+`)},
+		"venv/lib/python3.11/site-packages/classified-1.0.dist-info/METADATA": {Data: []byte(`Metadata-Version: 2.1
+Name: Classified
+Version: 1.0
+License: Copyright (c) Someone
+        Permission is hereby granted...
+Classifier: License :: OSI Approved :: MIT License
+Classifier: License :: OSI Approved :: BSD License
+Classifier: License :: OSI Approved :: GNU General Public License v2 (GPLv2)
+`)},
+		"venv/lib/python3.11/site-packages/modern-2.0.dist-info/METADATA": {Data: []byte(`Metadata-Version: 2.4
+Name: modern
+Version: 2.0
+License-Expression: MIT OR Apache-2.0
+`)},
+		"venv/lib/python3.11/site-packages/plain-0.1.dist-info/METADATA": {Data: []byte("Name: plain\nVersion: 0.1\nLicense: MIT\n")},
+	}
+	rootPkg := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-app"}
+
+	pkgs, _, err := BuildPythonPackages2_1(fsys, rootPkg)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 4 {
+		t.Fatalf("expected %d, got %d", 4, len(pkgs))
+	}
+
+	got := [][3]string{}
+	for _, pkg := range pkgs {
+		got = append(got, [3]string{pkg.PackageName, pkg.PackageVersion, pkg.PackageLicenseDeclared})
+	}
+	want := [][3]string{
+		{"classified", "1.0", "(MIT OR GPL-2.0-only)"},
+		{"modern", "2.0", "MIT OR Apache-2.0"},
+		{"plain", "0.1", "MIT"},
+		{"requests", "2.31.0", "Apache-2.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	wantComments := "license classifier: License :: OSI Approved :: BSD License\nLicense field contains license text"
+	if pkgs[0].PackageLicenseComments != wantComments {
+		t.Errorf("expected %q, got %q", wantComments, pkgs[0].PackageLicenseComments)
+	}
+	if pkgs[3].PackageLicenseComments != "License field: Apache 2.0" {
+		t.Errorf("expected %q, got %q", "License field: Apache 2.0", pkgs[3].PackageLicenseComments)
+	}
+	wantComment := "installed in venv/lib/python3.11/site-packages"
+	if pkgs[3].PackageComment != wantComment {
+		t.Errorf("expected %q, got %q", wantComment, pkgs[3].PackageComment)
+	}
+}
+
+func TestBuildPythonPackagesFailsForInvalidFiles(t *testing.T) {
+	for _, fsys := range []fstest.MapFS{
+		{"Pipfile.lock": {Data: []byte(`{"default": [`)}},
+		{"poetry.lock": {Data: []byte("[[package]]\nname = \"x\"\n")}},
+		{"poetry.lock": {Data: []byte("[[package]\n")}},
+		{"requirements.txt": {Data: []byte("!!!\n")}},
+		{"requirements.txt": {Data: []byte("-r missing.txt\n")}},
+	} {
+		_, _, err := BuildPythonPackages2_1(fsys, &spdx.Package2_1{})
+		if err == nil {
+			t.Errorf("expected non-nil error for %v, got nil", fsys)
+		}
+	}
+}
@@ -4,8 +4,11 @@ package builder2v1
 
 import (
 	"fmt"
+	"io/fs"
+	"strings"
 
 	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
 )
 
 // BuildRelationshipSection2_1 creates an SPDX Relationship (version 2.1)
@@ -21,3 +24,47 @@ func BuildRelationshipSection2_1(packageName string) (*spdx.Relationship2_1, err
 
 	return rln, nil
 }
+
+// BuildSymlinkRelationships2_1 creates SPDX Relationships (version 2.1)
+// from each File that is a symbolic link to the File it points to, if the
+// link's target is a file within fsys. It returns those relationships or
+// error if any is encountered. Arguments:
+//   - fsys: file system containing the files
+//   - files: the Package's Files, as built with utils.SymlinkRecord
+func BuildSymlinkRelationships2_1(fsys fs.FS, files []*spdx.File2_1) ([]*spdx.Relationship2_1, error) {
+	ids := map[string]string{}
+	for _, f := range files {
+		ids[f.FileName] = f.FileSPDXIdentifier
+	}
+
+	rlns := []*spdx.Relationship2_1{}
+	for _, f := range files {
+		fi, err := utils.Lstat(fsys, strings.TrimPrefix(f.FileName, "/"))
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&fs.ModeSymlink != fs.ModeSymlink {
+			continue
+		}
+
+		// links that point outside the tree, to directories, or to files
+		// that were ignored have no File to relate to
+		target, err := utils.EvalSymlinksFS(fsys, f.FileName)
+		if err != nil {
+			continue
+		}
+		targetID, ok := ids["/"+target]
+		if !ok {
+			continue
+		}
+
+		rlns = append(rlns, &spdx.Relationship2_1{
+			RefA:                f.FileSPDXIdentifier,
+			RefB:                targetID,
+			Relationship:        "OTHER",
+			RelationshipComment: "symbolic link to target file",
+		})
+	}
+
+	return rlns, nil
+}
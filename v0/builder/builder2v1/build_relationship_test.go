@@ -3,7 +3,11 @@
 package builder2v1
 
 import (
+	"io/fs"
 	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
 )
 
 // ===== Relationship section builder tests =====
@@ -29,3 +33,42 @@ func TestBuilder2_1CanBuildRelationshipSection(t *testing.T) {
 	}
 
 }
+
+func TestBuilder2_1CanBuildSymlinkRelationships(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file.txt":    {Data: []byte("x")},
+		"link":          {Data: []byte("a/file.txt"), Mode: fs.ModeSymlink},
+		"dirlink":       {Data: []byte("a"), Mode: fs.ModeSymlink},
+		"outside":       {Data: []byte("/etc/passwd"), Mode: fs.ModeSymlink},
+		"a/relativeUp":  {Data: []byte("../link"), Mode: fs.ModeSymlink},
+		"a/ignoredLink": {Data: []byte("ignored.txt"), Mode: fs.ModeSymlink},
+	}
+	files := []*spdx.File2_1{
+		{FileName: "/a/file.txt", FileSPDXIdentifier: "SPDXRef-File0"},
+		{FileName: "/a/ignoredLink", FileSPDXIdentifier: "SPDXRef-File1"},
+		{FileName: "/a/relativeUp", FileSPDXIdentifier: "SPDXRef-File2"},
+		{FileName: "/dirlink", FileSPDXIdentifier: "SPDXRef-File3"},
+		{FileName: "/link", FileSPDXIdentifier: "SPDXRef-File4"},
+		{FileName: "/outside", FileSPDXIdentifier: "SPDXRef-File5"},
+	}
+
+	rlns, err := BuildSymlinkRelationships2_1(fsys, files)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(rlns) != 2 {
+		t.Fatalf("expected %d, got %d", 2, len(rlns))
+	}
+	if rlns[0].RefA != "SPDXRef-File2" || rlns[0].RefB != "SPDXRef-File0" {
+		t.Errorf("expected %v -> %v, got %v -> %v", "SPDXRef-File2", "SPDXRef-File0", rlns[0].RefA, rlns[0].RefB)
+	}
+	if rlns[1].RefA != "SPDXRef-File4" || rlns[1].RefB != "SPDXRef-File0" {
+		t.Errorf("expected %v -> %v, got %v -> %v", "SPDXRef-File4", "SPDXRef-File0", rlns[1].RefA, rlns[1].RefB)
+	}
+	if rlns[1].Relationship != "OTHER" {
+		t.Errorf("expected %v, got %v", "OTHER", rlns[1].Relationship)
+	}
+	if rlns[1].RelationshipComment != "symbolic link to target file" {
+		t.Errorf("expected %v, got %v", "symbolic link to target file", rlns[1].RelationshipComment)
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// BuildSnippetSection2_1 creates an SPDX Snippet (version 2.1) for part of
+// a File's contents, and attaches it to the File's Snippets. The Snippet's
+// identifier is numbered by its position in the File's Snippets, and its
+// byte and line ranges are filled in from content. Arguments:
+//   - f: File that the Snippet is part of
+//   - content: contents of the file
+//   - byteStart: offset of the first byte of the Snippet within content
+//   - byteEnd: offset of the end of the Snippet (exclusive)
+//   - licenses: license IDs found in the Snippet, for LicenseInfoInSnippet
+func BuildSnippetSection2_1(f *spdx.File2_1, content []byte, byteStart int, byteEnd int, licenses []string) (*spdx.Snippet2_1, error) {
+	if byteStart < 0 || byteEnd <= byteStart || byteEnd > len(content) {
+		return nil, fmt.Errorf("invalid snippet range %d:%d for %s of %d bytes", byteStart, byteEnd, f.FileName, len(content))
+	}
+
+	lics := licenses
+	if len(lics) == 0 {
+		lics = []string{"NOASSERTION"}
+	}
+
+	// SPDX byte and line ranges start at 1, and include their ends
+	startLine := bytes.Count(content[:byteStart], []byte("\n")) + 1
+	endLine := startLine + bytes.Count(content[byteStart:byteEnd-1], []byte("\n"))
+
+	sn := &spdx.Snippet2_1{
+		SnippetSPDXIdentifier:         fmt.Sprintf("SPDXRef-Snippet-%s-%d", strings.TrimPrefix(f.FileSPDXIdentifier, "SPDXRef-"), len(f.Snippets)+1),
+		SnippetFromFileSPDXIdentifier: f.FileSPDXIdentifier,
+		SnippetByteRangeStart:         byteStart + 1,
+		SnippetByteRangeEnd:           byteEnd,
+		SnippetLineRangeStart:         startLine,
+		SnippetLineRangeEnd:           endLine,
+		SnippetLicenseConcluded:       "NOASSERTION",
+		LicenseInfoInSnippet:          lics,
+		SnippetCopyrightText:          "NOASSERTION",
+	}
+	f.Snippets = append(f.Snippets, sn)
+	return sn, nil
+}
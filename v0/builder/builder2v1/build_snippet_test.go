@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"testing"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Snippet section builder tests =====
+func TestBuilder2_1CanBuildSnippetSection(t *testing.T) {
+	f := &spdx.File2_1{FileName: "/main.c", FileSPDXIdentifier: "SPDXRef-File3"}
+	content := []byte("int a;\n/* MIT license\n * text */\nint b;\n")
+	start := 7
+	end := 32
+
+	sn, err := BuildSnippetSection2_1(f, content, start, end, []string{"MIT"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(f.Snippets) != 1 || f.Snippets[0] != sn {
+		t.Fatalf("expected snippet to be attached to file, got %v", f.Snippets)
+	}
+	if sn.SnippetSPDXIdentifier != "SPDXRef-Snippet-File3-1" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Snippet-File3-1", sn.SnippetSPDXIdentifier)
+	}
+	if sn.SnippetFromFileSPDXIdentifier != "SPDXRef-File3" {
+		t.Errorf("expected %v, got %v", "SPDXRef-File3", sn.SnippetFromFileSPDXIdentifier)
+	}
+	if sn.SnippetByteRangeStart != 8 || sn.SnippetByteRangeEnd != 32 {
+		t.Errorf("expected %v, got %d:%d", "8:32", sn.SnippetByteRangeStart, sn.SnippetByteRangeEnd)
+	}
+	if sn.SnippetLineRangeStart != 2 || sn.SnippetLineRangeEnd != 3 {
+		t.Errorf("expected %v, got %d:%d", "2:3", sn.SnippetLineRangeStart, sn.SnippetLineRangeEnd)
+	}
+	if len(sn.LicenseInfoInSnippet) != 1 || sn.LicenseInfoInSnippet[0] != "MIT" {
+		t.Errorf("expected %v, got %v", []string{"MIT"}, sn.LicenseInfoInSnippet)
+	}
+	if sn.SnippetLicenseConcluded != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", sn.SnippetLicenseConcluded)
+	}
+	if sn.SnippetCopyrightText != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", sn.SnippetCopyrightText)
+	}
+
+	// a range ending with a newline does not extend to the next line
+	sn, err = BuildSnippetSection2_1(f, content, 0, 7, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if sn.SnippetSPDXIdentifier != "SPDXRef-Snippet-File3-2" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Snippet-File3-2", sn.SnippetSPDXIdentifier)
+	}
+	if sn.SnippetLineRangeStart != 1 || sn.SnippetLineRangeEnd != 1 {
+		t.Errorf("expected %v, got %d:%d", "1:1", sn.SnippetLineRangeStart, sn.SnippetLineRangeEnd)
+	}
+	if len(sn.LicenseInfoInSnippet) != 1 || sn.LicenseInfoInSnippet[0] != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", []string{"NOASSERTION"}, sn.LicenseInfoInSnippet)
+	}
+}
+
+func TestBuilder2_1SnippetSectionFailsWithInvalidRange(t *testing.T) {
+	f := &spdx.File2_1{FileName: "/main.c", FileSPDXIdentifier: "SPDXRef-File3"}
+	content := []byte("int a;\n")
+	for _, r := range [][2]int{{-1, 3}, {3, 3}, {4, 2}, {0, 8}} {
+		if _, err := BuildSnippetSection2_1(f, content, r[0], r[1], nil); err == nil {
+			t.Errorf("expected non-nil error for range %v, got nil", r)
+		}
+	}
+	if len(f.Snippets) != 0 {
+		t.Errorf("expected no snippets, got %v", f.Snippets)
+	}
+}
@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// SubPackageRule describes directories whose files form a Package of their
+// own, such as a vendored copy of an upstream project, rather than being
+// part of the Package for the whole tree. A directory matches the rule if
+// its path matches Dir and it contains the files that Markers asks for.
+type SubPackageRule struct {
+	// Dir is a pattern in gitignore format that the directory's path,
+	// relative to the root of the tree, must match, such as
+	// "**/third_party/*/". If empty, any directory other than the root
+	// may match.
+	Dir string
+
+	// Markers lists groups of file name patterns, in the format accepted
+	// by path.Match and compared without regard to case. The directory
+	// must directly contain a file matching at least one pattern from each
+	// group: for instance, a group of license file names together with a
+	// group of manifest file names. If empty, no marker files are needed.
+	Markers [][]string
+}
+
+// LicenseFileMarkers is a group of file name patterns for license files,
+// for use in SubPackageRule.Markers.
+var LicenseFileMarkers = []string{"license*", "licence*", "copying*", "unlicense*"}
+
+// ManifestFileMarkers is a group of file name patterns for package
+// manifests, for use in SubPackageRule.Markers.
+var ManifestFileMarkers = []string{
+	"package.json", "go.mod", "cargo.toml", "pyproject.toml", "setup.py",
+	"pom.xml", "build.gradle", "build.gradle.kts", "composer.json",
+	"*.gemspec", "cmakelists.txt", "meson.build", "configure.ac",
+}
+
+// DefaultSubPackageRules treats each npm package in a node_modules
+// directory, each project directly within a third_party directory, and
+// each directory with a license file within a vendor directory as a
+// Package of its own.
+var DefaultSubPackageRules = []SubPackageRule{
+	{Dir: "**/node_modules/*/", Markers: [][]string{{"package.json"}}},
+	{Dir: "**/node_modules/@*/*/", Markers: [][]string{{"package.json"}}},
+	{Dir: "**/third_party/*/"},
+	{Dir: "**/vendor/**/", Markers: [][]string{LicenseFileMarkers}},
+}
+
+// BuildSubPackages2_1 splits the Files of the root Package into separate
+// SPDX Packages (version 2.1), one for each directory that matches one of
+// the rules, returning the new Packages and their Relationships or error
+// if any is encountered. Each File goes to the Package for the deepest
+// matching directory that contains it, and stays in the root Package if
+// there is none. Every Package, including the root Package, gets a
+// verification code for its own Files. The root Package gets a "CONTAINS"
+// Relationship to each new Package that is not nested in another, and a
+// new Package gets a "CONTAINS" Relationship to those nested directly in
+// it. Names and versions are read from a manifest in the directory if
+// there is one. Arguments:
+//   - fsys: the file system that the root Package was built from
+//   - rootPkg: the root Package, whose Files are modified
+//   - rules: the rules for finding sub-package directories
+func BuildSubPackages2_1(fsys fs.FS, rootPkg *spdx.Package2_1, rules []SubPackageRule) ([]*spdx.Package2_1, []*spdx.Relationship2_1, error) {
+	patterns := make([]*utils.PathPattern, len(rules))
+	for i, rule := range rules {
+		if rule.Dir == "" {
+			continue
+		}
+		pp, err := utils.NewPathPattern(rule.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		patterns[i] = pp
+	}
+
+	// list the names of the files directly in each directory, with paths
+	// relative to the root and "" for the root itself
+	dirFiles := map[string][]string{}
+	for _, f := range rootPkg.Files {
+		dir, base := path.Split(strings.TrimPrefix(f.FileName, "/"))
+		dir = strings.TrimSuffix(dir, "/")
+		dirFiles[dir] = append(dirFiles[dir], base)
+		for d := parentDir(dir); d != ""; d = parentDir(d) {
+			if _, ok := dirFiles[d]; !ok {
+				dirFiles[d] = nil
+			}
+		}
+	}
+
+	subDirs := []string{}
+	isSubDir := map[string]bool{}
+	for dir, names := range dirFiles {
+		if dir == "" {
+			continue
+		}
+		for i, rule := range rules {
+			if (patterns[i] == nil || patterns[i].Match(dir, true)) && hasMarkers(names, rule.Markers) {
+				subDirs = append(subDirs, dir)
+				isSubDir[dir] = true
+				break
+			}
+		}
+	}
+	if len(subDirs) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(subDirs)
+
+	// owner returns the deepest sub-package directory containing dir, or
+	// "" if it is only in the root Package
+	owner := func(dir string) string {
+		for ; dir != ""; dir = parentDir(dir) {
+			if isSubDir[dir] {
+				return dir
+			}
+		}
+		return ""
+	}
+
+	subFiles := map[string][]*spdx.File2_1{}
+	rootFiles := []*spdx.File2_1{}
+	for _, f := range rootPkg.Files {
+		dir, _ := path.Split(strings.TrimPrefix(f.FileName, "/"))
+		if o := owner(strings.TrimSuffix(dir, "/")); o != "" {
+			subFiles[o] = append(subFiles[o], f)
+		} else {
+			rootFiles = append(rootFiles, f)
+		}
+	}
+
+	ids := packageIDs{rootPkg.PackageSPDXIdentifier: true}
+	pkgIDs := map[string]string{"": rootPkg.PackageSPDXIdentifier}
+	pkgs := []*spdx.Package2_1{}
+	rlns := []*spdx.Relationship2_1{}
+	for _, dir := range subDirs {
+		code, err := utils.GetVerificationCode2_1(subFiles[dir], "")
+		if err != nil {
+			return nil, nil, err
+		}
+		pkg := &spdx.Package2_1{
+			PackageName:                 subPackageName(dir),
+			PackageSPDXIdentifier:       ids.unique("SPDXRef-Package-" + idString(dir)),
+			PackageFileName:             dir,
+			PackageDownloadLocation:     "NOASSERTION",
+			FilesAnalyzed:               true,
+			IsFilesAnalyzedTagPresent:   true,
+			PackageVerificationCode:     code,
+			PackageLicenseConcluded:     "NOASSERTION",
+			PackageLicenseInfoFromFiles: []string{},
+			PackageLicenseDeclared:      "NOASSERTION",
+			PackageCopyrightText:        "NOASSERTION",
+			Files:                       subFiles[dir],
+		}
+		readSubPackageManifest(fsys, dir, dirFiles[dir], pkg)
+		pkgIDs[dir] = pkg.PackageSPDXIdentifier
+		pkgs = append(pkgs, pkg)
+
+		// subDirs is sorted, so a parent always gets its ID first
+		rlns = append(rlns, &spdx.Relationship2_1{
+			RefA:         pkgIDs[owner(parentDir(dir))],
+			RefB:         pkg.PackageSPDXIdentifier,
+			Relationship: "CONTAINS",
+		})
+	}
+
+	code, err := utils.GetVerificationCode2_1(rootFiles, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	rootPkg.Files = rootFiles
+	rootPkg.PackageVerificationCode = code
+
+	return pkgs, rlns, nil
+}
+
+// parentDir returns the parent of a directory path relative to the root,
+// or "" for a directory at the top level.
+func parentDir(dir string) string {
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		return dir[:i]
+	}
+	return ""
+}
+
+// hasMarkers reports whether names includes a match for at least one
+// pattern from each group of markers.
+func hasMarkers(names []string, markers [][]string) bool {
+	for _, group := range markers {
+		found := false
+		for _, name := range names {
+			for _, pattern := range group {
+				if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// subPackageName returns the name to use for a sub-package directory that
+// has no manifest giving its name: its path below the nearest vendor,
+// third_party or node_modules directory, or else its base name.
+func subPackageName(dir string) string {
+	segments := strings.Split(dir, "/")
+	for i := len(segments) - 2; i >= 0; i-- {
+		switch segments[i] {
+		case "vendor", "third_party", "node_modules":
+			return strings.Join(segments[i+1:], "/")
+		}
+	}
+	return segments[len(segments)-1]
+}
+
+// readSubPackageManifest fills in a sub-package's name and version, and
+// for npm packages its declared license, from a manifest among the names
+// of the files in its directory. A manifest that cannot be read or parsed
+// is ignored, as the directory's files are what is being described.
+func readSubPackageManifest(fsys fs.FS, dir string, names []string, pkg *spdx.Package2_1) {
+	for _, name := range names {
+		p := path.Join(dir, name)
+		switch name {
+		case "package.json":
+			m, err := readNPMManifest(fsys, p)
+			if err != nil || m.Name == "" {
+				continue
+			}
+			pkg.PackageName, pkg.PackageVersion = m.Name, m.Version
+			setNPMLicense(pkg, m.license())
+			return
+		case "go.mod":
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				continue
+			}
+			if m, err := parseGoMod(data); err == nil && m.modulePath != "" {
+				pkg.PackageName = m.modulePath
+				return
+			}
+		case "Cargo.toml", "pyproject.toml":
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				continue
+			}
+			doc, err := utils.ParseTOML(data)
+			if err != nil {
+				continue
+			}
+			for _, table := range [][]string{{"package"}, {"project"}, {"tool", "poetry"}} {
+				t := tomlTable(doc, table)
+				if n, ok := t["name"].(string); ok && n != "" {
+					pkg.PackageName = n
+					pkg.PackageVersion, _ = t["version"].(string)
+					return
+				}
+			}
+		}
+	}
+}
+
+// tomlTable returns the table at keys within a parsed TOML document, or
+// nil if there is none.
+func tomlTable(doc map[string]interface{}, keys []string) map[string]interface{} {
+	t := doc
+	for _, key := range keys {
+		next, ok := t[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		t = next
+	}
+	return t
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// ===== Sub-package builder tests =====
+func testMonorepoFS() fstest.MapFS {
+	return fstest.MapFS{
+		"main.go":                                    {Data: []byte("package main\n")},
+		"node_modules/lodash/package.json":           {Data: []byte(`{"name":"lodash","version":"4.17.21","license":"MIT"}`)},
+		"node_modules/lodash/index.js":               {Data: []byte("module.exports = {}\n")},
+		"node_modules/@types/node/package.json":      {Data: []byte(`{"name":"@types/node","version":"20.11.0"}`)},
+		"node_modules/@types/node/index.d.ts":        {Data: []byte("export {}\n")},
+		"node_modules/a/package.json":                {Data: []byte(`{"name":"a","version":"1.0.0"}`)},
+		"node_modules/a/node_modules/b/package.json": {Data: []byte(`{"name":"b","version":"2.0.0"}`)},
+		"node_modules/a/node_modules/b/index.js":     {Data: []byte("// b\n")},
+		"node_modules/.bin/tool":                     {Data: []byte("#!/bin/sh\n")},
+		"third_party/README":                         {Data: []byte("vendored code\n")},
+		"third_party/zlib/zlib.h":                    {Data: []byte("/* zlib */\n")},
+		"third_party/zlib/contrib/extra.c":           {Data: []byte("/* extra */\n")},
+		"vendor/modules.txt":                         {Data: []byte("# github.com/pkg/errors v0.9.1\n")},
+		"vendor/github.com/pkg/errors/LICENSE":       {Data: []byte("BSD 2-Clause\n")},
+		"vendor/github.com/pkg/errors/errors.go":     {Data: []byte("package errors\n")},
+		"vendor/github.com/pkg/errors/sub/sub.go":    {Data: []byte("package sub\n")},
+		"tools/gen/LICENSE.txt":                      {Data: []byte("Apache-2.0\n")},
+		"tools/gen/Cargo.toml":                       {Data: []byte("[package]\nname = \"gen\"\nversion = \"0.1.0\"\n")},
+		"tools/gen/src/main.rs":                      {Data: []byte("fn main() {}\n")},
+	}
+}
+
+func fileNames(files []*spdx.File2_1) []string {
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.FileName)
+	}
+	return names
+}
+
+func TestBuildSubPackagesSplitsDefaultDirectories(t *testing.T) {
+	fsys := testMonorepoFS()
+	root, err := BuildPackageSectionFromFS2_1("repo", fsys, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	pkgs, rlns, err := BuildSubPackages2_1(fsys, root, DefaultSubPackageRules)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	want := []struct {
+		id, name, version, fileName, parent string
+		files                               int
+	}{
+		{"SPDXRef-Package-node-modules--types-node", "@types/node", "20.11.0", "node_modules/@types/node", "SPDXRef-Package-repo", 2},
+		{"SPDXRef-Package-node-modules-a", "a", "1.0.0", "node_modules/a", "SPDXRef-Package-repo", 1},
+		{"SPDXRef-Package-node-modules-a-node-modules-b", "b", "2.0.0", "node_modules/a/node_modules/b", "SPDXRef-Package-node-modules-a", 2},
+		{"SPDXRef-Package-node-modules-lodash", "lodash", "4.17.21", "node_modules/lodash", "SPDXRef-Package-repo", 2},
+		{"SPDXRef-Package-third-party-zlib", "zlib", "", "third_party/zlib", "SPDXRef-Package-repo", 2},
+		{"SPDXRef-Package-vendor-github.com-pkg-errors", "github.com/pkg/errors", "", "vendor/github.com/pkg/errors", "SPDXRef-Package-repo", 3},
+	}
+	if len(pkgs) != len(want) {
+		t.Fatalf("expected %d, got %d: %v", len(want), len(pkgs), pkgs)
+	}
+	if len(rlns) != len(want) {
+		t.Fatalf("expected %d, got %d", len(want), len(rlns))
+	}
+	for i, w := range want {
+		p := pkgs[i]
+		if p.PackageSPDXIdentifier != w.id || p.PackageName != w.name || p.PackageVersion != w.version || p.PackageFileName != w.fileName {
+			t.Errorf("expected %v %v %v %v, got %v %v %v %v", w.id, w.name, w.version, w.fileName,
+				p.PackageSPDXIdentifier, p.PackageName, p.PackageVersion, p.PackageFileName)
+		}
+		if len(p.Files) != w.files {
+			t.Errorf("expected %d files in %v, got %v", w.files, w.name, fileNames(p.Files))
+		}
+		code, _ := utils.GetVerificationCode2_1(p.Files, "")
+		if p.PackageVerificationCode != code {
+			t.Errorf("expected %v, got %v", code, p.PackageVerificationCode)
+		}
+		if rlns[i].RefA != w.parent || rlns[i].Relationship != "CONTAINS" || rlns[i].RefB != w.id {
+			t.Errorf("expected %v CONTAINS %v, got %+v", w.parent, w.id, rlns[i])
+		}
+	}
+	if pkgs[3].PackageLicenseDeclared != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", pkgs[3].PackageLicenseDeclared)
+	}
+
+	wantRoot := []string{"/main.go", "/node_modules/.bin/tool", "/third_party/README", "/tools/gen/Cargo.toml",
+		"/tools/gen/LICENSE.txt", "/tools/gen/src/main.rs", "/vendor/modules.txt"}
+	got := fileNames(root.Files)
+	if len(got) != len(wantRoot) {
+		t.Fatalf("expected %v, got %v", wantRoot, got)
+	}
+	for i := range wantRoot {
+		if got[i] != wantRoot[i] {
+			t.Errorf("expected %v, got %v", wantRoot[i], got[i])
+		}
+	}
+	code, _ := utils.GetVerificationCode2_1(root.Files, "")
+	if root.PackageVerificationCode != code {
+		t.Errorf("expected %v, got %v", code, root.PackageVerificationCode)
+	}
+}
+
+func TestBuildSubPackagesCanUseMarkerFiles(t *testing.T) {
+	fsys := testMonorepoFS()
+	root, err := BuildPackageSectionFromFS2_1("repo", fsys, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	rules := []SubPackageRule{{Markers: [][]string{LicenseFileMarkers, ManifestFileMarkers}}}
+	pkgs, rlns, err := BuildSubPackages2_1(fsys, root, rules)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 1 || len(rlns) != 1 {
+		t.Fatalf("expected 1 package and relationship, got %d and %d", len(pkgs), len(rlns))
+	}
+	if pkgs[0].PackageName != "gen" || pkgs[0].PackageVersion != "0.1.0" {
+		t.Errorf("expected gen 0.1.0, got %v %v", pkgs[0].PackageName, pkgs[0].PackageVersion)
+	}
+	if len(pkgs[0].Files) != 3 {
+		t.Errorf("expected %d, got %d", 3, len(pkgs[0].Files))
+	}
+}
+
+func TestBuildSubPackagesLeavesRootAloneWithoutMatches(t *testing.T) {
+	fsys := fstest.MapFS{"main.go": {Data: []byte("package main\n")}}
+	root, err := BuildPackageSectionFromFS2_1("repo", fsys, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	code := root.PackageVerificationCode
+
+	pkgs, rlns, err := BuildSubPackages2_1(fsys, root, DefaultSubPackageRules)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(pkgs) != 0 || len(rlns) != 0 {
+		t.Errorf("expected no packages or relationships, got %d and %d", len(pkgs), len(rlns))
+	}
+	if len(root.Files) != 1 || root.PackageVerificationCode != code {
+		t.Errorf("expected root package to be unchanged")
+	}
+}
+
+func TestBuildSubPackagesFailsWithInvalidPattern(t *testing.T) {
+	root := &spdx.Package2_1{PackageSPDXIdentifier: "SPDXRef-Package-repo"}
+	_, _, err := BuildSubPackages2_1(fstest.MapFS{}, root, []SubPackageRule{{Dir: "!vendor"}})
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
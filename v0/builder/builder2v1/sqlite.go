@@ -0,0 +1,300 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package builder2v1
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// sqliteDB is a minimal, read-only reader for SQLite 3 database files,
+// which is just enough to read the rows of a table such as the Packages
+// table of an rpm database. Indexes, WAL files and schema changes are not
+// supported.
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	// usable is the number of bytes in each page that are not reserved
+	usable int
+}
+
+// B-tree page types
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// openSQLite checks the header of an SQLite database file that has been
+// read into memory.
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != "SQLite format 3\x00" {
+		return nil, errors.New("not an SQLite 3 database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	if enc := binary.BigEndian.Uint32(data[56:60]); enc != 0 && enc != 1 {
+		return nil, errors.New("only UTF-8 databases are supported")
+	}
+	return &sqliteDB{
+		data:     data,
+		pageSize: pageSize,
+		usable:   pageSize - int(data[20]),
+	}, nil
+}
+
+// page returns the contents of page n, numbered from 1.
+func (db *sqliteDB) page(n uint32) ([]byte, error) {
+	start := int64(n-1) * int64(db.pageSize)
+	if n == 0 || start+int64(db.pageSize) > int64(len(db.data)) {
+		return nil, fmt.Errorf("page %d out of range", n)
+	}
+	return db.data[start : start+int64(db.pageSize)], nil
+}
+
+// tableRoot returns the root page of the named table, as listed in the
+// sqlite_schema table.
+func (db *sqliteDB) tableRoot(name string) (uint32, error) {
+	var root uint32
+	err := db.scanTable(1, func(rowid int64, values []interface{}) error {
+		if len(values) < 4 {
+			return nil
+		}
+		typ, _ := values[0].(string)
+		tblName, _ := values[1].(string)
+		rootPage, _ := values[3].(int64)
+		if typ == "table" && strings.EqualFold(tblName, name) && root == 0 {
+			root = uint32(rootPage)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("no table %q", name)
+	}
+	return root, nil
+}
+
+// scanTable calls fn for each row of the table whose B-tree is rooted at
+// the given page, in rowid order. Column values are nil, int64, float64,
+// string or []byte; an INTEGER PRIMARY KEY column is nil, since its value
+// is the rowid.
+func (db *sqliteDB) scanTable(root uint32, fn func(rowid int64, values []interface{}) error) error {
+	return db.scanPage(root, 0, fn)
+}
+
+func (db *sqliteDB) scanPage(n uint32, depth int, fn func(int64, []interface{}) error) error {
+	if depth > 64 {
+		return errors.New("B-tree too deep")
+	}
+	pg, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	hdr := 0
+	if n == 1 {
+		hdr = 100
+	}
+	if len(pg) < hdr+12 {
+		return fmt.Errorf("page %d too short", n)
+	}
+	numCells := int(binary.BigEndian.Uint16(pg[hdr+3 : hdr+5]))
+
+	switch pg[hdr] {
+	case sqliteLeafTable:
+		ptrs := hdr + 8
+		for i := 0; i < numCells; i++ {
+			if ptrs+2*i+2 > len(pg) {
+				return fmt.Errorf("page %d: corrupt cell pointer", n)
+			}
+			off := int(binary.BigEndian.Uint16(pg[ptrs+2*i:]))
+			rowid, payload, err := db.leafCell(pg, off)
+			if err != nil {
+				return fmt.Errorf("page %d: %v", n, err)
+			}
+			values, err := parseSQLiteRecord(payload)
+			if err != nil {
+				return fmt.Errorf("page %d: %v", n, err)
+			}
+			if err := fn(rowid, values); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case sqliteInteriorTable:
+		ptrs := hdr + 12
+		for i := 0; i < numCells; i++ {
+			if ptrs+2*i+2 > len(pg) {
+				return fmt.Errorf("page %d: corrupt cell pointer", n)
+			}
+			off := int(binary.BigEndian.Uint16(pg[ptrs+2*i:]))
+			if off+4 > len(pg) {
+				return fmt.Errorf("page %d: corrupt cell", n)
+			}
+			if err := db.scanPage(binary.BigEndian.Uint32(pg[off:]), depth+1, fn); err != nil {
+				return err
+			}
+		}
+		return db.scanPage(binary.BigEndian.Uint32(pg[hdr+8:]), depth+1, fn)
+
+	default:
+		return fmt.Errorf("page %d is not a table B-tree page", n)
+	}
+}
+
+// leafCell returns the rowid and the full payload of the table leaf cell
+// at offset off in page pg, following overflow pages as needed.
+func (db *sqliteDB) leafCell(pg []byte, off int) (int64, []byte, error) {
+	if off >= len(pg) {
+		return 0, nil, errors.New("corrupt cell")
+	}
+	size, n := sqliteVarint(pg[off:])
+	if n == 0 {
+		return 0, nil, errors.New("corrupt cell")
+	}
+	off += n
+	rowid, n := sqliteVarint(pg[off:])
+	if n == 0 {
+		return 0, nil, errors.New("corrupt cell")
+	}
+	off += n
+	if size > uint64(len(db.data)) {
+		return 0, nil, errors.New("corrupt payload size")
+	}
+
+	// the amount of the payload that is stored in the cell itself
+	total := int(size)
+	u := db.usable
+	maxLocal := u - 35
+	local := total
+	if total > maxLocal {
+		minLocal := (u-12)*32/255 - 23
+		local = minLocal + (total-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if off+local > len(pg) {
+		return 0, nil, errors.New("corrupt cell")
+	}
+	payload := append([]byte{}, pg[off:off+local]...)
+	if local == total {
+		return int64(rowid), payload, nil
+	}
+
+	if off+local+4 > len(pg) {
+		return 0, nil, errors.New("corrupt cell")
+	}
+	next := binary.BigEndian.Uint32(pg[off+local:])
+	for len(payload) < total {
+		if next == 0 {
+			return 0, nil, errors.New("overflow chain too short")
+		}
+		ovfl, err := db.page(next)
+		if err != nil {
+			return 0, nil, err
+		}
+		next = binary.BigEndian.Uint32(ovfl)
+		chunk := ovfl[4:u]
+		if rest := total - len(payload); rest < len(chunk) {
+			chunk = chunk[:rest]
+		}
+		payload = append(payload, chunk...)
+	}
+	return int64(rowid), payload, nil
+}
+
+// parseSQLiteRecord decodes a record in the SQLite record format.
+func parseSQLiteRecord(rec []byte) ([]interface{}, error) {
+	hdrLen, n := sqliteVarint(rec)
+	if n == 0 || hdrLen > uint64(len(rec)) {
+		return nil, errors.New("corrupt record header")
+	}
+	types := []uint64{}
+	for pos := n; pos < int(hdrLen); {
+		t, m := sqliteVarint(rec[pos:int(hdrLen)])
+		if m == 0 {
+			return nil, errors.New("corrupt record header")
+		}
+		types = append(types, t)
+		pos += m
+	}
+
+	values := []interface{}{}
+	body := rec[hdrLen:]
+	for _, t := range types {
+		size := 0
+		switch {
+		case t >= 12:
+			size = int((t - 12) / 2)
+		case t >= 1 && t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		}
+		if size > len(body) {
+			return nil, errors.New("corrupt record body")
+		}
+		v := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t >= 1 && t <= 6:
+			// big-endian two's complement integers
+			var x int64
+			if v[0]&0x80 != 0 {
+				x = -1
+			}
+			for _, b := range v {
+				x = x<<8 | int64(b)
+			}
+			values = append(values, x)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t >= 12 && t%2 == 0:
+			values = append(values, append([]byte{}, v...))
+		case t >= 13:
+			values = append(values, string(v))
+		default:
+			return nil, fmt.Errorf("invalid serial type %d", t)
+		}
+	}
+	return values, nil
+}
+
+// sqliteVarint decodes an SQLite variable-length integer, returning it and
+// the number of bytes used, or 0 bytes if b is too short.
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(b[8]), 9
+}
@@ -0,0 +1,336 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package gitfs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// git tree entry modes
+const (
+	modeTree    = 0040000
+	modeSymlink = 0120000
+	modeGitlink = 0160000
+	modeExec    = 0100755
+)
+
+// FS is a read-only fs.FS containing the files in a single git tree. It
+// implements fs.ReadDirFS and utils.ReadLinkFS. Submodules are omitted, since
+// their contents are not part of the repository's object store.
+type FS struct {
+	repo *Repository
+	tree string
+}
+
+// treeEntry is a single entry in a git tree object.
+type treeEntry struct {
+	name string
+	mode uint32
+	id   string
+}
+
+// Open opens the named file, following symbolic links within the tree.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.mode == modeTree {
+		entries, err := f.readTree(e.id)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &dir{info: fileInfo{entry: e}, entries: entries}, nil
+	}
+
+	_, data, err := f.repo.objects.read(e.id)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{info: fileInfo{entry: e, size: int64(len(data))}, r: bytes.NewReader(data)}, nil
+}
+
+// ReadDir reads the named directory, returning its entries sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode != modeTree {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.readTree(e.id)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadLink returns the destination of the named symbolic link.
+func (f *FS) ReadLink(name string) (string, error) {
+	e, err := f.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e.mode != modeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	_, data, err := f.repo.objects.read(e.id)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return string(data), nil
+}
+
+// Lstat returns a FileInfo describing the named file, without following
+// it if it is a symbolic link.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return f.stat(e)
+}
+
+// Stat returns a FileInfo describing the named file, following symbolic
+// links within the tree.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return f.stat(e)
+}
+
+func (f *FS) stat(e treeEntry) (fs.FileInfo, error) {
+	info := fileInfo{entry: e}
+	if e.mode != modeTree {
+		// the size is only known by reading the object
+		_, data, err := f.repo.objects.read(e.id)
+		if err != nil {
+			return nil, err
+		}
+		info.size = int64(len(data))
+	}
+	return info, nil
+}
+
+// lookup finds the tree entry for name. Symbolic links in directory
+// components are always followed; the final component is followed only
+// if follow is true.
+func (f *FS) lookup(op string, name string, follow bool) (treeEntry, error) {
+	if !fs.ValidPath(name) {
+		return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	root := treeEntry{name: ".", mode: modeTree, id: f.tree}
+	if name == "." {
+		return root, nil
+	}
+
+	parts := strings.Split(name, "/")
+	// stack holds the entries for each directory from the root down to
+	// the current one, so that ".." in link targets can be resolved
+	stack := []treeEntry{root}
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(stack) == 1 {
+				return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		cur := stack[len(stack)-1]
+		if cur.mode != modeTree {
+			return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		e, err := f.findEntry(cur.id, part)
+		if err != nil {
+			return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		if e.mode == modeSymlink && (len(parts) > 0 || follow) {
+			links++
+			if links > 40 {
+				return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			_, target, err := f.repo.objects.read(e.id)
+			if err != nil {
+				return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			if path.IsAbs(string(target)) {
+				// outside the tree
+				return treeEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			parts = append(strings.Split(string(target), "/"), parts...)
+			continue
+		}
+
+		stack = append(stack, e)
+	}
+
+	return stack[len(stack)-1], nil
+}
+
+// findEntry returns the entry with the given name in a tree.
+func (f *FS) findEntry(treeID string, name string) (treeEntry, error) {
+	entries, err := f.parseTree(treeID)
+	if err != nil {
+		return treeEntry{}, err
+	}
+	for _, e := range entries {
+		if e.name == name {
+			return e, nil
+		}
+	}
+	return treeEntry{}, fs.ErrNotExist
+}
+
+// readTree returns the entries in a tree as fs.DirEntry values, sorted by
+// name, leaving out submodules.
+func (f *FS) readTree(treeID string) ([]fs.DirEntry, error) {
+	entries, err := f.parseTree(treeID)
+	if err != nil {
+		return nil, err
+	}
+
+	des := []fs.DirEntry{}
+	for _, e := range entries {
+		if e.mode == modeGitlink {
+			continue
+		}
+		des = append(des, dirEntry{f: f, entry: e})
+	}
+	sort.Slice(des, func(i, j int) bool { return des[i].Name() < des[j].Name() })
+	return des, nil
+}
+
+// parseTree reads and parses a tree object.
+func (f *FS) parseTree(treeID string) ([]treeEntry, error) {
+	typ, data, err := f.repo.objects.read(treeID)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "tree" {
+		return nil, fmt.Errorf("%s is a %s, not a tree", treeID, typ)
+	}
+
+	entries := []treeEntry{}
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || len(data) < nul+21 {
+			return nil, fmt.Errorf("corrupt tree %s", treeID)
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt tree %s: %v", treeID, err)
+		}
+		entries = append(entries, treeEntry{
+			name: string(data[sp+1 : nul]),
+			mode: uint32(mode),
+			id:   hex.EncodeToString(data[nul+1 : nul+21]),
+		})
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// fileInfo describes a tree entry.
+type fileInfo struct {
+	entry treeEntry
+	size  int64
+}
+
+func (fi fileInfo) Name() string       { return path.Base(fi.entry.name) }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return entryMode(fi.entry.mode) }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.entry.mode == modeTree }
+
+// Sys returns the entry's git object ID, as a hex string.
+func (fi fileInfo) Sys() interface{} { return fi.entry.id }
+
+func entryMode(mode uint32) fs.FileMode {
+	switch mode {
+	case modeTree:
+		return fs.ModeDir | 0555
+	case modeSymlink:
+		return fs.ModeSymlink | 0777
+	case modeExec:
+		return 0555
+	default:
+		return 0444
+	}
+}
+
+// dirEntry is a tree entry returned by ReadDir.
+type dirEntry struct {
+	f     *FS
+	entry treeEntry
+}
+
+func (d dirEntry) Name() string      { return d.entry.name }
+func (d dirEntry) IsDir() bool       { return d.entry.mode == modeTree }
+func (d dirEntry) Type() fs.FileMode { return entryMode(d.entry.mode).Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	return d.f.stat(d.entry)
+}
+
+// file is an open blob.
+type file struct {
+	info fileInfo
+	r    *bytes.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Read(b []byte) (int, error) { return f.r.Read(b) }
+func (f *file) Close() error               { return nil }
+
+// dir is an open tree.
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.entry.name, Err: errors.New("is a directory")}
+}
+func (d *dir) Close() error { return nil }
+
+// ReadDir reads the directory's entries, in the manner of fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.pos:]
+	if n <= 0 {
+		d.pos = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.pos += n
+	return remaining[:n], nil
+}
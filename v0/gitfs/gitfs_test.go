@@ -0,0 +1,325 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package gitfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// makeTestRepo creates a git repository in a temporary directory with two
+// commits and a tag, and returns its path. The test is skipped if no git
+// binary is available.
+func makeTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q", "-b", "main")
+
+	writeFile(t, dir, "README", "first version\n")
+	writeFile(t, dir, "src/main.go", "package main\n")
+	writeFile(t, dir, "big.txt", bigText(""))
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "first")
+
+	writeFile(t, dir, "README", "second version\n")
+	writeFile(t, dir, "src/lib/lib.go", "package lib\n")
+	writeFile(t, dir, "big.txt", bigText("changed\n"))
+	if err := os.Symlink("src/main.go", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("src", filepath.Join(dir, "srclink")); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "second")
+	gitCmd(t, dir, "tag", "-a", "-m", "release", "v1.0")
+
+	return dir
+}
+
+// bigText returns a file's contents which is large enough for git to
+// store later versions of it as deltas when packing.
+func bigText(extra string) string {
+	var sb strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&sb, "line %d of a larger file\n", i)
+	}
+	return sb.String() + extra
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ===== Repository tests =====
+func TestCanResolveCommitNames(t *testing.T) {
+	dir := makeTestRepo(t)
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	head := gitCmd(t, dir, "rev-parse", "HEAD")
+	first := gitCmd(t, dir, "rev-parse", "HEAD~1")
+
+	for name, want := range map[string]string{
+		"HEAD":            head,
+		"main":            head,
+		"v1.0":            head,
+		"HEAD~1":          first,
+		"main^":           first,
+		"v1.0~1":          first,
+		head[:10]:         head,
+		first:             first,
+		"HEAD~1~0":        first,
+		"refs/heads/main": head,
+	} {
+		got, err := r.ResolveCommit(name)
+		if err != nil {
+			t.Errorf("%s: expected nil error, got %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestResolveCommitFailsForUnknownNames(t *testing.T) {
+	dir := makeTestRepo(t)
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	for _, name := range []string{"nope", "HEAD~5", "HEAD^{tree}", "", "~1", "0000000"} {
+		if _, err := r.ResolveCommit(name); err == nil {
+			t.Errorf("%s: expected non-nil error, got nil", name)
+		}
+	}
+}
+
+func TestOpenRepositoryFailsForNonRepository(t *testing.T) {
+	_, err := OpenRepository(t.TempDir())
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestCanResolveCommitsFromPackedRepository(t *testing.T) {
+	dir := makeTestRepo(t)
+	gitCmd(t, dir, "gc", "-q", "--aggressive")
+	gitCmd(t, dir, "repack", "-a", "-d", "-f", "-q")
+
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	head := gitCmd(t, dir, "rev-parse", "HEAD")
+	got, err := r.ResolveCommit("v1.0")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != head {
+		t.Errorf("expected %v, got %v", head, got)
+	}
+}
+
+// ===== FS tests =====
+func TestCommitFSContainsCommitContents(t *testing.T) {
+	dir := makeTestRepo(t)
+	// change the working tree, which must not affect the results
+	writeFile(t, dir, "README", "uncommitted\n")
+
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	fsys, _, err := r.CommitFS("HEAD")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkFile(t, fsys, "README", "second version\n")
+	checkFile(t, fsys, "src/lib/lib.go", "package lib\n")
+	checkFile(t, fsys, "link", "package main\n")
+	checkFile(t, fsys, "srclink/main.go", "package main\n")
+
+	fsys, _, err = r.CommitFS("HEAD~1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkFile(t, fsys, "README", "first version\n")
+	if _, err := fs.Stat(fsys, "src/lib/lib.go"); err == nil {
+		t.Errorf("expected lib.go to be missing from first commit")
+	}
+}
+
+func TestCommitFSReadsPackedObjects(t *testing.T) {
+	dir := makeTestRepo(t)
+	gitCmd(t, dir, "repack", "-a", "-d", "-f", "-q", "--depth=50", "--window=50")
+	gitCmd(t, dir, "prune-packed")
+
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	fsys, _, err := r.CommitFS("HEAD~1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkFile(t, fsys, "README", "first version\n")
+	checkFile(t, fsys, "src/main.go", "package main\n")
+	checkFile(t, fsys, "big.txt", bigText(""))
+
+	fsys, _, err = r.CommitFS("HEAD")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	checkFile(t, fsys, "big.txt", bigText("changed\n"))
+}
+
+func TestCommitFSPassesFSTest(t *testing.T) {
+	dir := makeTestRepo(t)
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	fsys, _, err := r.CommitFS("HEAD")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	err = fstest.TestFS(fsys, "README", "src/main.go", "src/lib/lib.go", "link")
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+}
+
+func TestCommitFSReportsSymlinks(t *testing.T) {
+	dir := makeTestRepo(t)
+	r, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	fsys, _, err := r.CommitFS("HEAD")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	fi, err := fsys.Lstat("link")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("expected symlink mode, got %v", fi.Mode())
+	}
+	target, err := fsys.ReadLink("link")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if target != "src/main.go" {
+		t.Errorf("expected %v, got %v", "src/main.go", target)
+	}
+	if _, err := fsys.ReadLink("README"); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"README", "big.txt", "link", "src", "srclink"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v, got %v", want, names)
+	}
+}
+
+func checkFile(t *testing.T, fsys fs.FS, name string, want string) {
+	t.Helper()
+	got, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Errorf("%s: expected nil error, got %v", name, err)
+		return
+	}
+	if string(got) != want {
+		t.Errorf("%s: expected %q, got %q", name, want, string(got))
+	}
+}
+
+func TestRepositoryCloseReleasesPackFiles(t *testing.T) {
+	dir := makeTestRepo(t)
+	gitCmd(t, dir, "repack", "-a", "-d", "-q")
+	gitCmd(t, dir, "prune-packed")
+
+	countFDs := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			return -1
+		}
+		return len(entries)
+	}
+	before := countFDs()
+
+	for i := 0; i < 300; i++ {
+		r, err := OpenRepository(dir)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		fsys, _, err := r.CommitFS("HEAD")
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		checkFile(t, fsys, "README", "second version\n")
+		if err = r.Close(); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if i == 0 {
+			if _, err = fs.ReadFile(fsys, "src/main.go"); err == nil {
+				t.Errorf("expected non-nil error after Close, got nil")
+			}
+		}
+	}
+
+	if after := countFDs(); after > before {
+		t.Errorf("expected at most %v open files, got %v", before, after)
+	}
+}
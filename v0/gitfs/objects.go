@@ -0,0 +1,543 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package gitfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// object types, as numbered in pack files
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var typeNames = map[int]string{
+	objCommit: "commit",
+	objTree:   "tree",
+	objBlob:   "blob",
+	objTag:    "tag",
+}
+
+// errObjectNotFound is returned when an object is in neither the loose
+// object directories nor any pack.
+var errObjectNotFound = errors.New("object not found")
+
+// objectStore reads objects from a repository's object directories.
+type objectStore struct {
+	// dirs lists the objects directory and any alternates
+	dirs  []string
+	packs []*packFile
+}
+
+// openObjectStore prepares to read objects from objectsDir, including any
+// alternate object directories it lists.
+func openObjectStore(objectsDir string) (*objectStore, error) {
+	s := &objectStore{}
+	if err := s.addDir(objectsDir, 0); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *objectStore) addDir(dir string, depth int) error {
+	// git itself only follows alternates five levels deep
+	if depth > 5 {
+		return nil
+	}
+	s.dirs = append(s.dirs, dir)
+
+	idxPaths, err := filepath.Glob(filepath.Join(dir, "pack", "pack-*.idx"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(idxPaths)
+	for _, idxPath := range idxPaths {
+		p, err := openPackFile(idxPath)
+		if err != nil {
+			return err
+		}
+		s.packs = append(s.packs, p)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "info", "alternates"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		if err = s.addDir(line, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the type name and contents of the object with the given
+// hex ID.
+func (s *objectStore) read(id string) (string, []byte, error) {
+	for _, dir := range s.dirs {
+		typ, data, err := readLooseObject(dir, id)
+		if err == nil {
+			return typ, data, nil
+		}
+		if !errors.Is(err, errObjectNotFound) {
+			return "", nil, err
+		}
+	}
+
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 20 {
+		return "", nil, fmt.Errorf("invalid object ID %q", id)
+	}
+	for _, p := range s.packs {
+		if off, ok := p.find(raw); ok {
+			typ, data, err := p.readAt(off, s)
+			if err != nil {
+				return "", nil, err
+			}
+			return typeNames[typ], data, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("%w: %s", errObjectNotFound, id)
+}
+
+// close closes all of the store's packs, returning the first error.
+// Loose objects are closed as soon as they are read, so need no closing.
+func (s *objectStore) close() error {
+	var firstErr error
+	for _, p := range s.packs {
+		if err := p.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// expand returns the full hex ID of the single object whose ID starts with
+// prefix, or an error if there is no such object or more than one.
+func (s *objectStore) expand(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	found := map[string]bool{}
+
+	for _, dir := range s.dirs {
+		if len(prefix) < 2 {
+			break
+		}
+		entries, err := os.ReadDir(filepath.Join(dir, prefix[:2]))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if id := prefix[:2] + e.Name(); len(id) == 40 && strings.HasPrefix(id, prefix) {
+				found[id] = true
+			}
+		}
+	}
+	for _, p := range s.packs {
+		for _, id := range p.withPrefix(prefix) {
+			found[id] = true
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", errObjectNotFound, prefix)
+	case 1:
+		for id := range found {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("short object ID %s is ambiguous", prefix)
+}
+
+// readLooseObject reads the zlib-compressed object for id in dir.
+func readLooseObject(dir string, id string) (string, []byte, error) {
+	if len(id) != 40 {
+		return "", nil, fmt.Errorf("invalid object ID %q", id)
+	}
+	f, err := os.Open(filepath.Join(dir, id[:2], id[2:]))
+	if os.IsNotExist(err) {
+		return "", nil, errObjectNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+	header, err := br.ReadString(0)
+	if err != nil {
+		return "", nil, fmt.Errorf("corrupt loose object %s: %v", id, err)
+	}
+	typ, sizeStr, ok := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	if !ok {
+		return "", nil, fmt.Errorf("corrupt loose object %s header", id)
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("corrupt loose object %s size: %v", id, err)
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return "", nil, fmt.Errorf("corrupt loose object %s: %v", id, err)
+	}
+	return typ, data, nil
+}
+
+// packFile reads objects from a version 2 pack index and its pack.
+type packFile struct {
+	path    string
+	fanout  [256]uint32
+	ids     []byte
+	offsets []byte
+	large   []byte
+
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+	// bases caches recently used delta bases by offset
+	bases     map[int64]packObject
+	baseBytes int
+}
+
+type packObject struct {
+	typ  int
+	data []byte
+}
+
+// maxBaseCacheBytes bounds the memory used to cache delta bases per pack.
+const maxBaseCacheBytes = 32 << 20
+
+func openPackFile(idxPath string) (*packFile, error) {
+	idx, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(idx[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index %s", idxPath)
+	}
+
+	p := &packFile{
+		path:  strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		bases: map[int64]packObject{},
+	}
+	for i := 0; i < 256; i++ {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(idx) < pos+n*(20+4+4) {
+		return nil, fmt.Errorf("truncated pack index %s", idxPath)
+	}
+	p.ids = idx[pos : pos+n*20]
+	pos += n * 20
+	// skip the CRC32 table
+	pos += n * 4
+	p.offsets = idx[pos : pos+n*4]
+	pos += n * 4
+	p.large = idx[pos:]
+
+	return p, nil
+}
+
+// find returns the offset in the pack of the object with the given raw ID.
+func (p *packFile) find(raw []byte) (int64, bool) {
+	lo := 0
+	if raw[0] > 0 {
+		lo = int(p.fanout[raw[0]-1])
+	}
+	hi := int(p.fanout[raw[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.ids[(lo+i)*20:(lo+i+1)*20], raw) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.ids[i*20:(i+1)*20], raw) {
+		return 0, false
+	}
+
+	off := int64(binary.BigEndian.Uint32(p.offsets[i*4:]))
+	if off&0x80000000 != 0 {
+		j := int(off & 0x7fffffff)
+		off = int64(binary.BigEndian.Uint64(p.large[j*8:]))
+	}
+	return off, true
+}
+
+// withPrefix returns the hex IDs of all objects in the pack starting with
+// the given hex prefix.
+func (p *packFile) withPrefix(prefix string) []string {
+	ids := []string{}
+	n := int(p.fanout[255])
+	i := sort.Search(n, func(i int) bool {
+		return hex.EncodeToString(p.ids[i*20:(i+1)*20]) >= prefix
+	})
+	for ; i < n; i++ {
+		id := hex.EncodeToString(p.ids[i*20 : (i+1)*20])
+		if !strings.HasPrefix(id, prefix) {
+			break
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// readAt returns the type and contents of the object at offset off,
+// resolving deltas. REF_DELTA bases are looked up through s.
+func (p *packFile) readAt(off int64, s *objectStore) (int, []byte, error) {
+	p.mu.Lock()
+	if obj, ok := p.bases[off]; ok {
+		p.mu.Unlock()
+		return obj.typ, obj.data, nil
+	}
+	if p.closed {
+		p.mu.Unlock()
+		return 0, nil, fmt.Errorf("%s: %w", p.path, os.ErrClosed)
+	}
+	if p.f == nil {
+		f, err := os.Open(p.path)
+		if err != nil {
+			p.mu.Unlock()
+			return 0, nil, err
+		}
+		p.f = f
+	}
+	typ, data, baseOff, baseID, err := p.readEntry(off)
+	p.mu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch typ {
+	case objOfsDelta, objRefDelta:
+		var baseTyp int
+		var base []byte
+		if typ == objOfsDelta {
+			baseTyp, base, err = p.readAt(baseOff, s)
+		} else {
+			var name string
+			name, base, err = s.read(baseID)
+			baseTyp = typeNumber(name)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		data, err = applyDelta(base, data)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%s at offset %d: %v", p.path, off, err)
+		}
+		typ = baseTyp
+	}
+
+	// remember trees and other small objects, which are likely to be the
+	// bases of further deltas
+	p.mu.Lock()
+	if p.baseBytes+len(data) > maxBaseCacheBytes {
+		p.bases = map[int64]packObject{}
+		p.baseBytes = 0
+	}
+	if len(data) <= maxBaseCacheBytes/4 {
+		p.bases[off] = packObject{typ: typ, data: data}
+		p.baseBytes += len(data)
+	}
+	p.mu.Unlock()
+
+	return typ, data, nil
+}
+
+// close closes the pack, if it has been opened. The pack can't be read
+// afterwards.
+func (p *packFile) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
+
+// readEntry reads the raw entry at off. For deltas, data is the delta
+// itself, and either baseOff or baseID identifies the base object.
+func (p *packFile) readEntry(off int64) (int, []byte, int64, string, error) {
+	br := bufio.NewReader(io.NewSectionReader(p.f, off, 1<<62))
+
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, 0, "", err
+	}
+	typ := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, nil, 0, "", err
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+
+	var baseOff int64
+	var baseID string
+	switch typ {
+	case objOfsDelta:
+		if c, err = br.ReadByte(); err != nil {
+			return 0, nil, 0, "", err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return 0, nil, 0, "", err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		baseOff = off - rel
+	case objRefDelta:
+		raw := make([]byte, 20)
+		if _, err = io.ReadFull(br, raw); err != nil {
+			return 0, nil, 0, "", err
+		}
+		baseID = hex.EncodeToString(raw)
+	case objCommit, objTree, objBlob, objTag:
+	default:
+		return 0, nil, 0, "", fmt.Errorf("%s: unknown object type %d at offset %d", p.path, typ, off)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, 0, "", err
+	}
+	defer zr.Close()
+	data := make([]byte, size)
+	if _, err = io.ReadFull(zr, data); err != nil {
+		return 0, nil, 0, "", fmt.Errorf("%s: corrupt object at offset %d: %v", p.path, off, err)
+	}
+
+	return typ, data, baseOff, baseID, nil
+}
+
+func typeNumber(name string) int {
+	for n, s := range typeNames {
+		if s == name {
+			return n
+		}
+	}
+	return 0
+}
+
+// applyDelta reconstructs an object from its base and a git delta.
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	pos := 0
+	readSize := func() (int, error) {
+		size, shift := 0, uint(0)
+		for {
+			if pos >= len(delta) {
+				return 0, errors.New("truncated delta header")
+			}
+			c := delta[pos]
+			pos++
+			size |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	baseSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("delta base size %d does not match %d", baseSize, len(base))
+	}
+	resultSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		if op&0x80 != 0 {
+			// copy from base
+			var cpOff, cpSize int
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated delta copy")
+					}
+					cpOff |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(1<<(4+i)) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated delta copy")
+					}
+					cpSize |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if cpSize == 0 {
+				cpSize = 0x10000
+			}
+			if cpOff+cpSize > len(base) {
+				return nil, errors.New("delta copy out of range")
+			}
+			result = append(result, base[cpOff:cpOff+cpSize]...)
+		} else if op != 0 {
+			// insert literal bytes
+			n := int(op)
+			if pos+n > len(delta) {
+				return nil, errors.New("truncated delta insert")
+			}
+			result = append(result, delta[pos:pos+n]...)
+			pos += n
+		} else {
+			return nil, errors.New("invalid delta opcode 0")
+		}
+	}
+
+	if len(result) != resultSize {
+		return nil, fmt.Errorf("delta result size %d does not match %d", len(result), resultSize)
+	}
+	return result, nil
+}
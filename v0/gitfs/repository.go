@@ -0,0 +1,357 @@
+// Package gitfs provides read-only access to the files in a commit of a
+// local git repository, as an fs.FS. It reads the repository's object store
+// directly (both loose objects and pack files), so it does not need a git
+// binary, a working tree checkout or network access.
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package gitfs
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Repository is a local git repository.
+type Repository struct {
+	// gitDir is the repository's .git directory (or the repository itself,
+	// if it is bare)
+	gitDir string
+	// commonDir is where the objects and shared refs live; it differs from
+	// gitDir for linked worktrees
+	commonDir string
+	objects   *objectStore
+}
+
+// OpenRepository opens the git repository at repoPath, which may be the
+// top of a working tree, its .git directory, or a bare repository.
+func OpenRepository(repoPath string) (*Repository, error) {
+	gitDir, err := findGitDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	commonDir := gitDir
+	if b, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(b))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	if err = checkObjectFormat(commonDir); err != nil {
+		return nil, err
+	}
+
+	objects, err := openObjectStore(filepath.Join(commonDir, "objects"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{gitDir: gitDir, commonDir: commonDir, objects: objects}, nil
+}
+
+// Close closes the pack files that were opened to read the repository's
+// objects. Neither the Repository nor any FS from it can be read after it
+// is closed.
+func (r *Repository) Close() error {
+	return r.objects.close()
+}
+
+// findGitDir locates the .git directory for repoPath.
+func findGitDir(repoPath string) (string, error) {
+	dotGit := filepath.Join(repoPath, ".git")
+	fi, err := os.Stat(dotGit)
+	if err == nil && fi.IsDir() {
+		return dotGit, nil
+	}
+	if err == nil {
+		// a .git file points to the real directory, as for linked
+		// worktrees and submodules
+		b, err := os.ReadFile(dotGit)
+		if err != nil {
+			return "", err
+		}
+		line := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(line, "gitdir:") {
+			return "", fmt.Errorf("%s: unrecognized .git file", repoPath)
+		}
+		gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(repoPath, gitDir)
+		}
+		return gitDir, nil
+	}
+
+	// otherwise, it should be a .git directory or bare repository itself
+	if _, err := os.Stat(filepath.Join(repoPath, "HEAD")); err != nil {
+		return "", fmt.Errorf("%s: not a git repository", repoPath)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "objects")); err != nil {
+		return "", fmt.Errorf("%s: not a git repository", repoPath)
+	}
+	return repoPath, nil
+}
+
+// checkObjectFormat returns an error for repositories using an object
+// format other than SHA-1, which are not supported.
+func checkObjectFormat(commonDir string) error {
+	f, err := os.Open(filepath.Join(commonDir, "config"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != "extensions" {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(key), "objectformat") && !strings.EqualFold(strings.TrimSpace(value), "sha1") {
+			return fmt.Errorf("unsupported git object format %s", strings.TrimSpace(value))
+		}
+	}
+	return scanner.Err()
+}
+
+// ResolveCommit returns the full hex ID of the commit named by commitish.
+// It accepts full or abbreviated object IDs, "HEAD" (or "@"), branch, tag
+// and remote-tracking ref names (looked up in the same order as git
+// rev-parse), and "~N" and "^N" ancestor suffixes. Annotated tags are
+// peeled to the commit they point to.
+func (r *Repository) ResolveCommit(commitish string) (string, error) {
+	// split off any ancestry suffixes, which are applied afterwards
+	base := commitish
+	suffixStart := strings.IndexAny(base, "~^")
+	suffixes := ""
+	if suffixStart >= 0 {
+		base, suffixes = base[:suffixStart], base[suffixStart:]
+	}
+	switch base {
+	case "":
+		return "", fmt.Errorf("invalid commit-ish %q", commitish)
+	case "@":
+		base = "HEAD"
+	}
+
+	id, err := r.resolveName(base)
+	if err != nil {
+		return "", err
+	}
+	id, err = r.peelToCommit(id)
+	if err != nil {
+		return "", err
+	}
+
+	for suffixes != "" {
+		op := suffixes[0]
+		suffixes = suffixes[1:]
+		if op != '~' && op != '^' {
+			return "", fmt.Errorf("invalid commit-ish %q", commitish)
+		}
+		n := 1
+		digits := len(suffixes) - len(strings.TrimLeft(suffixes, "0123456789"))
+		if digits > 0 {
+			if n, err = strconv.Atoi(suffixes[:digits]); err != nil {
+				return "", fmt.Errorf("invalid commit-ish %q", commitish)
+			}
+			suffixes = suffixes[digits:]
+		}
+
+		if op == '~' {
+			for i := 0; i < n; i++ {
+				if id, err = r.parent(id, 1); err != nil {
+					return "", fmt.Errorf("%s: %v", commitish, err)
+				}
+			}
+		} else if n > 0 {
+			// "^0" means the commit itself
+			if id, err = r.parent(id, n); err != nil {
+				return "", fmt.Errorf("%s: %v", commitish, err)
+			}
+		}
+	}
+
+	return id, nil
+}
+
+// resolveName converts an object ID or ref name to a full hex object ID.
+func (r *Repository) resolveName(name string) (string, error) {
+	if isHex(name) && len(name) == 40 {
+		return strings.ToLower(name), nil
+	}
+
+	for _, ref := range []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	} {
+		id, err := r.resolveRef(ref, 0)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	if isHex(name) && len(name) >= 4 && len(name) < 40 {
+		return r.objects.expand(name)
+	}
+
+	return "", fmt.Errorf("unknown revision %q", name)
+}
+
+// resolveRef follows a ref (including symbolic refs) to an object ID. It
+// returns an error wrapping os.ErrNotExist if the ref does not exist.
+func (r *Repository) resolveRef(ref string, depth int) (string, error) {
+	if depth > 10 {
+		return "", fmt.Errorf("too many levels of symbolic refs at %s", ref)
+	}
+	if strings.Contains(ref, "..") {
+		return "", os.ErrNotExist
+	}
+
+	// HEAD and other per-worktree refs live in gitDir; shared refs in
+	// commonDir
+	for _, dir := range []string{r.gitDir, r.commonDir} {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimSpace(string(b))
+		if strings.HasPrefix(content, "ref:") {
+			return r.resolveRef(strings.TrimSpace(strings.TrimPrefix(content, "ref:")), depth+1)
+		}
+		if isHex(content) && len(content) == 40 {
+			return strings.ToLower(content), nil
+		}
+	}
+
+	// fall back on packed refs
+	b, err := os.ReadFile(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, os.ErrNotExist)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		id, name, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && name == ref && isHex(id) && len(id) == 40 {
+			return strings.ToLower(id), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", ref, os.ErrNotExist)
+}
+
+// peelToCommit follows annotated tags until it reaches a commit.
+func (r *Repository) peelToCommit(id string) (string, error) {
+	for i := 0; i < 10; i++ {
+		typ, data, err := r.objects.read(id)
+		if err != nil {
+			return "", err
+		}
+		switch typ {
+		case "commit":
+			return id, nil
+		case "tag":
+			target, ok := headerValue(data, "object")
+			if !ok {
+				return "", fmt.Errorf("tag %s has no object", id)
+			}
+			id = target
+		default:
+			return "", fmt.Errorf("%s is a %s, not a commit", id, typ)
+		}
+	}
+	return "", fmt.Errorf("too many levels of tags at %s", id)
+}
+
+// parent returns the nth parent (starting at 1) of a commit.
+func (r *Repository) parent(id string, n int) (string, error) {
+	typ, data, err := r.objects.read(id)
+	if err != nil {
+		return "", err
+	}
+	if typ != "commit" {
+		return "", fmt.Errorf("%s is a %s, not a commit", id, typ)
+	}
+	parents := headerValues(data, "parent")
+	if n > len(parents) {
+		return "", fmt.Errorf("commit %s has no parent %d", id, n)
+	}
+	return parents[n-1], nil
+}
+
+// CommitFS returns an fs.FS for the tree of the commit named by commitish
+// (see ResolveCommit), and the full hex ID of that commit.
+func (r *Repository) CommitFS(commitish string) (*FS, string, error) {
+	id, err := r.ResolveCommit(commitish)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, data, err := r.objects.read(id)
+	if err != nil {
+		return nil, "", err
+	}
+	tree, ok := headerValue(data, "tree")
+	if !ok {
+		return nil, "", fmt.Errorf("commit %s has no tree", id)
+	}
+
+	return &FS{repo: r, tree: tree}, id, nil
+}
+
+// headerValue returns the value of the first header line with the given
+// key in a commit or tag object.
+func headerValue(data []byte, key string) (string, bool) {
+	vals := headerValues(data, key)
+	if len(vals) == 0 {
+		return "", false
+	}
+	return vals[0], true
+}
+
+// headerValues returns the values of all header lines with the given key
+// in a commit or tag object.
+func headerValues(data []byte, key string) []string {
+	vals := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			// end of headers
+			break
+		}
+		if k, v, ok := strings.Cut(line, " "); ok && k == key {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s + strings.Repeat("0", len(s)%2))
+	return err == nil
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idinserter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ===== Unified diff tests =====
+func TestUnifiedDiffIsEmptyWhenUnchanged(t *testing.T) {
+	if got := UnifiedDiff("f.c", []byte("a\nb\n"), []byte("a\nb\n")); got != "" {
+		t.Errorf("expected %q, got %q", "", got)
+	}
+}
+
+func TestUnifiedDiffShowsContext(t *testing.T) {
+	before := "1\n2\n3\n4\n5\n6\n7\n8\n"
+	after := "1\n2\n3\n4\nfive\n6\n7\n8\n"
+	want := "--- a/f.c\n+++ b/f.c\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"
+	if got := UnifiedDiff("f.c", []byte(before), []byte(after)); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestUnifiedDiffSplitsDistantChanges(t *testing.T) {
+	lines := []string{}
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	before := strings.Join(lines, "")
+	lines[0], lines[19] = "first\n", "last\n"
+	after := strings.Join(lines, "")
+
+	got := UnifiedDiff("f.c", []byte(before), []byte(after))
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Errorf("expected %v hunks, got %v in %q", 2, n, got)
+	}
+	if !strings.Contains(got, "@@ -1,4 +1,4 @@\n-line 1\n+first\n line 2\n") {
+		t.Errorf("expected first hunk at line 1, got %q", got)
+	}
+	if !strings.Contains(got, "@@ -17,4 +17,4 @@\n line 17\n line 18\n line 19\n-line 20\n+last\n") {
+		t.Errorf("expected second hunk at line 17, got %q", got)
+	}
+}
+
+func TestUnifiedDiffCanInsertIntoEmptyFile(t *testing.T) {
+	want := "--- a/f.sh\n+++ b/f.sh\n@@ -0,0 +1 @@\n+# x\n"
+	if got := UnifiedDiff("f.sh", []byte{}, []byte("# x\n")); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestUnifiedDiffMarksMissingNewline(t *testing.T) {
+	want := "--- a/f.sh\n+++ b/f.sh\n@@ -1 +1,2 @@\n-#!/bin/sh\n\\ No newline at end of file\n+#!/bin/sh\n+# x\n"
+	if got := UnifiedDiff("f.sh", []byte("#!/bin/sh"), []byte("#!/bin/sh\n# x\n")); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,327 @@
+// Package idinserter is used to add or update short-form IDs and copyright
+// notices in the headers of files, such as from the license findings in an
+// SPDX Document. It is the counterpart of package idsearcher.
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+package idinserter
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+const (
+	licenseTag   = "SPDX-License-Identifier:"
+	copyrightTag = "SPDX-FileCopyrightText:"
+)
+
+// Header is the information to be written to the header of a file.
+type Header struct {
+	// License is the license expression for the SPDX-License-Identifier
+	// line, or "" to leave the license unchanged.
+	License string
+	// Copyrights are the copyright notices for the SPDX-FileCopyrightText
+	// lines, or nil to leave the copyright notices unchanged.
+	Copyrights []string
+}
+
+// Config is a collection of configuration settings for UpdateHeaders.
+type Config struct {
+	// DryRun leaves the files unchanged. The diffs of the changes that
+	// would be made are still returned.
+	DryRun bool
+
+	// Styles maps file names or lower-case extensions to the comment
+	// syntax for those files, adding to or overriding the built-in ones.
+	Styles map[string]CommentStyle
+}
+
+// Change is an update made (or, for a dry run, to be made) to a file.
+type Change struct {
+	// FileName is the path to the file, relative to the directory.
+	FileName string
+	// Diff is the update, as a unified diff.
+	Diff string
+}
+
+// Result lists the outcome of UpdateHeaders.
+type Result struct {
+	// Changes are the updated files, sorted by FileName. Files whose
+	// headers were already up to date are not included.
+	Changes []Change
+	// Unsupported lists the files that were skipped because their comment
+	// syntax is not known, sorted.
+	Unsupported []string
+}
+
+// HeadersFromDocument returns the headers for the Files in an SPDX
+// Document, keyed by FileName. The License of each is the File's
+// LicenseConcluded; Files for which that and (if requested) the copyright
+// text are NOASSERTION or NONE are left out. Arguments:
+//   - doc: SPDX Document whose Files are used
+//   - withCopyright: true to also use each File's FileCopyrightText, with
+//     each of its lines as a separate copyright notice
+func HeadersFromDocument(doc *spdx.Document2_1, withCopyright bool) map[string]Header {
+	headers := map[string]Header{}
+	for _, pkg := range doc.Packages {
+		for _, f := range pkg.Files {
+			h := Header{}
+			if isAssertion(f.LicenseConcluded) {
+				h.License = f.LicenseConcluded
+			}
+			if withCopyright && isAssertion(f.FileCopyrightText) {
+				for _, line := range strings.Split(f.FileCopyrightText, "\n") {
+					if line = strings.TrimSpace(line); line != "" {
+						h.Copyrights = append(h.Copyrights, line)
+					}
+				}
+			}
+			if h.License != "" || len(h.Copyrights) > 0 {
+				headers[f.FileName] = h
+			}
+		}
+	}
+	return headers
+}
+
+func isAssertion(s string) bool {
+	return s != "" && s != "NOASSERTION" && s != "NONE"
+}
+
+// UpdateHeaders adds or updates the headers of files in a directory.
+// Arguments:
+//   - dirRoot: path to the directory containing the files
+//   - headers: the header for each file, keyed by its path relative to
+//     dirRoot, with or without a leading "/" or "./" (as in SPDX FileNames).
+//     An error is returned, before any file is changed, if a path leads
+//     outside of dirRoot.
+//   - config: Config object; nil uses the defaults
+func UpdateHeaders(dirRoot string, headers map[string]Header, config *Config) (*Result, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	// keys are the relative paths; values are the original keys
+	relPaths := map[string]string{}
+	for fileName := range headers {
+		relPath := path.Clean(strings.TrimPrefix(strings.TrimPrefix(fileName, "./"), "/"))
+		if !isLocalPath(relPath) {
+			return nil, fmt.Errorf("file name %q is outside of %s", fileName, dirRoot)
+		}
+		relPaths[relPath] = fileName
+	}
+	sortedPaths := []string{}
+	for relPath := range relPaths {
+		sortedPaths = append(sortedPaths, relPath)
+	}
+	sort.Strings(sortedPaths)
+
+	result := &Result{Changes: []Change{}, Unsupported: []string{}}
+	for _, relPath := range sortedPaths {
+		style, ok := LookupStyle(relPath, config.Styles)
+		if !ok {
+			result.Unsupported = append(result.Unsupported, relPath)
+			continue
+		}
+
+		filePath := filepath.Join(dirRoot, filepath.FromSlash(relPath))
+		fi, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		before, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		after := UpdateHeader(before, style, headers[relPaths[relPath]])
+		diff := UnifiedDiff(relPath, before, after)
+		if diff == "" {
+			continue
+		}
+		if !config.DryRun {
+			if err := os.WriteFile(filePath, after, fi.Mode().Perm()); err != nil {
+				return nil, err
+			}
+		}
+		result.Changes = append(result.Changes, Change{FileName: relPath, Diff: diff})
+	}
+	return result, nil
+}
+
+// isLocalPath reports whether the cleaned, slash-separated path p stays
+// within the directory it is relative to, both as given and as converted
+// to the platform's separators.
+func isLocalPath(p string) bool {
+	fp := filepath.Clean(filepath.FromSlash(p))
+	for _, c := range []string{p, filepath.ToSlash(fp)} {
+		if path.IsAbs(c) || c == ".." || strings.HasPrefix(c, "../") {
+			return false
+		}
+	}
+	return !filepath.IsAbs(fp) && filepath.VolumeName(fp) == ""
+}
+
+// magicCommentRe matches the encoding and similar pragmas of Python and
+// Ruby, which must stay within the first lines of a file.
+var magicCommentRe = regexp.MustCompile(`^[ \t\f]*#.*?(coding[:=]|frozen_string_literal:)`)
+
+// UpdateHeader returns the contents of a file with its header updated. An
+// existing SPDX-License-Identifier line in the header is updated in place,
+// and existing SPDX-FileCopyrightText lines are replaced; otherwise the
+// new lines are added at the top of the file, after any shebang, encoding
+// pragma, XML declaration, doctype or PHP opening tag. Arguments:
+//   - content: the original contents of the file
+//   - style: comment syntax for the file
+//   - h: the header to write
+func UpdateHeader(content []byte, style CommentStyle, h Header) []byte {
+	text := string(content)
+	bom := ""
+	if strings.HasPrefix(text, "\ufeff") {
+		bom, text = "\ufeff", text[len("\ufeff"):]
+	}
+	lines := splitLines(text)
+	nl := "\n"
+	if len(lines) > 0 && strings.HasSuffix(lines[0], "\r\n") {
+		nl = "\r\n"
+	}
+
+	// find the lines that must stay first, then the comments after them
+	top := prologueLength(lines, style)
+	licLine := -1
+	crLines := []int{}
+scan:
+	for i, inBlock := top, false; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		switch {
+		case inBlock:
+			inBlock = !strings.Contains(t, style.End)
+		case t == "":
+		case style.Line != "" && strings.HasPrefix(t, style.Line):
+		case style.Start != "" && strings.HasPrefix(t, style.Start):
+			inBlock = !strings.Contains(t[len(style.Start):], style.End)
+		default:
+			break scan
+		}
+		if licLine < 0 && strings.Contains(lines[i], licenseTag) {
+			licLine = i
+		}
+		if strings.Contains(lines[i], copyrightTag) {
+			crLines = append(crLines, i)
+		}
+	}
+
+	copyrights := []string{}
+	for _, c := range h.Copyrights {
+		c = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c), copyrightTag))
+		if c != "" {
+			copyrights = append(copyrights, c)
+		}
+	}
+
+	// replace holds the new lines for each existing line that changes
+	replace := map[int][]string{}
+	if h.License != "" && licLine >= 0 {
+		replace[licLine] = []string{retag(lines[licLine], licenseTag, licenseTag, h.License, style)}
+	}
+	if len(copyrights) > 0 && len(crLines) > 0 {
+		newLines := []string{}
+		for _, c := range copyrights {
+			newLines = append(newLines, retag(lines[crLines[0]], copyrightTag, copyrightTag, c, style))
+		}
+		replace[crLines[0]] = newLines
+		for _, i := range crLines[1:] {
+			replace[i] = []string{}
+		}
+	}
+
+	// lines to be added are written like the existing tag line next to
+	// them, if there is one, so that they fit into its comment
+	insertAt := top
+	insert := []string{}
+	switch {
+	case len(copyrights) > 0 && len(crLines) == 0 && licLine >= 0:
+		insertAt = licLine
+		for _, c := range copyrights {
+			insert = append(insert, retag(lines[licLine], licenseTag, copyrightTag, c, style))
+		}
+	case h.License != "" && licLine < 0 && len(crLines) > 0:
+		insertAt = crLines[len(crLines)-1] + 1
+		insert = append(insert, retag(lines[crLines[0]], copyrightTag, licenseTag, h.License, style))
+	default:
+		if len(copyrights) > 0 && len(crLines) == 0 {
+			for _, c := range copyrights {
+				insert = append(insert, style.comment(copyrightTag+" "+c)+nl)
+			}
+		}
+		if h.License != "" && licLine < 0 {
+			insert = append(insert, style.comment(licenseTag+" "+h.License)+nl)
+		}
+		// separate a new header from what follows it
+		if len(insert) > 0 && insertAt < len(lines) && strings.TrimSpace(lines[insertAt]) != "" {
+			insert = append(insert, nl)
+		}
+	}
+	if len(insert) > 0 && insertAt > 0 && !strings.HasSuffix(lines[insertAt-1], "\n") {
+		lines[insertAt-1] += nl
+	}
+
+	var sb strings.Builder
+	sb.WriteString(bom)
+	for i := 0; i <= len(lines); i++ {
+		if i == insertAt {
+			sb.WriteString(strings.Join(insert, ""))
+		}
+		if i == len(lines) {
+			break
+		}
+		if newLines, ok := replace[i]; ok {
+			sb.WriteString(strings.Join(newLines, ""))
+		} else {
+			sb.WriteString(lines[i])
+		}
+	}
+	return []byte(sb.String())
+}
+
+// prologueLength returns the number of lines at the start of a file that
+// must stay before any header.
+func prologueLength(lines []string, style CommentStyle) int {
+	n := 0
+	for n < len(lines) {
+		t := strings.ToLower(strings.TrimSpace(lines[n]))
+		switch {
+		case n == 0 && strings.HasPrefix(t, "#!"):
+		case style.Line == "#" && magicCommentRe.MatchString(t):
+		case strings.HasPrefix(t, "<?xml"), strings.HasPrefix(t, "<?php"), strings.HasPrefix(t, "<!doctype"):
+		default:
+			return n
+		}
+		n++
+	}
+	return n
+}
+
+// retag returns a copy of line, which contains the tag oldTag, with that
+// tag and its value replaced by newTag and value. Any comment delimiter
+// after the old value, and the line ending, are kept.
+func retag(line string, oldTag string, newTag string, value string, style CommentStyle) string {
+	body := strings.TrimRight(line, "\r\n")
+	ending := line[len(body):]
+	i := strings.Index(body, oldTag)
+	prefix, rest := body[:i], body[i+len(oldTag):]
+
+	suffix := ""
+	for _, end := range []string{style.End, "*/"} {
+		if j := strings.Index(rest, end); end != "" && j >= 0 {
+			suffix = " " + rest[j:]
+			break
+		}
+	}
+	return prefix + newTag + " " + value + suffix + ending
+}
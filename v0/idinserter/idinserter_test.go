@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idinserter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Header update tests =====
+func TestCanInsertHeaderWithLineComments(t *testing.T) {
+	content := "package main\n"
+	want := "// SPDX-FileCopyrightText: 2020 Jane Doe\n// SPDX-License-Identifier: MIT\n\npackage main\n"
+	got := string(UpdateHeader([]byte(content), styleC, Header{License: "MIT", Copyrights: []string{"2020 Jane Doe"}}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCanInsertHeaderWithBlockComments(t *testing.T) {
+	content := "body { color: red; }\n"
+	want := "/* SPDX-License-Identifier: MIT */\n\nbody { color: red; }\n"
+	got := string(UpdateHeader([]byte(content), styleCSS, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCanInsertHeaderInEmptyFile(t *testing.T) {
+	want := "# SPDX-License-Identifier: MIT\n"
+	got := string(UpdateHeader([]byte{}, styleHash, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInsertHeaderKeepsShebangAndEncoding(t *testing.T) {
+	content := "#!/usr/bin/env python3\n# -*- coding: utf-8 -*-\nimport os\n"
+	want := "#!/usr/bin/env python3\n# -*- coding: utf-8 -*-\n# SPDX-License-Identifier: Apache-2.0\n\nimport os\n"
+	got := string(UpdateHeader([]byte(content), styleHash, Header{License: "Apache-2.0"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInsertHeaderKeepsShebangWithoutNewline(t *testing.T) {
+	content := "#!/bin/sh"
+	want := "#!/bin/sh\n# SPDX-License-Identifier: MIT\n"
+	got := string(UpdateHeader([]byte(content), styleHash, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInsertHeaderKeepsXMLDeclarationAndPHPTag(t *testing.T) {
+	content := "<?xml version=\"1.0\"?>\n<root/>\n"
+	want := "<?xml version=\"1.0\"?>\n<!-- SPDX-License-Identifier: MIT -->\n\n<root/>\n"
+	got := string(UpdateHeader([]byte(content), styleHTML, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	content = "<?php\necho 1;\n"
+	want = "<?php\n// SPDX-License-Identifier: MIT\n\necho 1;\n"
+	got = string(UpdateHeader([]byte(content), styleC, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestInsertHeaderKeepsByteOrderMarkAndCRLF(t *testing.T) {
+	content := "\ufeffint x;\r\n"
+	want := "\ufeff// SPDX-License-Identifier: MIT\r\n\r\nint x;\r\n"
+	got := string(UpdateHeader([]byte(content), styleC, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCanUpdateExistingLicenseLine(t *testing.T) {
+	content := "/* SPDX-License-Identifier: GPL-2.0 */\n#include <stdio.h>\n"
+	want := "/* SPDX-License-Identifier: GPL-2.0-only */\n#include <stdio.h>\n"
+	got := string(UpdateHeader([]byte(content), styleC, Header{License: "GPL-2.0-only"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCanUpdateLicenseLineWithinBlockComment(t *testing.T) {
+	content := "/*\n * Some project\n * SPDX-FileCopyrightText: 2019 Old Owner\n */\nint x;\n"
+	want := "/*\n * Some project\n * SPDX-FileCopyrightText: 2020 New Owner\n * SPDX-FileCopyrightText: 2021 Other Owner\n * SPDX-License-Identifier: BSD-2-Clause\n */\nint x;\n"
+	h := Header{License: "BSD-2-Clause", Copyrights: []string{"2020 New Owner", "SPDX-FileCopyrightText: 2021 Other Owner"}}
+	got := string(UpdateHeader([]byte(content), styleC, h))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCanAddCopyrightBeforeExistingLicenseLine(t *testing.T) {
+	content := "# SPDX-License-Identifier: MIT\nx = 1\n"
+	want := "# SPDX-FileCopyrightText: 2020 Jane Doe\n# SPDX-License-Identifier: MIT\nx = 1\n"
+	got := string(UpdateHeader([]byte(content), styleHash, Header{Copyrights: []string{"2020 Jane Doe"}}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestUpdateHeaderIgnoresTagsAfterHeader(t *testing.T) {
+	content := "package main\n\n// SPDX-License-Identifier: is the tag\n"
+	want := "// SPDX-License-Identifier: MIT\n\npackage main\n\n// SPDX-License-Identifier: is the tag\n"
+	got := string(UpdateHeader([]byte(content), styleC, Header{License: "MIT"}))
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestUpdateHeaderLeavesUpToDateFileUnchanged(t *testing.T) {
+	content := "// SPDX-License-Identifier: MIT\n\npackage main\n"
+	got := string(UpdateHeader([]byte(content), styleC, Header{License: "MIT"}))
+	if got != content {
+		t.Errorf("expected %q, got %q", content, got)
+	}
+}
+
+// ===== Comment style tests =====
+func TestCanLookupStyles(t *testing.T) {
+	if cs, ok := LookupStyle("src/Main.JAVA", nil); !ok || cs != styleC {
+		t.Errorf("expected %v, got %v", styleC, cs)
+	}
+	if cs, ok := LookupStyle("build/Makefile", nil); !ok || cs != styleHash {
+		t.Errorf("expected %v, got %v", styleHash, cs)
+	}
+	if _, ok := LookupStyle("data.bin", nil); ok {
+		t.Errorf("expected no style for data.bin")
+	}
+	custom := map[string]CommentStyle{".bin": styleDash, "Makefile": styleC}
+	if cs, ok := LookupStyle("data.bin", custom); !ok || cs != styleDash {
+		t.Errorf("expected %v, got %v", styleDash, cs)
+	}
+	if cs, ok := LookupStyle("Makefile", custom); !ok || cs != styleC {
+		t.Errorf("expected %v, got %v", styleC, cs)
+	}
+}
+
+// ===== Top-level function tests =====
+func TestCanGetHeadersFromDocument(t *testing.T) {
+	doc := &spdx.Document2_1{
+		Packages: []*spdx.Package2_1{
+			{
+				Files: []*spdx.File2_1{
+					{FileName: "/a.c", LicenseConcluded: "MIT", FileCopyrightText: "Copyright 2020 A\nCopyright 2021 B"},
+					{FileName: "/b.c", LicenseConcluded: "NOASSERTION", FileCopyrightText: "NOASSERTION"},
+					{FileName: "/c.c", LicenseConcluded: "NONE", FileCopyrightText: "Copyright 2020 C"},
+				},
+			},
+		},
+	}
+
+	headers := HeadersFromDocument(doc, false)
+	if len(headers) != 1 {
+		t.Fatalf("expected %v, got %v", 1, len(headers))
+	}
+	if h := headers["/a.c"]; h.License != "MIT" || h.Copyrights != nil {
+		t.Errorf("expected %v, got %v", Header{License: "MIT"}, h)
+	}
+
+	headers = HeadersFromDocument(doc, true)
+	if len(headers) != 2 {
+		t.Fatalf("expected %v, got %v", 2, len(headers))
+	}
+	if h := headers["/a.c"]; len(h.Copyrights) != 2 || h.Copyrights[1] != "Copyright 2021 B" {
+		t.Errorf("expected %v, got %v", []string{"Copyright 2020 A", "Copyright 2021 B"}, h.Copyrights)
+	}
+	if h := headers["/c.c"]; h.License != "" || len(h.Copyrights) != 1 {
+		t.Errorf("expected %v, got %v", Header{Copyrights: []string{"Copyright 2020 C"}}, h)
+	}
+}
+
+func TestCanUpdateHeadersInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":       "package main\n",
+		"sub/run.sh":    "#!/bin/sh\n# SPDX-License-Identifier: MIT\necho hi\n",
+		"image.png":     "\x89PNG",
+		"sub/script.py": "print(1)\n",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	headers := map[string]Header{
+		"/main.go":        {License: "Apache-2.0"},
+		"/sub/run.sh":     {License: "MIT"},
+		"/image.png":      {License: "MIT"},
+		"./sub/script.py": {License: "GPL-2.0-or-later"},
+	}
+
+	// a dry run reports the changes without making them
+	result, err := UpdateHeaders(dir, headers, &Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(result.Changes) != 2 {
+		t.Fatalf("expected %v, got %v", 2, len(result.Changes))
+	}
+	if result.Changes[0].FileName != "main.go" || result.Changes[1].FileName != "sub/script.py" {
+		t.Errorf("expected %v, got %v", []string{"main.go", "sub/script.py"}, result.Changes)
+	}
+	wantDiff := "--- a/main.go\n+++ b/main.go\n@@ -1 +1,3 @@\n+// SPDX-License-Identifier: Apache-2.0\n+\n package main\n"
+	if result.Changes[0].Diff != wantDiff {
+		t.Errorf("expected %q, got %q", wantDiff, result.Changes[0].Diff)
+	}
+	if len(result.Unsupported) != 1 || result.Unsupported[0] != "image.png" {
+		t.Errorf("expected %v, got %v", []string{"image.png"}, result.Unsupported)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+	if string(data) != files["main.go"] {
+		t.Errorf("expected %q, got %q", files["main.go"], string(data))
+	}
+
+	// and otherwise makes them
+	if _, err = UpdateHeaders(dir, headers, &Config{}); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "sub", "script.py"))
+	want := "# SPDX-License-Identifier: GPL-2.0-or-later\n\nprint(1)\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, string(data))
+	}
+	result, err = UpdateHeaders(dir, headers, &Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", result.Changes)
+	}
+}
+
+func TestUpdateHeadersAcceptsNilConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := UpdateHeaders(dir, map[string]Header{"main.go": {License: "MIT"}}, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(result.Changes) != 1 {
+		t.Errorf("expected %v, got %v", 1, len(result.Changes))
+	}
+}
+
+func TestUpdateHeadersRejectsPathsOutsideDirectory(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "project")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"outside.c", filepath.Join("project", "main.c")} {
+		if err := os.WriteFile(filepath.Join(parent, name), []byte("int x;\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, fileName := range []string{"../outside.c", "/../outside.c", "./sub/../../outside.c", "//outside.c", ".."} {
+		headers := map[string]Header{
+			"main.c": {License: "MIT"},
+			fileName: {License: "MIT"},
+		}
+		if _, err := UpdateHeaders(dir, headers, &Config{}); err == nil {
+			t.Errorf("%s: expected non-nil error, got nil", fileName)
+		}
+	}
+
+	// no file was changed, inside or outside of the directory
+	for _, name := range []string{"outside.c", filepath.Join("project", "main.c")} {
+		data, _ := os.ReadFile(filepath.Join(parent, name))
+		if string(data) != "int x;\n" {
+			t.Errorf("expected %q, got %q", "int x;\n", string(data))
+		}
+	}
+}
+
+func TestUpdateHeadersFailsWithMissingFile(t *testing.T) {
+	_, err := UpdateHeaders(t.TempDir(), map[string]Header{"missing.c": {License: "MIT"}}, &Config{})
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestInsertHeaderGoesBeforeExistingComment(t *testing.T) {
+	content := "/*\n * Copyright 2020 Someone\n */\nint x;\n"
+	got := string(UpdateHeader([]byte(content), styleC, Header{License: "MIT OR Apache-2.0"}))
+	if !strings.HasPrefix(got, "// SPDX-License-Identifier: MIT OR Apache-2.0\n\n/*\n") {
+		t.Errorf("expected header before existing comment, got %q", got)
+	}
+}
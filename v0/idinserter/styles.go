@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idinserter
+
+import (
+	"path"
+	"strings"
+)
+
+// CommentStyle is the comment syntax used to write a header in a file.
+type CommentStyle struct {
+	// Line starts a comment that runs to the end of the line, such as
+	// "//" or "#".
+	Line string
+	// Start and End delimit a block comment, such as "/*" and "*/". They
+	// are used for new header lines only if Line is empty, but existing
+	// block comments are recognized either way.
+	Start string
+	End   string
+}
+
+// comment returns text as a single-line comment.
+func (cs CommentStyle) comment(text string) string {
+	if cs.Line != "" {
+		return cs.Line + " " + text
+	}
+	return cs.Start + " " + text + " " + cs.End
+}
+
+var (
+	styleC       = CommentStyle{Line: "//", Start: "/*", End: "*/"}
+	styleCSS     = CommentStyle{Start: "/*", End: "*/"}
+	styleHash    = CommentStyle{Line: "#"}
+	styleDash    = CommentStyle{Line: "--"}
+	styleSemi    = CommentStyle{Line: ";;"}
+	stylePercent = CommentStyle{Line: "%"}
+	styleHTML    = CommentStyle{Start: "<!--", End: "-->"}
+	styleML      = CommentStyle{Start: "(*", End: "*)"}
+)
+
+// extensionStyles maps file name extensions, in lower case, to the
+// comment style used for files with that extension.
+var extensionStyles = map[string]CommentStyle{
+	".c": styleC, ".h": styleC, ".cc": styleC, ".cpp": styleC, ".cxx": styleC,
+	".hh": styleC, ".hpp": styleC, ".hxx": styleC, ".m": styleC, ".mm": styleC,
+	".go": styleC, ".java": styleC, ".kt": styleC, ".kts": styleC,
+	".scala": styleC, ".groovy": styleC, ".gradle": styleC, ".cs": styleC,
+	".js": styleC, ".mjs": styleC, ".cjs": styleC, ".jsx": styleC,
+	".ts": styleC, ".tsx": styleC, ".rs": styleC, ".swift": styleC,
+	".dart": styleC, ".php": styleC, ".proto": styleC, ".scss": styleC,
+	".less": styleC, ".v": styleC, ".sv": styleC, ".zig": styleC,
+
+	".css": styleCSS,
+
+	".sh": styleHash, ".bash": styleHash, ".zsh": styleHash, ".fish": styleHash,
+	".py": styleHash, ".pyi": styleHash, ".rb": styleHash, ".pl": styleHash,
+	".pm": styleHash, ".r": styleHash, ".yaml": styleHash, ".yml": styleHash,
+	".toml": styleHash, ".cfg": styleHash, ".conf": styleHash, ".ini": styleHash,
+	".mk": styleHash, ".cmake": styleHash, ".ps1": styleHash, ".tf": styleHash,
+	".nix": styleHash, ".jl": styleHash, ".ex": styleHash, ".exs": styleHash,
+	".awk": styleHash, ".bzl": styleHash, ".star": styleHash,
+
+	".sql": styleDash, ".lua": styleDash, ".hs": styleDash, ".adb": styleDash,
+	".ads": styleDash, ".vhd": styleDash, ".vhdl": styleDash,
+
+	".el": styleSemi, ".lisp": styleSemi, ".clj": styleSemi, ".cljs": styleSemi,
+	".scm": styleSemi,
+
+	".erl": stylePercent, ".hrl": stylePercent, ".tex": stylePercent,
+	".sty": stylePercent,
+
+	".html": styleHTML, ".htm": styleHTML, ".xml": styleHTML, ".xsd": styleHTML,
+	".xsl": styleHTML, ".svg": styleHTML, ".md": styleHTML, ".vue": styleHTML,
+
+	".ml": styleML, ".mli": styleML,
+}
+
+// nameStyles maps file names without an extension that implies their
+// language to the comment style used for them.
+var nameStyles = map[string]CommentStyle{
+	"Makefile":       styleHash,
+	"GNUmakefile":    styleHash,
+	"Dockerfile":     styleHash,
+	"Containerfile":  styleHash,
+	"CMakeLists.txt": styleHash,
+	"BUILD":          styleHash,
+	"WORKSPACE":      styleHash,
+	"Gemfile":        styleHash,
+	"Rakefile":       styleHash,
+	".gitignore":     styleHash,
+	".gitattributes": styleHash,
+}
+
+// LookupStyle returns the comment style for a file, and whether one is
+// known. The file name is checked first, then its extension. Arguments:
+//   - filePath: path to the file
+//   - styles: comment styles keyed by file name (such as "Jenkinsfile") or
+//     lower-case extension (such as ".proto"), which take precedence over
+//     the built-in ones; may be nil
+func LookupStyle(filePath string, styles map[string]CommentStyle) (CommentStyle, bool) {
+	name := path.Base(filePath)
+	ext := strings.ToLower(path.Ext(name))
+	for _, table := range []map[string]CommentStyle{styles, nameStyles} {
+		if cs, ok := table[name]; ok {
+			return cs, true
+		}
+	}
+	if cs, ok := styles[ext]; ok {
+		return cs, true
+	}
+	cs, ok := extensionStyles[ext]
+	return cs, ok
+}
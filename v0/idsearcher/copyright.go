@@ -0,0 +1,297 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// CopyrightScanner is a FileScanner that finds copyright statements in
+// the header of each File: lines with an "SPDX-FileCopyrightText:" tag, or
+// containing "Copyright", "(c)" or "©". It fills in the File's
+// FileCopyrightText with the statements it finds, one per line, and the
+// Package's PackageCopyrightText with the statements from all of its Files,
+// merged by holder. Files whose FileType is BINARY or ARCHIVE are skipped.
+type CopyrightScanner struct {
+	// MaxLines is the number of lines at the start of each file that are
+	// searched. If 0, DefaultCopyrightLines is used.
+	MaxLines int
+}
+
+// DefaultCopyrightLines is the number of lines at the start of each file
+// that a CopyrightScanner searches by default.
+const DefaultCopyrightLines = 100
+
+// ScanFile searches the start of a File's contents for copyright statements.
+func (cs *CopyrightScanner) ScanFile(f *spdx.File2_1, r io.Reader) error {
+	if isBinaryFile(f) {
+		return nil
+	}
+
+	maxLines := cs.MaxLines
+	if maxLines <= 0 {
+		maxLines = DefaultCopyrightLines
+	}
+	stmts, err := FindCopyrights(r, maxLines)
+	if len(stmts) > 0 {
+		f.FileCopyrightText = strings.Join(stmts, "\n")
+	}
+	return err
+}
+
+// FinishPackage fills in the Package's copyright text from its Files.
+func (cs *CopyrightScanner) FinishPackage(pkg *spdx.Package2_1) error {
+	all := []Copyright{}
+	for _, f := range pkg.Files {
+		if f.FileCopyrightText == "NOASSERTION" || f.FileCopyrightText == "NONE" {
+			continue
+		}
+		for _, line := range strings.Split(f.FileCopyrightText, "\n") {
+			if c, ok := ParseCopyright(line); ok {
+				all = append(all, c)
+			}
+		}
+	}
+	if merged := MergeCopyrights(all); len(merged) > 0 {
+		stmts := []string{}
+		for _, c := range merged {
+			stmts = append(stmts, c.String())
+		}
+		pkg.PackageCopyrightText = strings.Join(stmts, "\n")
+	}
+	return nil
+}
+
+// PresentYear is the end of an open-ended range of years, such as
+// "2015-present", in Copyright.Years.
+const PresentYear = 9999
+
+// Copyright is a normalized copyright statement.
+type Copyright struct {
+	// Years are the years of the statement, as sorted, non-overlapping
+	// ranges; a single year has the same start and end, and an open-ended
+	// range ends with PresentYear.
+	Years [][2]int
+	// Holder is the copyright holder, without any trailing "All rights
+	// reserved".
+	Holder string
+}
+
+// String formats the statement as "Copyright <years> <holder>", with
+// consecutive years collapsed into ranges.
+func (c Copyright) String() string {
+	years := []string{}
+	for _, y := range c.Years {
+		if y[0] == y[1] {
+			years = append(years, strconv.Itoa(y[0]))
+		} else if y[1] == PresentYear {
+			years = append(years, fmt.Sprintf("%d-present", y[0]))
+		} else {
+			years = append(years, fmt.Sprintf("%d-%d", y[0], y[1]))
+		}
+	}
+	if len(years) == 0 {
+		return "Copyright " + c.Holder
+	}
+	return fmt.Sprintf("Copyright %s %s", strings.Join(years, ", "), c.Holder)
+}
+
+// FindCopyrights returns the normalized copyright statements found in the
+// first maxLines lines read from r, merged by holder.
+func FindCopyrights(r io.Reader, maxLines int) ([]string, error) {
+	found := []Copyright{}
+	n := 0
+	err := readLines(r, func(line string) bool {
+		if c, ok := ParseCopyright(line); ok {
+			found = append(found, c)
+		}
+		n++
+		return n < maxLines
+	})
+
+	stmts := []string{}
+	for _, c := range MergeCopyrights(found) {
+		stmts = append(stmts, c.String())
+	}
+	return stmts, err
+}
+
+var (
+	spdxCopyrightTag    = "SPDX-FileCopyrightText:"
+	copyrightMarkerRe   = regexp.MustCompile(`(?i)copyright\b|\(c\)|©|&copy;`)
+	copyrightPrefixRe   = regexp.MustCompile(`^(?i)(?:copyright\b|\(c\)|©|&copy;|[:,]|\s)+`)
+	rightsReservedRe    = regexp.MustCompile(`(?i)[\s,;]*all rights reserved[\s.]*$`)
+	yearListRe          = regexp.MustCompile(`^((?:19|20)\d{2})(?:\s*[-–]\s*((?:19|20)\d{2}|\d{2}|(?i:present))\b)?[\s,]*`)
+	trailingYearRe      = regexp.MustCompile(`[\s,]+((?:19|20)\d{2})(?:\s*[-–]\s*((?:19|20)\d{2}))?$`)
+	abbreviationEndRe   = regexp.MustCompile(`(?i)\b(?:inc|ltd|co|corp|ag|s\.a|b\.v|e\.v|al)\.$`)
+	holderEmailRe       = regexp.MustCompile(`<[^<>\s]+@[^<>\s]+>`)
+	commentTrailerRe    = regexp.MustCompile(`\s*(?:\*/|-->|"""|''')\s*$`)
+	copyrightStopWords  = map[string]bool{"notice": true, "notices": true, "holder": true, "holders": true, "owner": true, "owners": true, "law": true, "laws": true, "statement": true, "statements": true, "and": true, "or": true, "the": true, "of": true, "is": true, "to": true, "in": true, "for": true, "license": true, "info": true, "information": true, "protection": true, "text": true, "line": true, "lines": true, "year": true, "years": true, "header": true, "headers": true}
+	commentMarkerPrefix = []string{"<!--", "/*", "//", "**", "*", "#", "--", ";;", ";", "%", "'", "\"\"\"", "'''", "REM ", "!", "dnl "}
+)
+
+// ParseCopyright parses a copyright statement from a single line of a
+// file, which may be a comment. It returns false if the line does not
+// seem to contain one, such as prose that mentions copyright, or a
+// template with placeholders for the year and holder.
+func ParseCopyright(line string) (Copyright, bool) {
+	text := stripCommentMarkers(line)
+
+	var stmt string
+	if i := strings.Index(text, spdxCopyrightTag); i >= 0 {
+		stmt = text[i+len(spdxCopyrightTag):]
+	} else if loc := copyrightMarkerRe.FindStringIndex(text); loc != nil {
+		// a statement starts at the marker, and code or prose before it
+		// means this is not a statement
+		if strings.TrimSpace(text[:loc[0]]) != "" {
+			return Copyright{}, false
+		}
+		stmt = text[loc[0]:]
+	} else {
+		return Copyright{}, false
+	}
+
+	stmt = copyrightPrefixRe.ReplaceAllString(strings.TrimSpace(stmt), "")
+	stmt = rightsReservedRe.ReplaceAllString(stmt, "")
+
+	c := Copyright{}
+	for {
+		m := yearListRe.FindStringSubmatch(stmt)
+		if m == nil {
+			break
+		}
+		c.Years = append(c.Years, yearRange(m[1], m[2]))
+		stmt = stmt[len(m[0]):]
+	}
+	// a year may instead follow the holder, as in "Copyright Jane Doe 2020"
+	if len(c.Years) == 0 {
+		if m := trailingYearRe.FindStringSubmatch(stmt); m != nil {
+			c.Years = append(c.Years, yearRange(m[1], m[2]))
+			stmt = stmt[:len(stmt)-len(m[0])]
+		}
+	}
+
+	holder := strings.Join(strings.Fields(strings.TrimPrefix(strings.TrimSpace(stmt), "by ")), " ")
+	holder = strings.TrimRight(holder, ",;: ")
+	if strings.HasSuffix(holder, ".") && !abbreviationEndRe.MatchString(holder) {
+		holder = strings.TrimSuffix(holder, ".")
+	}
+	if !plausibleHolder(holder, len(c.Years) > 0) {
+		return Copyright{}, false
+	}
+	c.Holder = holder
+	c.Years = mergeYears(c.Years)
+	return c, true
+}
+
+// stripCommentMarkers removes comment delimiters from the start and end
+// of a line.
+func stripCommentMarkers(line string) string {
+	text := strings.TrimSpace(line)
+	for changed := true; changed; {
+		changed = false
+		for _, m := range commentMarkerPrefix {
+			if strings.HasPrefix(text, m) {
+				text = strings.TrimSpace(text[len(m):])
+				changed = true
+			}
+		}
+	}
+	return commentTrailerRe.ReplaceAllString(text, "")
+}
+
+// plausibleHolder reports whether holder looks like the name of a
+// copyright holder rather than prose, code or a placeholder.
+func plausibleHolder(holder string, hasYears bool) bool {
+	// an email address is the only markup allowed
+	if holder == "" || strings.ContainsAny(holderEmailRe.ReplaceAllString(holder, ""), "<>{}[]=`$") {
+		return false
+	}
+	first := strings.Fields(holder)[0]
+	if copyrightStopWords[first] {
+		return false
+	}
+	// without a year, only a name starting with a capital letter or a
+	// digit is accepted, to rule out prose that mentions copyright
+	if !hasYears {
+		r := []rune(first)[0]
+		if !(strings.ToUpper(string(r)) == string(r) && strings.ToLower(string(r)) != string(r)) && !(r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// yearRange converts a matched year and optional end year (which may be
+// two digits, or "present") into a range.
+func yearRange(start string, end string) [2]int {
+	s, _ := strconv.Atoi(start)
+	switch {
+	case strings.EqualFold(end, "present"):
+		return [2]int{s, PresentYear}
+	case len(end) == 4:
+		e, _ := strconv.Atoi(end)
+		if e >= s {
+			return [2]int{s, e}
+		}
+	case len(end) == 2:
+		e, _ := strconv.Atoi(end)
+		e += s / 100 * 100
+		if e >= s {
+			return [2]int{s, e}
+		}
+	}
+	return [2]int{s, s}
+}
+
+// mergeYears sorts year ranges and merges those that overlap or adjoin.
+func mergeYears(years [][2]int) [][2]int {
+	if len(years) == 0 {
+		return nil
+	}
+	sorted := append([][2]int{}, years...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+	merged := [][2]int{sorted[0]}
+	for _, y := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if y[0] <= last[1]+1 {
+			if y[1] > last[1] {
+				last[1] = y[1]
+			}
+			continue
+		}
+		merged = append(merged, y)
+	}
+	return merged
+}
+
+// MergeCopyrights combines statements with the same holder, ignoring case,
+// into one statement covering all of their years. The results are sorted
+// by holder.
+func MergeCopyrights(stmts []Copyright) []Copyright {
+	byHolder := map[string]*Copyright{}
+	keys := []string{}
+	for _, c := range stmts {
+		key := strings.ToLower(c.Holder)
+		m, ok := byHolder[key]
+		if !ok {
+			byHolder[key] = &Copyright{Holder: c.Holder, Years: c.Years}
+			keys = append(keys, key)
+			continue
+		}
+		m.Years = mergeYears(append(append([][2]int{}, m.Years...), c.Years...))
+	}
+	sort.Strings(keys)
+	merged := []Copyright{}
+	for _, key := range keys {
+		merged = append(merged, *byHolder[key])
+	}
+	return merged
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ===== Copyright scanner top-level tests =====
+func TestSearcherCanFillInCopyrights(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":  {Data: []byte("// Copyright (c) 2018, 2019 Example Corp.\n// All rights reserved.\n// SPDX-License-Identifier: MIT\npackage a\n")},
+		"b.py":  {Data: []byte("# SPDX-FileCopyrightText: 2020 Example Corp.\n# SPDX-FileCopyrightText: © 2021-2022 Jane Doe <jane@example.com>\n")},
+		"c.txt": {Data: []byte("no statements here, just the copyright law\n")},
+		"d.bin": {Data: []byte("\x7fELF\x00\x00Copyright 2020 Binary Vendor\n")},
+	}
+	config := &Config{
+		NamespacePrefix: "https://example.com/",
+		Scanners:        []FileScanner{&CopyrightScanner{}},
+	}
+
+	doc, err := BuildIDsDocumentFromFS("project", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	pkg := doc.Packages[0]
+	if len(pkg.Files) != 4 {
+		t.Fatalf("expected Files len to be 4, got %d", len(pkg.Files))
+	}
+
+	want := []string{
+		"Copyright 2018-2019 Example Corp.",
+		"Copyright 2020 Example Corp.\nCopyright 2021-2022 Jane Doe <jane@example.com>",
+		"NOASSERTION",
+		"NOASSERTION",
+	}
+	for i, f := range pkg.Files {
+		if f.FileCopyrightText != want[i] {
+			t.Errorf("expected %q, got %q", want[i], f.FileCopyrightText)
+		}
+	}
+	if pkg.Files[0].LicenseConcluded != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", pkg.Files[0].LicenseConcluded)
+	}
+
+	wantPkg := "Copyright 2018-2020 Example Corp.\nCopyright 2021-2022 Jane Doe <jane@example.com>"
+	if pkg.PackageCopyrightText != wantPkg {
+		t.Errorf("expected %q, got %q", wantPkg, pkg.PackageCopyrightText)
+	}
+}
+
+func TestSearcherLeavesCopyrightsWithoutScanner(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": {Data: []byte("// Copyright 2018 Example Corp.\n")},
+	}
+	doc, err := BuildIDsDocumentFromFS("project", fsys, &Config{NamespacePrefix: "https://example.com/"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	pkg := doc.Packages[0]
+	if pkg.Files[0].FileCopyrightText != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.Files[0].FileCopyrightText)
+	}
+	if pkg.PackageCopyrightText != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.PackageCopyrightText)
+	}
+}
+
+// ===== Copyright parsing tests =====
+func TestCanParseCopyrightStatements(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"// Copyright 2020 Jane Doe", "Copyright 2020 Jane Doe"},
+		{"/* Copyright (C) 2001-2003, 2005 Free Software Foundation, Inc. */", "Copyright 2001-2003, 2005 Free Software Foundation, Inc."},
+		{" * (c) 2019 - 21 Acme Ltd. All Rights Reserved.", "Copyright 2019-2021 Acme Ltd."},
+		{"# © 2017–present The Authors", "Copyright 2017-present The Authors"},
+		{"Copyright (c) 2015 - Present Acme Ltd.", "Copyright 2015-present Acme Ltd."},
+		{"<!-- SPDX-FileCopyrightText: 2022 Jane Doe -->", "Copyright 2022 Jane Doe"},
+		{"Copyright: 2015, 2016, 2014 Jane Doe.", "Copyright 2014-2016 Jane Doe"},
+		{"Copyright by Jane Doe 2012", "Copyright 2012 Jane Doe"},
+		{"Copyright The Go Authors", "Copyright The Go Authors"},
+		{"&copy; 2010 Example", "Copyright 2010 Example"},
+	}
+	for _, tt := range tests {
+		c, ok := ParseCopyright(tt.line)
+		if !ok {
+			t.Errorf("expected statement in %q, got none", tt.line)
+			continue
+		}
+		if c.String() != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, c.String())
+		}
+	}
+}
+
+func TestCanRejectNonCopyrightStatements(t *testing.T) {
+	lines := []string{
+		"// the copyright notice above must be retained",
+		"Copyright holders may not use this file",
+		"// Copyright <year> <name of author>",
+		"# Copyright {yyyy} {name}",
+		`if strings.Contains(line, "Copyright") {`,
+		"copyright protection under the law",
+		"Copyright",
+		"a simple line without anything",
+	}
+	for _, line := range lines {
+		if c, ok := ParseCopyright(line); ok {
+			t.Errorf("expected no statement in %q, got %q", line, c.String())
+		}
+	}
+}
+
+func TestCanFindCopyrightsWithinMaxLines(t *testing.T) {
+	text := "// Copyright 2019 Jane Doe\n// Copyright 2020 jane doe\n\n// Copyright 2021 John Roe\n"
+	stmts, err := FindCopyrights(strings.NewReader(text), 3)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want := []string{"Copyright 2019-2020 Jane Doe"}
+	if len(stmts) != len(want) || stmts[0] != want[0] {
+		t.Errorf("expected %v, got %v", want, stmts)
+	}
+}
+
+func TestCanMergeOpenEndedCopyrightYears(t *testing.T) {
+	var stmts []Copyright
+	for _, line := range []string{"Copyright 2015-present Jane Doe", "Copyright 2012, 2014, 2020 Jane Doe"} {
+		c, ok := ParseCopyright(line)
+		if !ok {
+			t.Fatalf("expected statement in %q, got none", line)
+		}
+		stmts = append(stmts, c)
+	}
+	merged := MergeCopyrights(stmts)
+	want := "Copyright 2012, 2014-present Jane Doe"
+	if len(merged) != 1 || merged[0].String() != want {
+		t.Errorf("expected %q, got %v", want, merged)
+	}
+}
+
+func TestCanMergeCopyrightsByHolder(t *testing.T) {
+	merged := MergeCopyrights([]Copyright{
+		{Years: [][2]int{{2010, 2010}}, Holder: "Zed"},
+		{Years: [][2]int{{2012, 2014}}, Holder: "Alpha Inc."},
+		{Years: [][2]int{{2015, 2015}, {2018, 2018}}, Holder: "alpha inc."},
+		{Holder: "Zed"},
+	})
+	want := []string{"Copyright 2012-2015, 2018 Alpha Inc.", "Copyright 2010 Zed"}
+	if len(merged) != len(want) {
+		t.Fatalf("expected %d statements, got %d", len(want), len(merged))
+	}
+	for i := range want {
+		if merged[i].String() != want[i] {
+			t.Errorf("expected %q, got %q", want[i], merged[i].String())
+		}
+	}
+}
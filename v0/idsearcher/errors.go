@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"fmt"
+)
+
+// ErrorPolicy determines what BuildIDsDocument does when a File cannot be
+// searched, such as when it cannot be read.
+type ErrorPolicy int
+
+const (
+	// CollectErrors searches the remaining Files, and collects the errors
+	// as FileErrors, which are returned by BuildIDsDocumentWithErrors and
+	// BuildIDsDocumentFromFSWithErrors. The Files with errors keep
+	// whatever was found in them before the error. This is the default.
+	CollectErrors ErrorPolicy = iota
+
+	// FailOnError stops at the first error, and returns it as a *FileError
+	// without a Document.
+	FailOnError
+
+	// CallbackOnError calls Config.ErrorCallback with each error as the
+	// Files are searched, one at a time and in the order of the Files. If
+	// the callback returns nil, the search continues; otherwise no further
+	// Files are searched, and the callback's error is returned without a
+	// Document. With more than one worker, Files that other workers had
+	// already started on are finished, but their errors are not reported.
+	CallbackOnError
+)
+
+// FileError is an error from searching a single File.
+type FileError struct {
+	// FileName is the name of the File, as in its FileName field.
+	FileName string
+	// Err is the error encountered.
+	Err error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.FileName, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileErrors is the list of errors collected from searching the Files of
+// a Document under the CollectErrors policy.
+type FileErrors []*FileError
+
+func (errs FileErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", errs[0].Error(), len(errs)-1)
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// failingScanner is a FileScanner that fails for the named Files.
+type failingScanner struct {
+	fail map[string]bool
+}
+
+func (s *failingScanner) ScanFile(f *spdx.File2_1, r io.Reader) error {
+	if s.fail[f.FileName] {
+		return errors.New("scan failed")
+	}
+	return nil
+}
+
+func (s *failingScanner) FinishPackage(pkg *spdx.Package2_1) error {
+	return nil
+}
+
+// recordingScanner is a FileScanner that records the names of the Files it
+// scans, and fails for the named Files.
+type recordingScanner struct {
+	mu      sync.Mutex
+	fail    map[string]bool
+	scanned []string
+}
+
+func (s *recordingScanner) ScanFile(f *spdx.File2_1, r io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scanned = append(s.scanned, f.FileName)
+	if s.fail[f.FileName] {
+		return errors.New("scan failed")
+	}
+	return nil
+}
+
+func (s *recordingScanner) FinishPackage(pkg *spdx.Package2_1) error {
+	return nil
+}
+
+func testErrorPolicyConfig(policy ErrorPolicy) *Config {
+	return &Config{
+		NamespacePrefix: "https://example.com/",
+		Scanners:        []FileScanner{&failingScanner{fail: map[string]bool{"/a.go": true, "/c.go": true}}},
+		ErrorPolicy:     policy,
+	}
+}
+
+var testErrorPolicyFS = fstest.MapFS{
+	"a.go": {Data: []byte("// SPDX-License-Identifier: MIT\n")},
+	"b.go": {Data: []byte("// SPDX-License-Identifier: MIT\n")},
+	"c.go": {Data: []byte("// SPDX-License-Identifier: MIT\n")},
+}
+
+// ===== Error policy tests =====
+func TestSearcherReturnsNilErrorForCollectedErrors(t *testing.T) {
+	doc, err := BuildIDsDocumentFromFS("project", testErrorPolicyFS, testErrorPolicyConfig(CollectErrors))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if doc == nil {
+		t.Fatalf("expected non-nil Document, got nil")
+	}
+}
+
+func TestSearcherCollectsFileErrorsByDefault(t *testing.T) {
+	doc, fileErrs, err := BuildIDsDocumentFromFSWithErrors("project", testErrorPolicyFS, testErrorPolicyConfig(CollectErrors))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if doc == nil {
+		t.Fatalf("expected non-nil Document, got nil")
+	}
+	if len(fileErrs) != 2 || fileErrs[0].FileName != "/a.go" || fileErrs[1].FileName != "/c.go" {
+		t.Errorf("expected errors for /a.go and /c.go, got %v", fileErrs)
+	}
+	if fileErrs.Error() != "/a.go: scan failed (and 1 more errors)" {
+		t.Errorf("expected %v, got %v", "/a.go: scan failed (and 1 more errors)", fileErrs.Error())
+	}
+
+	// the Files with errors keep what was found in them
+	for _, f := range doc.Packages[0].Files {
+		if f.LicenseConcluded != "MIT" {
+			t.Errorf("expected %v for %s, got %v", "MIT", f.FileName, f.LicenseConcluded)
+		}
+	}
+}
+
+func TestSearcherCanFailOnFileError(t *testing.T) {
+	doc, err := BuildIDsDocumentFromFS("project", testErrorPolicyFS, testErrorPolicyConfig(FailOnError))
+	if doc != nil {
+		t.Errorf("expected nil Document, got %v", doc)
+	}
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("expected *FileError, got %v", err)
+	}
+	if fileErr.FileName != "/a.go" || fileErr.Err.Error() != "scan failed" {
+		t.Errorf("expected %v, got %v", "/a.go: scan failed", fileErr)
+	}
+}
+
+func TestSearcherCanCallBackOnFileError(t *testing.T) {
+	config := testErrorPolicyConfig(CallbackOnError)
+	seen := []string{}
+	config.ErrorCallback = func(err *FileError) error {
+		seen = append(seen, err.FileName)
+		return nil
+	}
+	doc, err := BuildIDsDocumentFromFS("project", testErrorPolicyFS, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if doc == nil {
+		t.Fatalf("expected non-nil Document, got nil")
+	}
+	if strings.Join(seen, " ") != "/a.go /c.go" {
+		t.Errorf("expected %v, got %v", "[/a.go /c.go]", seen)
+	}
+
+	stop := errors.New("stop")
+	config.ErrorCallback = func(err *FileError) error {
+		return stop
+	}
+	doc, err = BuildIDsDocumentFromFS("project", testErrorPolicyFS, config)
+	if err != stop {
+		t.Errorf("expected %v, got %v", stop, err)
+	}
+	if doc != nil {
+		t.Errorf("expected nil Document, got %v", doc)
+	}
+}
+
+func TestSearcherStopsSearchingWhenCallbackFails(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 40; i++ {
+		fsys[fmt.Sprintf("file%02d.c", i)] = &fstest.MapFile{Data: []byte("// SPDX-License-Identifier: MIT\n")}
+	}
+	stop := errors.New("stop")
+
+	for _, numWorkers := range []int{1, 4} {
+		sc := &recordingScanner{fail: map[string]bool{"/file05.c": true, "/file30.c": true}}
+		seen := []string{}
+		config := &Config{
+			NamespacePrefix: "https://example.com/",
+			NumWorkers:      numWorkers,
+			Scanners:        []FileScanner{sc},
+			ErrorPolicy:     CallbackOnError,
+			ErrorCallback: func(err *FileError) error {
+				seen = append(seen, err.FileName)
+				return stop
+			},
+		}
+
+		_, err := BuildIDsDocumentFromFS("project", fsys, config)
+		if err != stop {
+			t.Errorf("expected %v, got %v", stop, err)
+		}
+		if strings.Join(seen, " ") != "/file05.c" {
+			t.Errorf("expected %v, got %v", "[/file05.c]", seen)
+		}
+		// with one worker, nothing after the failing File is scanned;
+		// with more, only the Files already handed out to other workers
+		if numWorkers == 1 && len(sc.scanned) != 6 {
+			t.Errorf("expected %d, got %d: %v", 6, len(sc.scanned), sc.scanned)
+		}
+		if len(sc.scanned) > 6+2*numWorkers {
+			t.Errorf("with %d workers, expected at most %d, got %d: %v", numWorkers, 6+2*numWorkers, len(sc.scanned), sc.scanned)
+		}
+	}
+}
+
+// errReader returns its data, and then an error instead of io.EOF.
+type errReader struct {
+	r io.Reader
+}
+
+func (er *errReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("read failed")
+	}
+	return n, err
+}
+
+func TestSearchReaderIDsReturnsIDsFoundBeforeError(t *testing.T) {
+	r := &errReader{strings.NewReader("// SPDX-License-Identifier: MIT\nmore\n")}
+	ids, err := searchReaderIDs(r)
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+	if len(ids) != 1 || ids[0] != "MIT" {
+		t.Errorf("expected %v, got %v", []string{"MIT"}, ids)
+	}
+}
+
+func TestSearchReaderIDsContinuesPastLongLines(t *testing.T) {
+	text := "var x=\"" + strings.Repeat("a", 3*maxLineLength) + "\";\n// SPDX-License-Identifier: Apache-2.0\n" +
+		strings.Repeat("b", 2*maxLineLength) + "\n// SPDX-License-Identifier: MIT"
+	ids, err := searchReaderIDs(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if strings.Join(ids, " ") != "Apache-2.0 MIT" {
+		t.Errorf("expected %v, got %v", "[Apache-2.0 MIT]", ids)
+	}
+}
@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// LicenseList is a set of known SPDX license and exception identifiers,
+// used to validate license expressions and to normalize their case.
+type LicenseList struct {
+	// licenses and exceptions map lowercased identifiers to their
+	// canonical form
+	licenses   map[string]string
+	exceptions map[string]string
+}
+
+// NewLicenseList creates a LicenseList of the given identifiers.
+// Arguments:
+//   - licenseIDs: SPDX license identifiers, such as "Apache-2.0"
+//   - exceptionIDs: SPDX exception identifiers, such as "LLVM-exception"
+func NewLicenseList(licenseIDs []string, exceptionIDs []string) *LicenseList {
+	ll := &LicenseList{licenses: map[string]string{}, exceptions: map[string]string{}}
+	for _, id := range licenseIDs {
+		ll.licenses[strings.ToLower(id)] = id
+	}
+	for _, id := range exceptionIDs {
+		ll.exceptions[strings.ToLower(id)] = id
+	}
+	return ll
+}
+
+// DefaultLicenseList returns a LicenseList of the identifiers on the SPDX
+// License List and Exceptions List that are built into idsearcher. Use
+// LoadLicenseList to use a newer version of the lists.
+func DefaultLicenseList() *LicenseList {
+	return NewLicenseList(defaultLicenseIDs, defaultExceptionIDs)
+}
+
+// LoadLicenseList reads the licenses.json and exceptions.json files at the
+// top level of a file system, such as the "json" directory of the SPDX
+// license-list-data repository.
+func LoadLicenseList(fsys fs.FS) (*LicenseList, error) {
+	var licenses struct {
+		Licenses []struct {
+			LicenseID string `json:"licenseId"`
+		} `json:"licenses"`
+	}
+	var exceptions struct {
+		Exceptions []struct {
+			LicenseExceptionID string `json:"licenseExceptionId"`
+		} `json:"exceptions"`
+	}
+
+	data, err := fs.ReadFile(fsys, "licenses.json")
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &licenses); err != nil {
+		return nil, fmt.Errorf("invalid licenses.json: %v", err)
+	}
+	data, err = fs.ReadFile(fsys, "exceptions.json")
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &exceptions); err != nil {
+		return nil, fmt.Errorf("invalid exceptions.json: %v", err)
+	}
+
+	licenseIDs := []string{}
+	for _, l := range licenses.Licenses {
+		licenseIDs = append(licenseIDs, l.LicenseID)
+	}
+	exceptionIDs := []string{}
+	for _, e := range exceptions.Exceptions {
+		exceptionIDs = append(exceptionIDs, e.LicenseExceptionID)
+	}
+	return NewLicenseList(licenseIDs, exceptionIDs), nil
+}
+
+// ExpressionError is a problem found in a license expression: either it is
+// not a valid SPDX license expression, or it uses an identifier that is
+// not on the LicenseList.
+type ExpressionError struct {
+	// Expression is the license expression, as found.
+	Expression string
+	// Message describes the problem.
+	Message string
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("license expression %q: %s", e.Expression, e.Message)
+}
+
+// LicenseExpression is a parsed SPDX license expression.
+type LicenseExpression struct {
+	root *exprNode
+	// unknown lists the identifiers that are not on the LicenseList
+	unknown []string
+}
+
+// exprNode is a node of a parsed license expression: either a license,
+// or an operator with its operands.
+type exprNode struct {
+	// op is "AND", "OR" or "WITH", or empty for a license
+	op          string
+	left, right *exprNode
+	// id is the license identifier, or for "WITH", the exception
+	id string
+	// plus is true for a license followed by "+"
+	plus bool
+	// parens is true if the node was written within parentheses
+	parens bool
+}
+
+// ParseLicenseExpression parses an SPDX license expression. Operators are
+// recognized in any case, and known identifiers are normalized to the case
+// used by the LicenseList. It returns an *ExpressionError if expr is not a
+// valid expression. Identifiers that are valid but unknown are allowed, and
+// listed by Unknown. Arguments:
+//   - expr: the license expression
+//   - list: the known licenses and exceptions
+func ParseLicenseExpression(expr string, list *LicenseList) (*LicenseExpression, error) {
+	p := &exprParser{expr: expr, toks: tokenizeExpression(expr), list: list}
+	if len(p.toks) == 0 {
+		return nil, &ExpressionError{Expression: expr, Message: "empty expression"}
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, p.errorf("unexpected %q", p.toks[p.pos])
+	}
+	return &LicenseExpression{root: root, unknown: p.unknown}, nil
+}
+
+// String returns the normalized expression, keeping any parentheses that
+// were written in it.
+func (e *LicenseExpression) String() string {
+	return e.root.String()
+}
+
+func (n *exprNode) String() string {
+	var s string
+	switch n.op {
+	case "":
+		s = n.id
+		if n.plus {
+			s += "+"
+		}
+	case "WITH":
+		s = n.left.String() + " WITH " + n.id
+	default:
+		s = n.left.String() + " " + n.op + " " + n.right.String()
+	}
+	if n.parens {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// Licenses returns the licenses and exceptions used in the expression,
+// sorted and without duplicates. A "+" after a license is not included.
+func (e *LicenseExpression) Licenses() []string {
+	seen := map[string]bool{}
+	var walk func(n *exprNode)
+	walk = func(n *exprNode) {
+		if n == nil {
+			return
+		}
+		if n.op == "" || n.op == "WITH" {
+			if n.id != "" {
+				seen[n.id] = true
+			}
+		}
+		walk(n.left)
+		walk(n.right)
+	}
+	walk(e.root)
+
+	lics := []string{}
+	for lic := range seen {
+		lics = append(lics, lic)
+	}
+	sort.Strings(lics)
+	return lics
+}
+
+// Unknown returns the license and exception identifiers in the expression
+// that are not on the LicenseList, not counting LicenseRef- and
+// DocumentRef- identifiers.
+func (e *LicenseExpression) Unknown() []string {
+	return e.unknown
+}
+
+// LicenseRefs returns the LicenseRef- identifiers in the expression that
+// refer to licenses in the same document, sorted and without duplicates.
+func (e *LicenseExpression) LicenseRefs() []string {
+	refs := []string{}
+	for _, lic := range e.Licenses() {
+		if strings.HasPrefix(lic, "LicenseRef-") {
+			refs = append(refs, lic)
+		}
+	}
+	return refs
+}
+
+// tokenizeExpression splits a license expression into parentheses and
+// words.
+func tokenizeExpression(expr string) []string {
+	toks := []string{}
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			toks = append(toks, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range expr {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			toks = append(toks, string(r))
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return toks
+}
+
+// exprParser holds the state of a ParseLicenseExpression call.
+type exprParser struct {
+	expr    string
+	toks    []string
+	pos     int
+	list    *LicenseList
+	unknown []string
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return &ExpressionError{Expression: p.expr, Message: fmt.Sprintf(format, args...)}
+}
+
+// peekOp returns the operator at the current position, if there is one.
+func (p *exprParser) peekOp() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	switch op := strings.ToUpper(p.toks[p.pos]); op {
+	case "AND", "OR", "WITH":
+		return op
+	}
+	return ""
+}
+
+// parseOr parses operands joined by OR, which binds least tightly.
+func (p *exprParser) parseOr() (*exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp() == "OR" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses operands joined by AND.
+func (p *exprParser) parseAnd() (*exprNode, error) {
+	left, err := p.parseWith()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp() == "AND" {
+		p.pos++
+		right, err := p.parseWith()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseWith parses a license, optionally followed by WITH and an
+// exception, or a parenthesized expression.
+func (p *exprParser) parseWith() (*exprNode, error) {
+	if p.pos >= len(p.toks) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	if p.toks[p.pos] == "(" {
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos] != ")" {
+			return nil, p.errorf("missing \")\"")
+		}
+		p.pos++
+		n.parens = true
+		return n, nil
+	}
+
+	lic, err := p.parseLicense()
+	if err != nil {
+		return nil, err
+	}
+	if p.peekOp() != "WITH" {
+		return lic, nil
+	}
+	p.pos++
+	if p.pos >= len(p.toks) || p.peekOp() != "" || p.toks[p.pos] == "(" || p.toks[p.pos] == ")" {
+		return nil, p.errorf("missing exception after WITH")
+	}
+	exc := p.toks[p.pos]
+	p.pos++
+	if !isIDString(exc) {
+		return nil, p.errorf("invalid exception identifier %q", exc)
+	}
+	if canonical, ok := p.list.exceptions[strings.ToLower(exc)]; ok {
+		exc = canonical
+	} else {
+		p.unknown = append(p.unknown, exc)
+	}
+	return &exprNode{op: "WITH", left: lic, id: exc}, nil
+}
+
+// parseLicense parses a license identifier, optionally followed by "+",
+// or a LicenseRef- or DocumentRef- identifier.
+func (p *exprParser) parseLicense() (*exprNode, error) {
+	tok := p.toks[p.pos]
+	if tok == ")" || p.peekOp() != "" {
+		return nil, p.errorf("unexpected %q", tok)
+	}
+	p.pos++
+
+	lower := strings.ToLower(tok)
+	switch {
+	case strings.HasPrefix(lower, "licenseref-"):
+		ref := tok[len("LicenseRef-"):]
+		if !isIDString(ref) {
+			return nil, p.errorf("invalid identifier %q", tok)
+		}
+		return &exprNode{id: "LicenseRef-" + ref}, nil
+	case strings.HasPrefix(lower, "documentref-"):
+		parts := strings.SplitN(tok[len("DocumentRef-"):], ":", 2)
+		if len(parts) != 2 || !isIDString(parts[0]) || !strings.HasPrefix(strings.ToLower(parts[1]), "licenseref-") || !isIDString(parts[1][len("LicenseRef-"):]) {
+			return nil, p.errorf("invalid identifier %q", tok)
+		}
+		return &exprNode{id: "DocumentRef-" + parts[0] + ":LicenseRef-" + parts[1][len("LicenseRef-"):]}, nil
+	}
+
+	n := &exprNode{id: tok}
+	if strings.HasSuffix(tok, "+") {
+		n.id, n.plus = strings.TrimSuffix(tok, "+"), true
+	}
+	if !isIDString(n.id) {
+		return nil, p.errorf("invalid license identifier %q", tok)
+	}
+	if canonical, ok := p.list.licenses[strings.ToLower(n.id)]; ok {
+		n.id = canonical
+	} else {
+		p.unknown = append(p.unknown, n.id)
+	}
+	return n, nil
+}
+
+// isIDString reports whether s is a valid SPDX idstring: one or more
+// letters, digits, "." or "-".
+func isIDString(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
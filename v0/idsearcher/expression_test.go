@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ===== License expression tests =====
+func TestCanParseAndNormalizeLicenseExpressions(t *testing.T) {
+	tests := []struct {
+		expr     string
+		want     string
+		licenses string
+	}{
+		{"MIT", "MIT", "MIT"},
+		{"apache-2.0 or gpl-2.0-or-later", "Apache-2.0 OR GPL-2.0-or-later", "Apache-2.0 GPL-2.0-or-later"},
+		{"(mit and bsd-3-clause) Or isc", "(MIT AND BSD-3-Clause) OR ISC", "BSD-3-Clause ISC MIT"},
+		{"epl-1.0+", "EPL-1.0+", "EPL-1.0"},
+		{"GPL-2.0-only with classpath-exception-2.0", "GPL-2.0-only WITH Classpath-exception-2.0", "Classpath-exception-2.0 GPL-2.0-only"},
+		{"licenseref-My-License AND documentref-other:licenseref-x", "LicenseRef-My-License AND DocumentRef-other:LicenseRef-x", "DocumentRef-other:LicenseRef-x LicenseRef-My-License"},
+		// redundant nested parentheses are collapsed
+		{"((MIT))", "(MIT)", "MIT"},
+		{"MIT OR Apache-2.0 AND ISC", "MIT OR Apache-2.0 AND ISC", "Apache-2.0 ISC MIT"},
+	}
+	list := DefaultLicenseList()
+	for _, tt := range tests {
+		e, err := ParseLicenseExpression(tt.expr, list)
+		if err != nil {
+			t.Errorf("expected nil error for %q, got %v", tt.expr, err)
+			continue
+		}
+		if e.String() != tt.want {
+			t.Errorf("expected %v, got %v", tt.want, e.String())
+		}
+		if strings.Join(e.Licenses(), " ") != tt.licenses {
+			t.Errorf("expected %v, got %v", tt.licenses, e.Licenses())
+		}
+		if len(e.Unknown()) != 0 {
+			t.Errorf("expected no unknown identifiers in %q, got %v", tt.expr, e.Unknown())
+		}
+	}
+}
+
+func TestLicenseExpressionPrecedence(t *testing.T) {
+	e, err := ParseLicenseExpression("MIT OR Apache-2.0 AND GPL-2.0-only WITH Classpath-exception-2.0", DefaultLicenseList())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	root := e.root
+	if root.op != "OR" || root.right.op != "AND" || root.right.right.op != "WITH" {
+		t.Errorf("expected OR of AND of WITH, got %v / %v", root.op, root.right.op)
+	}
+}
+
+func TestLicenseExpressionListsUnknownIDs(t *testing.T) {
+	e, err := ParseLicenseExpression("MIT OR Foo-1.0 WITH Bar-exception OR LicenseRef-x", DefaultLicenseList())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if strings.Join(e.Unknown(), " ") != "Foo-1.0 Bar-exception" {
+		t.Errorf("expected %v, got %v", "[Foo-1.0 Bar-exception]", e.Unknown())
+	}
+	if strings.Join(e.LicenseRefs(), " ") != "LicenseRef-x" {
+		t.Errorf("expected %v, got %v", "[LicenseRef-x]", e.LicenseRefs())
+	}
+}
+
+func TestLicenseExpressionParseFailsWithInvalidExpressions(t *testing.T) {
+	exprs := []string{
+		"",
+		"MIT AND",
+		"AND MIT",
+		"MIT Apache-2.0",
+		"(MIT OR ISC",
+		"MIT OR ISC)",
+		"()",
+		"MIT WITH",
+		"MIT WITH (ISC)",
+		"MIT_License",
+		"LicenseRef-",
+		"DocumentRef-x",
+		"DocumentRef-x:MIT",
+		"LicenseRef-a+b",
+	}
+	for _, expr := range exprs {
+		_, err := ParseLicenseExpression(expr, DefaultLicenseList())
+		var exprErr *ExpressionError
+		if !errors.As(err, &exprErr) {
+			t.Errorf("expected *ExpressionError for %q, got %v", expr, err)
+		}
+	}
+}
+
+func TestCanLoadLicenseList(t *testing.T) {
+	fsys := fstest.MapFS{
+		"licenses.json":   {Data: []byte(`{"licenseListVersion": "3.x", "licenses": [{"licenseId": "MIT"}, {"licenseId": "New-License-1.0"}]}`)},
+		"exceptions.json": {Data: []byte(`{"exceptions": [{"licenseExceptionId": "New-exception"}]}`)},
+	}
+	list, err := LoadLicenseList(fsys)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	e, err := ParseLicenseExpression("new-license-1.0 with NEW-EXCEPTION or apache-2.0", list)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if e.String() != "New-License-1.0 WITH New-exception OR apache-2.0" {
+		t.Errorf("expected %v, got %v", "New-License-1.0 WITH New-exception OR apache-2.0", e.String())
+	}
+	if strings.Join(e.Unknown(), " ") != "apache-2.0" {
+		t.Errorf("expected %v, got %v", "[apache-2.0]", e.Unknown())
+	}
+
+	delete(fsys, "exceptions.json")
+	if _, err := LoadLicenseList(fsys); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestSearcherValidatesAndNormalizesIDs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"LICENSES/LicenseRef-Custom.txt": {Data: []byte("Custom license text\n")},
+		"a.go":                           {Data: []byte("// SPDX-License-Identifier: mit OR apache-2.0\n// SPDX-License-Identifier: MIT or Apache-2.0\n")},
+		"b.go":                           {Data: []byte("// SPDX-License-Identifier: MIT AND\n// SPDX-License-Identifier: ISC\n")},
+		"c.go":                           {Data: []byte("// SPDX-License-Identifier: Made-Up-1.0 OR LicenseRef-Custom\n")},
+		"d.go":                           {Data: []byte("// SPDX-License-Identifier: LicenseRef-Other AND DocumentRef-ext:LicenseRef-y\n")},
+	}
+	config := &Config{NamespacePrefix: "https://example.com/", ReportUnknownLicenses: true}
+	doc, fileErrs, err := BuildIDsDocumentFromFSWithErrors("project", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(fileErrs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", fileErrs)
+	}
+	if fileErrs[0].FileName != "/b.go" || fileErrs[1].FileName != "/c.go" {
+		t.Errorf("expected errors for /b.go and /c.go, got %v", fileErrs)
+	}
+	var exprErr *ExpressionError
+	if !errors.As(fileErrs[1], &exprErr) || exprErr.Message != `unknown identifier "Made-Up-1.0"` {
+		t.Errorf("expected unknown identifier error, got %v", fileErrs[1])
+	}
+
+	pkg := doc.Packages[0]
+	want := []struct {
+		concluded string
+		licenses  string
+	}{
+		{"MIT OR Apache-2.0", "Apache-2.0 MIT"},
+		// the invalid expression is not recorded
+		{"ISC", "ISC"},
+		{"Made-Up-1.0 OR LicenseRef-Custom", "LicenseRef-Custom Made-Up-1.0"},
+		{"LicenseRef-Other AND DocumentRef-ext:LicenseRef-y", "DocumentRef-ext:LicenseRef-y LicenseRef-Other"},
+	}
+	for i, f := range pkg.Files[1:] {
+		if f.LicenseConcluded != want[i].concluded {
+			t.Errorf("expected %v for %s, got %v", want[i].concluded, f.FileName, f.LicenseConcluded)
+		}
+		if strings.Join(f.LicenseInfoInFile, " ") != want[i].licenses {
+			t.Errorf("expected %v for %s, got %v", want[i].licenses, f.FileName, f.LicenseInfoInFile)
+		}
+	}
+
+	// each LicenseRef- in the same document gets an Other License stub
+	if len(doc.OtherLicenses) != 2 {
+		t.Fatalf("expected 2 OtherLicenses, got %d", len(doc.OtherLicenses))
+	}
+	custom, other := doc.OtherLicenses[0], doc.OtherLicenses[1]
+	if custom.LicenseIdentifier != "LicenseRef-Custom" || custom.ExtractedText != "Custom license text\n" {
+		t.Errorf("expected LicenseRef-Custom with text from LICENSES, got %v", custom)
+	}
+	if other.LicenseIdentifier != "LicenseRef-Other" || other.ExtractedText != "NOASSERTION" || other.LicenseName != "NOASSERTION" {
+		t.Errorf("expected LicenseRef-Other stub, got %v", other)
+	}
+}
+
+func TestSearcherDoesNotReportUnknownIDsByDefault(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": {Data: []byte("// SPDX-License-Identifier: Unicode-3.0\n")},
+	}
+	config := &Config{NamespacePrefix: "https://example.com/"}
+	doc, fileErrs, err := BuildIDsDocumentFromFSWithErrors("project", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(fileErrs) != 0 {
+		t.Errorf("expected no errors, got %v", fileErrs)
+	}
+	if f := doc.Packages[0].Files[0]; f.LicenseConcluded != "Unicode-3.0" {
+		t.Errorf("expected %v, got %v", "Unicode-3.0", f.LicenseConcluded)
+	}
+}
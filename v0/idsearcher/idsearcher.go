@@ -7,13 +7,17 @@ package idsearcher
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/spdx/tools-golang/v0/builder"
+	"github.com/spdx/tools-golang/v0/builder/builder2v1"
 	"github.com/spdx/tools-golang/v0/spdx"
 	"github.com/spdx/tools-golang/v0/utils"
 )
@@ -35,92 +39,197 @@ type Config struct {
 	// file / directory, regardless of where it is in the file tree.
 	BuilderPathsIgnored []string
 
+	// BuilderIgnoreFileNames lists the names of gitignore-format files,
+	// such as ".gitignore" or ".spdxignore", whose patterns will also be
+	// omitted from the built document. See builder.Config2_1.
+	BuilderIgnoreFileNames []string
+
 	// SearcherPathsIgnored lists certain paths that should not be searched
 	// by idsearcher, even if those paths have Files present. It uses the
 	// same format as BuilderPathsIgnored.
 	SearcherPathsIgnored []string
+
+	// REUSE, if true, works out each File's licenses and copyright text
+	// following the REUSE specification: the information in a ".license"
+	// sidecar file replaces that in the file itself, and the stanzas of
+	// .reuse/dep5 and the annotations of REUSE.toml files apply to the
+	// paths they match. The Package's copyright text is aggregated from
+	// its Files. Use LintREUSE to check the built Document for problems.
+	REUSE bool
+
+	// Scanners lists additional steps that are run on the contents of each
+	// searched File after its short-form IDs are found, such as a
+	// CopyrightScanner. Each scanner's FinishPackage is called once all of
+	// the Package's Files have been scanned.
+	Scanners []FileScanner
+
+	// LicenseList is used to normalize the case of the identifiers in the
+	// license expressions found in the Files. Invalid expressions, which
+	// are not recorded, are reported as *ExpressionError errors following
+	// ErrorPolicy. If nil, DefaultLicenseList is used.
+	LicenseList *LicenseList
+
+	// ReportUnknownLicenses, if true, also reports each identifier that is
+	// not on LicenseList as an *ExpressionError. The expression is still
+	// recorded. Since the built-in list can lag behind the SPDX License
+	// List, this is best used together with LoadLicenseList.
+	ReportUnknownLicenses bool
+
+	// NumWorkers sets how many files are hashed by builder, and searched,
+	// concurrently. Values of 0 or 1 handle the files one at a time. The
+	// resulting Document and errors are the same either way, but with more
+	// than one worker, each of the Scanners may be called concurrently for
+	// different Files.
+	NumWorkers int
+
+	// ErrorPolicy determines what happens when a File cannot be searched:
+	// the errors are collected (the default), the search fails, or
+	// ErrorCallback is called.
+	ErrorPolicy ErrorPolicy
+
+	// ErrorCallback is called with each error under the CallbackOnError
+	// policy. Returning a non-nil error stops the search.
+	ErrorCallback func(err *FileError) error
+}
+
+// FileScanner is a step that examines the contents of each File searched
+// by idsearcher and fills in further details of the File and its Package.
+type FileScanner interface {
+	// ScanFile reads a File's contents from r and fills in fields of f.
+	ScanFile(f *spdx.File2_1, r io.Reader) error
+	// FinishPackage fills in fields of pkg from its scanned Files.
+	FinishPackage(pkg *spdx.Package2_1) error
 }
 
 // BuildIDsDocument creates an SPDX Document (version 2.1) and searches for
 // short-form IDs in each file, filling in license fields as appropriate. It
-// returns that document or error if any is encountered. Arguments:
+// returns that document or error if any is encountered. Under the default
+// CollectErrors policy, errors from searching individual files do not stop
+// the search, and are not returned; use BuildIDsDocumentWithErrors to get
+// them. Arguments:
 //   - packageName: name of package / directory
 //   - dirRoot: path to directory to be analyzed
 //   - namespacePrefix: URI representing a prefix for the
 //     namespace with which the SPDX Document will be associated
 func BuildIDsDocument(packageName string, dirRoot string, idconfig *Config) (*spdx.Document2_1, error) {
+	doc, _, err := BuildIDsDocumentWithErrors(packageName, dirRoot, idconfig)
+	return doc, err
+}
+
+// BuildIDsDocumentWithErrors creates an SPDX Document in the same manner as
+// BuildIDsDocument, and also returns the errors from searching individual
+// files that were collected under the CollectErrors policy. Arguments:
+//   - packageName: name of package / directory
+//   - dirRoot: path to directory to be analyzed
+//   - idconfig: Config object
+func BuildIDsDocumentWithErrors(packageName string, dirRoot string, idconfig *Config) (*spdx.Document2_1, FileErrors, error) {
+	return BuildIDsDocumentFromFSWithErrors(packageName, utils.DirFS(dirRoot), idconfig)
+}
+
+// BuildIDsDocumentFromFS creates an SPDX Document (version 2.1) for the
+// files in a file system, and searches for short-form IDs in each file, in
+// the same manner as BuildIDsDocument. Arguments:
+//   - packageName: name of package
+//   - fsys: file system to be analyzed
+//   - idconfig: Config object
+func BuildIDsDocumentFromFS(packageName string, fsys fs.FS, idconfig *Config) (*spdx.Document2_1, error) {
+	doc, _, err := BuildIDsDocumentFromFSWithErrors(packageName, fsys, idconfig)
+	return doc, err
+}
+
+// BuildIDsDocumentFromFSWithErrors creates an SPDX Document for the files in
+// a file system in the same manner as BuildIDsDocumentFromFS, and also
+// returns the errors from searching individual files that were collected
+// under the CollectErrors policy. Arguments:
+//   - packageName: name of package
+//   - fsys: file system to be analyzed
+//   - idconfig: Config object
+func BuildIDsDocumentFromFSWithErrors(packageName string, fsys fs.FS, idconfig *Config) (*spdx.Document2_1, FileErrors, error) {
 	// first, build the Document using builder
 	bconfig := &builder.Config2_1{
 		NamespacePrefix: idconfig.NamespacePrefix,
 		CreatorType:     "Tool",
 		Creator:         "github.com/spdx/tools-golang/v0/idsearcher",
 		PathsIgnored:    idconfig.BuilderPathsIgnored,
+		IgnoreFileNames: idconfig.BuilderIgnoreFileNames,
+		NumWorkers:      idconfig.NumWorkers,
 	}
-	doc, err := builder.Build2_1(packageName, dirRoot, bconfig)
+	doc, err := builder.BuildFromFS2_1(packageName, fsys, bconfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if doc == nil {
-		return nil, fmt.Errorf("builder returned nil Document")
+		return nil, nil, fmt.Errorf("builder returned nil Document")
 	}
 	if doc.Packages == nil {
-		return nil, fmt.Errorf("builder returned nil Package")
+		return nil, nil, fmt.Errorf("builder returned nil Package")
 	}
 	if len(doc.Packages) != 1 {
-		return nil, fmt.Errorf("builder returned %d Packages", len(doc.Packages))
+		return nil, nil, fmt.Errorf("builder returned %d Packages", len(doc.Packages))
 	}
 
 	// now, walk through each file and find its licenses (if any)
 	pkg := doc.Packages[0]
 	if pkg.Files == nil {
-		return nil, fmt.Errorf("builder returned nil Files in Package")
+		return nil, nil, fmt.Errorf("builder returned nil Files in Package")
 	}
-	licsForPackage := map[string]int{}
-	for _, f := range pkg.Files {
-		// start by initializing / clearing values
-		f.LicenseInfoInFile = []string{"NOASSERTION"}
-		f.LicenseConcluded = "NOASSERTION"
-
-		// check whether the searcher should ignore this file
-		if utils.ShouldIgnore(f.FileName, idconfig.SearcherPathsIgnored) {
-			continue
+	licenseList := idconfig.LicenseList
+	if licenseList == nil {
+		licenseList = DefaultLicenseList()
+	}
+	s := &fileSearcher{fsys: fsys, config: idconfig, licenseList: licenseList}
+	if idconfig.REUSE {
+		if s.reuse, err = loadREUSEInfo(fsys, pkg.Files); err != nil {
+			return nil, nil, err
 		}
-
-		fPath := filepath.Join(dirRoot, f.FileName)
-		// FIXME this is not preferable -- ignoring error
-		ids, _ := searchFileIDs(fPath)
-		// FIXME for now, proceed onwards with whatever IDs we obtained.
-		// FIXME instead of ignoring the error, should probably either log it,
-		// FIXME and/or enable the caller to configure what should happen.
-
-		// separate out for this file's licenses
-		licsForFile := map[string]int{}
-		licsParens := []string{}
-		for _, lid := range ids {
-			// get individual elements and add for file and package
-			licElements := getIndividualLicenses(lid)
-			for _, elt := range licElements {
-				licsForFile[elt] = 1
-				licsForPackage[elt] = 1
+	}
+	// stop searching at the first error under FailOnError, or when the
+	// callback returns an error under CallbackOnError
+	var callbackErr error
+	results := s.searchAll(pkg.Files, idconfig.NumWorkers, func(i int, r *fileResult) bool {
+		switch idconfig.ErrorPolicy {
+		case FailOnError:
+			return len(r.errs) > 0
+		case CallbackOnError:
+			if idconfig.ErrorCallback == nil {
+				return false
+			}
+			for _, err := range r.errs {
+				callbackErr = idconfig.ErrorCallback(&FileError{FileName: pkg.Files[i].FileName, Err: err})
+				if callbackErr != nil {
+					return true
+				}
 			}
-			// parenthesize if needed and add to slice for joining
-			licsParens = append(licsParens, makeElement(lid))
 		}
+		return false
+	})
+	if callbackErr != nil {
+		return nil, nil, callbackErr
+	}
 
-		// OK -- now we can fill in the file's details, or NOASSERTION if none
-		if len(licsForFile) > 0 {
-			f.LicenseInfoInFile = []string{}
-			for lic := range licsForFile {
-				f.LicenseInfoInFile = append(f.LicenseInfoInFile, lic)
-			}
-			sort.Strings(f.LicenseInfoInFile)
-			// avoid adding parens and joining for single-ID items
-			if len(licsParens) == 1 {
-				f.LicenseConcluded = ids[0]
-			} else {
-				f.LicenseConcluded = strings.Join(licsParens, " AND ")
+	// go through the results in the order of the files, so that errors
+	// are handled the same way no matter how many workers were used
+	var fileErrs FileErrors
+	licsForPackage := map[string]int{}
+	licenseRefs := map[string]bool{}
+	for i, f := range pkg.Files {
+		for _, err := range results[i].errs {
+			fileErr := &FileError{FileName: f.FileName, Err: err}
+			switch idconfig.ErrorPolicy {
+			case FailOnError:
+				return nil, nil, fileErr
+			case CallbackOnError:
+				// already passed to the callback by searchAll
+			default:
+				fileErrs = append(fileErrs, fileErr)
 			}
 		}
+		for _, lic := range results[i].licenses {
+			licsForPackage[lic] = 1
+		}
+		for _, ref := range results[i].licenseRefs {
+			licenseRefs[ref] = true
+		}
 	}
 
 	// and finally, we can fill in the package's details
@@ -133,33 +242,266 @@ func BuildIDsDocument(packageName string, dirRoot string, idconfig *Config) (*sp
 		}
 		sort.Strings(pkg.PackageLicenseInfoFromFiles)
 	}
+	if s.reuse != nil {
+		if err := (&CopyrightScanner{}).FinishPackage(pkg); err != nil {
+			return nil, nil, err
+		}
+	}
+	addOtherLicenseStubs(fsys, doc, licenseRefs)
+
+	for _, sc := range idconfig.Scanners {
+		if err := sc.FinishPackage(pkg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return doc, fileErrs, nil
+}
+
+// fileSearcher holds the settings shared by the searches of all of the
+// Files in a Package.
+type fileSearcher struct {
+	fsys        fs.FS
+	config      *Config
+	licenseList *LicenseList
+	// reuse is non-nil if REUSE information is applied
+	reuse *reuseInfo
+}
 
-	return doc, nil
+// fileResult is the outcome of searching a single File.
+type fileResult struct {
+	// errs are the errors encountered, in the order they occurred
+	errs []error
+	// licenses are the individual licenses found in the File
+	licenses []string
+	// licenseRefs are the LicenseRef- identifiers found in the File
+	licenseRefs []string
+}
+
+// searchAll searches each of files, returning the results in the same
+// order as files. Up to numWorkers files are searched concurrently; values
+// of 0 or 1 search them one at a time. stop is called with each result as
+// soon as it and the results of all earlier files are ready, one at a time
+// and in the order of files. Once stop returns true, it is not called
+// again, and no further files are searched; their results are left nil,
+// other than those of files that other workers had already started on.
+func (s *fileSearcher) searchAll(files []*spdx.File2_1, numWorkers int, stop func(i int, r *fileResult) bool) []*fileResult {
+	results := make([]*fileResult, len(files))
+
+	if numWorkers <= 1 {
+		for i, f := range files {
+			results[i] = s.searchFile(f)
+			if stop(i, results[i]) {
+				break
+			}
+		}
+		return results
+	}
+
+	// results, next and stopped are guarded by mu; whichever worker fills
+	// in the result at next passes it, and any following results that
+	// are ready, to stop
+	jobs := make(chan int)
+	var mu sync.Mutex
+	next := 0
+	stopped := false
+	var failed int32
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := s.searchFile(files[i])
+				mu.Lock()
+				results[i] = r
+				for !stopped && next < len(files) && results[next] != nil {
+					if stop(next, results[next]) {
+						stopped = true
+						atomic.StoreInt32(&failed, 1)
+					}
+					next++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// stop handing out new files once stop has returned true; all files
+	// before the one it returned true for have still been searched
+	for i := range files {
+		if atomic.LoadInt32(&failed) != 0 {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// searchFile finds the licenses of a single File and fills in its license
+// fields, then runs the configured scanners on it.
+func (s *fileSearcher) searchFile(f *spdx.File2_1) *fileResult {
+	r := &fileResult{}
+
+	// start by initializing / clearing values
+	f.LicenseInfoInFile = []string{"NOASSERTION"}
+	f.LicenseConcluded = "NOASSERTION"
+
+	// check whether the searcher should ignore this file
+	if utils.ShouldIgnore(f.FileName, s.config.SearcherPathsIgnored) {
+		return r
+	}
+
+	// binary files have no license headers to search; on error, proceed
+	// onwards with whatever IDs we obtained
+	var ids []string
+	if !isBinaryFile(f) {
+		var err error
+		if ids, err = searchFSFileIDs(s.fsys, f.FileName); err != nil {
+			r.errs = append(r.errs, err)
+		}
+	}
+	if s.reuse != nil {
+		var err error
+		if ids, err = s.reuse.apply(s.fsys, f, ids); err != nil {
+			r.errs = append(r.errs, err)
+		}
+	}
+
+	// parse and normalize each expression, and separate out for this
+	// file's licenses
+	licsForFile := map[string]int{}
+	licsParens := []string{}
+	exprs := []string{}
+	seenExprs := map[string]bool{}
+	for _, lid := range ids {
+		expr, err := ParseLicenseExpression(lid, s.licenseList)
+		if err != nil {
+			r.errs = append(r.errs, err)
+			continue
+		}
+		if s.config.ReportUnknownLicenses {
+			for _, unknown := range expr.Unknown() {
+				r.errs = append(r.errs, &ExpressionError{Expression: lid, Message: fmt.Sprintf("unknown identifier %q", unknown)})
+			}
+		}
+		r.licenseRefs = append(r.licenseRefs, expr.LicenseRefs()...)
+
+		normalized := expr.String()
+		if seenExprs[normalized] {
+			continue
+		}
+		seenExprs[normalized] = true
+		exprs = append(exprs, normalized)
+
+		// get individual elements for file and package
+		for _, elt := range expr.Licenses() {
+			licsForFile[elt] = 1
+		}
+		// parenthesize if needed and add to slice for joining
+		licsParens = append(licsParens, makeElement(normalized))
+	}
+
+	// OK -- now we can fill in the file's details, or NOASSERTION if none
+	if len(licsForFile) > 0 {
+		f.LicenseInfoInFile = []string{}
+		for lic := range licsForFile {
+			f.LicenseInfoInFile = append(f.LicenseInfoInFile, lic)
+		}
+		sort.Strings(f.LicenseInfoInFile)
+		r.licenses = f.LicenseInfoInFile
+		// avoid adding parens and joining for single-ID items
+		if len(licsParens) == 1 {
+			f.LicenseConcluded = exprs[0]
+		} else {
+			f.LicenseConcluded = strings.Join(licsParens, " AND ")
+		}
+	}
+
+	for _, sc := range s.config.Scanners {
+		if err := scanFSFile(s.fsys, f, sc); err != nil {
+			r.errs = append(r.errs, err)
+		}
+	}
+	return r
+}
+
+// addOtherLicenseStubs adds an Other License section to the Document for
+// each LicenseRef- identifier that does not have one yet. The license text
+// is read from the LICENSES directory, as used by REUSE, if it is there.
+func addOtherLicenseStubs(fsys fs.FS, doc *spdx.Document2_1, licenseRefs map[string]bool) {
+	for _, ol := range doc.OtherLicenses {
+		delete(licenseRefs, ol.LicenseIdentifier)
+	}
+	refs := []string{}
+	for ref := range licenseRefs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		ol := &spdx.OtherLicense2_1{
+			LicenseIdentifier: ref,
+			ExtractedText:     "NOASSERTION",
+			LicenseName:       "NOASSERTION",
+			LicenseComment:    "Identifier found in the package's files; the license text was not found.",
+		}
+		if text, err := fs.ReadFile(fsys, "LICENSES/"+ref+".txt"); err == nil {
+			ol.ExtractedText = string(text)
+			ol.LicenseComment = fmt.Sprintf("Identifier found in the package's files; text from LICENSES/%s.txt.", ref)
+		}
+		doc.OtherLicenses = append(doc.OtherLicenses, ol)
+	}
 }
 
 // ===== Utility functions =====
 func searchFileIDs(filePath string) ([]string, error) {
-	idsMap := map[string]int{}
-	ids := []string{}
-
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
+	return searchReaderIDs(f)
+}
 
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), "SPDX-License-Identifier:") {
-			strs := strings.SplitN(scanner.Text(), "SPDX-License-Identifier:", 2)
+func searchFSFileIDs(fsys fs.FS, filePath string) ([]string, error) {
+	f, err := fsys.Open(strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return searchReaderIDs(f)
+}
+
+func scanFSFile(fsys fs.FS, f *spdx.File2_1, sc FileScanner) error {
+	r, err := fsys.Open(strings.TrimPrefix(f.FileName, "/"))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return sc.ScanFile(f, r)
+}
+
+func searchReaderIDs(r io.Reader) ([]string, error) {
+	idsMap := map[string]int{}
+	ids := []string{}
+
+	err := readLines(r, func(line string) bool {
+		if strings.Contains(line, "SPDX-License-Identifier:") {
+			strs := strings.SplitN(line, "SPDX-License-Identifier:", 2)
 
 			// if prefixed by more than n characters, it's probably not a
 			// short-form ID; it's probably code to detect short-form IDs.
 			// Like this function itself, for example  =)
 			prefix := stripTrash(strs[0])
 			if len(prefix) > 5 {
-				continue
+				return true
 			}
 
 			// stop before trailing */ if it is present
@@ -169,16 +511,11 @@ func searchFileIDs(filePath string) ([]string, error) {
 			lid = stripTrash(lid)
 			idsMap[lid] = 1
 		}
-	}
-
-	// FIXME for now, ignore scanner errors because we want to return whatever
-	// FIXME IDs were in fact found. should probably be changed to either
-	// FIXME log the error, and/or be configurable for what should happen.
-	// if err = scanner.Err(); err != nil {
-	// 	return nil, err
-	// }
+		return true
+	})
 
-	// now, convert map to string
+	// now, convert map to string, keeping whatever IDs were found before
+	// any error
 	for lid := range idsMap {
 		ids = append(ids, lid)
 	}
@@ -186,12 +523,51 @@ func searchFileIDs(filePath string) ([]string, error) {
 	// and sort it
 	sort.Strings(ids)
 
-	return ids, nil
+	return ids, err
 }
 
+// maxLineLength is the most bytes of a single line that are searched. The
+// rest of a longer line, such as in a minified file, is skipped.
+const maxLineLength = 64 * 1024
+
+// readLines calls fn with each line read from r, without its line ending,
+// until fn returns false. Lines longer than maxLineLength are cut short,
+// rather than ending the read, so that the lines after them are still
+// searched.
+func readLines(r io.Reader, fn func(line string) bool) error {
+	br := bufio.NewReader(r)
+	for {
+		var line []byte
+		isPrefix := true
+		for isPrefix {
+			var frag []byte
+			var err error
+			frag, isPrefix, err = br.ReadLine()
+			if err == io.EOF {
+				if len(line) > 0 {
+					fn(string(line))
+				}
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if room := maxLineLength - len(line); len(frag) > room {
+				frag = frag[:room]
+			}
+			line = append(line, frag...)
+		}
+		if !fn(string(line)) {
+			return nil
+		}
+	}
+}
+
+// trashRe matches the characters that cannot be part of a short-form ID.
+var trashRe = regexp.MustCompile(`[^\w\s\d.:\-\+()]+`)
+
 func stripTrash(lid string) string {
-	re := regexp.MustCompile(`[^\w\s\d.\-\+()]+`)
-	return re.ReplaceAllString(lid, "")
+	return trashRe.ReplaceAllString(lid, "")
 }
 
 func makeElement(lic string) string {
@@ -202,27 +578,14 @@ func makeElement(lic string) string {
 	return lic
 }
 
-func getIndividualLicenses(lic string) []string {
-	// replace parens and '+' with spaces
-	lic = strings.Replace(lic, "(", " ", -1)
-	lic = strings.Replace(lic, ")", " ", -1)
-	lic = strings.Replace(lic, "+", " ", -1)
-
-	// now, split by spaces, trim, and add to slice
-	licElements := strings.Split(lic, " ")
-	lics := []string{}
-	for _, elt := range licElements {
-		elt := strings.TrimSpace(elt)
-		// don't add if empty or if case-insensitive operator
-		if elt == "" || strings.EqualFold(elt, "AND") ||
-			strings.EqualFold(elt, "OR") || strings.EqualFold(elt, "WITH") {
-			continue
+// isBinaryFile reports whether the builder classified a File as a binary
+// or an archive, whose contents have no license header or copyright
+// notice to search for.
+func isBinaryFile(f *spdx.File2_1) bool {
+	for _, t := range f.FileType {
+		if t == builder2v1.FileTypeBinary || t == builder2v1.FileTypeArchive {
+			return true
 		}
-
-		lics = append(lics, elt)
 	}
-
-	// sort before returning
-	sort.Strings(lics)
-	return lics
+	return false
 }
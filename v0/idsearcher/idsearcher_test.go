@@ -3,7 +3,16 @@
 package idsearcher
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
 )
 
 // ===== Searcher top-level function tests =====
@@ -460,144 +469,185 @@ func TestWillNotParenthesizeIfNotNeeded(t *testing.T) {
 	}
 }
 
-func TestCanGetIndividualLicenses(t *testing.T) {
-	// single license
-	lic := "MIT"
-	lics := getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
-	}
-	if len(lics) != 1 {
-		t.Fatalf("expected lics to have len 1, got %d", len(lics))
+func TestSearcherCanFillInIDsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":    {Data: []byte("// SPDX-License-Identifier: MIT\npackage main\n")},
+		"README.txt": {Data: []byte("nothing to see here\n")},
 	}
-	if lics[0] != "MIT" {
-		t.Errorf("expected %v, got %v", "MIT", lics[0])
+	config := &Config{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
 	}
 
-	// two-license combo
-	lic = "ISC AND BSD-3-Clause"
-	lics = getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
-	}
-	if len(lics) != 2 {
-		t.Fatalf("expected lics to have len 2, got %d", len(lics))
+	doc, err := BuildIDsDocumentFromFS("inmemory", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
 	}
-	// should be sorted alphabetically
-	if lics[0] != "BSD-3-Clause" {
-		t.Errorf("expected %v, got %v", "BSD-3-Clause", lics[0])
+	if len(doc.Packages) != 1 {
+		t.Fatalf("expected Packages len to be 1, got %d", len(doc.Packages))
 	}
-	if lics[1] != "ISC" {
-		t.Errorf("expected %v, got %v", "ISC", lics[1])
+	pkg := doc.Packages[0]
+	if len(pkg.Files) != 2 {
+		t.Fatalf("expected Files len to be 2, got %d", len(pkg.Files))
 	}
 
-	// license WITH exception
-	lic = "GPL-2.0-only WITH Classpath-exception-2.0"
-	lics = getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
+	readme := pkg.Files[0]
+	if readme.LicenseConcluded != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", readme.LicenseConcluded)
 	}
-	if len(lics) != 2 {
-		t.Fatalf("expected lics to have len 2, got %d", len(lics))
+	mainGo := pkg.Files[1]
+	if mainGo.LicenseConcluded != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", mainGo.LicenseConcluded)
 	}
-	// exception should be listed separately
-	if lics[0] != "Classpath-exception-2.0" {
-		t.Errorf("expected %v, got %v", "Classpath-exception-2.0", lics[0])
-	}
-	if lics[1] != "GPL-2.0-only" {
-		t.Errorf("expected %v, got %v", "GPL-2.0-only", lics[1])
+	if len(pkg.PackageLicenseInfoFromFiles) != 1 || pkg.PackageLicenseInfoFromFiles[0] != "MIT" {
+		t.Errorf("expected %v, got %v", []string{"MIT"}, pkg.PackageLicenseInfoFromFiles)
 	}
+}
 
-	// two-license combo with parens
-	lic = "(JSON OR BSD-2-Clause)"
-	lics = getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
+func TestSearcherSkipsIDSearchInBinaryFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib.so":  {Data: []byte("\x7fELF\x00\x00SPDX-License-Identifier: MIT\n")},
+		"main.go": {Data: []byte("// SPDX-License-Identifier: Apache-2.0\npackage main\n")},
 	}
-	if len(lics) != 2 {
-		t.Fatalf("expected lics to have len 2, got %d", len(lics))
-	}
-	// parens should get dropped
-	if lics[0] != "BSD-2-Clause" {
-		t.Errorf("expected %v, got %v", "BSD-2-Clause", lics[0])
-	}
-	if lics[1] != "JSON" {
-		t.Errorf("expected %v, got %v", "JSON", lics[1])
+	config := &Config{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
 	}
 
-	// multi-license combo with nested parens
-	lic = "GPL-2.0-only AND ((EPL-1.0 AND BSD-4-Clause) OR MIT)"
-	lics = getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
-	}
-	if len(lics) != 4 {
-		t.Fatalf("expected lics to have len 4, got %d", len(lics))
-	}
-	if lics[0] != "BSD-4-Clause" {
-		t.Errorf("expected %v, got %v", "BSD-4-Clause", lics[0])
+	doc, err := BuildIDsDocumentFromFS("inmemory", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
 	}
-	if lics[1] != "EPL-1.0" {
-		t.Errorf("expected %v, got %v", "EPL-1.0", lics[1])
+	pkg := doc.Packages[0]
+	if pkg.Files[0].FileName != "/lib.so" {
+		t.Fatalf("expected %v, got %v", "/lib.so", pkg.Files[0].FileName)
 	}
-	if lics[2] != "GPL-2.0-only" {
-		t.Errorf("expected %v, got %v", "GPL-2.0-only", lics[2])
+	if pkg.Files[0].LicenseConcluded != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", pkg.Files[0].LicenseConcluded)
 	}
-	if lics[3] != "MIT" {
-		t.Errorf("expected %v, got %v", "MIT", lics[3])
+	if pkg.Files[1].LicenseConcluded != "Apache-2.0" {
+		t.Errorf("expected %v, got %v", "Apache-2.0", pkg.Files[1].LicenseConcluded)
 	}
 }
 
-func TestCanGetIndividualLicensesIgnoringOperatorCase(t *testing.T) {
-	// two-license combo with lowercase 'and'
-	lic := "ISC and BSD-3-Clause"
-	lics := getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
-	}
-	// should be sorted alphabetically; 'and' should not appear
-	if len(lics) != 2 {
-		t.Fatalf("expected lics to have len 2, got %d", len(lics))
-	}
-	if lics[0] != "BSD-3-Clause" {
-		t.Errorf("expected %v, got %v", "BSD-3-Clause", lics[0])
-	}
-	if lics[1] != "ISC" {
-		t.Errorf("expected %v, got %v", "ISC", lics[1])
+func TestSearcherGivesSameResultsWithWorkers(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("dir%d/file%02d.c", i%5, i)
+		var data string
+		switch i % 4 {
+		case 0:
+			data = "// SPDX-License-Identifier: MIT\n"
+		case 1:
+			data = "// SPDX-License-Identifier: GPL-2.0-only OR (MIT AND\n"
+		case 2:
+			data = "// SPDX-License-Identifier: LicenseRef-Custom AND BSD-2-Clause\n"
+		default:
+			data = "// SPDX-License-Identifier: Not-A-License\n"
+		}
+		fsys[name] = &fstest.MapFile{Data: []byte("// Copyright 2020 Someone\n" + data)}
+	}
+
+	search := func(numWorkers int) ([]*spdx.File2_1, []string, string) {
+		config := &Config{
+			NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+			NumWorkers:      numWorkers,
+			Scanners:        []FileScanner{&CopyrightScanner{}},
+		}
+		doc, fileErrs, err := BuildIDsDocumentFromFSWithErrors("inmemory", fsys, config)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if len(fileErrs) == 0 {
+			t.Fatalf("expected collected errors, got none")
+		}
+		errStrs := []string{}
+		for _, fileErr := range fileErrs {
+			errStrs = append(errStrs, fileErr.Error())
+		}
+		return doc.Packages[0].Files, doc.Packages[0].PackageLicenseInfoFromFiles, strings.Join(errStrs, "\n")
+	}
+
+	wantFiles, wantLics, wantErr := search(1)
+	for _, numWorkers := range []int{2, 8} {
+		files, lics, errStr := search(numWorkers)
+		if !reflect.DeepEqual(files, wantFiles) {
+			t.Errorf("with %d workers, expected same Files as with 1 worker", numWorkers)
+		}
+		if !reflect.DeepEqual(lics, wantLics) {
+			t.Errorf("expected %v, got %v", wantLics, lics)
+		}
+		if errStr != wantErr {
+			t.Errorf("expected %v, got %v", wantErr, errStr)
+		}
 	}
+}
 
-	// two-license combo with lowercase 'or'
-	lic = "ISC or BSD-3-Clause"
-	lics = getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
+func TestSearcherStopsAtFirstErrorWithWorkers(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 20; i++ {
+		fsys[fmt.Sprintf("file%02d.c", i)] = &fstest.MapFile{Data: []byte("// SPDX-License-Identifier: MIT\n")}
 	}
-	// should be sorted alphabetically; 'or' should not appear
-	if len(lics) != 2 {
-		t.Fatalf("expected lics to have len 2, got %d", len(lics))
-	}
-	if lics[0] != "BSD-3-Clause" {
-		t.Errorf("expected %v, got %v", "BSD-3-Clause", lics[0])
-	}
-	if lics[1] != "ISC" {
-		t.Errorf("expected %v, got %v", "ISC", lics[1])
+	config := &Config{
+		NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+		NumWorkers:      4,
+		ErrorPolicy:     FailOnError,
+		Scanners:        []FileScanner{&failingScanner{fail: map[string]bool{"/file07.c": true, "/file12.c": true}}},
 	}
 
-	// two-license combo with lowercase 'with'
-	lic = "GPL-2.0-only with Classpath-exception-2.0"
-	lics = getIndividualLicenses(lic)
-	if lics == nil {
-		t.Fatalf("expected non-nil lics, got nil")
-	}
-	// should be sorted alphabetically; 'with' should not appear
-	if len(lics) != 2 {
-		t.Fatalf("expected lics to have len 2, got %d", len(lics))
+	_, err := BuildIDsDocumentFromFS("inmemory", fsys, config)
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("expected *FileError, got %v", err)
 	}
-	if lics[0] != "Classpath-exception-2.0" {
-		t.Errorf("expected %v, got %v", "Classpath-exception-2.0", lics[0])
+	if fileErr.FileName != "/file07.c" {
+		t.Errorf("expected %v, got %v", "/file07.c", fileErr.FileName)
 	}
-	if lics[1] != "GPL-2.0-only" {
-		t.Errorf("expected %v, got %v", "GPL-2.0-only", lics[1])
+}
+
+// ===== Benchmarks =====
+
+// benchmarkTreeFiles is the number of files in the synthetic tree searched
+// by BenchmarkBuildIDsDocument.
+const benchmarkTreeFiles = 100000
+
+// writeBenchmarkTree creates a tree of small source files under dir, most
+// with short-form IDs, spread across directories of 1000 files each.
+func writeBenchmarkTree(b *testing.B, dir string) {
+	headers := []string{
+		"// SPDX-License-Identifier: MIT\n",
+		"// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later\n",
+		"// SPDX-License-Identifier: BSD-3-Clause\n",
+		"",
+	}
+	body := strings.Repeat("int f(void) { return 0; }\n", 20)
+	for i := 0; i < benchmarkTreeFiles; i++ {
+		subdir := filepath.Join(dir, fmt.Sprintf("dir%03d", i/1000))
+		if i%1000 == 0 {
+			if err := os.MkdirAll(subdir, 0755); err != nil {
+				b.Fatal(err)
+			}
+		}
+		data := "// Copyright 2021 Someone\n" + headers[i%len(headers)] + body
+		if err := os.WriteFile(filepath.Join(subdir, fmt.Sprintf("file%03d.c", i%1000)), []byte(data), 0644); err != nil {
+			b.Fatal(err)
+		}
 	}
+}
 
+func BenchmarkBuildIDsDocument(b *testing.B) {
+	dir := b.TempDir()
+	writeBenchmarkTree(b, dir)
+
+	for _, numWorkers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", numWorkers), func(b *testing.B) {
+			config := &Config{
+				NamespacePrefix: "https://github.com/swinslow/spdx-docs/spdx-go/testdata-",
+				NumWorkers:      numWorkers,
+			}
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildIDsDocument("bench", dir, config); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
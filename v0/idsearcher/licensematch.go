@@ -0,0 +1,541 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spdx/tools-golang/v0/builder/builder2v1"
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// LicenseTemplate is a license text from the SPDX License List, in the
+// template format used by the license-list-data repository: the text of
+// the license, with <<var;...>> markup for text that may be replaced (such
+// as the copyright notice) and <<beginOptional>> / <<endOptional>> around
+// text that may be omitted.
+type LicenseTemplate struct {
+	// ID is the SPDX short-form identifier of the license.
+	ID string
+
+	elems    []templateElem
+	required int
+	vocab    map[string]bool
+}
+
+// templateElem is a single word of a template, or a gap for a var.
+type templateElem struct {
+	word     string
+	optional bool
+	isVar    bool
+}
+
+// maxVarTokens is the most words of a file that a single template var can
+// stand in for.
+const maxVarTokens = 80
+
+// ParseLicenseTemplate parses the template text for the license with the
+// given SPDX ID. Arguments:
+//   - id: SPDX short-form identifier of the license
+//   - text: the license template text
+func ParseLicenseTemplate(id string, text string) (*LicenseTemplate, error) {
+	lt := &LicenseTemplate{ID: id, vocab: map[string]bool{}}
+	optional := 0
+	for text != "" {
+		i := strings.Index(text, "<<")
+		if i < 0 {
+			lt.addWords(text, optional > 0)
+			break
+		}
+		lt.addWords(text[:i], optional > 0)
+
+		tag, rest, err := splitTemplateTag(text[i+2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %v", id, err)
+		}
+		text = rest
+
+		name, attrs := parseTemplateTag(tag)
+		switch name {
+		case "var":
+			lt.addVar(attrs["original"])
+		case "beginOptional":
+			optional++
+		case "endOptional":
+			if optional == 0 {
+				return nil, fmt.Errorf("invalid template for %s: endOptional without beginOptional", id)
+			}
+			optional--
+		default:
+			return nil, fmt.Errorf("invalid template for %s: unknown tag %q", id, name)
+		}
+	}
+	if optional != 0 {
+		return nil, fmt.Errorf("invalid template for %s: beginOptional without endOptional", id)
+	}
+	if lt.required == 0 {
+		return nil, fmt.Errorf("invalid template for %s: no required text", id)
+	}
+	return lt, nil
+}
+
+// parseTemplateTag parses the body of a template tag into its name and
+// its attributes, such as `var;name="copyright";original="..."`.
+func parseTemplateTag(tag string) (string, map[string]string) {
+	parts := []string{}
+	var part strings.Builder
+	inQuote := false
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case inQuote && tag[i] == '\\' && i+1 < len(tag):
+			i++
+			part.WriteByte(tag[i])
+		case tag[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && tag[i] == ';':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(tag[i])
+		}
+	}
+	parts = append(parts, part.String())
+
+	attrs := map[string]string{}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			attrs[strings.TrimSpace(kv[0])] = kv[1]
+		}
+	}
+	return strings.TrimSpace(parts[0]), attrs
+}
+
+// splitTemplateTag splits off the body of a template tag, which s starts
+// with, from the text after the tag's closing ">>". Quoted attribute
+// values, such as a var's original text, may contain ">>".
+func splitTemplateTag(s string) (string, string, error) {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(s[i:], ">>"):
+			return s[:i], s[i+2:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated tag")
+}
+
+func (lt *LicenseTemplate) addWords(text string, optional bool) {
+	for _, tok := range tokenizeLicenseText(text) {
+		lt.elems = append(lt.elems, templateElem{word: tok.word, optional: optional})
+		if !optional {
+			lt.required++
+			lt.vocab[tok.word] = true
+		}
+	}
+}
+
+// addVar adds a var to the template. The words of its original text are
+// optional, so that they anchor the match where the text has them, and
+// each <placeholder> in it becomes a gap for any text. A var without
+// placeholders is followed by a gap in place of its original text.
+func (lt *LicenseTemplate) addVar(original string) {
+	gap := func() {
+		if n := len(lt.elems); n == 0 || !lt.elems[n-1].isVar {
+			lt.elems = append(lt.elems, templateElem{isVar: true, optional: true})
+		}
+	}
+	hasPlaceholder := false
+	for {
+		i := strings.Index(original, "<")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(original[i:], ">")
+		if j < 0 {
+			break
+		}
+		lt.addWords(original[:i], true)
+		gap()
+		hasPlaceholder = true
+		original = original[i+j+1:]
+	}
+	lt.addWords(original, true)
+	if !hasPlaceholder {
+		gap()
+	}
+}
+
+// LoadLicenseTemplates parses every "<ID>.template.txt" file at the top
+// level of a file system, such as the "template" directory of the SPDX
+// license-list-data repository. The templates are returned sorted by ID.
+func LoadLicenseTemplates(fsys fs.FS) ([]*LicenseTemplate, error) {
+	names, err := fs.Glob(fsys, "*.template.txt")
+	if err != nil {
+		return nil, err
+	}
+	templates := []*LicenseTemplate{}
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		lt, err := ParseLicenseTemplate(strings.TrimSuffix(path.Base(name), ".template.txt"), string(b))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, lt)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+	return templates, nil
+}
+
+// licenseToken is a normalized word of license text, with its byte range
+// in the original text.
+type licenseToken struct {
+	word  string
+	start int
+	end   int
+}
+
+// licenseEquivalentWords maps variant spellings to the one used for
+// comparison, following the SPDX License List matching guidelines.
+var licenseEquivalentWords = map[string]string{
+	"licence":         "license",
+	"licences":        "licenses",
+	"licenced":        "licensed",
+	"sublicence":      "sublicense",
+	"acknowledgement": "acknowledgment",
+	"analogue":        "analog",
+	"authorisation":   "authorization",
+	"authorised":      "authorized",
+	"centre":          "center",
+	"favour":          "favor",
+	"organisation":    "organization",
+	"programme":       "program",
+	"recognised":      "recognized",
+	"utilisation":     "utilization",
+}
+
+// tokenizeLicenseText splits text into lowercased words, ignoring
+// whitespace, punctuation and comment markers, so that license texts can
+// be compared following the SPDX License List matching guidelines. The
+// copyright symbols "©" and "(c)" become the word "copyright".
+func tokenizeLicenseText(text string) []licenseToken {
+	toks := []licenseToken{}
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			word := strings.ToLower(text[start:end])
+			if eq, ok := licenseEquivalentWords[word]; ok {
+				word = eq
+			}
+			toks = append(toks, licenseToken{word: word, start: start, end: end})
+			start = -1
+		}
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+		case r == '©':
+			flush(i)
+			toks = append(toks, licenseToken{word: "copyright", start: i, end: i + size})
+		case r == '(' && len(text) >= i+3 && (text[i+1] == 'c' || text[i+1] == 'C') && text[i+2] == ')':
+			flush(i)
+			toks = append(toks, licenseToken{word: "copyright", start: i, end: i + 3})
+			size = 3
+		case r == '\'' && start >= 0:
+			// keep apostrophes within words, such as "licensor's"
+			if next, _ := utf8.DecodeRuneInString(text[i+size:]); !unicode.IsLetter(next) {
+				flush(i)
+			}
+		default:
+			flush(i)
+		}
+		i += size
+	}
+	flush(len(text))
+	return toks
+}
+
+// LicenseMatch is a license found by a LicenseMatcher in a file's text.
+type LicenseMatch struct {
+	// LicenseID is the SPDX short-form identifier of the matched license.
+	LicenseID string
+	// Confidence is between 0 and 1: 1 means the text matches the license
+	// template exactly, ignoring whitespace, punctuation and case.
+	Confidence float64
+	// ByteStart and ByteEnd are the offsets of the start of the matched
+	// text and of the end of it (exclusive).
+	ByteStart int
+	ByteEnd   int
+}
+
+// LicenseMatcher is a FileScanner that finds license texts in files by
+// comparing them against SPDX license templates. The IDs of the licenses
+// it finds are added to each File's LicenseInfoInFile, alongside any
+// found from short-form IDs, and to the Package's
+// PackageLicenseInfoFromFiles. Files whose FileType is BINARY or ARCHIVE
+// are skipped.
+type LicenseMatcher struct {
+	// Templates are the license templates to match against, such as from
+	// LoadLicenseTemplates.
+	Templates []*LicenseTemplate
+
+	// Threshold is the lowest confidence of a match that is reported. If
+	// 0, DefaultLicenseMatchThreshold is used.
+	Threshold float64
+}
+
+// DefaultLicenseMatchThreshold is the lowest confidence of a match that is
+// reported by a LicenseMatcher by default.
+const DefaultLicenseMatchThreshold = 0.9
+
+// Match finds the licenses in text. Where matches for different licenses
+// overlap, only the one with the highest confidence (or if equal, the
+// longest) is kept. The matches are returned in the order they appear.
+func (lm *LicenseMatcher) Match(text []byte) []LicenseMatch {
+	threshold := lm.Threshold
+	if threshold <= 0 {
+		threshold = DefaultLicenseMatchThreshold
+	}
+
+	toks := tokenizeLicenseText(string(text))
+	present := map[string]bool{}
+	for _, tok := range toks {
+		present[tok.word] = true
+	}
+
+	candidates := []LicenseMatch{}
+	for _, lt := range lm.Templates {
+		// skip the alignment when too few of the template's words occur
+		// anywhere in the text for it to possibly match
+		found := 0
+		for w := range lt.vocab {
+			if present[w] {
+				found++
+			}
+		}
+		if float64(found) < threshold*float64(len(lt.vocab)) {
+			continue
+		}
+
+		for from := 0; from < len(toks); {
+			start, end, cost := lt.align(toks[from:])
+			confidence := 1 - float64(cost)/float64(lt.required)
+			if end <= start || confidence < threshold {
+				break
+			}
+			candidates = append(candidates, LicenseMatch{
+				LicenseID:  lt.ID,
+				Confidence: confidence,
+				ByteStart:  toks[from+start].start,
+				ByteEnd:    toks[from+end-1].end,
+			})
+			from += end
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].ByteEnd-candidates[i].ByteStart > candidates[j].ByteEnd-candidates[j].ByteStart
+	})
+	matches := []LicenseMatch{}
+	for _, c := range candidates {
+		overlaps := false
+		for _, m := range matches {
+			if c.ByteStart < m.ByteEnd && m.ByteStart < c.ByteEnd {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			matches = append(matches, c)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ByteStart < matches[j].ByteStart })
+	return matches
+}
+
+// alignment is the best alignment of a template prefix ending at some
+// position in the text.
+type alignment struct {
+	cost    int
+	matched int
+	start   int
+}
+
+// better reports whether a is a better alignment than b: it has fewer
+// differences or, if equal, more matching words or, if equal, a later
+// start, giving a shorter match.
+func (a alignment) better(b alignment) bool {
+	if a.cost != b.cost {
+		return a.cost < b.cost
+	}
+	if a.matched != b.matched {
+		return a.matched > b.matched
+	}
+	return a.start > b.start
+}
+
+// align finds the span of toks that best matches the template, returning
+// the token indexes of its start and end (exclusive), and the number of
+// words that differ: template words that are missing or replaced, and
+// extra words in the text. Optional template words may be missing at no
+// cost, and each var gap may stand in for up to maxVarTokens words.
+func (lt *LicenseTemplate) align(toks []licenseToken) (int, int, int) {
+	n := len(toks)
+	prev, cur := make([]alignment, n+1), make([]alignment, n+1)
+	// the match may start anywhere in the text
+	for j := range prev {
+		prev[j] = alignment{start: j}
+	}
+
+	for _, e := range lt.elems {
+		if e.isVar {
+			// a gap takes the best of the previous row within the last
+			// maxVarTokens positions, kept as a deque of candidate indexes
+			window := []int{}
+			for j := 0; j <= n; j++ {
+				for len(window) > 0 && !prev[window[len(window)-1]].better(prev[j]) {
+					window = window[:len(window)-1]
+				}
+				window = append(window, j)
+				if window[0] < j-maxVarTokens {
+					window = window[1:]
+				}
+				cur[j] = prev[window[0]]
+			}
+		} else {
+			skip := 1
+			if e.optional {
+				skip = 0
+			}
+			cur[0] = alignment{prev[0].cost + skip, prev[0].matched, prev[0].start}
+			for j := 1; j <= n; j++ {
+				best := alignment{prev[j].cost + skip, prev[j].matched, prev[j].start}
+				sub := prev[j-1]
+				if toks[j-1].word == e.word {
+					sub.matched++
+				} else {
+					sub.cost++
+				}
+				if sub.better(best) {
+					best = sub
+				}
+				extra := alignment{cur[j-1].cost + 1, cur[j-1].matched, cur[j-1].start}
+				if extra.better(best) {
+					best = extra
+				}
+				cur[j] = best
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	// the match may end anywhere in the text; prefer the shortest
+	bestEnd := 0
+	for j := 1; j <= n; j++ {
+		a, b := prev[j], prev[bestEnd]
+		if a.cost < b.cost || (a.cost == b.cost && (a.matched > b.matched || (a.matched == b.matched && j-a.start < bestEnd-b.start))) {
+			bestEnd = j
+		}
+	}
+	return prev[bestEnd].start, bestEnd, prev[bestEnd].cost
+}
+
+// ScanFile adds the IDs of the licenses found in a File to its
+// LicenseInfoInFile. Each license text that differs from the File's
+// overall license, such as the license of a vendored function, is also
+// recorded as a Snippet of the File. The overall license is given by the
+// File's short-form IDs or, if it has none, by the first license text.
+func (lm *LicenseMatcher) ScanFile(f *spdx.File2_1, r io.Reader) error {
+	if isBinaryFile(f) {
+		return nil
+	}
+
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	matches := lm.Match(text)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	lics := map[string]bool{}
+	for _, lic := range f.LicenseInfoInFile {
+		if lic != "NOASSERTION" && lic != "NONE" {
+			lics[lic] = true
+		}
+	}
+	overall := map[string]bool{}
+	for lic := range lics {
+		overall[lic] = true
+	}
+	if len(overall) == 0 {
+		overall[matches[0].LicenseID] = true
+	}
+
+	for _, m := range matches {
+		lics[m.LicenseID] = true
+		if overall[m.LicenseID] {
+			continue
+		}
+		sn, err := builder2v1.BuildSnippetSection2_1(f, text, m.ByteStart, m.ByteEnd, []string{m.LicenseID})
+		if err != nil {
+			return err
+		}
+		sn.SnippetLicenseComments = fmt.Sprintf("matched %s license template with confidence %.2f", m.LicenseID, m.Confidence)
+		if stmts, _ := FindCopyrights(bytes.NewReader(text[m.ByteStart:m.ByteEnd]), DefaultCopyrightLines); len(stmts) > 0 {
+			sn.SnippetCopyrightText = strings.Join(stmts, "\n")
+		}
+	}
+
+	f.LicenseInfoInFile = []string{}
+	for lic := range lics {
+		f.LicenseInfoInFile = append(f.LicenseInfoInFile, lic)
+	}
+	sort.Strings(f.LicenseInfoInFile)
+	return nil
+}
+
+// FinishPackage fills in the Package's PackageLicenseInfoFromFiles from
+// the LicenseInfoInFile of its Files.
+func (lm *LicenseMatcher) FinishPackage(pkg *spdx.Package2_1) error {
+	lics := map[string]bool{}
+	for _, f := range pkg.Files {
+		for _, lic := range f.LicenseInfoInFile {
+			if lic != "NOASSERTION" && lic != "NONE" {
+				lics[lic] = true
+			}
+		}
+	}
+	if len(lics) == 0 {
+		return nil
+	}
+	pkg.PackageLicenseInfoFromFiles = []string{}
+	for lic := range lics {
+		pkg.PackageLicenseInfoFromFiles = append(pkg.PackageLicenseInfoFromFiles, lic)
+	}
+	sort.Strings(pkg.PackageLicenseInfoFromFiles)
+	return nil
+}
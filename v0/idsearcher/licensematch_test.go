@@ -0,0 +1,334 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+const testMITTemplate = `<<beginOptional>>MIT License<<endOptional>>
+
+<<var;name="copyright";original="Copyright (c) <year> <copyright holders>";match=".{0,5000}">>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+`
+
+const testBSD2Template = `<<var;name="copyright";original="Copyright (c) <year> <owner>. All rights reserved.";match=".{0,5000}">>
+
+Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+
+<<var;name="bullet";original="1.";match=".{0,20}">> Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+
+<<var;name="bullet";original="2.";match=".{0,20}">> Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+`
+
+const testBSD3Clause = `<<var;name="bullet";original="3.";match=".{0,20}">> Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+
+`
+
+// testBSD3Template inserts the third clause into the BSD-2-Clause template.
+var testBSD3Template = strings.Replace(testBSD2Template, "THIS SOFTWARE", testBSD3Clause+"THIS SOFTWARE", 1)
+
+func testLicenseTemplates(t *testing.T) []*LicenseTemplate {
+	templates, err := LoadLicenseTemplates(fstest.MapFS{
+		"MIT.template.txt":          {Data: []byte(testMITTemplate)},
+		"BSD-2-Clause.template.txt": {Data: []byte(testBSD2Template)},
+		"BSD-3-Clause.template.txt": {Data: []byte(testBSD3Template)},
+		"README.md":                 {Data: []byte("not a template")},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return templates
+}
+
+// commentOut turns license text into a block of line comments, as found
+// in source file headers.
+func commentOut(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		lines = append(lines, strings.TrimSpace("// "+line))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ===== License template tests =====
+func TestCanLoadLicenseTemplates(t *testing.T) {
+	templates := testLicenseTemplates(t)
+	if len(templates) != 3 {
+		t.Fatalf("expected %d templates, got %d", 3, len(templates))
+	}
+	want := []string{"BSD-2-Clause", "BSD-3-Clause", "MIT"}
+	for i, lt := range templates {
+		if lt.ID != want[i] {
+			t.Errorf("expected %v, got %v", want[i], lt.ID)
+		}
+	}
+}
+
+func TestLicenseTemplateParseFailsWithInvalidMarkup(t *testing.T) {
+	templates := map[string]string{
+		"unterminated": `text <<var;name="x";original="a>>b`,
+		"unbalanced":   `text <<beginOptional>> more`,
+		"extra end":    `text <<endOptional>>`,
+		"unknown tag":  `text <<beginRequired>>`,
+		"empty":        `<<var;name="x";original="";match=".*">>`,
+	}
+	for name, text := range templates {
+		if _, err := ParseLicenseTemplate("X", text); err == nil {
+			t.Errorf("expected non-nil error for %s template, got nil", name)
+		}
+	}
+}
+
+func TestCanParseLicenseTemplateWithQuotedMarkup(t *testing.T) {
+	lt, err := ParseLicenseTemplate("X", `Hello <<var;name="x";original="a >> b \" c";match=".*">> world`)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// the var's original words are optional, followed by a gap
+	want := []templateElem{
+		{word: "hello"},
+		{word: "a", optional: true},
+		{word: "b", optional: true},
+		{word: "c", optional: true},
+		{isVar: true, optional: true},
+		{word: "world"},
+	}
+	if len(lt.elems) != len(want) {
+		t.Fatalf("expected %v, got %v", want, lt.elems)
+	}
+	for i := range want {
+		if lt.elems[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], lt.elems[i])
+		}
+	}
+	if lt.required != 2 {
+		t.Errorf("expected %v, got %v", 2, lt.required)
+	}
+}
+
+func TestCanParseLicenseTemplateVarPlaceholders(t *testing.T) {
+	lt, err := ParseLicenseTemplate("X", `<<var;name="copyright";original="Copyright (c) <year> <owner>. All rights reserved.";match=".+">> text`)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// adjacent placeholders share one gap
+	want := []templateElem{
+		{word: "copyright", optional: true},
+		{word: "copyright", optional: true},
+		{isVar: true, optional: true},
+		{word: "all", optional: true},
+		{word: "rights", optional: true},
+		{word: "reserved", optional: true},
+		{word: "text"},
+	}
+	if len(lt.elems) != len(want) {
+		t.Fatalf("expected %v, got %v", want, lt.elems)
+	}
+	for i := range want {
+		if lt.elems[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], lt.elems[i])
+		}
+	}
+}
+
+// ===== License matcher tests =====
+func TestLicenseMatcherCanMatchExactText(t *testing.T) {
+	mit := strings.Replace(strings.Replace(testMITTemplate, "<<beginOptional>>MIT License<<endOptional>>", "", 1),
+		`<<var;name="copyright";original="Copyright (c) <year> <copyright holders>";match=".{0,5000}">>`,
+		"Copyright (c) 2020 Jane Doe", 1)
+	text := "package main\n\n" + commentOut(mit) + "\nfunc main() {}\n"
+
+	lm := &LicenseMatcher{Templates: testLicenseTemplates(t)}
+	matches := lm.Match([]byte(text))
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+	m := matches[0]
+	if m.LicenseID != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", m.LicenseID)
+	}
+	if m.Confidence != 1 {
+		t.Errorf("expected %v, got %v", 1, m.Confidence)
+	}
+	matched := text[m.ByteStart:m.ByteEnd]
+	if !strings.HasPrefix(matched, "Copyright (c) 2020") || !strings.HasSuffix(matched, "DEALINGS IN THE SOFTWARE") {
+		t.Errorf("expected range covering license text, got %q", matched)
+	}
+}
+
+func TestLicenseMatcherCanMatchChangedText(t *testing.T) {
+	mit := strings.Replace(testMITTemplate, "<<beginOptional>>MIT License<<endOptional>>", "The MIT Licence", 1)
+	mit = strings.Replace(mit, "free of charge, ", "", 1)
+	mit = strings.Replace(mit, "substantial portions", "large portions", 1)
+
+	lm := &LicenseMatcher{Templates: testLicenseTemplates(t)}
+	matches := lm.Match([]byte(mit))
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+	if matches[0].LicenseID != "MIT" {
+		t.Errorf("expected %v, got %v", "MIT", matches[0].LicenseID)
+	}
+	if matches[0].Confidence >= 1 || matches[0].Confidence < 0.95 {
+		t.Errorf("expected confidence between 0.95 and 1, got %v", matches[0].Confidence)
+	}
+
+	lm.Threshold = 0.999
+	if matches := lm.Match([]byte(mit)); len(matches) != 0 {
+		t.Errorf("expected no matches above threshold, got %v", matches)
+	}
+}
+
+func TestLicenseMatcherPrefersBestOverlappingMatch(t *testing.T) {
+	bsd3 := strings.NewReplacer(
+		`<<var;name="copyright";original="Copyright (c) <year> <owner>. All rights reserved.";match=".{0,5000}">>`, "Copyright 2019 Example Corp.",
+		`<<var;name="bullet";original="1.";match=".{0,20}">>`, "1.",
+		`<<var;name="bullet";original="2.";match=".{0,20}">>`, "2.",
+		`<<var;name="bullet";original="3.";match=".{0,20}">>`, "3.",
+	).Replace(testBSD3Template)
+
+	lm := &LicenseMatcher{Templates: testLicenseTemplates(t), Threshold: 0.5}
+	matches := lm.Match([]byte(bsd3))
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %v", matches)
+	}
+	if matches[0].LicenseID != "BSD-3-Clause" || matches[0].Confidence != 1 {
+		t.Errorf("expected exact BSD-3-Clause match, got %v", matches[0])
+	}
+}
+
+func TestLicenseMatcherCanFindSeveralLicenses(t *testing.T) {
+	mit := strings.NewReplacer(
+		"<<beginOptional>>", "",
+		"<<endOptional>>", "",
+		`<<var;name="copyright";original="Copyright (c) <year> <copyright holders>";match=".{0,5000}">>`, "Copyright 2020 Jane Doe",
+	).Replace(testMITTemplate)
+	bsd2 := strings.Replace(testBSD2Template, `<<var;name="copyright";original="Copyright (c) <year> <owner>. All rights reserved.";match=".{0,5000}">>`, "Copyright 2019 Example Corp.", 1)
+	text := commentOut(bsd2) + "\nint x;\n\n" + commentOut(mit)
+
+	lm := &LicenseMatcher{Templates: testLicenseTemplates(t)}
+	matches := lm.Match([]byte(text))
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %v", matches)
+	}
+	if matches[0].LicenseID != "BSD-2-Clause" || matches[1].LicenseID != "MIT" {
+		t.Errorf("expected [BSD-2-Clause MIT], got [%v %v]", matches[0].LicenseID, matches[1].LicenseID)
+	}
+	if matches[0].ByteEnd > strings.Index(text, "int x;") || matches[1].ByteStart < strings.Index(text, "int x;") {
+		t.Errorf("expected matches on either side of code, got %v", matches)
+	}
+}
+
+func TestLicenseMatcherFindsNothingInUnrelatedText(t *testing.T) {
+	lm := &LicenseMatcher{Templates: testLicenseTemplates(t)}
+	text := "Permission is granted to read this file.\nThe software is provided as is.\n"
+	if matches := lm.Match([]byte(text)); len(matches) != 0 {
+		t.Errorf("expected no matches, got %v", matches)
+	}
+}
+
+func TestSearcherCanFillInMatchedLicenses(t *testing.T) {
+	mit := strings.NewReplacer(
+		"<<beginOptional>>", "",
+		"<<endOptional>>", "",
+		`<<var;name="copyright";original="Copyright (c) <year> <copyright holders>";match=".{0,5000}">>`, "Copyright 2020 Jane Doe",
+	).Replace(testMITTemplate)
+	fsys := fstest.MapFS{
+		"LICENSE": {Data: []byte(mit)},
+		"a.go":    {Data: []byte("// SPDX-License-Identifier: Apache-2.0\n" + commentOut(mit) + "package a\n")},
+		"b.go":    {Data: []byte("package b\n")},
+	}
+	config := &Config{
+		NamespacePrefix: "https://example.com/",
+		Scanners:        []FileScanner{&LicenseMatcher{Templates: testLicenseTemplates(t)}},
+	}
+
+	doc, err := BuildIDsDocumentFromFS("project", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	pkg := doc.Packages[0]
+	want := [][]string{{"MIT"}, {"Apache-2.0", "MIT"}, {"NOASSERTION"}}
+	for i, f := range pkg.Files {
+		if strings.Join(f.LicenseInfoInFile, " ") != strings.Join(want[i], " ") {
+			t.Errorf("expected %v for %s, got %v", want[i], f.FileName, f.LicenseInfoInFile)
+		}
+	}
+	if pkg.Files[1].LicenseConcluded != "Apache-2.0" {
+		t.Errorf("expected %v, got %v", "Apache-2.0", pkg.Files[1].LicenseConcluded)
+	}
+	if strings.Join(pkg.PackageLicenseInfoFromFiles, " ") != "Apache-2.0 MIT" {
+		t.Errorf("expected %v, got %v", "[Apache-2.0 MIT]", pkg.PackageLicenseInfoFromFiles)
+	}
+
+	// the MIT text differs from a.go's short-form ID, so it is a snippet
+	if len(pkg.Files[0].Snippets) != 0 {
+		t.Errorf("expected no snippets in LICENSE, got %v", pkg.Files[0].Snippets)
+	}
+	if len(pkg.Files[1].Snippets) != 1 {
+		t.Fatalf("expected 1 snippet in a.go, got %v", pkg.Files[1].Snippets)
+	}
+	sn := pkg.Files[1].Snippets[0]
+	if sn.SnippetFromFileSPDXIdentifier != pkg.Files[1].FileSPDXIdentifier {
+		t.Errorf("expected %v, got %v", pkg.Files[1].FileSPDXIdentifier, sn.SnippetFromFileSPDXIdentifier)
+	}
+	if sn.SnippetLineRangeStart != 2 || sn.SnippetLineRangeEnd != 10 {
+		t.Errorf("expected %v, got %d:%d", "2:10", sn.SnippetLineRangeStart, sn.SnippetLineRangeEnd)
+	}
+	if strings.Join(sn.LicenseInfoInSnippet, " ") != "MIT" {
+		t.Errorf("expected %v, got %v", "[MIT]", sn.LicenseInfoInSnippet)
+	}
+	if sn.SnippetCopyrightText != "Copyright 2020 Jane Doe" {
+		t.Errorf("expected %v, got %v", "Copyright 2020 Jane Doe", sn.SnippetCopyrightText)
+	}
+}
+
+func TestLicenseMatcherCanBuildSnippetsForDifferingLicenses(t *testing.T) {
+	mit := strings.NewReplacer(
+		"<<beginOptional>>", "",
+		"<<endOptional>>", "",
+		`<<var;name="copyright";original="Copyright (c) <year> <copyright holders>";match=".{0,5000}">>`, "Copyright 2020 Jane Doe",
+	).Replace(testMITTemplate)
+	bsd2 := strings.Replace(testBSD2Template, `<<var;name="copyright";original="Copyright (c) <year> <owner>. All rights reserved.";match=".{0,5000}">>`, "Copyright 2019 Example Corp.", 1)
+	text := commentOut(bsd2) + "\nint x;\n\n" + commentOut(mit) + "int y;\n\n" + commentOut(bsd2)
+	f := &spdx.File2_1{FileName: "/x.c", FileSPDXIdentifier: "SPDXRef-File0", LicenseInfoInFile: []string{"NOASSERTION"}}
+
+	lm := &LicenseMatcher{Templates: testLicenseTemplates(t)}
+	if err := lm.ScanFile(f, strings.NewReader(text)); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if strings.Join(f.LicenseInfoInFile, " ") != "BSD-2-Clause MIT" {
+		t.Errorf("expected %v, got %v", "[BSD-2-Clause MIT]", f.LicenseInfoInFile)
+	}
+
+	// the first license text gives the overall license
+	if len(f.Snippets) != 1 {
+		t.Fatalf("expected 1 snippet, got %v", f.Snippets)
+	}
+	sn := f.Snippets[0]
+	// the range starts at the optional title, and ends before the final
+	// full stop, as 1-based inclusive offsets
+	start := strings.Index(text, "// MIT License") + 3
+	end := strings.Index(text, ".\nint y;")
+	if sn.SnippetByteRangeStart != start+1 || sn.SnippetByteRangeEnd != end {
+		t.Errorf("expected %d:%d, got %d:%d", start+1, end, sn.SnippetByteRangeStart, sn.SnippetByteRangeEnd)
+	}
+	if sn.SnippetSPDXIdentifier != "SPDXRef-Snippet-File0-1" {
+		t.Errorf("expected %v, got %v", "SPDXRef-Snippet-File0-1", sn.SnippetSPDXIdentifier)
+	}
+	if !strings.HasPrefix(sn.SnippetLicenseComments, "matched MIT license template with confidence 1.00") {
+		t.Errorf("expected comment giving confidence, got %v", sn.SnippetLicenseComments)
+	}
+}
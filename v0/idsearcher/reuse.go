@@ -0,0 +1,477 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+	"github.com/spdx/tools-golang/v0/utils"
+)
+
+// reuseAnnotation assigns licenses and copyright statements to the files
+// matching any of its patterns, from a .reuse/dep5 or REUSE.toml file.
+type reuseAnnotation struct {
+	patterns []*regexp.Regexp
+	// precedence is "closest", "aggregate" or "override", as in REUSE.toml
+	precedence string
+	licenses   []string
+	copyrights []string
+}
+
+// matches reports whether the annotation covers the file at p, relative
+// to the directory of the file that the annotation is from.
+func (a *reuseAnnotation) matches(p string) bool {
+	for _, re := range a.patterns {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// reuseInfo holds the licensing information for a package that is given
+// outside of the files themselves, following the REUSE specification.
+type reuseInfo struct {
+	// dep5 are the stanzas of .reuse/dep5, which apply in addition to the
+	// files' own information
+	dep5 []*reuseAnnotation
+	// tomls maps the directory of each REUSE.toml file to its annotations
+	tomls map[string][]*reuseAnnotation
+}
+
+// loadREUSEInfo reads .reuse/dep5 and every REUSE.toml file among the
+// Package's Files.
+func loadREUSEInfo(fsys fs.FS, files []*spdx.File2_1) (*reuseInfo, error) {
+	ri := &reuseInfo{tomls: map[string][]*reuseAnnotation{}}
+
+	data, err := fs.ReadFile(fsys, ".reuse/dep5")
+	if err == nil {
+		if ri.dep5, err = parseDep5(data); err != nil {
+			return nil, fmt.Errorf("invalid .reuse/dep5: %v", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, f := range files {
+		name := strings.TrimPrefix(f.FileName, "/")
+		if path.Base(name) != "REUSE.toml" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		annotations, err := parseREUSETOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		ri.tomls[path.Dir(name)] = annotations
+	}
+	return ri, nil
+}
+
+// parseDep5 parses the stanzas of a Debian machine-readable copyright
+// file that have a Files field.
+func parseDep5(data []byte) ([]*reuseAnnotation, error) {
+	annotations := []*reuseAnnotation{}
+	for _, stanza := range parseDep5Stanzas(data) {
+		files, ok := stanza["files"]
+		if !ok {
+			continue
+		}
+		a := &reuseAnnotation{precedence: "aggregate"}
+		for _, glob := range strings.Fields(files) {
+			re, err := regexp.Compile("^" + dep5GlobToRegexp(glob) + "$")
+			if err != nil {
+				return nil, err
+			}
+			a.patterns = append(a.patterns, re)
+		}
+		// the first line of License is the expression; any others are
+		// the license text
+		if lic := strings.TrimSpace(strings.SplitN(stanza["license"], "\n", 2)[0]); lic != "" {
+			a.licenses = []string{lic}
+		}
+		for _, line := range strings.Split(stanza["copyright"], "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				a.copyrights = append(a.copyrights, line)
+			}
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, nil
+}
+
+// parseDep5Stanzas splits a Debian control-format file into stanzas of
+// fields, keyed by lowercased field name. Continuation lines are joined
+// with newlines, and a lone "." stands for a blank line.
+func parseDep5Stanzas(data []byte) []map[string]string {
+	stanzas := []map[string]string{}
+	stanza := map[string]string{}
+	key := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+				stanza = map[string]string{}
+			}
+			key = ""
+		case strings.HasPrefix(line, "#"):
+		case line[0] == ' ' || line[0] == '\t':
+			if key != "" {
+				cont := strings.TrimSpace(line)
+				if cont == "." {
+					cont = ""
+				}
+				stanza[key] += "\n" + cont
+			}
+		default:
+			kv := strings.SplitN(line, ":", 2)
+			if len(kv) != 2 {
+				key = ""
+				continue
+			}
+			key = strings.ToLower(strings.TrimSpace(kv[0]))
+			stanza[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas
+}
+
+// dep5GlobToRegexp converts a Files pattern from a dep5 file to a regular
+// expression: "*" matches any characters, including "/", and "?" matches
+// any single character.
+func dep5GlobToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '*':
+			sb.WriteString(".*")
+		case c == '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return sb.String()
+}
+
+// parseREUSETOML parses the annotations of a REUSE.toml file.
+func parseREUSETOML(data []byte) ([]*reuseAnnotation, error) {
+	doc, err := utils.ParseTOML(data)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := doc["version"].(int64); !ok || v != 1 {
+		return nil, fmt.Errorf("unsupported version %v", doc["version"])
+	}
+
+	tables, _ := doc["annotations"].([]interface{})
+	annotations := []*reuseAnnotation{}
+	for _, t := range tables {
+		table, ok := t.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("annotations must be tables")
+		}
+		a := &reuseAnnotation{precedence: "closest"}
+		if p, ok := table["precedence"].(string); ok {
+			if p != "closest" && p != "aggregate" && p != "override" {
+				return nil, fmt.Errorf("unknown precedence %q", p)
+			}
+			a.precedence = p
+		}
+		globs := tomlStrings(table["path"])
+		if len(globs) == 0 {
+			return nil, fmt.Errorf("annotation without path")
+		}
+		for _, glob := range globs {
+			re, err := regexp.Compile("^" + reuseGlobToRegexp(glob) + "$")
+			if err != nil {
+				return nil, err
+			}
+			a.patterns = append(a.patterns, re)
+		}
+		a.licenses = tomlStrings(table["SPDX-License-Identifier"])
+		a.copyrights = tomlStrings(table["SPDX-FileCopyrightText"])
+		annotations = append(annotations, a)
+	}
+	return annotations, nil
+}
+
+// tomlStrings returns a TOML value that is either a string or an array of
+// strings as a slice.
+func tomlStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		strs := []string{}
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+// reuseGlobToRegexp converts a path pattern from a REUSE.toml file to a
+// regular expression: "*" matches any characters except "/", and "**"
+// matches any characters, including "/".
+func reuseGlobToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return sb.String()
+}
+
+// annotationsFor returns the annotations that apply to the file at p: the
+// last matching stanza of .reuse/dep5, and the last matching annotation of
+// the closest REUSE.toml file that has one.
+func (ri *reuseInfo) annotationsFor(p string) []*reuseAnnotation {
+	annotations := []*reuseAnnotation{}
+	for i := len(ri.dep5) - 1; i >= 0; i-- {
+		if ri.dep5[i].matches(p) {
+			annotations = append(annotations, ri.dep5[i])
+			break
+		}
+	}
+
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		rel := p
+		if dir != "." {
+			rel = strings.TrimPrefix(p, dir+"/")
+		}
+		tomlAnnotations := ri.tomls[dir]
+		for i := len(tomlAnnotations) - 1; i >= 0; i-- {
+			if tomlAnnotations[i].matches(rel) {
+				return append(annotations, tomlAnnotations[i])
+			}
+		}
+		if dir == "." {
+			return annotations
+		}
+	}
+}
+
+// apply works out a File's licensing information following the REUSE
+// specification, and returns its license expressions. The information in
+// the file itself, or in its ".license" sidecar file if there is one, is
+// combined with the annotations that cover it. The File's copyright text
+// is filled in along the way. On error, the information found so far is
+// still returned. Arguments:
+//   - fsys: file system containing the file
+//   - f: File to fill in
+//   - ids: license expressions found in the file itself
+func (ri *reuseInfo) apply(fsys fs.FS, f *spdx.File2_1, ids []string) ([]string, error) {
+	name := strings.TrimPrefix(f.FileName, "/")
+
+	// a sidecar file replaces the file's own information, which is
+	// otherwise only looked for in files that have text headers
+	var copyrights []string
+	var err error
+	if _, statErr := fs.Stat(fsys, name+".license"); statErr == nil {
+		ids, err = searchFSFileIDs(fsys, name+".license")
+		if err == nil {
+			copyrights, err = findFSCopyrights(fsys, name+".license")
+		}
+	} else if !isBinaryFile(f) {
+		copyrights, err = findFSCopyrights(fsys, name)
+	}
+
+	for _, a := range ri.annotationsFor(name) {
+		switch a.precedence {
+		case "override":
+			ids, copyrights = a.licenses, a.copyrights
+		case "aggregate":
+			ids = append(append([]string{}, ids...), a.licenses...)
+			copyrights = append(copyrights, a.copyrights...)
+		default:
+			if len(ids) == 0 {
+				ids = a.licenses
+			}
+			if len(copyrights) == 0 {
+				copyrights = a.copyrights
+			}
+		}
+	}
+
+	if stmts := normalizeCopyrights(copyrights); len(stmts) > 0 {
+		f.FileCopyrightText = strings.Join(stmts, "\n")
+	}
+
+	idsMap := map[string]bool{}
+	for _, lid := range ids {
+		idsMap[lid] = true
+	}
+	ids = []string{}
+	for lid := range idsMap {
+		ids = append(ids, lid)
+	}
+	sort.Strings(ids)
+	return ids, err
+}
+
+// findFSCopyrights returns the copyright statements at the start of a
+// file.
+func findFSCopyrights(fsys fs.FS, name string) ([]string, error) {
+	r, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return FindCopyrights(r, DefaultCopyrightLines)
+}
+
+// normalizeCopyrights normalizes and merges copyright statements, which
+// may lack the word "Copyright" as in dep5 and REUSE.toml files. Any that
+// cannot be parsed are kept as they are.
+func normalizeCopyrights(stmts []string) []string {
+	parsed := []Copyright{}
+	unparsed := []string{}
+	for _, s := range stmts {
+		if c, ok := ParseCopyright(spdxCopyrightTag + " " + s); ok {
+			parsed = append(parsed, c)
+		} else {
+			unparsed = append(unparsed, s)
+		}
+	}
+	normalized := []string{}
+	for _, c := range MergeCopyrights(parsed) {
+		normalized = append(normalized, c.String())
+	}
+	return append(normalized, unparsed...)
+}
+
+// REUSEReport lists the problems that a REUSE lint would find in a
+// Package.
+type REUSEReport struct {
+	// MissingLicense lists the names of Files without any license.
+	MissingLicense []string
+	// MissingCopyright lists the names of Files without any copyright
+	// statement.
+	MissingCopyright []string
+	// MissingLicenseTexts lists the IDs of licenses used by Files that do
+	// not have a license text in the LICENSES directory.
+	MissingLicenseTexts []string
+	// UnusedLicenseTexts lists the names of the files in the LICENSES
+	// directory whose license is not used by any File.
+	UnusedLicenseTexts []string
+}
+
+// Compliant reports whether the lint found no problems.
+func (r *REUSEReport) Compliant() bool {
+	return len(r.MissingLicense) == 0 && len(r.MissingCopyright) == 0 &&
+		len(r.MissingLicenseTexts) == 0 && len(r.UnusedLicenseTexts) == 0
+}
+
+// LintREUSE checks a Document built by BuildIDsDocument with Config.REUSE
+// set against the REUSE specification, returning a report of the Files
+// and licenses that would fail a REUSE lint. License texts, ".license"
+// sidecar files, REUSE.toml files, and files in the LICENSES, .reuse and
+// .git directories or named LICENSE* or COPYING* are not checked.
+// Arguments:
+//   - fsys: file system that the Document was built from
+//   - doc: Document to check
+func LintREUSE(fsys fs.FS, doc *spdx.Document2_1) (*REUSEReport, error) {
+	report := &REUSEReport{
+		MissingLicense:      []string{},
+		MissingCopyright:    []string{},
+		MissingLicenseTexts: []string{},
+		UnusedLicenseTexts:  []string{},
+	}
+
+	used := map[string]bool{}
+	for _, pkg := range doc.Packages {
+		for _, f := range pkg.Files {
+			if isREUSEExempt(f.FileName) {
+				continue
+			}
+			hasLicense := false
+			for _, lic := range f.LicenseInfoInFile {
+				if lic != "NOASSERTION" && lic != "NONE" {
+					used[lic] = true
+					hasLicense = true
+				}
+			}
+			if !hasLicense {
+				report.MissingLicense = append(report.MissingLicense, f.FileName)
+			}
+			if f.FileCopyrightText == "" || f.FileCopyrightText == "NOASSERTION" || f.FileCopyrightText == "NONE" {
+				report.MissingCopyright = append(report.MissingCopyright, f.FileName)
+			}
+		}
+	}
+
+	texts := map[string]bool{}
+	entries, err := fs.ReadDir(fsys, "LICENSES")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		lic := strings.TrimSuffix(e.Name(), path.Ext(e.Name()))
+		texts[lic] = true
+		if !used[lic] {
+			report.UnusedLicenseTexts = append(report.UnusedLicenseTexts, "LICENSES/"+e.Name())
+		}
+	}
+	for lic := range used {
+		if !texts[lic] {
+			report.MissingLicenseTexts = append(report.MissingLicenseTexts, lic)
+		}
+	}
+	sort.Strings(report.MissingLicenseTexts)
+	sort.Strings(report.UnusedLicenseTexts)
+	return report, nil
+}
+
+// isREUSEExempt reports whether a file does not need licensing
+// information of its own under the REUSE specification.
+func isREUSEExempt(fileName string) bool {
+	name := strings.TrimPrefix(fileName, "/")
+	for _, dir := range []string{"LICENSES/", ".reuse/", ".git/"} {
+		if strings.HasPrefix(name, dir) || strings.Contains(name, "/"+dir) {
+			return true
+		}
+	}
+	base := path.Base(name)
+	return strings.HasSuffix(base, ".license") || base == "REUSE.toml" ||
+		strings.HasPrefix(base, "LICENSE") || strings.HasPrefix(base, "LICENCE") ||
+		strings.HasPrefix(base, "COPYING")
+}
@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package idsearcher
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+func testREUSEFS() fstest.MapFS {
+	return fstest.MapFS{
+		"LICENSES/MIT.txt":        {Data: []byte("MIT license text\n")},
+		"LICENSES/CC0-1.0.txt":    {Data: []byte("CC0 text\n")},
+		"LICENSES/Apache-2.0.txt": {Data: []byte("Apache text\n")},
+		".reuse/dep5": {Data: []byte(`Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: project
+
+Files: docs/*
+Copyright: 2019 Jane Doe
+ 2020 Jane Doe
+License: CC0-1.0
+`)},
+		"REUSE.toml": {Data: []byte(`version = 1
+
+[[annotations]]
+path = "assets/*.png"
+SPDX-FileCopyrightText = "2021 Example Corp."
+SPDX-License-Identifier = "CC0-1.0"
+
+[[annotations]]
+path = ["gen/**"]
+precedence = "override"
+SPDX-FileCopyrightText = ["2022 Generator Authors"]
+SPDX-License-Identifier = "MIT"
+`)},
+		"sub/REUSE.toml": {Data: []byte(`version = 1
+
+[[annotations]]
+path = "*.txt"
+precedence = "aggregate"
+SPDX-FileCopyrightText = "2023 Sub Authors"
+SPDX-License-Identifier = "Apache-2.0"
+`)},
+		"main.go":              {Data: []byte("// SPDX-FileCopyrightText: 2018 Jane Doe\n// SPDX-License-Identifier: MIT\npackage main\n")},
+		"logo.bin":             {Data: []byte("\x7fELF\x00\x00binary")},
+		"logo.bin.license":     {Data: []byte("SPDX-FileCopyrightText: 2017 Jane Doe\nSPDX-License-Identifier: Apache-2.0\n")},
+		"docs/guide.md":        {Data: []byte("# Guide\n")},
+		"assets/icon.png":      {Data: []byte("\x89PNG\r\n\x1a\n\x00\x00")},
+		"gen/out.go":           {Data: []byte("// SPDX-License-Identifier: GPL-2.0-only\npackage gen\n")},
+		"sub/notes.txt":        {Data: []byte("SPDX-License-Identifier: MIT\nCopyright 2016 Jane Doe\n")},
+		"sub/deep/more.txt":    {Data: []byte("more notes\n")},
+		"untracked/nothing.go": {Data: []byte("package nothing\n")},
+	}
+}
+
+func findTestFile(t *testing.T, pkg *spdx.Package2_1, name string) *spdx.File2_1 {
+	for _, f := range pkg.Files {
+		if f.FileName == name {
+			return f
+		}
+	}
+	t.Fatalf("expected file %s, got none", name)
+	return nil
+}
+
+// ===== REUSE tests =====
+func TestSearcherCanApplyREUSEInfo(t *testing.T) {
+	config := &Config{
+		NamespacePrefix: "https://example.com/",
+		REUSE:           true,
+	}
+	doc, err := BuildIDsDocumentFromFS("project", testREUSEFS(), config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	pkg := doc.Packages[0]
+
+	tests := []struct {
+		name       string
+		licenses   string
+		concluded  string
+		copyrights string
+	}{
+		{"/main.go", "MIT", "MIT", "Copyright 2018 Jane Doe"},
+		// the sidecar file replaces the binary's own contents
+		{"/logo.bin", "Apache-2.0", "Apache-2.0", "Copyright 2017 Jane Doe"},
+		// dep5 applies in addition to the file's own information
+		{"/docs/guide.md", "CC0-1.0", "CC0-1.0", "Copyright 2019-2020 Jane Doe"},
+		{"/assets/icon.png", "CC0-1.0", "CC0-1.0", "Copyright 2021 Example Corp."},
+		// override ignores the file's own information
+		{"/gen/out.go", "MIT", "MIT", "Copyright 2022 Generator Authors"},
+		// the closest REUSE.toml applies, with paths relative to it
+		{"/sub/notes.txt", "Apache-2.0 MIT", "Apache-2.0 AND MIT", "Copyright 2016 Jane Doe\nCopyright 2023 Sub Authors"},
+		{"/sub/deep/more.txt", "NOASSERTION", "NOASSERTION", "NOASSERTION"},
+		{"/untracked/nothing.go", "NOASSERTION", "NOASSERTION", "NOASSERTION"},
+	}
+	for _, tt := range tests {
+		f := findTestFile(t, pkg, tt.name)
+		if strings.Join(f.LicenseInfoInFile, " ") != tt.licenses {
+			t.Errorf("expected %v for %s, got %v", tt.licenses, tt.name, f.LicenseInfoInFile)
+		}
+		if f.LicenseConcluded != tt.concluded {
+			t.Errorf("expected %v for %s, got %v", tt.concluded, tt.name, f.LicenseConcluded)
+		}
+		if f.FileCopyrightText != tt.copyrights {
+			t.Errorf("expected %q for %s, got %q", tt.copyrights, tt.name, f.FileCopyrightText)
+		}
+	}
+
+	if !strings.Contains(pkg.PackageCopyrightText, "Copyright 2016-2020 Jane Doe") {
+		t.Errorf("expected merged package copyright text, got %q", pkg.PackageCopyrightText)
+	}
+}
+
+func TestSearcherIgnoresREUSEInfoWhenDisabled(t *testing.T) {
+	doc, err := BuildIDsDocumentFromFS("project", testREUSEFS(), &Config{NamespacePrefix: "https://example.com/"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	f := findTestFile(t, doc.Packages[0], "/gen/out.go")
+	if f.LicenseConcluded != "GPL-2.0-only" {
+		t.Errorf("expected %v, got %v", "GPL-2.0-only", f.LicenseConcluded)
+	}
+	if f.FileCopyrightText != "NOASSERTION" {
+		t.Errorf("expected %v, got %v", "NOASSERTION", f.FileCopyrightText)
+	}
+}
+
+func TestSearcherFailsWithInvalidREUSETOML(t *testing.T) {
+	fsys := fstest.MapFS{
+		"REUSE.toml": {Data: []byte("version = 2\n")},
+		"a.go":       {Data: []byte("package a\n")},
+	}
+	_, err := BuildIDsDocumentFromFS("project", fsys, &Config{NamespacePrefix: "https://example.com/", REUSE: true})
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestCanLintREUSE(t *testing.T) {
+	fsys := testREUSEFS()
+	config := &Config{
+		NamespacePrefix: "https://example.com/",
+		REUSE:           true,
+	}
+	doc, err := BuildIDsDocumentFromFS("project", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	report, err := LintREUSE(fsys, doc)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if report.Compliant() {
+		t.Errorf("expected non-compliant report, got compliant")
+	}
+	want := "/sub/deep/more.txt /untracked/nothing.go"
+	if strings.Join(report.MissingLicense, " ") != want {
+		t.Errorf("expected %v, got %v", want, report.MissingLicense)
+	}
+	if strings.Join(report.MissingCopyright, " ") != want {
+		t.Errorf("expected %v, got %v", want, report.MissingCopyright)
+	}
+	if len(report.MissingLicenseTexts) != 0 {
+		t.Errorf("expected no missing license texts, got %v", report.MissingLicenseTexts)
+	}
+	if len(report.UnusedLicenseTexts) != 0 {
+		t.Errorf("expected no unused license texts, got %v", report.UnusedLicenseTexts)
+	}
+
+	delete(fsys, "LICENSES/MIT.txt")
+	fsys["LICENSES/GPL-3.0-only.txt"] = &fstest.MapFile{Data: []byte("GPL text\n")}
+	delete(fsys, "sub/deep/more.txt")
+	delete(fsys, "untracked/nothing.go")
+	doc, err = BuildIDsDocumentFromFS("project", fsys, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	report, err = LintREUSE(fsys, doc)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(report.MissingLicense) != 0 || len(report.MissingCopyright) != 0 {
+		t.Errorf("expected no files missing information, got %v and %v", report.MissingLicense, report.MissingCopyright)
+	}
+	if strings.Join(report.MissingLicenseTexts, " ") != "MIT" {
+		t.Errorf("expected %v, got %v", "[MIT]", report.MissingLicenseTexts)
+	}
+	if strings.Join(report.UnusedLicenseTexts, " ") != "LICENSES/GPL-3.0-only.txt" {
+		t.Errorf("expected %v, got %v", "[LICENSES/GPL-3.0-only.txt]", report.UnusedLicenseTexts)
+	}
+}
+
+func TestCanConvertREUSEGlobs(t *testing.T) {
+	tests := []struct {
+		glob    string
+		dep5    bool
+		path    string
+		matches bool
+	}{
+		{"docs/*", true, "docs/a/b.md", true},
+		{"*.md", true, "docs/a.md", true},
+		{"file?.c", true, "file1.c", true},
+		{`a\*b`, true, "axxb", false},
+		{"*.md", false, "docs/a.md", false},
+		{"**/*.md", false, "docs/a.md", true},
+		{"docs/**", false, "docs/a/b.md", true},
+		{"*.txt", false, "notes.txt", true},
+	}
+	for _, tt := range tests {
+		expr := reuseGlobToRegexp(tt.glob)
+		if tt.dep5 {
+			expr = dep5GlobToRegexp(tt.glob)
+		}
+		a := &reuseAnnotation{}
+		a.patterns = append(a.patterns, regexpMustCompile(t, "^"+expr+"$"))
+		if a.matches(tt.path) != tt.matches {
+			t.Errorf("expected %v for %s matching %s, got %v", tt.matches, tt.glob, tt.path, !tt.matches)
+		}
+	}
+}
+
+func regexpMustCompile(t *testing.T, expr string) *regexp.Regexp {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return re
+}
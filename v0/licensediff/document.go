@@ -0,0 +1,402 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package licensediff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ChangeKind is whether an element was added, removed or changed between
+// two SPDX Documents.
+type ChangeKind string
+
+// The kinds of Change.
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// Section is the part of an SPDX Document that a Change is in.
+type Section string
+
+// The Sections compared by DiffDocuments.
+const (
+	SectionCreationInfo Section = "CreationInfo"
+	SectionPackage      Section = "Package"
+	SectionFile         Section = "File"
+	SectionOtherLicense Section = "OtherLicense"
+	SectionRelationship Section = "Relationship"
+)
+
+// Change is a single difference between two SPDX Documents.
+type Change struct {
+	Kind    ChangeKind
+	Section Section
+	// Package is the ID of the Package containing a File, for Changes in
+	// SectionFile.
+	Package string
+	// ID identifies the element: for a Package, its PackageName, or
+	// "PackageName@PackageVersion" if several Packages share the name; a
+	// FileName or LicenseIdentifier; "A RELATIONSHIP B" for a
+	// Relationship, with each side given as "DOCUMENT", a Package's ID or
+	// "PackageID:FileName"; or "" for the CreationInfo.
+	ID string
+	// Field is the name of the changed field, for Changes of kind Changed.
+	Field string
+	// First and Second are the field's values in the first and second
+	// Documents, for Changes of kind Changed. Lists of values are sorted
+	// and joined with ", ".
+	First  string
+	Second string
+}
+
+func (c Change) String() string {
+	id := c.ID
+	if c.Package != "" {
+		id = c.Package + ":" + c.ID
+	}
+	s := fmt.Sprintf("%s %s", c.Kind, c.Section)
+	if id != "" {
+		s += fmt.Sprintf(" %q", id)
+	}
+	if c.Kind == Changed {
+		s += fmt.Sprintf(" %s: %q -> %q", c.Field, c.First, c.Second)
+	}
+	return s
+}
+
+// field is a named field of an element, with its values in the first and
+// second Documents.
+type field struct {
+	name   string
+	first  string
+	second string
+}
+
+// DiffDocuments compares two SPDX Documents, and returns the differences
+// between them: in their CreationInfo, Packages (matched by PackageName, or
+// by PackageName and PackageVersion where several Packages share a name),
+// Files (matched by FileName within each Package present in both),
+// OtherLicenses (matched by LicenseIdentifier) and Relationships (matched
+// by the Packages and Files they relate, rather than by their SPDX
+// identifiers, which may differ between builds). The Changes are given in
+// that order, sorted by ID, with the Changes to the Files of each Package
+// right after those to the Package itself. Files of a Package that was
+// added or removed are not listed separately. An error is returned if a
+// Document has two Packages with the same name and version.
+func DiffDocuments(d1 *spdx.Document2_1, d2 *spdx.Document2_1) ([]Change, error) {
+	if d1 == nil || d2 == nil {
+		return nil, fmt.Errorf("got nil Document")
+	}
+	changes := []Change{}
+	changes = append(changes, diffCreationInfo(d1.CreationInfo, d2.CreationInfo)...)
+
+	// packages, each followed by the changes to its files
+	versioned := sharedPackageNames(d1, d2)
+	pkgs1, err := packagesByID(d1, versioned)
+	if err != nil {
+		return nil, err
+	}
+	pkgs2, err := packagesByID(d2, versioned)
+	if err != nil {
+		return nil, err
+	}
+	pkgNames := map[string]bool{}
+	for id := range pkgs1 {
+		pkgNames[id] = true
+	}
+	for id := range pkgs2 {
+		pkgNames[id] = true
+	}
+	for _, name := range sortedKeys(pkgNames) {
+		p1, ok1 := pkgs1[name]
+		p2, ok2 := pkgs2[name]
+		switch {
+		case !ok2:
+			changes = append(changes, Change{Kind: Removed, Section: SectionPackage, ID: name})
+		case !ok1:
+			changes = append(changes, Change{Kind: Added, Section: SectionPackage, ID: name})
+		default:
+			changes = append(changes, diffFields(SectionPackage, "", name, packageFields(p1, p2))...)
+			changes = append(changes, diffFiles(name, p1.Files, p2.Files)...)
+		}
+	}
+
+	// other licenses
+	licIDs := map[string]bool{}
+	lics1 := map[string]*spdx.OtherLicense2_1{}
+	for _, ol := range d1.OtherLicenses {
+		lics1[ol.LicenseIdentifier] = ol
+		licIDs[ol.LicenseIdentifier] = true
+	}
+	lics2 := map[string]*spdx.OtherLicense2_1{}
+	for _, ol := range d2.OtherLicenses {
+		lics2[ol.LicenseIdentifier] = ol
+		licIDs[ol.LicenseIdentifier] = true
+	}
+	for _, id := range sortedKeys(licIDs) {
+		ol1, ok1 := lics1[id]
+		ol2, ok2 := lics2[id]
+		switch {
+		case !ok2:
+			changes = append(changes, Change{Kind: Removed, Section: SectionOtherLicense, ID: id})
+		case !ok1:
+			changes = append(changes, Change{Kind: Added, Section: SectionOtherLicense, ID: id})
+		default:
+			changes = append(changes, diffFields(SectionOtherLicense, "", id, []field{
+				{"LicenseName", ol1.LicenseName, ol2.LicenseName},
+				{"ExtractedText", ol1.ExtractedText, ol2.ExtractedText},
+				{"LicenseCrossReferences", joinSorted(ol1.LicenseCrossReferences), joinSorted(ol2.LicenseCrossReferences)},
+				{"LicenseComment", ol1.LicenseComment, ol2.LicenseComment},
+			})...)
+		}
+	}
+
+	// relationships
+	relIDs := map[string]bool{}
+	rels1 := map[string]*spdx.Relationship2_1{}
+	elements1 := elementIDs(pkgs1)
+	for _, rln := range d1.Relationships {
+		id := relationshipID(rln, elements1)
+		rels1[id] = rln
+		relIDs[id] = true
+	}
+	rels2 := map[string]*spdx.Relationship2_1{}
+	elements2 := elementIDs(pkgs2)
+	for _, rln := range d2.Relationships {
+		id := relationshipID(rln, elements2)
+		rels2[id] = rln
+		relIDs[id] = true
+	}
+	for _, id := range sortedKeys(relIDs) {
+		r1, ok1 := rels1[id]
+		r2, ok2 := rels2[id]
+		switch {
+		case !ok2:
+			changes = append(changes, Change{Kind: Removed, Section: SectionRelationship, ID: id})
+		case !ok1:
+			changes = append(changes, Change{Kind: Added, Section: SectionRelationship, ID: id})
+		default:
+			changes = append(changes, diffFields(SectionRelationship, "", id, []field{
+				{"RelationshipComment", r1.RelationshipComment, r2.RelationshipComment},
+			})...)
+		}
+	}
+
+	return changes, nil
+}
+
+func diffCreationInfo(ci1 *spdx.CreationInfo2_1, ci2 *spdx.CreationInfo2_1) []Change {
+	if ci1 == nil {
+		ci1 = &spdx.CreationInfo2_1{}
+	}
+	if ci2 == nil {
+		ci2 = &spdx.CreationInfo2_1{}
+	}
+	return diffFields(SectionCreationInfo, "", "", []field{
+		{"SPDXVersion", ci1.SPDXVersion, ci2.SPDXVersion},
+		{"DataLicense", ci1.DataLicense, ci2.DataLicense},
+		{"SPDXIdentifier", ci1.SPDXIdentifier, ci2.SPDXIdentifier},
+		{"DocumentName", ci1.DocumentName, ci2.DocumentName},
+		{"DocumentNamespace", ci1.DocumentNamespace, ci2.DocumentNamespace},
+		{"ExternalDocumentReferences", joinSorted(ci1.ExternalDocumentReferences), joinSorted(ci2.ExternalDocumentReferences)},
+		{"LicenseListVersion", ci1.LicenseListVersion, ci2.LicenseListVersion},
+		{"CreatorPersons", joinSorted(ci1.CreatorPersons), joinSorted(ci2.CreatorPersons)},
+		{"CreatorOrganizations", joinSorted(ci1.CreatorOrganizations), joinSorted(ci2.CreatorOrganizations)},
+		{"CreatorTools", joinSorted(ci1.CreatorTools), joinSorted(ci2.CreatorTools)},
+		{"Created", ci1.Created, ci2.Created},
+		{"CreatorComment", ci1.CreatorComment, ci2.CreatorComment},
+		{"DocumentComment", ci1.DocumentComment, ci2.DocumentComment},
+	})
+}
+
+func packageFields(p1 *spdx.Package2_1, p2 *spdx.Package2_1) []field {
+	return []field{
+		{"PackageVersion", p1.PackageVersion, p2.PackageVersion},
+		{"PackageFileName", p1.PackageFileName, p2.PackageFileName},
+		{"PackageSupplier", supplier(p1), supplier(p2)},
+		{"PackageOriginator", originator(p1), originator(p2)},
+		{"PackageDownloadLocation", p1.PackageDownloadLocation, p2.PackageDownloadLocation},
+		{"PackageVerificationCode", p1.PackageVerificationCode, p2.PackageVerificationCode},
+		{"PackageChecksumSHA1", p1.PackageChecksumSHA1, p2.PackageChecksumSHA1},
+		{"PackageChecksumSHA256", p1.PackageChecksumSHA256, p2.PackageChecksumSHA256},
+		{"PackageChecksumMD5", p1.PackageChecksumMD5, p2.PackageChecksumMD5},
+		{"PackageHomePage", p1.PackageHomePage, p2.PackageHomePage},
+		{"PackageLicenseConcluded", p1.PackageLicenseConcluded, p2.PackageLicenseConcluded},
+		{"PackageLicenseInfoFromFiles", joinSorted(p1.PackageLicenseInfoFromFiles), joinSorted(p2.PackageLicenseInfoFromFiles)},
+		{"PackageLicenseDeclared", p1.PackageLicenseDeclared, p2.PackageLicenseDeclared},
+		{"PackageCopyrightText", p1.PackageCopyrightText, p2.PackageCopyrightText},
+		{"PackageExternalReferences", externalRefs(p1), externalRefs(p2)},
+	}
+}
+
+// sharedPackageNames returns the PackageNames that are used by more than
+// one Package in either Document.
+func sharedPackageNames(docs ...*spdx.Document2_1) map[string]bool {
+	shared := map[string]bool{}
+	for _, doc := range docs {
+		seen := map[string]bool{}
+		for _, pkg := range doc.Packages {
+			if seen[pkg.PackageName] {
+				shared[pkg.PackageName] = true
+			}
+			seen[pkg.PackageName] = true
+		}
+	}
+	return shared
+}
+
+// packagesByID returns a Document's Packages keyed by their IDs: the
+// PackageName, with the PackageVersion added for the names in versioned.
+func packagesByID(doc *spdx.Document2_1, versioned map[string]bool) (map[string]*spdx.Package2_1, error) {
+	pkgs := map[string]*spdx.Package2_1{}
+	for _, pkg := range doc.Packages {
+		id := pkg.PackageName
+		if versioned[id] {
+			id += "@" + pkg.PackageVersion
+		}
+		if _, ok := pkgs[id]; ok {
+			return nil, fmt.Errorf("more than one Package %q in Document", id)
+		}
+		pkgs[id] = pkg
+	}
+	return pkgs, nil
+}
+
+// elementIDs maps the SPDX identifiers of a Document's Packages and Files
+// to the IDs they have in Changes, so that Relationships can be matched
+// by what they relate.
+func elementIDs(pkgs map[string]*spdx.Package2_1) map[string]string {
+	ids := map[string]string{"SPDXRef-DOCUMENT": "DOCUMENT"}
+	for pkgID, pkg := range pkgs {
+		if pkg.PackageSPDXIdentifier != "" {
+			ids[pkg.PackageSPDXIdentifier] = pkgID
+		}
+		for _, f := range pkg.Files {
+			if f.FileSPDXIdentifier != "" {
+				ids[f.FileSPDXIdentifier] = pkgID + ":" + f.FileName
+			}
+		}
+	}
+	return ids
+}
+
+// externalRefs returns a Package's external references in tag-value form,
+// sorted and joined.
+func externalRefs(p *spdx.Package2_1) string {
+	refs := []string{}
+	for _, ref := range p.PackageExternalReferences {
+		refs = append(refs, fmt.Sprintf("%s %s %s", ref.Category, ref.RefType, ref.Locator))
+	}
+	return joinSorted(refs)
+}
+
+// diffFiles compares the Files of a Package that is in both Documents.
+func diffFiles(pkgName string, files1 []*spdx.File2_1, files2 []*spdx.File2_1) []Change {
+	changes := []Change{}
+	fileNames := map[string]bool{}
+	byName1 := map[string]*spdx.File2_1{}
+	for _, f := range files1 {
+		byName1[f.FileName] = f
+		fileNames[f.FileName] = true
+	}
+	byName2 := map[string]*spdx.File2_1{}
+	for _, f := range files2 {
+		byName2[f.FileName] = f
+		fileNames[f.FileName] = true
+	}
+	for _, name := range sortedKeys(fileNames) {
+		f1, ok1 := byName1[name]
+		f2, ok2 := byName2[name]
+		switch {
+		case !ok2:
+			changes = append(changes, Change{Kind: Removed, Section: SectionFile, Package: pkgName, ID: name})
+		case !ok1:
+			changes = append(changes, Change{Kind: Added, Section: SectionFile, Package: pkgName, ID: name})
+		default:
+			changes = append(changes, diffFields(SectionFile, pkgName, name, []field{
+				{"FileChecksumSHA1", f1.FileChecksumSHA1, f2.FileChecksumSHA1},
+				{"FileChecksumSHA256", f1.FileChecksumSHA256, f2.FileChecksumSHA256},
+				{"FileChecksumMD5", f1.FileChecksumMD5, f2.FileChecksumMD5},
+				{"LicenseConcluded", f1.LicenseConcluded, f2.LicenseConcluded},
+				{"LicenseInfoInFile", joinSorted(f1.LicenseInfoInFile), joinSorted(f2.LicenseInfoInFile)},
+				{"FileCopyrightText", f1.FileCopyrightText, f2.FileCopyrightText},
+			})...)
+		}
+	}
+	return changes
+}
+
+// diffFields returns a Change for each of fields whose values differ.
+func diffFields(section Section, pkgName string, id string, fields []field) []Change {
+	changes := []Change{}
+	for _, fld := range fields {
+		if fld.first != fld.second {
+			changes = append(changes, Change{
+				Kind:    Changed,
+				Section: section,
+				Package: pkgName,
+				ID:      id,
+				Field:   fld.name,
+				First:   fld.first,
+				Second:  fld.second,
+			})
+		}
+	}
+	return changes
+}
+
+func supplier(p *spdx.Package2_1) string {
+	return agent(p.PackageSupplierPerson, p.PackageSupplierOrganization, p.PackageSupplierNOASSERTION)
+}
+
+func originator(p *spdx.Package2_1) string {
+	return agent(p.PackageOriginatorPerson, p.PackageOriginatorOrganization, p.PackageOriginatorNOASSERTION)
+}
+
+// agent returns a Package supplier or originator in tag-value form.
+func agent(person string, organization string, noassertion bool) string {
+	switch {
+	case person != "":
+		return "Person: " + person
+	case organization != "":
+		return "Organization: " + organization
+	case noassertion:
+		return "NOASSERTION"
+	}
+	return ""
+}
+
+// relationshipID identifies a Relationship by its type and the elements it
+// relates. Elements not in ids, such as those in other Documents, are given
+// by their SPDX identifiers.
+func relationshipID(rln *spdx.Relationship2_1, ids map[string]string) string {
+	a, b := rln.RefA, rln.RefB
+	if id, ok := ids[a]; ok {
+		a = id
+	}
+	if id, ok := ids[b]; ok {
+		b = id
+	}
+	return fmt.Sprintf("%s %s %s", a, rln.Relationship, b)
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package licensediff
+
+import (
+	"testing"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Document diff tests =====
+func TestDifferCanDiffDocuments(t *testing.T) {
+	d1 := &spdx.Document2_1{
+		CreationInfo: &spdx.CreationInfo2_1{
+			SPDXVersion:  "SPDX-2.1",
+			DocumentName: "project-1.0",
+			CreatorTools: []string{"b", "a"},
+			Created:      "2019-01-01T00:00:00Z",
+		},
+		Packages: []*spdx.Package2_1{
+			{
+				PackageName:                 "project",
+				PackageSPDXIdentifier:       "SPDXRef-Package-1",
+				PackageVersion:              "1.0",
+				PackageSupplierOrganization: "Example Inc.",
+				PackageChecksumSHA1:         "aaaa",
+				PackageLicenseDeclared:      "MIT",
+				PackageLicenseInfoFromFiles: []string{"MIT", "Apache-2.0"},
+				Files: []*spdx.File2_1{
+					{FileName: "/a.c", FileSPDXIdentifier: "SPDXRef-File0", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+					{FileName: "/b.c", FileSPDXIdentifier: "SPDXRef-File1", FileChecksumSHA1: "2222", LicenseConcluded: "MIT"},
+				},
+			},
+			{PackageName: "old-dep", PackageSPDXIdentifier: "SPDXRef-Package-2"},
+		},
+		OtherLicenses: []*spdx.OtherLicense2_1{
+			{LicenseIdentifier: "LicenseRef-1", ExtractedText: "old text"},
+			{LicenseIdentifier: "LicenseRef-2", ExtractedText: "same"},
+		},
+		Relationships: []*spdx.Relationship2_1{
+			{RefA: "SPDXRef-DOCUMENT", RefB: "SPDXRef-Package-1", Relationship: "DESCRIBES"},
+			{RefA: "SPDXRef-Package-1", RefB: "SPDXRef-Package-2", Relationship: "DEPENDS_ON"},
+			{RefA: "SPDXRef-File1", RefB: "SPDXRef-File0", Relationship: "OTHER"},
+		},
+	}
+	d2 := &spdx.Document2_1{
+		CreationInfo: &spdx.CreationInfo2_1{
+			SPDXVersion:  "SPDX-2.1",
+			DocumentName: "project-1.1",
+			CreatorTools: []string{"a", "b"},
+			Created:      "2020-01-01T00:00:00Z",
+		},
+		Packages: []*spdx.Package2_1{
+			{
+				PackageName:                 "project",
+				PackageSPDXIdentifier:       "SPDXRef-Package-2",
+				PackageVersion:              "1.1",
+				PackageSupplierNOASSERTION:  true,
+				PackageChecksumSHA1:         "bbbb",
+				PackageLicenseDeclared:      "MIT",
+				PackageLicenseInfoFromFiles: []string{"Apache-2.0", "MIT"},
+				Files: []*spdx.File2_1{
+					{FileName: "/a.c", FileSPDXIdentifier: "SPDXRef-File2", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+					{FileName: "/b.c", FileSPDXIdentifier: "SPDXRef-File3", FileChecksumSHA1: "3333", LicenseConcluded: "MIT"},
+					{FileName: "/c.c", FileChecksumSHA1: "4444", LicenseConcluded: "MIT"},
+				},
+			},
+			{PackageName: "new-dep", PackageSPDXIdentifier: "SPDXRef-Package-1"},
+		},
+		OtherLicenses: []*spdx.OtherLicense2_1{
+			{LicenseIdentifier: "LicenseRef-1", ExtractedText: "new text"},
+			{LicenseIdentifier: "LicenseRef-2", ExtractedText: "same"},
+		},
+		Relationships: []*spdx.Relationship2_1{
+			{RefA: "SPDXRef-DOCUMENT", RefB: "SPDXRef-Package-2", Relationship: "DESCRIBES", RelationshipComment: "main"},
+			{RefA: "SPDXRef-Package-2", RefB: "SPDXRef-Package-1", Relationship: "DEPENDS_ON"},
+			{RefA: "SPDXRef-File3", RefB: "SPDXRef-File2", Relationship: "OTHER"},
+		},
+	}
+
+	changes, err := DiffDocuments(d1, d2)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want := []Change{
+		{Kind: Changed, Section: SectionCreationInfo, Field: "DocumentName", First: "project-1.0", Second: "project-1.1"},
+		{Kind: Changed, Section: SectionCreationInfo, Field: "Created", First: "2019-01-01T00:00:00Z", Second: "2020-01-01T00:00:00Z"},
+		{Kind: Added, Section: SectionPackage, ID: "new-dep"},
+		{Kind: Removed, Section: SectionPackage, ID: "old-dep"},
+		{Kind: Changed, Section: SectionPackage, ID: "project", Field: "PackageVersion", First: "1.0", Second: "1.1"},
+		{Kind: Changed, Section: SectionPackage, ID: "project", Field: "PackageSupplier", First: "Organization: Example Inc.", Second: "NOASSERTION"},
+		{Kind: Changed, Section: SectionPackage, ID: "project", Field: "PackageChecksumSHA1", First: "aaaa", Second: "bbbb"},
+		{Kind: Changed, Section: SectionFile, Package: "project", ID: "/b.c", Field: "FileChecksumSHA1", First: "2222", Second: "3333"},
+		{Kind: Added, Section: SectionFile, Package: "project", ID: "/c.c"},
+		{Kind: Changed, Section: SectionOtherLicense, ID: "LicenseRef-1", Field: "ExtractedText", First: "old text", Second: "new text"},
+		{Kind: Changed, Section: SectionRelationship, ID: "DOCUMENT DESCRIBES project", Field: "RelationshipComment", First: "", Second: "main"},
+		{Kind: Added, Section: SectionRelationship, ID: "project DEPENDS_ON new-dep"},
+		{Kind: Removed, Section: SectionRelationship, ID: "project DEPENDS_ON old-dep"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %d: %v", len(want), len(changes), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], changes[i])
+		}
+	}
+}
+
+func TestDifferMatchesPackagesSharingANameByVersion(t *testing.T) {
+	d1 := &spdx.Document2_1{
+		Packages: []*spdx.Package2_1{
+			{PackageName: "lodash", PackageVersion: "4.17.20", PackageSPDXIdentifier: "SPDXRef-Package-1", PackageLicenseDeclared: "MIT"},
+			{PackageName: "lodash", PackageVersion: "3.10.1", PackageSPDXIdentifier: "SPDXRef-Package-2", PackageLicenseDeclared: "MIT"},
+		},
+	}
+	d2 := &spdx.Document2_1{
+		Packages: []*spdx.Package2_1{
+			{PackageName: "lodash", PackageVersion: "3.10.1", PackageSPDXIdentifier: "SPDXRef-Package-1", PackageLicenseDeclared: "MIT"},
+			{
+				PackageName:            "lodash",
+				PackageVersion:         "4.17.20",
+				PackageSPDXIdentifier:  "SPDXRef-Package-2",
+				PackageLicenseDeclared: "MIT",
+				PackageExternalReferences: []*spdx.PackageExternalReference2_1{
+					{Category: "PACKAGE-MANAGER", RefType: "purl", Locator: "pkg:npm/lodash@4.17.20"},
+				},
+			},
+		},
+	}
+
+	changes, err := DiffDocuments(d1, d2)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want := []Change{
+		{Kind: Changed, Section: SectionPackage, ID: "lodash@4.17.20", Field: "PackageExternalReferences", First: "", Second: "PACKAGE-MANAGER purl pkg:npm/lodash@4.17.20"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %d: %v", len(want), len(changes), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], changes[i])
+		}
+	}
+}
+
+func TestDifferFailsForDuplicatePackages(t *testing.T) {
+	d1 := &spdx.Document2_1{
+		Packages: []*spdx.Package2_1{
+			{PackageName: "lodash", PackageVersion: "4.17.20"},
+			{PackageName: "lodash", PackageVersion: "4.17.20"},
+		},
+	}
+	_, err := DiffDocuments(d1, &spdx.Document2_1{})
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestDifferFindsNoChangesInSameDocument(t *testing.T) {
+	doc := &spdx.Document2_1{
+		Packages: []*spdx.Package2_1{
+			{PackageName: "p", Files: []*spdx.File2_1{{FileName: "/a.c", FileChecksumSHA1: "1111"}}},
+		},
+	}
+	changes, err := DiffDocuments(doc, doc)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestDifferCanDiffDocumentsWithoutCreationInfo(t *testing.T) {
+	d2 := &spdx.Document2_1{CreationInfo: &spdx.CreationInfo2_1{SPDXVersion: "SPDX-2.1"}}
+	changes, err := DiffDocuments(&spdx.Document2_1{}, d2)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(changes) != 1 || changes[0].Field != "SPDXVersion" || changes[0].Second != "SPDX-2.1" {
+		t.Errorf("expected SPDXVersion change, got %v", changes)
+	}
+}
+
+func TestDifferFailsToDiffNilDocument(t *testing.T) {
+	_, err := DiffDocuments(nil, &spdx.Document2_1{})
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestChangeCanBeRendered(t *testing.T) {
+	c := Change{Kind: Changed, Section: SectionFile, Package: "p", ID: "/a.c", Field: "LicenseConcluded", First: "MIT", Second: "BSD-2-Clause"}
+	want := `changed File "p:/a.c" LicenseConcluded: "MIT" -> "BSD-2-Clause"`
+	if c.String() != want {
+		t.Errorf("expected %v, got %v", want, c.String())
+	}
+	c = Change{Kind: Added, Section: SectionPackage, ID: "dep"}
+	want = `added Package "dep"`
+	if c.String() != want {
+		t.Errorf("expected %v, got %v", want, c.String())
+	}
+}
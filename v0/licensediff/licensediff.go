@@ -1,5 +1,6 @@
 // Package licensediff is used to generate a "diff" between the concluded
-// licenses in two SPDX Packages, using the filename as the match point.
+// licenses in two SPDX Packages, using the filename as the match point, or
+// between two whole SPDX Documents.
 // SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
 package licensediff
 
@@ -50,16 +51,25 @@ type LicenseDiff struct {
 	InBothSame    map[string]string
 	InFirstOnly   map[string]string
 	InSecondOnly  map[string]string
+
+	// Renamed and RenamedModified are filled in only by MakeRenameResults,
+	// keyed by the filename in the first Package. Renamed files have the
+	// same SHA1 checksum in both Packages, and RenamedModified files were
+	// matched by their similar paths.
+	Renamed         map[string]RenamedFile
+	RenamedModified map[string]RenamedFile
 }
 
 // MakeResults creates a more structured set of results from the output
 // of MakePairs.
 func MakeResults(pairs map[string]LicensePair) (*LicenseDiff, error) {
 	diff := &LicenseDiff{
-		InBothChanged: map[string]LicensePair{},
-		InBothSame:    map[string]string{},
-		InFirstOnly:   map[string]string{},
-		InSecondOnly:  map[string]string{},
+		InBothChanged:   map[string]LicensePair{},
+		InBothSame:      map[string]string{},
+		InFirstOnly:     map[string]string{},
+		InSecondOnly:    map[string]string{},
+		Renamed:         map[string]RenamedFile{},
+		RenamedModified: map[string]RenamedFile{},
 	}
 
 	// walk through pairs and allocate them where they belong
@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package licensediff
+
+import (
+	"path"
+	"sort"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// DefaultMinPathSimilarity is the PathSimilarity that two paths need to
+// reach to be matched, if RenameConfig.MinPathSimilarity is not set.
+const DefaultMinPathSimilarity = 0.6
+
+// RenamedFile is a file that has different filenames in two SPDX Packages.
+type RenamedFile struct {
+	FirstName  string
+	SecondName string
+	// Licenses are the file's concluded licenses in the two Packages.
+	Licenses LicensePair
+}
+
+// RenameConfig is a collection of configuration settings for
+// MakeRenameResults.
+type RenameConfig struct {
+	// MatchPaths also pairs up files whose contents differ, if their
+	// paths are similar enough.
+	MatchPaths bool
+
+	// MinPathSimilarity is the lowest PathSimilarity, from 0 to 1, for
+	// files to be paired by MatchPaths. If 0, DefaultMinPathSimilarity is
+	// used.
+	MinPathSimilarity float64
+}
+
+// MakeRenameResults creates structured results like MakeResults, but also
+// pairs up files that would otherwise be only in the first or only in the
+// second Package. Files with the same FileChecksumSHA1 are paired first,
+// and reported in Renamed. Then, if config.MatchPaths is set, files with
+// the same extension and similar paths are paired and reported in
+// RenamedModified. Where a file could be paired with several others, the
+// most similar paths are paired first. A nil config matches by checksum
+// only.
+func MakeRenameResults(p1 *spdx.Package2_1, p2 *spdx.Package2_1, config *RenameConfig) (*LicenseDiff, error) {
+	pairs, err := MakePairs(p1, p2)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := MakeResults(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	// only files that are in just one of the Packages can be renamed
+	firstOnly := []*spdx.File2_1{}
+	for _, f := range p1.Files {
+		if _, ok := diff.InFirstOnly[f.FileName]; ok {
+			firstOnly = append(firstOnly, f)
+		}
+	}
+	secondOnly := []*spdx.File2_1{}
+	for _, f := range p2.Files {
+		if _, ok := diff.InSecondOnly[f.FileName]; ok {
+			secondOnly = append(secondOnly, f)
+		}
+	}
+
+	if config == nil {
+		config = &RenameConfig{}
+	}
+
+	// first pair up files with the same contents, looking them up by
+	// checksum; the similarity of their paths only decides between
+	// several files with the same contents
+	bySHA1 := map[string][]*spdx.File2_1{}
+	for _, f2 := range secondOnly {
+		if f2.FileChecksumSHA1 != "" {
+			bySHA1[f2.FileChecksumSHA1] = append(bySHA1[f2.FileChecksumSHA1], f2)
+		}
+	}
+	candidates := []renameCandidate{}
+	for _, f1 := range firstOnly {
+		if f1.FileChecksumSHA1 == "" {
+			continue
+		}
+		for _, f2 := range bySHA1[f1.FileChecksumSHA1] {
+			candidates = append(candidates, renameCandidate{f1, f2, PathSimilarity(f1.FileName, f2.FileName)})
+		}
+	}
+	pairRenames(diff, candidates, diff.Renamed)
+
+	if !config.MatchPaths {
+		return diff, nil
+	}
+
+	// then pair up the remaining files by the similarity of their paths
+	minSimilarity := config.MinPathSimilarity
+	if minSimilarity <= 0 {
+		minSimilarity = DefaultMinPathSimilarity
+	}
+	candidates = []renameCandidate{}
+	for _, f1 := range firstOnly {
+		if _, ok := diff.InFirstOnly[f1.FileName]; !ok {
+			continue
+		}
+		for _, f2 := range secondOnly {
+			if _, ok := diff.InSecondOnly[f2.FileName]; !ok {
+				continue
+			}
+			if path.Ext(f1.FileName) != path.Ext(f2.FileName) {
+				continue
+			}
+			// the similarity can be no more than the ratio of the lengths,
+			// so skip the comparison if that is already too low
+			if lengthRatio(f1.FileName, f2.FileName) < minSimilarity {
+				continue
+			}
+			similarity := PathSimilarity(f1.FileName, f2.FileName)
+			if similarity < minSimilarity {
+				continue
+			}
+			candidates = append(candidates, renameCandidate{f1, f2, similarity})
+		}
+	}
+	pairRenames(diff, candidates, diff.RenamedModified)
+
+	return diff, nil
+}
+
+// pairRenames pairs up the files in candidates, most similar paths first,
+// so that the result doesn't depend on the order of the files. Each pair
+// is removed from diff's InFirstOnly and InSecondOnly and added to
+// renamed, keyed by the first file's name.
+func pairRenames(diff *LicenseDiff, candidates []renameCandidate, renamed map[string]RenamedFile) {
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if ci.similarity != cj.similarity {
+			return ci.similarity > cj.similarity
+		}
+		if ci.first.FileName != cj.first.FileName {
+			return ci.first.FileName < cj.first.FileName
+		}
+		return ci.second.FileName < cj.second.FileName
+	})
+
+	for _, c := range candidates {
+		firstLic, ok1 := diff.InFirstOnly[c.first.FileName]
+		secondLic, ok2 := diff.InSecondOnly[c.second.FileName]
+		if !ok1 || !ok2 {
+			// already paired with another file
+			continue
+		}
+		delete(diff.InFirstOnly, c.first.FileName)
+		delete(diff.InSecondOnly, c.second.FileName)
+
+		renamed[c.first.FileName] = RenamedFile{
+			FirstName:  c.first.FileName,
+			SecondName: c.second.FileName,
+			Licenses:   LicensePair{First: firstLic, Second: secondLic},
+		}
+	}
+}
+
+// renameCandidate is a possible pairing of a file only in the first
+// Package with one only in the second.
+type renameCandidate struct {
+	first      *spdx.File2_1
+	second     *spdx.File2_1
+	similarity float64
+}
+
+func lengthRatio(a string, b string) float64 {
+	la, lb := len([]rune(a)), len([]rune(b))
+	if la > lb {
+		la, lb = lb, la
+	}
+	if lb == 0 {
+		return 1
+	}
+	return float64(la) / float64(lb)
+}
+
+// PathSimilarity returns how alike two paths are, from 0 for completely
+// different paths to 1 for the same path, based on the number of
+// characters that would need to be inserted, deleted or replaced to turn
+// one into the other.
+func PathSimilarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	// Levenshtein distance, keeping only the previous row
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
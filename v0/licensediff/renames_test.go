@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package licensediff
+
+import (
+	"testing"
+
+	"github.com/spdx/tools-golang/v0/spdx"
+)
+
+// ===== Rename-aware license diff tests =====
+func makeRenameTestPackages() (*spdx.Package2_1, *spdx.Package2_1) {
+	p1 := &spdx.Package2_1{
+		PackageName: "p1",
+		Files: []*spdx.File2_1{
+			{FileName: "/project/same.c", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+			// moved, unchanged
+			{FileName: "/project/src/moved.c", FileChecksumSHA1: "2222", LicenseConcluded: "MIT"},
+			// moved and modified
+			{FileName: "/project/src/parser.c", FileChecksumSHA1: "3333", LicenseConcluded: "GPL-2.0-only"},
+			// removed
+			{FileName: "/project/old/gone.txt", FileChecksumSHA1: "4444", LicenseConcluded: "MIT"},
+		},
+	}
+	p2 := &spdx.Package2_1{
+		PackageName: "p2",
+		Files: []*spdx.File2_1{
+			{FileName: "/project/same.c", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+			{FileName: "/project/lib/moved.c", FileChecksumSHA1: "2222", LicenseConcluded: "MIT"},
+			{FileName: "/project/lib/parser.c", FileChecksumSHA1: "5555", LicenseConcluded: "GPL-2.0-or-later"},
+			// added
+			{FileName: "/project/new/README.md", FileChecksumSHA1: "6666", LicenseConcluded: "CC-BY-4.0"},
+		},
+	}
+	return p1, p2
+}
+
+func TestDifferCanMatchRenamedFilesByChecksum(t *testing.T) {
+	p1, p2 := makeRenameTestPackages()
+
+	diff, err := MakeRenameResults(p1, p2, &RenameConfig{})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(diff.InBothSame) != 1 {
+		t.Errorf("expected %v, got %v", 1, len(diff.InBothSame))
+	}
+	want := RenamedFile{
+		FirstName:  "/project/src/moved.c",
+		SecondName: "/project/lib/moved.c",
+		Licenses:   LicensePair{First: "MIT", Second: "MIT"},
+	}
+	if len(diff.Renamed) != 1 || diff.Renamed["/project/src/moved.c"] != want {
+		t.Errorf("expected %v, got %v", want, diff.Renamed)
+	}
+	if len(diff.RenamedModified) != 0 {
+		t.Errorf("expected no RenamedModified, got %v", diff.RenamedModified)
+	}
+	if len(diff.InFirstOnly) != 2 {
+		t.Errorf("expected %v, got %v", 2, diff.InFirstOnly)
+	}
+	if len(diff.InSecondOnly) != 2 {
+		t.Errorf("expected %v, got %v", 2, diff.InSecondOnly)
+	}
+}
+
+func TestDifferCanMatchRenamedFilesByPath(t *testing.T) {
+	p1, p2 := makeRenameTestPackages()
+
+	diff, err := MakeRenameResults(p1, p2, &RenameConfig{MatchPaths: true})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(diff.Renamed) != 1 {
+		t.Errorf("expected %v, got %v", 1, diff.Renamed)
+	}
+	want := RenamedFile{
+		FirstName:  "/project/src/parser.c",
+		SecondName: "/project/lib/parser.c",
+		Licenses:   LicensePair{First: "GPL-2.0-only", Second: "GPL-2.0-or-later"},
+	}
+	if len(diff.RenamedModified) != 1 || diff.RenamedModified["/project/src/parser.c"] != want {
+		t.Errorf("expected %v, got %v", want, diff.RenamedModified)
+	}
+	if lic, ok := diff.InFirstOnly["/project/old/gone.txt"]; len(diff.InFirstOnly) != 1 || !ok || lic != "MIT" {
+		t.Errorf("expected only %v, got %v", "/project/old/gone.txt", diff.InFirstOnly)
+	}
+	if _, ok := diff.InSecondOnly["/project/new/README.md"]; len(diff.InSecondOnly) != 1 || !ok {
+		t.Errorf("expected only %v, got %v", "/project/new/README.md", diff.InSecondOnly)
+	}
+}
+
+func TestDifferDoesNotMatchDissimilarPaths(t *testing.T) {
+	p1 := &spdx.Package2_1{Files: []*spdx.File2_1{
+		{FileName: "/a/b/c/main.c", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+	}}
+	p2 := &spdx.Package2_1{Files: []*spdx.File2_1{
+		{FileName: "/xyz/util.c", FileChecksumSHA1: "2222", LicenseConcluded: "MIT"},
+	}}
+
+	diff, err := MakeRenameResults(p1, p2, &RenameConfig{MatchPaths: true})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(diff.RenamedModified) != 0 || len(diff.InFirstOnly) != 1 || len(diff.InSecondOnly) != 1 {
+		t.Errorf("expected no match, got %v", diff.RenamedModified)
+	}
+
+	// unless the threshold is low enough
+	diff, err = MakeRenameResults(p1, p2, &RenameConfig{MatchPaths: true, MinPathSimilarity: 0.1})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(diff.RenamedModified) != 1 {
+		t.Errorf("expected %v, got %v", 1, diff.RenamedModified)
+	}
+}
+
+func TestDifferPairsDuplicateChecksumsByPath(t *testing.T) {
+	p1 := &spdx.Package2_1{Files: []*spdx.File2_1{
+		{FileName: "/old/a/LICENSE", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+		{FileName: "/old/b/LICENSE", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+	}}
+	p2 := &spdx.Package2_1{Files: []*spdx.File2_1{
+		{FileName: "/new/b/LICENSE", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+		{FileName: "/new/a/LICENSE", FileChecksumSHA1: "1111", LicenseConcluded: "MIT"},
+	}}
+
+	diff, err := MakeRenameResults(p1, p2, nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if diff.Renamed["/old/a/LICENSE"].SecondName != "/new/a/LICENSE" {
+		t.Errorf("expected %v, got %v", "/new/a/LICENSE", diff.Renamed["/old/a/LICENSE"].SecondName)
+	}
+	if diff.Renamed["/old/b/LICENSE"].SecondName != "/new/b/LICENSE" {
+		t.Errorf("expected %v, got %v", "/new/b/LICENSE", diff.Renamed["/old/b/LICENSE"].SecondName)
+	}
+}
+
+func TestPathSimilarity(t *testing.T) {
+	if s := PathSimilarity("/a/b.c", "/a/b.c"); s != 1 {
+		t.Errorf("expected %v, got %v", 1, s)
+	}
+	if s := PathSimilarity("abcd", "wxyz"); s != 0 {
+		t.Errorf("expected %v, got %v", 0, s)
+	}
+	if s := PathSimilarity("/src/x.c", "/lib/x.c"); s != 0.625 {
+		t.Errorf("expected %v, got %v", 0.625, s)
+	}
+	if s := PathSimilarity("", ""); s != 1 {
+		t.Errorf("expected %v, got %v", 1, s)
+	}
+}
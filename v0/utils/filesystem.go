@@ -7,9 +7,12 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -18,38 +21,263 @@ import (
 // path patterns to ignore), and returns a slice of relative paths to all files
 // in that directory and its subdirectories (excluding those that are ignored).
 func GetAllFilePaths(dirRoot string, pathsIgnored []string) ([]string, error) {
-	// paths is a _pointer_ to a slice -- not just a slice.
-	// this is so that it can be appropriately modified by append
-	// in the sub-function.
-	paths := &[]string{}
-	prefix := strings.TrimSuffix(dirRoot, "/")
+	return GetAllFilePathsFS(DirFS(dirRoot), pathsIgnored)
+}
 
-	err := filepath.Walk(dirRoot, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
+// GetAllFilePathsFS takes a file system (including an optional slice of path
+// patterns to ignore), and returns a slice of paths to all files in it,
+// relative to its root and prefixed with "/" (excluding those that are
+// ignored).
+func GetAllFilePathsFS(fsys fs.FS, pathsIgnored []string) ([]string, error) {
+	return GetAllFilePathsFSWithOptions(fsys, &FilePathOptions{PathsIgnored: pathsIgnored})
+}
+
+// SymlinkPolicy determines how GetAllFilePathsFSWithOptions handles
+// symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinkSkip omits symbolic links entirely. This is the default.
+	SymlinkSkip SymlinkPolicy = iota
+
+	// SymlinkFollow treats links as the files or directories they point
+	// to, reporting their contents under the link's path. Links that would
+	// lead back into one of their own parent directories are skipped, as
+	// are links whose target does not exist.
+	SymlinkFollow
+
+	// SymlinkRecord reports each link as a file of its own, without
+	// following it.
+	SymlinkRecord
+)
+
+// FilePathOptions is a collection of optional settings that control which
+// files GetAllFilePathsFSWithOptions returns.
+type FilePathOptions struct {
+	// PathsIgnored is a slice of path patterns to ignore, in the format
+	// accepted by ShouldIgnore.
+	PathsIgnored []string
+
+	// IgnoreFileNames lists the names of gitignore-format files, such as
+	// ".gitignore" or ".spdxignore". Files with these names are read from
+	// each directory as it is walked, and their patterns exclude paths in
+	// that directory and below it, following the rules in gitignore(5):
+	// later patterns and deeper files take precedence, "!" re-includes a
+	// path, and files inside an excluded directory cannot be re-included.
+	IgnoreFileNames []string
+
+	// SymlinkPolicy determines how symbolic links are handled.
+	SymlinkPolicy SymlinkPolicy
+}
+
+// GetAllFilePathsFSWithOptions takes a file system and optional settings,
+// and returns a slice of paths to all files in it, relative to its root and
+// prefixed with "/" (excluding those that are ignored).
+func GetAllFilePathsFSWithOptions(fsys fs.FS, opts *FilePathOptions) ([]string, error) {
+	if opts == nil {
+		opts = &FilePathOptions{}
+	}
+	w := &filePathWalker{
+		fsys:  fsys,
+		opts:  opts,
+		rules: &ignoreRules{},
+		paths: []string{},
+	}
+
+	// make sure the root is a directory we can read, as fs.WalkDir would
+	fi, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return w.paths, err
+	}
+	if !fi.IsDir() {
+		return w.paths, &fs.PathError{Op: "readdir", Path: ".", Err: fs.ErrInvalid}
+	}
+
+	err = w.walkDir(".", []walkedDir{{realPath: ".", fi: fi}})
+	return w.paths, err
+}
+
+// filePathWalker holds the state for a single GetAllFilePathsFSWithOptions
+// walk.
+type filePathWalker struct {
+	fsys  fs.FS
+	opts  *FilePathOptions
+	rules *ignoreRules
+	paths []string
+}
+
+// walkedDir identifies a directory on the path from the root to the one
+// currently being walked, so that symbolic link cycles can be detected.
+type walkedDir struct {
+	// realPath is the directory's path with symbolic links resolved, or
+	// "" if it is reached through a link that points outside the fsys
+	realPath string
+	fi       fs.FileInfo
+}
+
+// walkDir records the files in dir and its subdirectories, in lexical order.
+// ancestors ends with dir itself.
+func (w *filePathWalker) walkDir(dir string, ancestors []walkedDir) error {
+	if len(w.opts.IgnoreFileNames) > 0 {
+		if err := w.rules.loadIgnoreFiles(w.fsys, dir, w.opts.IgnoreFileNames); err != nil {
 			return err
 		}
-		// don't include path if it's a directory
-		if fi.IsDir() {
-			return nil
+	}
+
+	entries, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range entries {
+		p := path.Join(dir, d.Name())
+		isDir := d.IsDir()
+		isLink := d.Type()&fs.ModeSymlink == fs.ModeSymlink
+
+		var fi fs.FileInfo
+		if isLink {
+			switch w.opts.SymlinkPolicy {
+			case SymlinkRecord:
+				// fall through to record the link like a file
+			case SymlinkFollow:
+				fi, err = fs.Stat(w.fsys, p)
+				if err != nil {
+					// dangling link; nothing to follow
+					continue
+				}
+				isDir = fi.IsDir()
+			default:
+				// don't include path if it's a symbolic link
+				continue
+			}
 		}
-		// don't include path if it's a symbolic link
-		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
-			return nil
+
+		if isDir {
+			// skip directories excluded by an ignore file
+			if w.rules.shouldIgnore(p, true) {
+				continue
+			}
+			sub := walkedDir{}
+			if w.opts.SymlinkPolicy == SymlinkFollow {
+				if sub, err = w.identifyDir(p, d, fi, ancestors[len(ancestors)-1]); err != nil {
+					return err
+				}
+				if isCycle(sub, ancestors) {
+					continue
+				}
+			}
+			if err = w.walkDir(p, append(ancestors, sub)); err != nil {
+				return err
+			}
+			continue
 		}
 
-		shortPath := strings.TrimPrefix(path, prefix)
+		shortPath := "/" + p
 
 		// don't include path if it should be ignored
-		if pathsIgnored != nil && ShouldIgnore(shortPath, pathsIgnored) {
-			return nil
+		if w.opts.PathsIgnored != nil && ShouldIgnore(shortPath, w.opts.PathsIgnored) {
+			continue
+		}
+		if w.rules.shouldIgnore(p, false) {
+			continue
 		}
 
 		// if we got here, record the path
-		*paths = append(*paths, shortPath)
-		return nil
-	})
+		w.paths = append(w.paths, shortPath)
+	}
 
-	return *paths, err
+	return nil
+}
+
+// identifyDir fills in a walkedDir for the subdirectory p of parent. fi is
+// the result of following p if it is a symbolic link, and nil otherwise.
+func (w *filePathWalker) identifyDir(p string, d fs.DirEntry, fi fs.FileInfo, parent walkedDir) (walkedDir, error) {
+	if fi != nil {
+		// reached through a link, so work out where it really is
+		realPath, err := EvalSymlinksFS(w.fsys, p)
+		if err != nil {
+			realPath = ""
+		}
+		return walkedDir{realPath: realPath, fi: fi}, nil
+	}
+
+	fi, err := d.Info()
+	if err != nil {
+		return walkedDir{}, err
+	}
+	realPath := ""
+	if parent.realPath != "" {
+		realPath = path.Join(parent.realPath, d.Name())
+	}
+	return walkedDir{realPath: realPath, fi: fi}, nil
+}
+
+// isCycle reports whether dir is the same directory as any of its
+// ancestors.
+func isCycle(dir walkedDir, ancestors []walkedDir) bool {
+	for _, a := range ancestors {
+		if dir.realPath != "" && dir.realPath == a.realPath {
+			return true
+		}
+		// for directories reached through links that point outside the
+		// fsys, fall back on the OS's notion of identity if available
+		if dir.fi != nil && a.fi != nil && os.SameFile(dir.fi, a.fi) {
+			return true
+		}
+	}
+	return false
+}
+
+// EvalSymlinksFS returns the path p within fsys after resolving any
+// symbolic links in it, in the manner of filepath.EvalSymlinks. It returns
+// an error if a link cannot be read, or if it points outside of fsys.
+func EvalSymlinksFS(fsys fs.FS, p string) (string, error) {
+	const maxLinks = 255
+
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	resolved := "."
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", &fs.PathError{Op: "evalsymlinks", Path: p, Err: fs.ErrNotExist}
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		fi, err := Lstat(fsys, next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink != fs.ModeSymlink {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: p, Err: errors.New("too many links")}
+		}
+		target, err := ReadLink(fsys, next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: p, Err: fs.ErrNotExist}
+		}
+		// the target is relative to the directory containing the link
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+
+	return resolved, nil
 }
 
 // GetHashesForFilePath takes a path to a file on disk, and returns
@@ -61,14 +289,32 @@ func GetHashesForFilePath(p string) (string, string, string, error) {
 	}
 	defer f.Close()
 
+	return GetHashesForReader(f)
+}
+
+// GetHashesForFS takes a file system and a path to a file within it (as
+// returned by GetAllFilePathsFS), and returns SHA1, SHA256 and MD5 hashes
+// for that file as strings.
+func GetHashesForFS(fsys fs.FS, p string) (string, string, string, error) {
+	f, err := fsys.Open(strings.TrimPrefix(p, "/"))
+	if err != nil {
+		return "", "", "", err
+	}
+	defer f.Close()
+
+	return GetHashesForReader(f)
+}
+
+// GetHashesForReader reads r until EOF, and returns SHA1, SHA256 and MD5
+// hashes for its contents as strings.
+func GetHashesForReader(r io.Reader) (string, string, string, error) {
 	var ssha1, ssha256, smd5 string
 	hSHA1 := sha1.New()
 	hSHA256 := sha256.New()
 	hMD5 := md5.New()
 	hMulti := io.MultiWriter(hSHA1, hSHA256, hMD5)
 
-	if _, err := io.Copy(hMulti, f); err != nil {
-		f.Close()
+	if _, err := io.Copy(hMulti, r); err != nil {
 		return "", "", "", err
 	}
 	ssha1 = fmt.Sprintf("%x", hSHA1.Sum(nil))
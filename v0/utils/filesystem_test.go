@@ -3,7 +3,11 @@
 package utils
 
 import (
+	"io/fs"
+	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 // ===== Filesystem and hash functionality tests =====
@@ -124,6 +128,24 @@ func TestFilesystemGetsErrorWhenRequestingHashesForInvalidFilePath(t *testing.T)
 // FIXME add test to make sure we get an error for hashes for a file without
 // FIXME appropriate permissions to read its contents
 
+func TestFilesystemGetsHashesForReader(t *testing.T) {
+	r := strings.NewReader("")
+
+	ssha1, ssha256, smd5, err := GetHashesForReader(r)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if ssha1 != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+		t.Errorf("expected %v, got %v", "da39a3ee5e6b4b0d3255bfef95601890afd80709", ssha1)
+	}
+	if ssha256 != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("expected %v, got %v", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ssha256)
+	}
+	if smd5 != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Errorf("expected %v, got %v", "d41d8cd98f00b204e9800998ecf8427e", smd5)
+	}
+}
+
 func TestFilesystemExcludesForIgnoredPaths(t *testing.T) {
 	// one specific file
 	pathsIgnored := []string{"/file.txt"}
@@ -224,3 +246,151 @@ func TestFilesystemExcludesForIgnoredPaths(t *testing.T) {
 	}
 
 }
+
+func TestFilesystemCanGetSliceOfFSContents(t *testing.T) {
+	fsys := fstest.MapFS{
+		"b.txt":         {Data: []byte("b")},
+		"a/z.txt":       {Data: []byte("z")},
+		"a/link":        {Data: []byte("b.txt"), Mode: fs.ModeSymlink},
+		"c/ignored.txt": {Data: []byte("c")},
+	}
+
+	filePaths, err := GetAllFilePathsFS(fsys, []string{"/c/"})
+	if err != nil {
+		t.Fatalf("expected filePaths, got error: %v", err)
+	}
+	if len(filePaths) != 2 {
+		t.Fatalf("expected %v, got %v", 2, len(filePaths))
+	}
+	if filePaths[0] != "/a/z.txt" {
+		t.Errorf("expected %v, got %v", "/a/z.txt", filePaths[0])
+	}
+	if filePaths[1] != "/b.txt" {
+		t.Errorf("expected %v, got %v", "/b.txt", filePaths[1])
+	}
+}
+
+func TestFilesystemGetsHashesForFS(t *testing.T) {
+	fsys := os.DirFS("../../testdata/project1/")
+
+	ssha1, ssha256, smd5, err := GetHashesForFS(fsys, "/file1.testdata.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if ssha1 != "024f870eb6323f532515f7a09d5646a97083b819" {
+		t.Errorf("expected %v, got %v", "024f870eb6323f532515f7a09d5646a97083b819", ssha1)
+	}
+	if ssha256 != "b14e44284ca477b4c0db34b15ca4c454b2947cce7883e22321cf2984050e15bf" {
+		t.Errorf("expected %v, got %v", "b14e44284ca477b4c0db34b15ca4c454b2947cce7883e22321cf2984050e15bf", ssha256)
+	}
+	if smd5 != "37c8208479dfe42d2bb29debd6e32d4a" {
+		t.Errorf("expected %v, got %v", "37c8208479dfe42d2bb29debd6e32d4a", smd5)
+	}
+}
+
+func TestFilesystemGetsErrorWhenRequestingHashesForInvalidFSPath(t *testing.T) {
+	fsys := fstest.MapFS{}
+
+	_, _, _, err := GetHashesForFS(fsys, "/does/not/exist")
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestFilesystemCanFollowSymlinks(t *testing.T) {
+	dirRoot := "../../testdata/project1/"
+	opts := &FilePathOptions{SymlinkPolicy: SymlinkFollow}
+
+	filePaths, err := GetAllFilePathsFSWithOptions(os.DirFS(dirRoot), opts)
+	if err != nil {
+		t.Fatalf("expected filePaths, got error: %v", err)
+	}
+	if len(filePaths) != 6 {
+		t.Fatalf("expected %v, got %v", 6, len(filePaths))
+	}
+	if filePaths[5] != "/symbolic-link" {
+		t.Errorf("expected %v, got %v", "/symbolic-link", filePaths[5])
+	}
+}
+
+func TestFilesystemCanRecordSymlinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file.txt": {Data: []byte("x")},
+		"dirlink":    {Data: []byte("a"), Mode: fs.ModeSymlink},
+		"dangling":   {Data: []byte("nope"), Mode: fs.ModeSymlink},
+	}
+	opts := &FilePathOptions{SymlinkPolicy: SymlinkRecord}
+
+	filePaths, err := GetAllFilePathsFSWithOptions(fsys, opts)
+	if err != nil {
+		t.Fatalf("expected filePaths, got error: %v", err)
+	}
+	want := []string{"/a/file.txt", "/dangling", "/dirlink"}
+	if len(filePaths) != len(want) {
+		t.Fatalf("expected %v, got %v", want, filePaths)
+	}
+	for i := range want {
+		if filePaths[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], filePaths[i])
+		}
+	}
+}
+
+func TestFilesystemFollowingSymlinksSkipsCyclesAndDanglingLinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file.txt":   {Data: []byte("x")},
+		"a/loop":       {Data: []byte(".."), Mode: fs.ModeSymlink},
+		"a/self":       {Data: []byte("."), Mode: fs.ModeSymlink},
+		"b/dangling":   {Data: []byte("../nope"), Mode: fs.ModeSymlink},
+		"b/linkToA":    {Data: []byte("../a"), Mode: fs.ModeSymlink},
+		"b/linkToFile": {Data: []byte("../a/file.txt"), Mode: fs.ModeSymlink},
+	}
+	opts := &FilePathOptions{SymlinkPolicy: SymlinkFollow}
+
+	filePaths, err := GetAllFilePathsFSWithOptions(fsys, opts)
+	if err != nil {
+		t.Fatalf("expected filePaths, got error: %v", err)
+	}
+	want := []string{"/a/file.txt", "/b/linkToA/file.txt", "/b/linkToFile"}
+	if len(filePaths) != len(want) {
+		t.Fatalf("expected %v, got %v", want, filePaths)
+	}
+	for i := range want {
+		if filePaths[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], filePaths[i])
+		}
+	}
+}
+
+func TestFilesystemCanEvalSymlinksFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b/file.txt": {Data: []byte("x")},
+		"a/link":       {Data: []byte("b"), Mode: fs.ModeSymlink},
+		"chain":        {Data: []byte("a/link/file.txt"), Mode: fs.ModeSymlink},
+		"abs":          {Data: []byte("/etc/passwd"), Mode: fs.ModeSymlink},
+		"escape":       {Data: []byte("../../outside"), Mode: fs.ModeSymlink},
+		"loop1":        {Data: []byte("loop2"), Mode: fs.ModeSymlink},
+		"loop2":        {Data: []byte("loop1"), Mode: fs.ModeSymlink},
+	}
+
+	got, err := EvalSymlinksFS(fsys, "/chain")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "a/b/file.txt" {
+		t.Errorf("expected %v, got %v", "a/b/file.txt", got)
+	}
+	got, err = EvalSymlinksFS(fsys, "a/link/file.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "a/b/file.txt" {
+		t.Errorf("expected %v, got %v", "a/b/file.txt", got)
+	}
+
+	for _, p := range []string{"abs", "escape", "loop1", "missing"} {
+		if _, err = EvalSymlinksFS(fsys, p); err == nil {
+			t.Errorf("expected non-nil error for %v, got nil", p)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashCache remembers the SHA1, SHA256 and MD5 hashes of files on disk, so
+// that files which have not changed since a previous run do not need to be
+// read and hashed again. A file is considered unchanged if its path, size,
+// modification time and inode all match the cached entry. Files with no
+// modification time, such as those in an embed.FS, are always hashed.
+//
+// A HashCache is safe for concurrent use. A nil *HashCache is valid and
+// simply hashes every file.
+type HashCache struct {
+	mu      sync.Mutex
+	entries map[string]hashCacheEntry
+	seen    map[string]bool
+	// startedAt is when this run started, and prevStartedAt is when the
+	// run that saved the loaded cache started
+	startedAt     int64
+	prevStartedAt int64
+}
+
+// hashCacheEntry is the cached data for a single file.
+type hashCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Inode   uint64 `json:"inode"`
+	SHA1    string `json:"sha1"`
+	SHA256  string `json:"sha256"`
+	MD5     string `json:"md5"`
+	// FileType is set only for files looked up by GetHashesAndTypeForFS
+	FileType string `json:"type,omitempty"`
+}
+
+// hashCacheFile is the on-disk format of a HashCache.
+type hashCacheFile struct {
+	StartedAt int64                     `json:"startedAt"`
+	Entries   map[string]hashCacheEntry `json:"entries"`
+}
+
+// NewHashCache returns an empty HashCache. The time it is created is taken
+// as the start of the run that will use it.
+func NewHashCache() *HashCache {
+	return &HashCache{
+		entries:   map[string]hashCacheEntry{},
+		seen:      map[string]bool{},
+		startedAt: time.Now().UnixNano(),
+	}
+}
+
+// LoadHashCache reads a HashCache previously written by Save from the file
+// at cachePath. If no file exists there yet, an empty HashCache is returned.
+// As for NewHashCache, the time it is loaded is taken as the start of the
+// run that will use it.
+func LoadHashCache(cachePath string) (*HashCache, error) {
+	c := NewHashCache()
+
+	b, err := os.ReadFile(cachePath)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cf hashCacheFile
+	if err = json.Unmarshal(b, &cf); err != nil {
+		return nil, err
+	}
+	if cf.Entries != nil {
+		c.entries = cf.Entries
+	}
+	c.prevStartedAt = cf.StartedAt
+
+	return c, nil
+}
+
+// Save writes the HashCache to the file at cachePath. Only entries for files
+// that were hashed or looked up since the cache was loaded are kept, so that
+// files which have been deleted from the tree drop out of the cache. The
+// time the run started is saved too, rather than the time of saving, since
+// files may have been changed while the run was hashing them.
+func (c *HashCache) Save(cachePath string) error {
+	c.mu.Lock()
+	cf := hashCacheFile{
+		StartedAt: c.startedAt,
+		Entries:   map[string]hashCacheEntry{},
+	}
+	for p := range c.seen {
+		cf.Entries[p] = c.entries[p]
+	}
+	c.mu.Unlock()
+
+	b, err := json.Marshal(cf)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that an interrupted run does not
+	// leave a truncated cache behind
+	tmp := cachePath + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cachePath)
+}
+
+// GetHashesForFilePath returns SHA1, SHA256 and MD5 hashes for the file at
+// path p, in the same manner as the package-level GetHashesForFilePath. If
+// the file is unchanged since it was last hashed, the cached hashes are
+// returned without reading the file.
+func (c *HashCache) GetHashesForFilePath(p string) (string, string, string, error) {
+	if c == nil {
+		return GetHashesForFilePath(p)
+	}
+
+	key, err := filepath.Abs(p)
+	if err != nil {
+		return "", "", "", err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	e, err := c.getEntry(key, fi, false, func() (hashCacheEntry, error) {
+		ssha1, ssha256, smd5, err := GetHashesForFilePath(p)
+		return hashCacheEntry{SHA1: ssha1, SHA256: ssha256, MD5: smd5}, err
+	})
+	return e.SHA1, e.SHA256, e.MD5, err
+}
+
+// GetHashesForFS returns SHA1, SHA256 and MD5 hashes for the file at path p
+// within fsys, in the same manner as the package-level GetHashesForFS. If
+// the file is unchanged since it was last hashed, the cached hashes are
+// returned without reading the file. Entries are keyed by p, so a cache
+// should only be shared between runs over the same tree.
+func (c *HashCache) GetHashesForFS(fsys fs.FS, p string) (string, string, string, error) {
+	if c == nil {
+		return GetHashesForFS(fsys, p)
+	}
+
+	fi, err := fs.Stat(fsys, strings.TrimPrefix(p, "/"))
+	if err != nil {
+		return "", "", "", err
+	}
+
+	e, err := c.getEntry(p, fi, false, func() (hashCacheEntry, error) {
+		ssha1, ssha256, smd5, err := GetHashesForFS(fsys, p)
+		return hashCacheEntry{SHA1: ssha1, SHA256: ssha256, MD5: smd5}, err
+	})
+	return e.SHA1, e.SHA256, e.MD5, err
+}
+
+// GetHashesAndTypeForFS is like GetHashesForFS, but also caches a file type
+// along with the hashes, so that unchanged files need not be read to find
+// it either. hash is called to read the file when it is not in the cache,
+// and returns its SHA1, SHA256 and MD5 hashes and its type. The cached
+// types are only as current as whatever hash used to find them, so a cache
+// should not be shared between runs that find types differently.
+func (c *HashCache) GetHashesAndTypeForFS(fsys fs.FS, p string, hash func() (string, string, string, string, error)) (string, string, string, string, error) {
+	if c == nil {
+		return hash()
+	}
+
+	fi, err := fs.Stat(fsys, strings.TrimPrefix(p, "/"))
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	e, err := c.getEntry(p, fi, true, func() (hashCacheEntry, error) {
+		ssha1, ssha256, smd5, fileType, err := hash()
+		return hashCacheEntry{SHA1: ssha1, SHA256: ssha256, MD5: smd5, FileType: fileType}, err
+	})
+	return e.SHA1, e.SHA256, e.MD5, e.FileType, err
+}
+
+// getEntry returns the cached entry for key if fi shows that the file is
+// unchanged (and, if withType is set, the entry has a file type), or else
+// calls hash and records the result.
+func (c *HashCache) getEntry(key string, fi fs.FileInfo, withType bool, hash func() (hashCacheEntry, error)) (hashCacheEntry, error) {
+	// without a modification time, a changed file can't be told apart
+	if fi.ModTime().IsZero() {
+		return hash()
+	}
+
+	size := fi.Size()
+	modTime := fi.ModTime().UnixNano()
+	inode := getInode(fi)
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	// a file modified at or after the start of the run that saved the
+	// cache may have changed again after it was hashed, so don't trust it
+	if ok && e.Size == size && e.ModTime == modTime && e.Inode == inode && modTime < c.prevStartedAt && (!withType || e.FileType != "") {
+		c.seen[key] = true
+		c.mu.Unlock()
+		return e, nil
+	}
+	c.mu.Unlock()
+
+	e, err := hash()
+	if err != nil {
+		return hashCacheEntry{}, err
+	}
+	e.Size = size
+	e.ModTime = modTime
+	e.Inode = inode
+
+	c.mu.Lock()
+	c.entries[key] = e
+	c.seen[key] = true
+	c.mu.Unlock()
+
+	return e, nil
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// ===== Hash cache tests =====
+func TestHashCacheGetsHashesForFilePath(t *testing.T) {
+	c := NewHashCache()
+	ssha1, ssha256, smd5, err := c.GetHashesForFilePath("../../testdata/project1/file1.testdata.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if ssha1 != "024f870eb6323f532515f7a09d5646a97083b819" {
+		t.Errorf("expected %v, got %v", "024f870eb6323f532515f7a09d5646a97083b819", ssha1)
+	}
+	if ssha256 != "b14e44284ca477b4c0db34b15ca4c454b2947cce7883e22321cf2984050e15bf" {
+		t.Errorf("expected %v, got %v", "b14e44284ca477b4c0db34b15ca4c454b2947cce7883e22321cf2984050e15bf", ssha256)
+	}
+	if smd5 != "37c8208479dfe42d2bb29debd6e32d4a" {
+		t.Errorf("expected %v, got %v", "37c8208479dfe42d2bb29debd6e32d4a", smd5)
+	}
+}
+
+func TestHashCacheNilCacheStillHashes(t *testing.T) {
+	var c *HashCache
+	ssha1, _, _, err := c.GetHashesForFilePath("../../testdata/project1/file1.testdata.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if ssha1 != "024f870eb6323f532515f7a09d5646a97083b819" {
+		t.Errorf("expected %v, got %v", "024f870eb6323f532515f7a09d5646a97083b819", ssha1)
+	}
+}
+
+func TestHashCacheFailsForInvalidFilePath(t *testing.T) {
+	c := NewHashCache()
+	_, _, _, err := c.GetHashesForFilePath("./does/not/exist")
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestHashCacheReusesUnchangedAndRehashesChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "file.txt")
+	cachePath := filepath.Join(dir, "cache.json")
+	if err := os.WriteFile(p, []byte("hello"), 0644); err != nil {
+		t.Fatalf("couldn't write test file: %v", err)
+	}
+	// make sure the file predates the cache being saved
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(p, past, past); err != nil {
+		t.Fatalf("couldn't set test file times: %v", err)
+	}
+
+	c, err := LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want, _, _, err := c.GetHashesForFilePath(p)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err = c.Save(cachePath); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	// tamper with the saved entry, to tell whether it gets used
+	c, err = LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	key, _ := filepath.Abs(p)
+	e := c.entries[key]
+	if e.SHA1 != want {
+		t.Fatalf("expected %v, got %v", want, e.SHA1)
+	}
+	e.SHA1 = "cached"
+	c.entries[key] = e
+	got, _, _, err := c.GetHashesForFilePath(p)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "cached" {
+		t.Errorf("expected %v, got %v", "cached", got)
+	}
+
+	// now change the file; it should be hashed again
+	if err = os.WriteFile(p, []byte("goodbye"), 0644); err != nil {
+		t.Fatalf("couldn't write test file: %v", err)
+	}
+	if err = os.Chtimes(p, past, past.Add(time.Second)); err != nil {
+		t.Fatalf("couldn't set test file times: %v", err)
+	}
+	got, _, _, err = c.GetHashesForFilePath(p)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "3c8ec4874488f6090a157b014ce3397ca8e06d4f" {
+		t.Errorf("expected %v, got %v", "3c8ec4874488f6090a157b014ce3397ca8e06d4f", got)
+	}
+}
+
+func TestHashCacheSaveDropsFilesNotSeen(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+
+	c := NewHashCache()
+	c.entries["/gone"] = hashCacheEntry{SHA1: "abc"}
+	if _, _, _, err := c.GetHashesForFilePath("../../testdata/project1/file1.testdata.txt"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err := c.Save(cachePath); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	c, err := LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(c.entries) != 1 {
+		t.Fatalf("expected %d, got %d", 1, len(c.entries))
+	}
+	if _, ok := c.entries["/gone"]; ok {
+		t.Errorf("expected /gone to be dropped from cache")
+	}
+}
+
+func TestHashCacheLoadFailsForInvalidCacheFile(t *testing.T) {
+	_, err := LoadHashCache("../../testdata/project1/file1.testdata.txt")
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestHashCacheGetsHashesForFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"file.txt": {Data: []byte("goodbye"), ModTime: time.Now().Add(-time.Hour)},
+	}
+
+	c := NewHashCache()
+	c.prevStartedAt = time.Now().UnixNano()
+	got, _, _, err := c.GetHashesForFS(fsys, "/file.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "3c8ec4874488f6090a157b014ce3397ca8e06d4f" {
+		t.Errorf("expected %v, got %v", "3c8ec4874488f6090a157b014ce3397ca8e06d4f", got)
+	}
+
+	// a second lookup of the unchanged file should come from the cache
+	e := c.entries["/file.txt"]
+	e.SHA1 = "cached"
+	c.entries["/file.txt"] = e
+	got, _, _, err = c.GetHashesForFS(fsys, "/file.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "cached" {
+		t.Errorf("expected %v, got %v", "cached", got)
+	}
+}
+
+func TestHashCacheRehashesFilesChangedDuringRun(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "file.txt")
+	cachePath := filepath.Join(dir, "cache.json")
+	if err := os.WriteFile(p, []byte("hello"), 0644); err != nil {
+		t.Fatalf("couldn't write test file: %v", err)
+	}
+
+	c, err := LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	// the file is changed after the run started, but before the cache
+	// is saved
+	modified := time.Unix(0, c.startedAt).Add(time.Millisecond)
+	if err = os.Chtimes(p, modified, modified); err != nil {
+		t.Fatalf("couldn't set test file times: %v", err)
+	}
+	if _, _, _, err = c.GetHashesForFilePath(p); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err = c.Save(cachePath); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	c, err = LoadHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	key, _ := filepath.Abs(p)
+	e := c.entries[key]
+	e.SHA1 = "cached"
+	c.entries[key] = e
+	got, _, _, err := c.GetHashesForFilePath(p)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if got != "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d" {
+		t.Errorf("expected %v, got %v", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", got)
+	}
+}
+
+func TestHashCacheAlwaysHashesFilesWithoutModTime(t *testing.T) {
+	fsys := fstest.MapFS{
+		"file.txt": {Data: []byte("goodbye")},
+	}
+
+	c := NewHashCache()
+	c.prevStartedAt = time.Now().UnixNano()
+	if _, _, _, err := c.GetHashesForFS(fsys, "/file.txt"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("expected %v, got %v", 0, len(c.entries))
+	}
+}
+
+func TestHashCacheGetsHashesAndTypeForFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"file.txt": {Data: []byte("goodbye"), ModTime: time.Now().Add(-time.Hour)},
+	}
+	calls := 0
+	hash := func() (string, string, string, string, error) {
+		calls++
+		ssha1, ssha256, smd5, err := GetHashesForFS(fsys, "/file.txt")
+		return ssha1, ssha256, smd5, "OTHER", err
+	}
+
+	c := NewHashCache()
+	c.prevStartedAt = time.Now().UnixNano()
+	// an entry without a type doesn't count as cached
+	if _, _, _, err := c.GetHashesForFS(fsys, "/file.txt"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		got, _, _, fileType, err := c.GetHashesAndTypeForFS(fsys, "/file.txt", hash)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if got != "3c8ec4874488f6090a157b014ce3397ca8e06d4f" {
+			t.Errorf("expected %v, got %v", "3c8ec4874488f6090a157b014ce3397ca8e06d4f", got)
+		}
+		if fileType != "OTHER" {
+			t.Errorf("expected %v, got %v", "OTHER", fileType)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected %v, got %v", 1, calls)
+	}
+}
@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is a single pattern read from a gitignore-format file.
+type ignorePattern struct {
+	// base is the directory containing the ignore file the pattern came
+	// from, relative to the root of the file system ("" for the root)
+	base string
+	// negate is true for patterns starting with "!", which re-include a
+	// previously ignored path
+	negate bool
+	// dirOnly is true for patterns ending with "/", which only match
+	// directories
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// ignoreRules is an ordered list of patterns from every ignore file found
+// so far during a walk. Later patterns take precedence over earlier ones.
+type ignoreRules struct {
+	patterns []ignorePattern
+}
+
+// loadIgnoreFiles reads each of the named ignore files, if present, in the
+// directory dir of fsys, and appends their patterns to the rules.
+func (rules *ignoreRules) loadIgnoreFiles(fsys fs.FS, dir string, names []string) error {
+	base := dir
+	if base == "." {
+		base = ""
+	}
+
+	for _, name := range names {
+		f, err := fsys.Open(path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		patterns, err := parseIgnorePatterns(f, base)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		rules.patterns = append(rules.patterns, patterns...)
+	}
+
+	return nil
+}
+
+// shouldIgnore reports whether the path p (relative to the root of the file
+// system, without a leading slash) is excluded by the rules. isDir tells
+// whether p is a directory.
+func (rules *ignoreRules) shouldIgnore(p string, isDir bool) bool {
+	ignored := false
+	for _, pat := range rules.patterns {
+		rel := p
+		if pat.base != "" {
+			if !strings.HasPrefix(p, pat.base+"/") {
+				continue
+			}
+			rel = p[len(pat.base)+1:]
+		}
+		if pat.dirOnly && !isDir {
+			continue
+		}
+		// the last matching pattern decides
+		if pat.re.MatchString(rel) {
+			ignored = !pat.negate
+		}
+	}
+	return ignored
+}
+
+// parseIgnorePatterns reads gitignore-format patterns from f, scoping them
+// to the directory base.
+func parseIgnorePatterns(f fs.File, base string) ([]ignorePattern, error) {
+	patterns := []ignorePattern{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pat, ok := parseIgnoreLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		pat.base = base
+		patterns = append(patterns, pat)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+// parseIgnoreLine converts one line of a gitignore-format file into a
+// pattern, following the rules described in gitignore(5). It returns false
+// for blank lines and comments.
+func parseIgnoreLine(line string) (ignorePattern, bool) {
+	pat := ignorePattern{}
+
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pat, false
+	}
+
+	// trailing spaces are dropped unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if strings.HasPrefix(line, "!") {
+		pat.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pat.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pat, false
+	}
+
+	// a slash at the start or in the middle anchors the pattern to the
+	// ignore file's directory; otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return pat, false
+	}
+	pat.re = re
+
+	return pat, true
+}
+
+// globToRegexp converts a gitignore glob into a regular expression,
+// without the surrounding anchors.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				atStart := i == 0 || glob[i-1] == '/'
+				atEnd := i+2 == len(glob) || glob[i+2] == '/'
+				if atStart && atEnd {
+					if i+2 == len(glob) {
+						// trailing "/**" matches everything inside
+						sb.WriteString(".*")
+					} else {
+						// leading "**/" or inner "/**/" matches zero
+						// or more directories
+						sb.WriteString("(?:.*/)?")
+						i++
+					}
+					i++
+					continue
+				}
+			}
+			// other asterisks, including other runs of them, match
+			// anything except a slash
+			sb.WriteString("[^/]*")
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			// a "]" right after the opening bracket is part of the class
+			if class == "" || class == "!" || class == "^" {
+				next := strings.IndexByte(glob[i+2+end:], ']')
+				if next < 0 {
+					sb.WriteString(regexp.QuoteMeta("["))
+					continue
+				}
+				end += next + 1
+				class = glob[i+1 : i+1+end]
+			}
+			sb.WriteString(globClassToRegexp(class))
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				c = glob[i]
+			}
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// globClassToRegexp converts the inside of a glob bracket expression into
+// a regular expression character class. A negated class never matches a
+// slash.
+func globClassToRegexp(class string) string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	negate := strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^")
+	if negate {
+		sb.WriteString("^/")
+		class = class[1:]
+	}
+	for i := 0; i < len(class); i++ {
+		c := class[i]
+		switch {
+		case c == '\\' && i+1 < len(class):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(class[i])))
+		case c == '-' && i > 0 && i+1 < len(class):
+			sb.WriteByte('-')
+		case c == '[' || c == ']' || c == '^' || c == '-' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// PathPattern is a single path pattern in gitignore format, for matching
+// paths relative to the root of a file system.
+type PathPattern struct {
+	pat ignorePattern
+}
+
+// NewPathPattern compiles a pattern in gitignore format, as if it appeared
+// in an ignore file at the root of the file system. Negated patterns are
+// not meaningful on their own and are rejected.
+func NewPathPattern(pattern string) (*PathPattern, error) {
+	pat, ok := parseIgnoreLine(pattern)
+	if !ok || pat.negate {
+		return nil, fmt.Errorf("invalid path pattern %q", pattern)
+	}
+	return &PathPattern{pat: pat}, nil
+}
+
+// Match reports whether the path p (relative to the root of the file
+// system, without a leading slash) matches the pattern. isDir tells
+// whether p is a directory.
+func (pp *PathPattern) Match(p string, isDir bool) bool {
+	if pp.pat.dirOnly && !isDir {
+		return false
+	}
+	return pp.pat.re.MatchString(p)
+}
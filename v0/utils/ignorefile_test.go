@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// ===== gitignore-format pattern tests =====
+func TestIgnoreFileCanMatchPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		p       string
+		isDir   bool
+		want    bool
+	}{
+		// unanchored patterns match at any depth
+		{"*.o", "main.o", false, true},
+		{"*.o", "a/b/main.o", false, true},
+		{"*.o", "main.c", false, false},
+		{"build", "build", true, true},
+		{"build", "x/build", true, true},
+		// "*" and "?" don't match slashes
+		{"a/*.txt", "a/b.txt", false, true},
+		{"a/*.txt", "a/b/c.txt", false, false},
+		{"?.c", "x.c", false, true},
+		{"?.c", "xy.c", false, false},
+		// a slash anchors the pattern to the ignore file's directory
+		{"/todo.txt", "todo.txt", false, true},
+		{"/todo.txt", "sub/todo.txt", false, false},
+		{"doc/frotz", "doc/frotz", false, true},
+		{"doc/frotz", "a/doc/frotz", false, false},
+		// trailing slash only matches directories
+		{"out/", "out", true, true},
+		{"out/", "out", false, false},
+		// "**" forms
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"**/foo/bar", "a/foo/bar", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "ax/b", false, false},
+		{"foo**bar", "fooxbar", false, true},
+		{"foo**bar", "foo/bar", false, false},
+		// bracket expressions
+		{"[abc].txt", "b.txt", false, true},
+		{"[abc].txt", "d.txt", false, false},
+		{"[a-c].txt", "b.txt", false, true},
+		{"[!a-c].txt", "d.txt", false, true},
+		{"[!a-c].txt", "a.txt", false, false},
+		// escapes
+		{"\\#notes", "#notes", false, true},
+		{"\\!important", "!important", false, true},
+		{"trailing\\ ", "trailing ", false, true},
+		{"spaces   ", "spaces", false, true},
+	}
+
+	for _, tc := range tests {
+		pat, ok := parseIgnoreLine(tc.pattern)
+		if !ok {
+			t.Errorf("expected pattern %q to parse", tc.pattern)
+			continue
+		}
+		rules := &ignoreRules{patterns: []ignorePattern{pat}}
+		got := rules.shouldIgnore(tc.p, tc.isDir)
+		if got != tc.want {
+			t.Errorf("pattern %q, path %q (dir %v): expected %v, got %v", tc.pattern, tc.p, tc.isDir, tc.want, got)
+		}
+	}
+}
+
+func TestIgnoreFileSkipsBlankLinesAndComments(t *testing.T) {
+	for _, line := range []string{"", "# comment", "!", "/", "\r"} {
+		if _, ok := parseIgnoreLine(line); ok {
+			t.Errorf("expected %q to be skipped", line)
+		}
+	}
+}
+
+func TestIgnoreFileLastMatchingPatternWins(t *testing.T) {
+	rules := &ignoreRules{}
+	for _, line := range []string{"*.log", "!keep.log"} {
+		pat, _ := parseIgnoreLine(line)
+		rules.patterns = append(rules.patterns, pat)
+	}
+
+	if !rules.shouldIgnore("debug.log", false) {
+		t.Errorf("expected debug.log to be ignored")
+	}
+	if rules.shouldIgnore("sub/keep.log", false) {
+		t.Errorf("expected sub/keep.log to be re-included")
+	}
+}
+
+func TestFilesystemCanHonorIgnoreFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":          {Data: []byte("# build outputs\n*.o\n/dist/\nlogs/\n!important.o\n")},
+		"main.c":              {Data: []byte("c")},
+		"main.o":              {Data: []byte("o")},
+		"important.o":         {Data: []byte("o")},
+		"dist/app":            {Data: []byte("bin")},
+		"logs/today.txt":      {Data: []byte("log")},
+		"sub/dist/kept.txt":   {Data: []byte("anchored pattern doesn't apply here")},
+		"sub/.spdxignore":     {Data: []byte("secret.txt\n!again.o\n")},
+		"sub/secret.txt":      {Data: []byte("s")},
+		"sub/again.o":         {Data: []byte("o")},
+		"sub/other.o":         {Data: []byte("o")},
+		"other/secret.txt":    {Data: []byte(".spdxignore in sub doesn't apply here")},
+		"logs2/!logs/x.txt":   {Data: []byte("x")},
+		"vendor/.gitignore":   {Data: []byte("!*.o\n")},
+		"vendor/lib.o":        {Data: []byte("re-included by deeper file")},
+		"logs/.gitignore":     {Data: []byte("!today.txt\n")},
+		"logs/sub/nested.txt": {Data: []byte("in ignored dir")},
+	}
+	opts := &FilePathOptions{
+		IgnoreFileNames: []string{".gitignore", ".spdxignore"},
+	}
+
+	filePaths, err := GetAllFilePathsFSWithOptions(fsys, opts)
+	if err != nil {
+		t.Fatalf("expected filePaths, got error: %v", err)
+	}
+
+	want := []string{
+		"/.gitignore",
+		"/important.o",
+		"/logs2/!logs/x.txt",
+		"/main.c",
+		"/other/secret.txt",
+		"/sub/.spdxignore",
+		"/sub/again.o",
+		"/sub/dist/kept.txt",
+		"/vendor/.gitignore",
+		"/vendor/lib.o",
+	}
+	if len(filePaths) != len(want) {
+		t.Fatalf("expected %v, got %v", want, filePaths)
+	}
+	for i := range want {
+		if filePaths[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], filePaths[i])
+		}
+	}
+}
+
+func TestFilesystemCanCombineIgnoreFilesAndPathsIgnored(t *testing.T) {
+	fsys := fstest.MapFS{
+		".spdxignore": {Data: []byte("*.tmp\n")},
+		"a.tmp":       {Data: []byte("a")},
+		"b.txt":       {Data: []byte("b")},
+		"c.txt":       {Data: []byte("c")},
+	}
+	opts := &FilePathOptions{
+		PathsIgnored:    []string{"/c.txt", "/.spdxignore"},
+		IgnoreFileNames: []string{".spdxignore"},
+	}
+
+	filePaths, err := GetAllFilePathsFSWithOptions(fsys, opts)
+	if err != nil {
+		t.Fatalf("expected filePaths, got error: %v", err)
+	}
+	if len(filePaths) != 1 {
+		t.Fatalf("expected %v, got %v", 1, len(filePaths))
+	}
+	if filePaths[0] != "/b.txt" {
+		t.Errorf("expected %v, got %v", "/b.txt", filePaths[0])
+	}
+}
+
+func TestPathPatternCanMatchPaths(t *testing.T) {
+	pp, err := NewPathPattern("**/node_modules/@*/*/")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !pp.Match("node_modules/@types/node", true) {
+		t.Errorf("expected %v, got %v", true, false)
+	}
+	if !pp.Match("web/node_modules/@types/node", true) {
+		t.Errorf("expected %v, got %v", true, false)
+	}
+	if pp.Match("node_modules/@types/node", false) {
+		t.Errorf("expected %v, got %v", false, true)
+	}
+	if pp.Match("node_modules/lodash", true) {
+		t.Errorf("expected %v, got %v", false, true)
+	}
+
+	for _, bad := range []string{"", "# comment", "!negated"} {
+		if _, err = NewPathPattern(bad); err == nil {
+			t.Errorf("expected non-nil error for %q, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package utils
+
+import (
+	"os"
+)
+
+// getInode returns 0, since inode numbers are not available on this
+// platform. The cache then relies on path, size and modification time.
+func getInode(fi os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ReadLinkFS is a file system that can report symbolic links, rather than
+// following them. TarFS and gitfs.FS implement it, as do the file systems
+// returned by DirFS.
+type ReadLinkFS interface {
+	fs.FS
+
+	// ReadLink returns the target of the named symbolic link.
+	ReadLink(name string) (string, error)
+
+	// Lstat returns a FileInfo describing the named file, without
+	// following a symbolic link at the end of its path.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// Lstat returns a FileInfo describing the named file in fsys, without
+// following a symbolic link at the end of its path. If fsys does not
+// implement ReadLinkFS, it falls back to fs.Stat.
+func Lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if rfs, ok := fsys.(ReadLinkFS); ok {
+		return rfs.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// ReadLink returns the target of the named symbolic link in fsys. If fsys
+// does not implement ReadLinkFS, but its Stat reports the file as a link
+// (so that it does not follow links, as with fstest.MapFS before Go 1.25),
+// the contents of the file are taken as the target.
+func ReadLink(fsys fs.FS, name string) (string, error) {
+	if rfs, ok := fsys.(ReadLinkFS); ok {
+		return rfs.ReadLink(name)
+	}
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&fs.ModeSymlink != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
+
+// DirFS returns a file system for the tree of files rooted at the
+// directory dir, like os.DirFS, that also implements ReadLinkFS so that
+// symbolic links on disk can be recorded or followed with any Go version.
+func DirFS(dir string) fs.FS {
+	return &dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(d.FS, name)
+}
+
+func (d *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(d.FS, name)
+}
+
+func (d *dirFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(d.FS, name)
+}
+
+func (d *dirFS) Lstat(name string) (fs.FileInfo, error) {
+	p, err := d.join("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Lstat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: unwrapPathError(err)}
+	}
+	return fi, nil
+}
+
+func (d *dirFS) ReadLink(name string) (string, error) {
+	p, err := d.join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(p)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: unwrapPathError(err)}
+	}
+	return filepath.ToSlash(target), nil
+}
+
+// join returns the path on disk of name, which must be a valid fs.FS path.
+func (d *dirFS) join(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
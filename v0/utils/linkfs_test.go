@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// ===== Symbolic link helper tests =====
+func TestDirFSCanReadSymlinks(t *testing.T) {
+	fsys := DirFS("../../testdata/project1/")
+
+	fi, err := Lstat(fsys, "symbolic-link")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if fi.Mode()&fs.ModeSymlink != fs.ModeSymlink {
+		t.Errorf("expected symlink mode, got %v", fi.Mode())
+	}
+	target, err := ReadLink(fsys, "symbolic-link")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if target != "file3.testdata.txt" {
+		t.Errorf("expected %v, got %v", "file3.testdata.txt", target)
+	}
+
+	if _, err := ReadLink(fsys, "file1.testdata.txt"); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+	if _, err := Lstat(fsys, "../project2"); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+// statOnlyFS hides any ReadLink and Lstat methods of the wrapped FS.
+type statOnlyFS struct {
+	fsys fstest.MapFS
+}
+
+func (s statOnlyFS) Open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+func TestLinkHelpersFallBackToStat(t *testing.T) {
+	fsys := statOnlyFS{fstest.MapFS{
+		"file.txt": {Data: []byte("x")},
+	}}
+
+	fi, err := Lstat(fsys, "file.txt")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if fi.Size() != 1 {
+		t.Errorf("expected %v, got %v", 1, fi.Size())
+	}
+	if _, err := ReadLink(fsys, "file.txt"); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
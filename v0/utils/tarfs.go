@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TarFS is a read-only fs.FS for the contents of an uncompressed tar
+// archive, such as an image saved by "docker save". The archive's headers
+// are read once when it is opened; file contents are read from the archive
+// on demand, so it is never extracted or held in memory. Symbolic and hard
+// links within the archive are followed. Directories that have no entry of
+// their own in the archive are still listed.
+type TarFS struct {
+	r       io.ReaderAt
+	entries map[string]*tarEntry
+}
+
+// tarEntry is a single file, directory or link in a TarFS.
+type tarEntry struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	size     int64
+	offset   int64
+	linkname string
+	children map[string]*tarEntry
+}
+
+// NewTarFS reads the headers of the tar archive in the first size bytes of
+// r and returns a TarFS for its contents.
+func NewTarFS(r io.ReaderAt, size int64) (*TarFS, error) {
+	tfs := &TarFS{
+		r:       r,
+		entries: map[string]*tarEntry{".": {name: ".", mode: fs.ModeDir | 0755, children: map[string]*tarEntry{}}},
+	}
+
+	// tar.Reader seeks past file contents, so only the headers are read
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			continue
+		}
+
+		e := &tarEntry{name: path.Base(name), modTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			e.mode = fs.FileMode(hdr.Mode).Perm()
+			e.size = hdr.Size
+			e.offset = offset
+		case tar.TypeDir:
+			e.mode = fs.ModeDir | fs.FileMode(hdr.Mode).Perm()
+		case tar.TypeSymlink:
+			e.mode = fs.ModeSymlink | 0777
+			e.linkname = hdr.Linkname
+		case tar.TypeLink:
+			// a hard link shares the contents of an earlier entry
+			target, ok := tfs.entries[path.Clean(strings.TrimPrefix(hdr.Linkname, "/"))]
+			if !ok || target.mode.Type() != 0 {
+				continue
+			}
+			e.mode, e.size, e.offset = target.mode, target.size, target.offset
+		default:
+			continue
+		}
+		tfs.add(name, e)
+	}
+	return tfs, nil
+}
+
+// add records an entry, creating its parent directories if needed. A
+// later entry for the same path replaces an earlier one, as it would on
+// extraction, except that a directory keeps its children.
+func (tfs *TarFS) add(name string, e *tarEntry) {
+	parent := tfs.entries["."]
+	if dir := path.Dir(name); dir != "." {
+		p, ok := tfs.entries[dir]
+		if !ok || !p.mode.IsDir() {
+			tfs.add(dir, &tarEntry{name: path.Base(dir), mode: fs.ModeDir | 0755})
+			p = tfs.entries[dir]
+		}
+		parent = p
+	}
+	if old, ok := tfs.entries[name]; ok && old.mode.IsDir() && e.mode.IsDir() {
+		e.children = old.children
+	}
+	if e.mode.IsDir() && e.children == nil {
+		e.children = map[string]*tarEntry{}
+	}
+	tfs.entries[name] = e
+	parent.children[e.name] = e
+}
+
+// lookup finds the entry for a path, following symbolic links in it. If
+// followLast is false, a symbolic link at the end of the path is returned
+// itself.
+func (tfs *TarFS) lookup(op string, name string, followLast bool) (string, *tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	resolved := "."
+	rest := strings.Split(name, "/")
+	if name == "." {
+		rest = nil
+	}
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		next := path.Join(resolved, elem)
+		e, ok := tfs.entries[next]
+		if !ok {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if e.mode.Type() != fs.ModeSymlink || (len(rest) == 0 && !followLast) {
+			if len(rest) > 0 && !e.mode.IsDir() {
+				return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			resolved = next
+			continue
+		}
+		if links++; links > 40 {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		target := e.linkname
+		if !path.IsAbs(target) {
+			target = path.Join(resolved, target)
+		}
+		target = path.Clean(strings.TrimPrefix(target, "/"))
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		resolved = "."
+		if target != "." {
+			rest = append(strings.Split(target, "/"), rest...)
+		}
+	}
+	return resolved, tfs.entries[resolved], nil
+}
+
+// Open opens the named file or directory.
+func (tfs *TarFS) Open(name string) (fs.File, error) {
+	resolved, e, err := tfs.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &tarFile{tfs: tfs, name: resolved, entry: e}
+	if !e.mode.IsDir() {
+		f.SectionReader = io.NewSectionReader(tfs.r, e.offset, e.size)
+	}
+	return f, nil
+}
+
+// Stat returns a FileInfo describing the named file, following links.
+func (tfs *TarFS) Stat(name string) (fs.FileInfo, error) {
+	_, e, err := tfs.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return tarFileInfo{e}, nil
+}
+
+// Lstat returns a FileInfo describing the named file, without following a
+// symbolic link at the end of its path.
+func (tfs *TarFS) Lstat(name string) (fs.FileInfo, error) {
+	_, e, err := tfs.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return tarFileInfo{e}, nil
+}
+
+// ReadLink returns the target of the named symbolic link.
+func (tfs *TarFS) ReadLink(name string) (string, error) {
+	_, e, err := tfs.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e.mode.Type() != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return e.linkname, nil
+}
+
+// ReadDir reads the named directory, returning its entries sorted by name.
+func (tfs *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	_, e, err := tfs.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return e.dirEntries(), nil
+}
+
+func (e *tarEntry) dirEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(e.children))
+	for _, c := range e.children {
+		entries = append(entries, fs.FileInfoToDirEntry(tarFileInfo{c}))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// tarFile is an open file or directory in a TarFS.
+type tarFile struct {
+	*io.SectionReader
+	tfs     *TarFS
+	name    string
+	entry   *tarEntry
+	dirRead []fs.DirEntry
+	dirPos  int
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return tarFileInfo{f.entry}, nil
+}
+
+func (f *tarFile) Read(b []byte) (int, error) {
+	if f.SectionReader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	return f.SectionReader.Read(b)
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+// ReadDir reads the contents of a directory, as fs.ReadDirFile does.
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if f.dirRead == nil {
+		f.dirRead = f.entry.dirEntries()
+	}
+	remaining := f.dirRead[f.dirPos:]
+	if n <= 0 {
+		f.dirPos = len(f.dirRead)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	f.dirPos += n
+	return remaining[:n], nil
+}
+
+// tarFileInfo describes an entry in a TarFS.
+type tarFileInfo struct {
+	e *tarEntry
+}
+
+func (fi tarFileInfo) Name() string       { return fi.e.name }
+func (fi tarFileInfo) Size() int64        { return fi.e.size }
+func (fi tarFileInfo) Mode() fs.FileMode  { return fi.e.mode }
+func (fi tarFileInfo) ModTime() time.Time { return fi.e.modTime }
+func (fi tarFileInfo) IsDir() bool        { return fi.e.mode.IsDir() }
+func (fi tarFileInfo) Sys() interface{}   { return nil }
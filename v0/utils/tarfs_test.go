@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ===== Tar file system tests =====
+type testTarEntry struct {
+	name     string
+	typ      byte
+	body     string
+	linkname string
+}
+
+func buildTestTar(t *testing.T, entries []testTarEntry) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typ, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.body))}
+		if e.typ != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if e.typ == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestTarFSReadsFilesAndDirectories(t *testing.T) {
+	r := buildTestTar(t, []testTarEntry{
+		{name: "manifest.json", typ: tar.TypeReg, body: "[]"},
+		{name: "abc/", typ: tar.TypeDir},
+		{name: "abc/layer.tar", typ: tar.TypeReg, body: strings.Repeat("layer", 300)},
+		{name: "./def/layer.tar", typ: tar.TypeSymlink, linkname: "../abc/layer.tar"},
+		{name: "hard.tar", typ: tar.TypeLink, linkname: "abc/layer.tar"},
+		{name: "deep/nested/file.txt", typ: tar.TypeReg, body: "nested"},
+	})
+
+	tfs, err := NewTarFS(r, r.Size())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	data, err := fs.ReadFile(tfs, "def/layer.tar")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if string(data) != strings.Repeat("layer", 300) {
+		t.Errorf("expected layer contents, got %d bytes", len(data))
+	}
+	data, err = fs.ReadFile(tfs, "hard.tar")
+	if err != nil || len(data) != 1500 {
+		t.Errorf("expected 1500 bytes and nil error, got %d bytes and %v", len(data), err)
+	}
+
+	target, err := tfs.ReadLink("def/layer.tar")
+	if err != nil || target != "../abc/layer.tar" {
+		t.Errorf("expected %v and nil error, got %v and %v", "../abc/layer.tar", target, err)
+	}
+	fi, err := tfs.Lstat("def/layer.tar")
+	if err != nil || fi.Mode().Type() != fs.ModeSymlink {
+		t.Errorf("expected a symlink, got %v and %v", fi, err)
+	}
+
+	entries, err := fs.ReadDir(tfs, ".")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "abc,deep,def,hard.tar,manifest.json" {
+		t.Errorf("expected %v, got %v", "abc,deep,def,hard.tar,manifest.json", names)
+	}
+
+	if _, err = tfs.Open("missing"); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+
+	if err = fstest.TestFS(tfs, "manifest.json", "abc/layer.tar", "deep/nested/file.txt", "hard.tar"); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+}
+
+func TestTarFSRejectsLinksOutsideArchive(t *testing.T) {
+	r := buildTestTar(t, []testTarEntry{
+		{name: "escape", typ: tar.TypeSymlink, linkname: "../../etc/passwd"},
+	})
+
+	tfs, err := NewTarFS(r, r.Size())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, err = tfs.Open("escape"); err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
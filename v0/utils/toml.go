@@ -0,0 +1,478 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseTOML parses a TOML document, such as a poetry.lock or REUSE.toml
+// file, into nested maps. Tables become map[string]interface{}, arrays
+// (including arrays of tables) become []interface{}, and the other values
+// become string, int64, float64 or bool. Dates and times are not
+// interpreted, and are returned as strings.
+func ParseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{s: string(data), line: 1}
+	root := map[string]interface{}{}
+	if err := p.parse(root); err != nil {
+		return nil, fmt.Errorf("line %d: %v", p.line, err)
+	}
+	return root, nil
+}
+
+// tomlParser holds the state of a ParseTOML call.
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) parse(root map[string]interface{}) error {
+	current := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+
+		if p.peek() == '[' {
+			p.pos++
+			isArray := p.peek() == '['
+			if isArray {
+				p.pos++
+			}
+			p.skipSpace(false)
+			keys, err := p.parseKey()
+			if err != nil {
+				return err
+			}
+			p.skipSpace(false)
+			closing := "]"
+			if isArray {
+				closing = "]]"
+			}
+			if !strings.HasPrefix(p.s[p.pos:], closing) {
+				return fmt.Errorf("expected %q", closing)
+			}
+			p.pos += len(closing)
+
+			parent, err := tomlTable(root, keys[:len(keys)-1])
+			if err != nil {
+				return err
+			}
+			last := keys[len(keys)-1]
+			if isArray {
+				arr, ok := parent[last].([]interface{})
+				if !ok && parent[last] != nil {
+					return fmt.Errorf("%s is not an array of tables", strings.Join(keys, "."))
+				}
+				current = map[string]interface{}{}
+				parent[last] = append(arr, current)
+			} else if current, err = tomlTable(parent, []string{last}); err != nil {
+				return err
+			}
+		} else {
+			keys, err := p.parseKey()
+			if err != nil {
+				return err
+			}
+			if err := p.parseKeyValue(current, keys); err != nil {
+				return err
+			}
+		}
+
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// tomlTable returns the table found by following keys from t, creating
+// tables that do not exist yet. For an array of tables, the last table in
+// the array is used.
+func tomlTable(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			t[k] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%s is not a table", k)
+			}
+			last, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", k)
+			}
+			t = last
+		default:
+			return nil, fmt.Errorf("%s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// parseKeyValue parses "= value" after a key has been read, and stores the
+// value in t.
+func (p *tomlParser) parseKeyValue(t map[string]interface{}, keys []string) error {
+	p.skipSpace(false)
+	if p.peek() != '=' {
+		return fmt.Errorf("expected \"=\" after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace(false)
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := tomlTable(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseKey parses a possibly dotted key.
+func (p *tomlParser) parseKey() ([]string, error) {
+	keys := []string{}
+	for {
+		var k string
+		var err error
+		switch p.peek() {
+		case '"':
+			k, err = p.parseBasicString()
+		case '\'':
+			k, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key")
+			}
+			k = p.s[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+
+		p.skipSpace(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+		p.skipSpace(false)
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.s[p.pos:], `"""`) {
+			return p.parseMultilineString(`"""`)
+		}
+		return p.parseBasicString()
+	case '\'':
+		if strings.HasPrefix(p.s[p.pos:], "'''") {
+			return p.parseMultilineString("'''")
+		}
+		return p.parseLiteralString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && (isBareKeyChar(p.peek()) || strings.IndexByte("+.:", p.peek()) >= 0) {
+		p.pos++
+	}
+	token := p.s[start:p.pos]
+	switch token {
+	case "":
+		return nil, fmt.Errorf("expected a value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+
+	if strings.Contains(token, ":") || strings.Count(token, "-") >= 2 && !strings.ContainsAny(token, "eE") {
+		// a date or time
+		return token, nil
+	}
+	clean := strings.ReplaceAll(token, "_", "")
+	if i, err := strconv.ParseInt(clean, 0, 64); err == nil {
+		if len(clean) > 1 && clean[0] == '0' && clean[1] >= '0' && clean[1] <= '9' {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", token)
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	p.pos++ // "["
+	arr := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.peek() == ']' {
+			p.pos++
+			return arr, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+		p.skipSpace(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return arr, nil
+		default:
+			return nil, fmt.Errorf("expected \",\" or \"]\" in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.pos++ // "{"
+	t := map[string]interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.peek() == '}' {
+			p.pos++
+			return t, nil
+		}
+		keys, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.parseKeyValue(t, keys); err != nil {
+			return nil, err
+		}
+		p.skipSpace(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expected \",\" or \"}\" in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++ // opening quote
+	end := strings.IndexAny(p.s[p.pos:], "'\n")
+	if end < 0 || p.s[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// parseMultilineString parses a string delimited by three double quotes
+// (a multi-line basic string) or three single quotes (a multi-line literal
+// string).
+func (p *tomlParser) parseMultilineString(delim string) (string, error) {
+	p.pos += len(delim)
+	// a newline immediately after the opening delimiter is trimmed
+	if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	}
+
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.s[p.pos:], delim) {
+			p.pos += len(delim)
+			// up to two quotes just before the closing delimiter are
+			// part of the string
+			for i := 0; i < 2 && !p.eof() && p.peek() == delim[0]; i++ {
+				sb.WriteByte(delim[0])
+				p.pos++
+			}
+			return sb.String(), nil
+		}
+
+		c := p.peek()
+		if c == '\\' && delim == `"""` {
+			// a backslash at the end of a line trims the following
+			// whitespace, including newlines
+			rest := strings.TrimLeft(p.s[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				p.pos++
+				for !p.eof() && (p.peek() == '\n' || p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+					if p.peek() == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if c == '\n' {
+			p.line++
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+}
+
+// parseEscape parses a backslash escape sequence in a basic string.
+func (p *tomlParser) parseEscape(sb *strings.Builder) error {
+	p.pos++ // "\"
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte(0x1b)
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(r))
+		p.pos += n
+	default:
+		return fmt.Errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// skipSpace skips spaces and tabs, and also newlines and comments if
+// newlines is true.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.line++
+			p.pos++
+		case c == '#' && newlines:
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine checks that nothing but a comment follows on the current line.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if !p.eof() && p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+	if !p.eof() && p.peek() != '\n' {
+		return fmt.Errorf("unexpected %q", p.peek())
+	}
+	return nil
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
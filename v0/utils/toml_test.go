@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// ===== TOML parser tests =====
+func TestParseTOMLReadsTablesAndValues(t *testing.T) {
+	data := []byte(`# a comment
+title = "TOML \"example\" \u00e9"
+literal = 'C:\path'
+count = 1_000
+hex = 0xff
+pi = 3.14
+neg = -2e-3
+enabled = true
+date = 1979-05-27
+multi = """
+first \
+  second"""
+raw = '''
+line1
+line2'''
+
+[owner]
+name = "Tom"
+"quoted key" = 1
+site.url = "https://example.com"
+
+[[package]]
+name = "a"
+files = [
+    {file = "a.whl", hash = "sha256:aaa"}, # trailing comment
+    {file = "a.tar.gz", hash = "sha256:bbb"},
+]
+
+[package.dependencies]
+b = ">=1.0"
+
+[[package]]
+name = "b"
+files = []
+`)
+
+	got, err := ParseTOML(data)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	want := map[string]interface{}{
+		"title":   "TOML \"example\" é",
+		"literal": `C:\path`,
+		"count":   int64(1000),
+		"hex":     int64(255),
+		"pi":      3.14,
+		"neg":     -2e-3,
+		"enabled": true,
+		"date":    "1979-05-27",
+		"multi":   "first second",
+		"raw":     "line1\nline2",
+		"owner": map[string]interface{}{
+			"name":       "Tom",
+			"quoted key": int64(1),
+			"site":       map[string]interface{}{"url": "https://example.com"},
+		},
+		"package": []interface{}{
+			map[string]interface{}{
+				"name": "a",
+				"files": []interface{}{
+					map[string]interface{}{"file": "a.whl", "hash": "sha256:aaa"},
+					map[string]interface{}{"file": "a.tar.gz", "hash": "sha256:bbb"},
+				},
+				"dependencies": map[string]interface{}{"b": ">=1.0"},
+			},
+			map[string]interface{}{
+				"name":  "b",
+				"files": []interface{}{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseTOMLFailsForInvalidDocuments(t *testing.T) {
+	for _, data := range []string{
+		"a = \"unterminated\n",
+		"a = 1\na = 2\n",
+		"a = 1 b = 2\n",
+		"[table\n",
+		"a = [1, 2\n",
+		"a = 1\n[[a]]\n",
+		"= 1\n",
+		"a = 012\n",
+		"a = \"\\q\"\n",
+	} {
+		if _, err := ParseTOML([]byte(data)); err == nil {
+			t.Errorf("expected non-nil error for %q, got nil", data)
+		}
+	}
+}
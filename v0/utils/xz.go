@@ -0,0 +1,851 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+// xzMagic starts every xz stream.
+var xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+// xzCheckSizes is the size of the integrity check for each check type.
+var xzCheckSizes = [16]int{0, 4, 4, 4, 8, 8, 8, 16, 16, 16, 32, 32, 32, 64, 64, 64}
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// errXZCorrupt is returned for xz data that can't be decoded.
+var errXZCorrupt = errors.New("xz: corrupt data")
+
+// NewXZReader returns a reader for the decompressed contents of the xz
+// data read from r, as written by xz(1). Concatenated streams are read one
+// after another. Only the LZMA2 filter is supported, which is all that xz
+// uses unless it is asked for a BCJ or delta filter. CRC32, CRC64 and
+// SHA-256 checks are verified; blocks with other check types are read
+// without verifying them. An error is returned if r does not start with an
+// xz stream header.
+func NewXZReader(r io.Reader) (io.Reader, error) {
+	z := &xzReader{r: bufio.NewReader(r)}
+	if err := z.readStreamHeader(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// xzReader decodes an xz file one LZMA2 chunk at a time.
+type xzReader struct {
+	r *bufio.Reader
+	// out holds decoded data not yet returned by Read
+	out []byte
+	err error
+
+	// the current stream's check type, and the sizes of its blocks so far
+	checkType int
+	records   []xzRecord
+
+	// the current block, if inBlock is set
+	inBlock      bool
+	check        hash.Hash
+	blockRead    int64
+	headerSize   int64
+	uncompressed int64
+
+	lzma *lzma2Decoder
+}
+
+// xzRecord is an index record: a block's unpadded and uncompressed sizes.
+type xzRecord struct {
+	unpadded     int64
+	uncompressed int64
+}
+
+func (z *xzReader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.decodeMore()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// decodeMore decodes the next chunk of a block, or moves on to the next
+// block or stream. It returns io.EOF after the last stream.
+func (z *xzReader) decodeMore() error {
+	if !z.inBlock {
+		return z.startBlock()
+	}
+
+	data, err := z.lzma.decodeChunk(z.r, &z.blockRead)
+	if err == io.EOF {
+		return z.finishBlock()
+	}
+	if err != nil {
+		return err
+	}
+	z.uncompressed += int64(len(data))
+	if z.check != nil {
+		z.check.Write(data)
+	}
+	z.out = data
+	return nil
+}
+
+func (z *xzReader) readStreamHeader() error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(z.r, header); err != nil {
+		return noEOF(err)
+	}
+	if !bytes.Equal(header[:6], xzMagic) {
+		return errors.New("xz: not an xz stream")
+	}
+	if header[6] != 0 || header[7] > 0x0f {
+		return errors.New("xz: unsupported stream flags")
+	}
+	if crc32.ChecksumIEEE(header[6:8]) != binary.LittleEndian.Uint32(header[8:]) {
+		return errXZCorrupt
+	}
+	z.checkType = int(header[7])
+	z.records = nil
+	return nil
+}
+
+// startBlock reads a block header, or else the index that follows the last
+// block of a stream.
+func (z *xzReader) startBlock() error {
+	first, err := z.r.ReadByte()
+	if err != nil {
+		return noEOF(err)
+	}
+	if first == 0 {
+		return z.finishStream()
+	}
+
+	headerSize := (int(first) + 1) * 4
+	header := make([]byte, headerSize)
+	header[0] = first
+	if _, err = io.ReadFull(z.r, header[1:]); err != nil {
+		return noEOF(err)
+	}
+	if crc32.ChecksumIEEE(header[:headerSize-4]) != binary.LittleEndian.Uint32(header[headerSize-4:]) {
+		return errXZCorrupt
+	}
+
+	flags := header[1]
+	if flags&0x3c != 0 {
+		return errors.New("xz: unsupported block flags")
+	}
+	br := bytes.NewReader(header[2 : headerSize-4])
+	if flags&0x40 != 0 {
+		if _, err = readXZVarint(br); err != nil {
+			return err
+		}
+	}
+	if flags&0x80 != 0 {
+		if _, err = readXZVarint(br); err != nil {
+			return err
+		}
+	}
+	var dictSize int
+	for i := 0; i <= int(flags&0x03); i++ {
+		id, err := readXZVarint(br)
+		if err != nil {
+			return err
+		}
+		propsSize, err := readXZVarint(br)
+		if err != nil {
+			return err
+		}
+		if id != 0x21 {
+			return fmt.Errorf("xz: unsupported filter 0x%x", id)
+		}
+		if propsSize != 1 || i != int(flags&0x03) {
+			return errXZCorrupt
+		}
+		prop, err := br.ReadByte()
+		if err != nil {
+			return errXZCorrupt
+		}
+		if dictSize, err = lzma2DictSize(prop); err != nil {
+			return err
+		}
+	}
+	// the rest of the header is padding
+	for br.Len() > 0 {
+		if b, _ := br.ReadByte(); b != 0 {
+			return errXZCorrupt
+		}
+	}
+
+	z.inBlock = true
+	z.headerSize = int64(headerSize)
+	z.blockRead = 0
+	z.uncompressed = 0
+	z.check = newXZCheck(z.checkType)
+	if z.lzma == nil || z.lzma.dict.size != dictSize {
+		z.lzma = newLZMA2Decoder(dictSize)
+	} else {
+		z.lzma.reset()
+	}
+	return nil
+}
+
+// finishBlock reads the padding and check at the end of a block.
+func (z *xzReader) finishBlock() error {
+	z.inBlock = false
+	for n := z.blockRead; n%4 != 0; n++ {
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if b != 0 {
+			return errXZCorrupt
+		}
+	}
+
+	sum := make([]byte, xzCheckSizes[z.checkType])
+	if _, err := io.ReadFull(z.r, sum); err != nil {
+		return noEOF(err)
+	}
+	if z.check != nil {
+		want := z.check.Sum(nil)
+		// CRC32 and CRC64 are stored little-endian
+		if z.checkType == 0x01 || z.checkType == 0x04 {
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+		if !bytes.Equal(sum, want) {
+			return errors.New("xz: checksum mismatch")
+		}
+	}
+
+	z.records = append(z.records, xzRecord{
+		unpadded:     z.headerSize + z.blockRead + int64(len(sum)),
+		uncompressed: z.uncompressed,
+	})
+	return nil
+}
+
+// finishStream reads the index, whose indicator byte has already been
+// read, and the stream footer. It then skips any stream padding, and
+// either starts the next stream or returns io.EOF.
+func (z *xzReader) finishStream() error {
+	index := &bytes.Buffer{}
+	index.WriteByte(0)
+	tr := io.TeeReader(z.r, index)
+	count, err := readXZVarint(byteReader{tr})
+	if err != nil {
+		return err
+	}
+	if count != uint64(len(z.records)) {
+		return errXZCorrupt
+	}
+	for _, rec := range z.records {
+		unpadded, err := readXZVarint(byteReader{tr})
+		if err != nil {
+			return err
+		}
+		uncompressed, err := readXZVarint(byteReader{tr})
+		if err != nil {
+			return err
+		}
+		if unpadded != uint64(rec.unpadded) || uncompressed != uint64(rec.uncompressed) {
+			return errXZCorrupt
+		}
+	}
+	for index.Len()%4 != 0 {
+		b, err := byteReader{tr}.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if b != 0 {
+			return errXZCorrupt
+		}
+	}
+	indexSize := index.Len()
+
+	crc := make([]byte, 4)
+	if _, err = io.ReadFull(z.r, crc); err != nil {
+		return noEOF(err)
+	}
+	if crc32.ChecksumIEEE(index.Bytes()) != binary.LittleEndian.Uint32(crc) {
+		return errXZCorrupt
+	}
+
+	footer := make([]byte, 12)
+	if _, err = io.ReadFull(z.r, footer); err != nil {
+		return noEOF(err)
+	}
+	if !bytes.Equal(footer[10:], []byte("YZ")) ||
+		crc32.ChecksumIEEE(footer[4:10]) != binary.LittleEndian.Uint32(footer) ||
+		int(binary.LittleEndian.Uint32(footer[4:])+1)*4 != indexSize+4 ||
+		footer[8] != 0 || int(footer[9]) != z.checkType {
+		return errXZCorrupt
+	}
+
+	// stream padding is a multiple of four zero bytes
+	for {
+		b, err := z.r.Peek(4)
+		if len(b) == 0 && err == io.EOF {
+			return io.EOF
+		}
+		if err != nil {
+			return noEOF(err)
+		}
+		if !bytes.Equal(b, []byte{0, 0, 0, 0}) {
+			break
+		}
+		z.r.Discard(4)
+	}
+	return z.readStreamHeader()
+}
+
+// newXZCheck returns the hash for a check type, or nil if it is not
+// verified.
+func newXZCheck(checkType int) hash.Hash {
+	switch checkType {
+	case 0x01:
+		return crc32.NewIEEE()
+	case 0x04:
+		return crc64.New(crc64Table)
+	case 0x0a:
+		return sha256.New()
+	}
+	return nil
+}
+
+// readXZVarint reads a multibyte integer, as used in xz headers.
+func readXZVarint(br io.ByteReader) (uint64, error) {
+	var n uint64
+	for i := 0; i < 9; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		n |= uint64(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			if b == 0 && i > 0 {
+				return 0, errXZCorrupt
+			}
+			return n, nil
+		}
+	}
+	return 0, errXZCorrupt
+}
+
+// byteReader reads single bytes from an io.Reader.
+type byteReader struct {
+	r io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(br.r, b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// noEOF turns an io.EOF in the middle of xz data into an error.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// lzma2DictSize returns the dictionary size given by an LZMA2 property
+// byte.
+func lzma2DictSize(prop byte) (int, error) {
+	switch {
+	case prop > 40:
+		return 0, errXZCorrupt
+	case prop == 40:
+		return 0xffffffff, nil
+	}
+	return (2 | int(prop&1)) << (prop/2 + 11), nil
+}
+
+// lzmaDict is the sliding window of recently decoded data. It grows as
+// data is decoded, up to its full size, so that a large dictionary size
+// in a header doesn't cost memory unless the data needs it.
+type lzmaDict struct {
+	buf  []byte
+	size int
+	pos  int
+	// total is the number of bytes decoded since the last reset
+	total int64
+}
+
+func (d *lzmaDict) reset() {
+	d.buf = d.buf[:0]
+	d.pos = 0
+	d.total = 0
+}
+
+func (d *lzmaDict) put(b byte) {
+	if len(d.buf) < d.size {
+		d.buf = append(d.buf, b)
+	} else {
+		d.buf[d.pos] = b
+	}
+	d.pos++
+	if d.pos == d.size {
+		d.pos = 0
+	}
+	d.total++
+}
+
+// get returns the byte dist bytes back, where 1 is the last byte.
+func (d *lzmaDict) get(dist int) byte {
+	i := d.pos - dist
+	if i < 0 {
+		i += len(d.buf)
+	}
+	return d.buf[i]
+}
+
+// lzma2Decoder decodes LZMA2 chunks, keeping the dictionary and LZMA state
+// from one chunk to the next.
+type lzma2Decoder struct {
+	dict      lzmaDict
+	needDict  bool
+	needProps bool
+	lzma      lzmaState
+}
+
+func newLZMA2Decoder(dictSize int) *lzma2Decoder {
+	d := &lzma2Decoder{}
+	d.dict.size = dictSize
+	d.reset()
+	return d
+}
+
+// reset prepares for a new block, which must start with a dictionary
+// reset.
+func (d *lzma2Decoder) reset() {
+	d.dict.reset()
+	d.needDict = true
+	d.needProps = true
+}
+
+// decodeChunk decodes the next chunk read from r, adding the number of
+// bytes read to *n. It returns io.EOF at the end of the LZMA2 data.
+func (d *lzma2Decoder) decodeChunk(r *bufio.Reader, n *int64) ([]byte, error) {
+	control, err := r.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	*n++
+	if control == 0 {
+		return nil, io.EOF
+	}
+
+	if control < 0x80 {
+		// an uncompressed chunk, with (1) or without (2) a dictionary reset
+		if control > 2 {
+			return nil, errXZCorrupt
+		}
+		if control == 1 {
+			d.dict.reset()
+			d.needDict = false
+		} else if d.needDict {
+			return nil, errXZCorrupt
+		}
+		sizeBytes := make([]byte, 2)
+		if _, err = io.ReadFull(r, sizeBytes); err != nil {
+			return nil, noEOF(err)
+		}
+		size := int(binary.BigEndian.Uint16(sizeBytes)) + 1
+		data := make([]byte, size)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, noEOF(err)
+		}
+		*n += int64(2 + size)
+		for _, b := range data {
+			d.dict.put(b)
+		}
+		return data, nil
+	}
+
+	sizes := make([]byte, 4)
+	if _, err = io.ReadFull(r, sizes); err != nil {
+		return nil, noEOF(err)
+	}
+	*n += 4
+	unpackedSize := int(control&0x1f)<<16 + int(binary.BigEndian.Uint16(sizes)) + 1
+	packedSize := int(binary.BigEndian.Uint16(sizes[2:])) + 1
+
+	switch reset := (control >> 5) & 3; {
+	case reset == 3:
+		d.dict.reset()
+		d.needDict = false
+	case d.needDict:
+		return nil, errXZCorrupt
+	}
+	if (control>>5)&3 >= 2 {
+		prop, err := r.ReadByte()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		*n++
+		if err = d.lzma.setProps(prop); err != nil {
+			return nil, err
+		}
+		d.needProps = false
+	} else if d.needProps {
+		return nil, errXZCorrupt
+	}
+	if (control>>5)&3 >= 1 {
+		d.lzma.reset()
+	}
+
+	packed := make([]byte, packedSize)
+	if _, err = io.ReadFull(r, packed); err != nil {
+		return nil, noEOF(err)
+	}
+	*n += int64(packedSize)
+
+	return d.lzma.decode(packed, &d.dict, unpackedSize)
+}
+
+// LZMA model constants, as in the LZMA SDK.
+const (
+	lzmaStates          = 12
+	lzmaPosStatesMax    = 1 << 4
+	lzmaLenToPosStates  = 4
+	lzmaEndPosModel     = 14
+	lzmaFullDistances   = 1 << (lzmaEndPosModel >> 1)
+	lzmaAlignBits       = 4
+	lzmaMatchMinLen     = 2
+	lzmaProbInit        = 1 << 10
+	lzmaNumBitModelBits = 11
+	lzmaMoveBits        = 5
+)
+
+// lzmaState is the probability model and recent distances of an LZMA
+// decoder.
+type lzmaState struct {
+	lc, lp, pb int
+
+	state            int
+	rep0, rep1       int
+	rep2, rep3       int
+	literal          []uint16
+	isMatch          [lzmaStates * lzmaPosStatesMax]uint16
+	isRep            [lzmaStates]uint16
+	isRepG0          [lzmaStates]uint16
+	isRepG1          [lzmaStates]uint16
+	isRepG2          [lzmaStates]uint16
+	isRep0Long       [lzmaStates * lzmaPosStatesMax]uint16
+	posSlot          [lzmaLenToPosStates][1 << 6]uint16
+	posSpecial       [1 + lzmaFullDistances - lzmaEndPosModel]uint16
+	align            [1 << lzmaAlignBits]uint16
+	matchLen, repLen lzmaLenDecoder
+	rc               rangeDecoder
+}
+
+func (s *lzmaState) setProps(prop byte) error {
+	if prop >= 9*5*5 {
+		return errXZCorrupt
+	}
+	lc, lp, pb := int(prop%9), int(prop/9%5), int(prop/45)
+	if lc+lp > 4 {
+		return errXZCorrupt
+	}
+	s.lc, s.lp, s.pb = lc, lp, pb
+	s.literal = make([]uint16, 0x300<<uint(lc+lp))
+	return nil
+}
+
+func (s *lzmaState) reset() {
+	s.state = 0
+	s.rep0, s.rep1, s.rep2, s.rep3 = 0, 0, 0, 0
+	initProbs(s.literal)
+	initProbs(s.isMatch[:])
+	initProbs(s.isRep[:])
+	initProbs(s.isRepG0[:])
+	initProbs(s.isRepG1[:])
+	initProbs(s.isRepG2[:])
+	initProbs(s.isRep0Long[:])
+	for i := range s.posSlot {
+		initProbs(s.posSlot[i][:])
+	}
+	initProbs(s.posSpecial[:])
+	initProbs(s.align[:])
+	s.matchLen.reset()
+	s.repLen.reset()
+}
+
+func initProbs(probs []uint16) {
+	for i := range probs {
+		probs[i] = lzmaProbInit
+	}
+}
+
+// decode decodes an LZMA chunk from packed, which must produce exactly
+// unpackedSize bytes.
+func (s *lzmaState) decode(packed []byte, dict *lzmaDict, unpackedSize int) ([]byte, error) {
+	if err := s.rc.init(packed); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, unpackedSize)
+	pbMask := int64(1)<<uint(s.pb) - 1
+	lpMask := int64(1)<<uint(s.lp) - 1
+
+	put := func(b byte) {
+		dict.put(b)
+		out = append(out, b)
+	}
+
+	for len(out) < unpackedSize {
+		posState := int(dict.total & pbMask)
+		if s.rc.bit(&s.isMatch[s.state<<4+posState]) == 0 {
+			// a literal
+			prev := 0
+			if len(dict.buf) > 0 {
+				prev = int(dict.get(1))
+			}
+			litState := int(dict.total&lpMask)<<uint(s.lc) + prev>>uint(8-s.lc)
+			probs := s.literal[0x300*litState : 0x300*(litState+1)]
+			symbol := 1
+			if s.state >= 7 {
+				if s.rep0+1 > len(dict.buf) {
+					return nil, errXZCorrupt
+				}
+				matchByte := int(dict.get(s.rep0 + 1))
+				for symbol < 0x100 {
+					matchBit := (matchByte >> 7) & 1
+					matchByte <<= 1
+					bit := s.rc.bit(&probs[(1+matchBit)<<8+symbol])
+					symbol = symbol<<1 | bit
+					if matchBit != bit {
+						break
+					}
+				}
+			}
+			for symbol < 0x100 {
+				symbol = symbol<<1 | s.rc.bit(&probs[symbol])
+			}
+			put(byte(symbol))
+			switch {
+			case s.state < 4:
+				s.state = 0
+			case s.state < 10:
+				s.state -= 3
+			default:
+				s.state -= 6
+			}
+			continue
+		}
+
+		var length int
+		if s.rc.bit(&s.isRep[s.state]) == 0 {
+			// a match with a new distance
+			s.rep3, s.rep2, s.rep1 = s.rep2, s.rep1, s.rep0
+			length = s.matchLen.decode(&s.rc, posState)
+			if s.state < 7 {
+				s.state = 7
+			} else {
+				s.state = 10
+			}
+			s.rep0 = s.decodeDistance(length)
+			if s.rep0 == 0xffffffff {
+				// an end marker is not allowed in LZMA2
+				return nil, errXZCorrupt
+			}
+		} else {
+			// a match repeating one of the last four distances
+			if s.rc.bit(&s.isRepG0[s.state]) == 0 {
+				if s.rc.bit(&s.isRep0Long[s.state<<4+posState]) == 0 {
+					// a single byte at the last distance
+					if s.state < 7 {
+						s.state = 9
+					} else {
+						s.state = 11
+					}
+					if s.rep0+1 > len(dict.buf) {
+						return nil, errXZCorrupt
+					}
+					put(dict.get(s.rep0 + 1))
+					continue
+				}
+			} else {
+				var dist int
+				if s.rc.bit(&s.isRepG1[s.state]) == 0 {
+					dist = s.rep1
+				} else {
+					if s.rc.bit(&s.isRepG2[s.state]) == 0 {
+						dist = s.rep2
+					} else {
+						dist = s.rep3
+						s.rep3 = s.rep2
+					}
+					s.rep2 = s.rep1
+				}
+				s.rep1 = s.rep0
+				s.rep0 = dist
+			}
+			length = s.repLen.decode(&s.rc, posState)
+			if s.state < 7 {
+				s.state = 8
+			} else {
+				s.state = 11
+			}
+		}
+
+		if s.rep0+1 > len(dict.buf) || len(out)+length > unpackedSize {
+			return nil, errXZCorrupt
+		}
+		for i := 0; i < length; i++ {
+			put(dict.get(s.rep0 + 1))
+		}
+	}
+
+	if s.rc.err != nil {
+		return nil, s.rc.err
+	}
+	return out, nil
+}
+
+// decodeDistance decodes the distance of a match of the given length,
+// less one.
+func (s *lzmaState) decodeDistance(length int) int {
+	lenState := length - lzmaMatchMinLen
+	if lenState > lzmaLenToPosStates-1 {
+		lenState = lzmaLenToPosStates - 1
+	}
+	posSlot := s.rc.bitTree(s.posSlot[lenState][:], 6)
+	if posSlot < 4 {
+		return posSlot
+	}
+	numDirectBits := uint(posSlot>>1) - 1
+	dist := (2 | posSlot&1) << numDirectBits
+	if posSlot < lzmaEndPosModel {
+		return dist + s.rc.reverseBitTree(s.posSpecial[dist-posSlot:], numDirectBits)
+	}
+	dist += s.rc.directBits(numDirectBits-lzmaAlignBits) << lzmaAlignBits
+	return dist + s.rc.reverseBitTree(s.align[:], lzmaAlignBits)
+}
+
+// lzmaLenDecoder decodes match lengths.
+type lzmaLenDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [lzmaPosStatesMax][1 << 3]uint16
+	mid     [lzmaPosStatesMax][1 << 3]uint16
+	high    [1 << 8]uint16
+}
+
+func (ld *lzmaLenDecoder) reset() {
+	ld.choice = lzmaProbInit
+	ld.choice2 = lzmaProbInit
+	for i := range ld.low {
+		initProbs(ld.low[i][:])
+		initProbs(ld.mid[i][:])
+	}
+	initProbs(ld.high[:])
+}
+
+func (ld *lzmaLenDecoder) decode(rc *rangeDecoder, posState int) int {
+	if rc.bit(&ld.choice) == 0 {
+		return lzmaMatchMinLen + rc.bitTree(ld.low[posState][:], 3)
+	}
+	if rc.bit(&ld.choice2) == 0 {
+		return lzmaMatchMinLen + 8 + rc.bitTree(ld.mid[posState][:], 3)
+	}
+	return lzmaMatchMinLen + 16 + rc.bitTree(ld.high[:], 8)
+}
+
+// rangeDecoder is the arithmetic decoder underlying LZMA. Running out of
+// input is recorded in err, rather than checked on every bit.
+type rangeDecoder struct {
+	in   []byte
+	rng  uint32
+	code uint32
+	err  error
+}
+
+func (rc *rangeDecoder) init(in []byte) error {
+	if len(in) < 5 || in[0] != 0 {
+		return errXZCorrupt
+	}
+	rc.in = in[5:]
+	rc.rng = 0xffffffff
+	rc.code = binary.BigEndian.Uint32(in[1:5])
+	rc.err = nil
+	return nil
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng < 1<<24 {
+		rc.rng <<= 8
+		if len(rc.in) == 0 {
+			rc.err = errXZCorrupt
+			rc.code <<= 8
+			return
+		}
+		rc.code = rc.code<<8 | uint32(rc.in[0])
+		rc.in = rc.in[1:]
+	}
+}
+
+func (rc *rangeDecoder) bit(prob *uint16) int {
+	bound := (rc.rng >> lzmaNumBitModelBits) * uint32(*prob)
+	var b int
+	if rc.code < bound {
+		rc.rng = bound
+		*prob += (1<<lzmaNumBitModelBits - *prob) >> lzmaMoveBits
+	} else {
+		rc.rng -= bound
+		rc.code -= bound
+		*prob -= *prob >> lzmaMoveBits
+		b = 1
+	}
+	rc.normalize()
+	return b
+}
+
+func (rc *rangeDecoder) directBits(n uint) int {
+	res := 0
+	for ; n > 0; n-- {
+		rc.rng >>= 1
+		res <<= 1
+		if rc.code >= rc.rng {
+			rc.code -= rc.rng
+			res |= 1
+		}
+		rc.normalize()
+	}
+	return res
+}
+
+func (rc *rangeDecoder) bitTree(probs []uint16, numBits uint) int {
+	m := 1
+	for i := uint(0); i < numBits; i++ {
+		m = m<<1 | rc.bit(&probs[m])
+	}
+	return m - 1<<numBits
+}
+
+func (rc *rangeDecoder) reverseBitTree(probs []uint16, numBits uint) int {
+	m, symbol := 1, 0
+	for i := uint(0); i < numBits; i++ {
+		b := rc.bit(&probs[m])
+		m = m<<1 | b
+		symbol |= b << i
+	}
+	return symbol
+}
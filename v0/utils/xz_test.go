@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0 OR GPL-2.0-or-later
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+// ===== xz reader tests =====
+
+// xzTestText is the uncompressed contents of testdata/xz/text*.xz.
+func xzTestText() []byte {
+	buf := &bytes.Buffer{}
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(buf, "line %d of the xz test data\n", i)
+	}
+	return buf.Bytes()
+}
+
+// xzTestRandom is the uncompressed contents of testdata/xz/random.xz,
+// which doesn't compress and so is stored in uncompressed LZMA2 chunks.
+func xzTestRandom() []byte {
+	out := make([]byte, 70000)
+	x := uint32(1)
+	for i := range out {
+		x = (x*1103515245 + 12345) & 0x7fffffff
+		out[i] = byte(x >> 16)
+	}
+	return out
+}
+
+func readXZTestFile(t *testing.T, name string) []byte {
+	data, err := os.ReadFile("../../testdata/xz/" + name)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return data
+}
+
+func TestXZReaderDecompressesFiles(t *testing.T) {
+	text := xzTestText()
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		{"text.xz", text},
+		{"text-9e-sha256.xz", text},
+		{"text-blocks-crc32.xz", text},
+		{"text-lp2-none.xz", text},
+		{"random.xz", xzTestRandom()},
+	}
+	for _, tc := range tests {
+		r, err := NewXZReader(bytes.NewReader(readXZTestFile(t, tc.name)))
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %v", tc.name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %v", tc.name, err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: expected %d decompressed bytes to match, got %d bytes", tc.name, len(tc.want), len(got))
+		}
+	}
+}
+
+func TestXZReaderReadsConcatenatedStreams(t *testing.T) {
+	data := append(readXZTestFile(t, "text.xz"), 0, 0, 0, 0)
+	data = append(data, readXZTestFile(t, "random.xz")...)
+	r, err := NewXZReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want := append(xzTestText(), xzTestRandom()...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected %d decompressed bytes to match, got %d bytes", len(want), len(got))
+	}
+}
+
+func TestXZReaderFailsForNonXZData(t *testing.T) {
+	_, err := NewXZReader(bytes.NewReader([]byte("not xz data")))
+	if err == nil {
+		t.Errorf("expected non-nil error, got nil")
+	}
+}
+
+func TestXZReaderFailsForCorruptData(t *testing.T) {
+	for _, name := range []string{"text.xz", "random.xz"} {
+		data := readXZTestFile(t, name)
+		data[len(data)/2] ^= 0x55
+		r, err := NewXZReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: expected nil error, got %v", name, err)
+		}
+		if _, err = io.ReadAll(r); err == nil {
+			t.Errorf("%s: expected non-nil error, got nil", name)
+		}
+	}
+}
+
+func TestXZReaderFailsForTruncatedData(t *testing.T) {
+	data := readXZTestFile(t, "text.xz")
+	r, err := NewXZReader(bytes.NewReader(data[:len(data)-8]))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, err = io.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}